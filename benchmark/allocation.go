@@ -0,0 +1,181 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// AllocationTarget 被压测的设备插件，在进程内直接调用，不经过gRPC
+type AllocationTarget interface {
+	GetPreferredAllocation(ctx context.Context, r *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error)
+	Allocate(ctx context.Context, r *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error)
+}
+
+// AllocationLoad 分配压测参数
+type AllocationLoad struct {
+	// Concurrency : 同时执行分配序列的数量
+	Concurrency int `json:"concurrency"`
+	// Requests : 分配序列的总数，每个序列依次调用 GetPreferredAllocation 和 Allocate
+	Requests int `json:"requests"`
+	// Size : 每次申请的设备数量
+	Size int `json:"size"`
+}
+
+// LatencySummary 延迟分位数
+type LatencySummary struct {
+	Count  int           `json:"count"`
+	Errors int           `json:"errors"`
+	P50    time.Duration `json:"p50"`
+	P90    time.Duration `json:"p90"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+}
+
+// AllocationReport 分配压测结果
+type AllocationReport struct {
+	Load     AllocationLoad `json:"load"`
+	Devices  int            `json:"devices"`
+	Duration time.Duration  `json:"duration"`
+	// Throughput : 每秒完成的分配序列数
+	Throughput          float64        `json:"throughput"`
+	PreferredAllocation LatencySummary `json:"preferredAllocation"`
+	Allocate            LatencySummary `json:"allocate"`
+	// FirstError : 第一个失败请求的错误
+	FirstError string `json:"firstError,omitempty"`
+}
+
+// latencies 并发记录的延迟和错误
+type latencies struct {
+	mu        sync.Mutex
+	preferred []time.Duration
+	allocate  []time.Duration
+	prefErrs  int
+	allocErrs int
+	firstErr  error
+}
+
+func (l *latencies) record(preferred, allocate time.Duration, prefErr, allocErr error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.preferred = append(l.preferred, preferred)
+	if prefErr != nil {
+		l.prefErrs++
+	}
+	if allocErr != nil {
+		l.allocErrs++
+	}
+	if prefErr == nil {
+		l.allocate = append(l.allocate, allocate)
+	}
+	if l.firstErr == nil {
+		if prefErr != nil {
+			l.firstErr = prefErr
+		} else if allocErr != nil {
+			l.firstErr = allocErr
+		}
+	}
+}
+
+// RunAllocationLoad 以 load.Concurrency 个并发重放 load.Requests 次分配序列，
+// 每个序列从 available 中获取推荐分配并申请这些设备，返回各阶段的延迟分位数
+func RunAllocationLoad(ctx context.Context, target AllocationTarget, available []string, load AllocationLoad) (AllocationReport, error) {
+	if load.Concurrency <= 0 || load.Requests <= 0 || load.Size <= 0 {
+		return AllocationReport{}, fmt.Errorf("concurrency, requests and size must be positive")
+	}
+	if load.Size > len(available) {
+		return AllocationReport{}, fmt.Errorf("allocation size %d exceeds the %d available devices", load.Size, len(available))
+	}
+	var (
+		lat  latencies
+		wg   sync.WaitGroup
+		next = make(chan struct{})
+	)
+	start := time.Now()
+	for i := 0; i < load.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range next {
+				lat.record(allocationSequence(ctx, target, available, load.Size))
+			}
+		}()
+	}
+	for i := 0; i < load.Requests; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- struct{}{}
+	}
+	close(next)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := AllocationReport{
+		Load:                load,
+		Devices:             len(available),
+		Duration:            elapsed,
+		PreferredAllocation: summarize(lat.preferred, lat.prefErrs),
+		Allocate:            summarize(lat.allocate, lat.allocErrs),
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(len(lat.preferred)) / elapsed.Seconds()
+	}
+	if lat.firstErr != nil {
+		report.FirstError = lat.firstErr.Error()
+	}
+	return report, ctx.Err()
+}
+
+// allocationSequence 模拟kubelet的一次分配：先获取推荐分配，再申请推荐的设备
+func allocationSequence(ctx context.Context, target AllocationTarget, available []string, size int) (time.Duration, time.Duration, error, error) {
+	start := time.Now()
+	pref, err := target.GetPreferredAllocation(ctx, &pluginapi.PreferredAllocationRequest{
+		ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{
+			{AvailableDeviceIDs: available, AllocationSize: int32(size)},
+		},
+	})
+	preferred := time.Since(start)
+	if err == nil && (len(pref.ContainerResponses) != 1 || len(pref.ContainerResponses[0].DeviceIDs) != size) {
+		err = fmt.Errorf("preferred allocation returned an unexpected number of devices")
+	}
+	if err != nil {
+		return preferred, 0, err, nil
+	}
+	start = time.Now()
+	_, err = target.Allocate(ctx, &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIDs: pref.ContainerResponses[0].DeviceIDs},
+		},
+	})
+	return preferred, time.Since(start), nil, err
+}
+
+// summarize 计算延迟分位数
+func summarize(samples []time.Duration, errors int) LatencySummary {
+	s := LatencySummary{Count: len(samples), Errors: errors}
+	if len(samples) == 0 {
+		return s
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.P50 = percentile(sorted, 0.50)
+	s.P90 = percentile(sorted, 0.90)
+	s.P99 = percentile(sorted, 0.99)
+	s.Max = sorted[len(sorted)-1]
+	return s
+}
+
+// percentile 已排序样本的最近秩分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -1,15 +1,43 @@
 package benchmark
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// 性能分析文件名称
+const (
+	ProfileCPU    = "cpu.prof"
+	ProfileMemory = "mem.prof"
+	ProfileBlock  = "block.prof"
+	ProfileMutex  = "mutex.prof"
+)
+
+var (
+	// ErrRunning : 性能分析已在运行
+	ErrRunning = errors.New("benchmark is already running")
+	// ErrNotRunning : 性能分析未运行
+	ErrNotRunning = errors.New("benchmark is not running")
+)
+
+// Status : 性能分析状态
+type Status struct {
+	Running   bool      `json:"running"`
+	OutPath   string    `json:"outPath"`
+	StartedAt time.Time `json:"startedAt,omitempty"`
+	// StopAt : 定时运行的自动停止时间，为空表示需要手动停止
+	StopAt   time.Time `json:"stopAt,omitempty"`
+	Profiles []string  `json:"profiles"`
+}
+
 // Benchmark :
 type Benchmark struct {
 	outPath   string
@@ -18,6 +46,14 @@ type Benchmark struct {
 	blockprof *os.File
 	mtxprof   *os.File
 	logger    *zap.Logger
+	mu        sync.Mutex
+	running   bool
+	runs      int
+	startedAt time.Time
+	stopAt    time.Time
+	timer     *time.Timer
+	// maxDuration : RunFor 的最长运行时间，0表示不限制
+	maxDuration time.Duration
 }
 
 // NewBenchmark :
@@ -50,75 +86,204 @@ func NewBenchmark(logger *zap.Logger, outPath string) (*Benchmark, error) {
 	}, nil
 }
 
-// Run :
+// Run : 开始性能分析，直到调用 Stop
 func (b *Benchmark) Run() error {
-	var err error
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.run()
+}
+
+// SetMaxDuration : 设置 RunFor 的最长运行时间，0表示不限制
+func (b *Benchmark) SetMaxDuration(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxDuration = d
+}
+
+// RunFor : 开始性能分析，经过 d 后自动停止，d 为0时与 Run 相同
+// 设置了最长运行时间时，d 为0或超过最长时间的运行在最长时间后停止
+func (b *Benchmark) RunFor(d time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.maxDuration > 0 && (d <= 0 || d > b.maxDuration) {
+		d = b.maxDuration
+	}
+	if err := b.run(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+	b.stopAt = b.startedAt.Add(d)
+	run := b.runs
+	b.timer = time.AfterFunc(d, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// 期间已手动停止并重新开始时不停止新的运行
+		if !b.running || b.runs != run {
+			return
+		}
+		if err := b.stop(); err != nil {
+			b.logger.Error("failed to stop benchmark", zap.Error(err))
+		}
+	})
+	return nil
+}
+
+func (b *Benchmark) run() (err error) {
+	if b.running {
+		return ErrRunning
+	}
+	// 任何一步失败时停止已开始的CPU分析并关闭已创建的文件
+	defer func() {
+		if err != nil {
+			b.release()
+		}
+	}()
 
 	// Start CPU profiling.
-	b.cpuprof, err = os.Create(filepath.Join(b.outPath, "cpu.prof"))
+	cpuprof, err := os.Create(filepath.Join(b.outPath, ProfileCPU))
 	if err != nil {
 		return fmt.Errorf("bench: could not create cpu profile: %v", err)
 	}
-	if err := pprof.StartCPUProfile(b.cpuprof); err != nil {
+	// 其它CPU分析（如 /debug/pprof/profile）正在运行时启动失败，此时不能停止别人的分析
+	if err := pprof.StartCPUProfile(cpuprof); err != nil {
+		cpuprof.Close()
 		return fmt.Errorf("bench: could not start CPU profile: %v", err)
 	}
+	b.cpuprof = cpuprof
 
-	// Start memory profiling.
-	b.memprof, err = os.Create(filepath.Join(b.outPath, "mem.prof"))
+	// Create memory, block and mutex profiles.
+	b.memprof, err = os.Create(filepath.Join(b.outPath, ProfileMemory))
 	if err != nil {
 		return fmt.Errorf("bench: could not create memory profile: %v", err)
 	}
-	runtime.MemProfileRate = 64 * 1024
-
-	// Start fatal profiling.
-	b.blockprof, err = os.Create(filepath.Join(b.outPath, "block.prof"))
+	b.blockprof, err = os.Create(filepath.Join(b.outPath, ProfileBlock))
 	if err != nil {
 		return fmt.Errorf("bench: could not create block profile: %v", err)
 	}
-	runtime.SetBlockProfileRate(20)
-
-	// Start mutex profiling.
-	b.mtxprof, err = os.Create(filepath.Join(b.outPath, "mutex.prof"))
+	b.mtxprof, err = os.Create(filepath.Join(b.outPath, ProfileMutex))
 	if err != nil {
 		return fmt.Errorf("bench: could not create mutex profile: %v", err)
 	}
+	// 文件都创建成功后再开启采样
+	runtime.MemProfileRate = 64 * 1024
+	runtime.SetBlockProfileRate(20)
 	runtime.SetMutexProfileFraction(20)
 
+	b.running = true
+	b.runs++
+	b.startedAt = time.Now()
+	b.stopAt = time.Time{}
 	b.logger.Info("Benchmark started")
 	return nil
 }
 
-// Stop :
+// Stop : 停止性能分析并写入分析文件
 func (b *Benchmark) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.running {
+		return ErrNotRunning
+	}
+	return b.stop()
+}
+
+func (b *Benchmark) stop() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.running = false
+	b.stopAt = time.Time{}
+	// 某个分析文件写入失败时仍然写入其它文件，所有文件都关闭
+	var errs []error
 	if b.cpuprof != nil {
 		pprof.StopCPUProfile()
-		b.cpuprof.Close()
-		b.cpuprof = nil
-	}
-	if b.memprof != nil {
-		if err := pprof.Lookup("heap").WriteTo(b.memprof, 0); err != nil {
-			return fmt.Errorf("error writing mem profile: %v", err)
+		if err := b.cpuprof.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error writing cpu profile: %v", err))
 		}
-		b.memprof.Close()
-		b.memprof = nil
 	}
-	if b.blockprof != nil {
-		if err := pprof.Lookup("block").WriteTo(b.blockprof, 0); err != nil {
-			return fmt.Errorf("error writing block profile: %v", err)
-		}
-		b.blockprof.Close()
-		b.blockprof = nil
-		runtime.SetBlockProfileRate(0)
+	errs = append(errs,
+		writeProfile("mem", "heap", b.memprof),
+		writeProfile("block", "block", b.blockprof),
+		writeProfile("mutex", "mutex", b.mtxprof),
+	)
+	b.cpuprof, b.memprof, b.blockprof, b.mtxprof = nil, nil, nil, nil
+	runtime.SetBlockProfileRate(0)
+	runtime.SetMutexProfileFraction(0)
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	b.logger.Info("Benchmark stopped")
+	return nil
+}
+
+// release : 开始分析失败时停止CPU分析并关闭已创建的文件，不写入分析结果
+func (b *Benchmark) release() {
+	if b.cpuprof != nil {
+		pprof.StopCPUProfile()
 	}
-	if b.mtxprof != nil {
-		if err := pprof.Lookup("mutex").WriteTo(b.mtxprof, 0); err != nil {
-			return fmt.Errorf("error writing mutex profile: %v", err)
+	for _, f := range []*os.File{b.cpuprof, b.memprof, b.blockprof, b.mtxprof} {
+		if f != nil {
+			f.Close()
 		}
-		b.mtxprof.Close()
-		b.mtxprof = nil
-		runtime.SetMutexProfileFraction(0)
 	}
+	b.cpuprof, b.memprof, b.blockprof, b.mtxprof = nil, nil, nil, nil
+}
 
-	b.logger.Info("Benchmark stopped")
+// writeProfile : 写入并关闭分析文件，f 为空时跳过
+func writeProfile(name, profile string, f *os.File) error {
+	if f == nil {
+		return nil
+	}
+	err := pprof.Lookup(profile).WriteTo(f, 0)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s profile: %v", name, err)
+	}
 	return nil
 }
+
+// Status : 当前的性能分析状态和已生成的分析文件
+func (b *Benchmark) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Status{
+		Running:   b.running,
+		OutPath:   b.outPath,
+		StartedAt: b.startedAt,
+		StopAt:    b.stopAt,
+		Profiles:  []string{},
+	}
+	if !b.running {
+		for _, name := range []string{ProfileCPU, ProfileMemory, ProfileBlock, ProfileMutex} {
+			if _, err := os.Stat(filepath.Join(b.outPath, name)); err == nil {
+				s.Profiles = append(s.Profiles, name)
+			}
+		}
+	}
+	return s
+}
+
+// ProfilePath : 分析文件的路径，运行期间文件尚未写完，返回 ErrRunning
+func (b *Benchmark) ProfilePath(name string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running {
+		return "", ErrRunning
+	}
+	switch name {
+	case ProfileCPU, ProfileMemory, ProfileBlock, ProfileMutex:
+	default:
+		return "", fmt.Errorf("unknown profile %q", name)
+	}
+	path := filepath.Join(b.outPath, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
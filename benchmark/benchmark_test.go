@@ -0,0 +1,67 @@
+package benchmark
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// 创建分析文件失败时停止已开始的CPU分析，之后可以重新开始
+func TestRunFailureReleasesProfile(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBenchmark(zap.NewNop(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同名目录使内存分析文件无法创建
+	if err := os.Mkdir(filepath.Join(dir, ProfileMemory), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Run(); err == nil {
+		t.Fatal("Run succeeded without a memory profile")
+	}
+	if b.Status().Running {
+		t.Fatal("benchmark running after a failed start")
+	}
+	if err := pprof.StartCPUProfile(io.Discard); err != nil {
+		t.Fatalf("CPU profile still running after a failed start: %v", err)
+	}
+	pprof.StopCPUProfile()
+
+	if err := os.Remove(filepath.Join(dir, ProfileMemory)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{ProfileCPU, ProfileMemory, ProfileBlock, ProfileMutex} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+}
+
+// 其它CPU分析正在运行时开始失败，且不停止其它分析
+func TestRunKeepsOtherCPUProfile(t *testing.T) {
+	b, err := NewBenchmark(zap.NewNop(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pprof.StartCPUProfile(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	defer pprof.StopCPUProfile()
+	if err := b.Run(); err == nil {
+		t.Fatal("Run succeeded while another CPU profile was running")
+	}
+	if err := pprof.StartCPUProfile(io.Discard); err == nil {
+		t.Fatal("failed Run stopped the other CPU profile")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/feature"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/store"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// command 子命令，run 返回进程退出码
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+// commands 子命令列表，不带子命令时等同于 serve
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "serve", usage: "run the device plugin (default)", run: func(args []string) int { serve(args); return 0 }},
+		{name: "validate", usage: "validate the config and print the effective config as YAML", run: runValidate},
+		{name: "list-devices", usage: "print the devices this node would advertise and exit", run: runListDevices},
+		{name: "version", usage: "print build and driver versions", run: runVersion},
+		{name: "help", usage: "show this help", run: runHelp},
+	}
+}
+
+// lookupCommand : 根据第一个参数查找子命令，第一个参数是选项或为空时返回false
+func lookupCommand(args []string) (command, []string, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return command{}, nil, false
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd, args[1:], true
+		}
+	}
+	return command{name: args[0], run: func([]string) int {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		runHelp(nil)
+		return 2
+	}}, nil, true
+}
+
+// runHelp : 打印子命令列表
+func runHelp([]string) int {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> --help' for the flags of a command.\n", os.Args[0])
+	return 0
+}
+
+// addConfigFlags : 读取配置的参数，所有子命令通用
+func addConfigFlags(flags *pflag.FlagSet) {
+	flags.String("configFile", "config", "name of config file (without extension)")
+	flags.String("configDir", "", "config directory with config.yml and per-node overlays, overrides configFile")
+}
+
+// bindFlag : 命令行参数覆盖配置项，只有显式指定参数时才覆盖
+func bindFlag(flags *pflag.FlagSet, name string, key string) {
+	viper.BindPFlag(key, flags.Lookup(name))
+}
+
+// loadConfig : 合并默认值和配置文件并校验，requireFile 为真时找不到配置文件视为错误
+// 只有未显式指定配置时找不到默认的配置文件才使用默认值继续，配置文件无法解析或覆盖配置合并失败都返回错误
+func loadConfig(flags *pflag.FlagSet, requireFile bool) (*config.Config, []string, error) {
+	viper.BindPFlags(flags)
+
+	// 默认配置
+	config.SetDefaultConfig()
+
+	var configFiles []string
+	var err error
+	if dir := viper.GetString("configDir"); dir != "" {
+		// 基础配置加上匹配当前节点的覆盖配置
+		configFiles, err = config.LoadDir(dir)
+	} else {
+		viper.AddConfigPath(".")
+		viper.SetConfigName(viper.GetString("configFile"))
+		viper.SetConfigType("yml")
+		if err = viper.ReadInConfig(); err == nil {
+			configFiles = []string{viper.ConfigFileUsed()}
+		}
+	}
+	if err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		explicit := flags.Changed("configDir") || flags.Changed("configFile")
+		if requireFile || explicit || !errors.As(err, &notFound) {
+			return nil, configFiles, err
+		}
+		log.Printf("config file not found, using defaults: %s \n", err.Error())
+	}
+
+	cfg := new(config.Config)
+	if err := viper.Unmarshal(cfg); err != nil {
+		return nil, configFiles, fmt.Errorf("fatal unmarshal config: %w", err)
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, configFiles, err
+	}
+	return cfg, configFiles, nil
+}
+
+// validateConfig : 校验配置和依赖其它模块的配置项，特性开关在 cfg.Validate 中校验
+func validateConfig(cfg *config.Config) error {
+	var errs []error
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := resource.ValidatePrefix(cfg.ResourcePrefix); err != nil {
+		errs = append(errs, fmt.Errorf("resourcePrefix: %w", err))
+	}
+	if err := plugin.ValidateSharing(cfg.Sharing.TimeSlicing, cfg.ResourcePrefix); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains(store.Backends(), cfg.Storage.Backend) {
+		errs = append(errs, fmt.Errorf("storage.backend: %q is not one of %v", cfg.Storage.Backend, store.Backends()))
+	}
+	return errors.Join(errs...)
+}
+
+// runValidate : 校验配置并输出合并默认值后的配置，用于在CI中检查Helm values
+func runValidate(args []string) int {
+	flags := pflag.NewFlagSet("validate", pflag.ExitOnError)
+	addConfigFlags(flags)
+	flags.Bool("validate-config", true, "")
+	flags.MarkHidden("validate-config")
+	flags.Parse(args)
+	return printValidatedConfig(flags)
+}
+
+// printValidatedConfig : 按已解析的参数加载并校验配置，输出合并默认值和参数覆盖后的配置
+func printValidatedConfig(flags *pflag.FlagSet) int {
+	cfg, configFiles, err := loadConfig(flags, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("# merged from: %s\n", strings.Join(configFiles, ", "))
+	os.Stdout.Write(out)
+	return 0
+}
+
+// listedDevice list-devices 输出的设备
+type listedDevice struct {
+	Resource          string   `json:"resource"`
+	ID                string   `json:"id"`
+	Index             string   `json:"index"`
+	Health            string   `json:"health"`
+	NUMANode          *int64   `json:"numaNode,omitempty"`
+	MemoryMiB         uint64   `json:"memoryMiB,omitempty"`
+	ComputeCapability string   `json:"computeCapability,omitempty"`
+	Clique            string   `json:"clique,omitempty"`
+	NIC               string   `json:"nic,omitempty"`
+	Paths             []string `json:"paths"`
+}
+
+// listedDevices list-devices 的JSON输出
+type listedDevices struct {
+	Devices  []listedDevice          `json:"devices"`
+	Excluded []device.ExcludedDevice `json:"excluded,omitempty"`
+}
+
+// runListDevices : 按当前配置发现设备并打印，不注册插件，用于在无法访问Web端口的节点上排查问题
+func runListDevices(args []string) int {
+	flags := pflag.NewFlagSet("list-devices", pflag.ExitOnError)
+	addConfigFlags(flags)
+	output := flags.StringP("output", "o", "table", "output format: table or json")
+	verbose := flags.BoolP("verbose", "v", false, "log discovery details to stderr")
+	flags.Parse(args)
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+	cfg, _, err := loadConfig(flags, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	setCLILogger(*verbose)
+	if err := feature.DefaultGate.Set(cfg.FeatureGates); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	nvmllib, shutdown, err := openNVML(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer shutdown()
+
+	loaded := &util.CloseOnce{C: make(chan struct{})}
+	pm := plugin.NewPluginManager(cfg, nvmllib, nil, nil, nil, loaded)
+	defer pm.ShutdownNVML()
+	dmp, excluded, err := pm.Discover()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var res listedDevices
+	for _, name := range sortedNames(dmp) {
+		for _, id := range sortedNames(dmp[name]) {
+			d := dmp[name][id]
+			ld := listedDevice{
+				Resource:          name,
+				ID:                id,
+				Index:             d.Index,
+				Health:            d.Health,
+				MemoryMiB:         d.TotalMemory / (1024 * 1024),
+				ComputeCapability: d.ComputeCapability,
+				Clique:            d.Clique,
+				NIC:               d.NIC,
+				Paths:             d.Paths,
+			}
+			if d.Topology != nil && len(d.Topology.Nodes) > 0 {
+				ld.NUMANode = &d.Topology.Nodes[0].ID
+			}
+			res.Devices = append(res.Devices, ld)
+		}
+	}
+	res.Excluded = excluded
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tID\tINDEX\tHEALTH\tNUMA\tMEMORY(MiB)\tPATHS")
+	for _, d := range res.Devices {
+		numa := "-"
+		if d.NUMANode != nil {
+			numa = fmt.Sprint(*d.NUMANode)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", d.Resource, d.ID, d.Index, d.Health, numa, d.MemoryMiB, strings.Join(d.Paths, ","))
+	}
+	w.Flush()
+	if len(excluded) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "EXCLUDED\tINDEX\tNAME\tREASON")
+		for _, e := range excluded {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.UUID, e.Index, e.Name, e.Reason)
+		}
+		w.Flush()
+	}
+	return 0
+}
+
+// runVersion : 打印构建信息，节点上有NVML时附带驱动版本
+func runVersion(args []string) int {
+	flags := pflag.NewFlagSet("version", pflag.ExitOnError)
+	addConfigFlags(flags)
+	output := flags.StringP("output", "o", "text", "output format: text or json")
+	flags.Parse(args)
+	setCLILogger(false)
+	var driver version.Driver
+	// 读取配置只为支持模拟模式，配置无效时仍打印构建信息
+	if cfg, _, err := loadConfig(flags, false); err == nil {
+		if nvmllib, shutdown, err := openNVML(cfg); err == nil {
+			loaded := &util.CloseOnce{C: make(chan struct{})}
+			pm := plugin.NewPluginManager(cfg, nvmllib, nil, nil, nil, loaded)
+			driver = pm.DriverVersions()
+			pm.ShutdownNVML()
+			shutdown()
+		}
+	}
+	v := version.Get(driver)
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return 0
+	}
+	fmt.Printf("version:    %s\ngit commit: %s\nbuild date: %s\ngo version: %s\nplatform:   %s\n", v.Version, v.GitCommit, v.BuildDate, v.GoVersion, v.Platform)
+	if v.DriverVersion != "" {
+		fmt.Printf("driver:     %s\nnvml:       %s\ncuda:       %s\n", v.DriverVersion, v.NvmlVersion, v.CudaDriverVersion)
+	}
+	return 0
+}
+
+// openNVML : 初始化NVML或模拟的NVML，返回关闭函数；节点没有NVML时返回未初始化的实例
+func openNVML(cfg *config.Config) (nvml.Interface, func(), error) {
+	var nvmllib nvml.Interface = nvml.New()
+	if cfg.Simulate.Enabled {
+		var err error
+		nvmllib, err = simulate.New(cfg.Simulate)
+		if err != nil {
+			return nil, nil, fmt.Errorf("init simulated nvml failed: %w", err)
+		}
+	}
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(nvmllib) {
+		return nvmllib, func() {}, nil
+	}
+	if ret := nvmllib.Init(); ret != nvml.SUCCESS {
+		return nil, nil, fmt.Errorf("failed to initialize NVML: %v", ret)
+	}
+	return nvmllib, func() { nvmllib.Shutdown() }, nil
+}
+
+// setCLILogger : 命令行子命令的日志，stdout 留给命令输出，verbose 时输出到 stderr
+func setCLILogger(verbose bool) {
+	if !verbose {
+		l.Logger = zap.NewNop()
+		return
+	}
+	cfg := zap.NewDevelopmentConfig()
+	cfg.OutputPaths = []string{"stderr"}
+	logger, err := cfg.Build()
+	if err != nil {
+		l.Logger = zap.NewNop()
+		return
+	}
+	l.Logger = logger
+}
+
+// sortedNames : 按名称排序的键
+func sortedNames[M ~map[string]V, V any](m M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
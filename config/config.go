@@ -1,22 +1,728 @@
 package config
 
 import (
+	"os"
+	"time"
+
 	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/tracing"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	WebListenAddress string       `yaml:"webListenAddress"`
-	MigStrategy      string       `yaml:"migStrategy"`
-	Benchmark        bool         `yaml:"benchmark"`
-	Log              *l.LogConfig `yaml:"log"`
+	WebListenAddress    string                   `yaml:"webListenAddress"`
+	WebAuth             *WebAuthConfig           `yaml:"webAuth"`
+	InstanceID          string                   `yaml:"instanceId"`
+	Platform            string                   `yaml:"platform"`
+	MigStrategy         string                   `yaml:"migStrategy"`
+	ResourcePrefix      string                   `yaml:"resourcePrefix"`
+	Resources           *ResourcesConfig         `yaml:"resources"`
+	NonGpuNodeBehavior  string                   `yaml:"nonGpuNodeBehavior"`
+	NonGpuProbeInterval time.Duration            `yaml:"nonGpuProbeInterval"`
+	IncludeDevices      []string                 `yaml:"includeDevices"`
+	ExcludeDevices      []string                 `yaml:"excludeDevices"`
+	SysfsRoot           string                   `yaml:"sysfsRoot"`
+	Benchmark           bool                     `yaml:"benchmark"`
+	Profiling           *ProfilingConfig         `yaml:"profiling"`
+	PodResources        *PodResourcesConfig      `yaml:"podResources"`
+	NVMLMetrics         *NVMLMetricsConfig       `yaml:"nvmlMetrics"`
+	Kubernetes          *KubernetesConfig        `yaml:"kubernetes"`
+	Shutdown            *ShutdownConfig          `yaml:"shutdown"`
+	Simulate            *SimulateConfig          `yaml:"simulate"`
+	Allocate            *AllocateConfig          `yaml:"allocate"`
+	AllocationPolicy    string                   `yaml:"allocationPolicy"`
+	AllocationWebhook   *AllocationWebhookConfig `yaml:"allocationWebhook"`
+	Registration        *RegistrationConfig      `yaml:"registration"`
+	Inventory           *InventoryConfig         `yaml:"inventory"`
+	ListAndWatch        *ListAndWatchConfig      `yaml:"listAndWatch"`
+	GRPC                *GRPCConfig              `yaml:"grpc"`
+	DeviceHealth        *DeviceHealthConfig      `yaml:"deviceHealth"`
+	HealthBackend       string                   `yaml:"healthBackend"`
+	DCGM                *DCGMConfig              `yaml:"dcgm"`
+	Thermal             *ThermalConfig           `yaml:"thermal"`
+	GPUMemory           *GPUMemoryConfig         `yaml:"gpuMemory"`
+	MigAny              *MigAnyConfig            `yaml:"migAny"`
+	Sharing             *SharingConfig           `yaml:"sharing"`
+	ModeDrift           *ModeDriftConfig         `yaml:"modeDrift"`
+	Hotplug             *HotplugConfig           `yaml:"hotplug"`
+	MigWatch            *MigWatchConfig          `yaml:"migWatch"`
+	Storage             *StorageConfig           `yaml:"storage"`
+	NodeAPI             *NodeAPIConfig           `yaml:"nodeAPI"`
+	DriverPolicy        *DriverPolicyConfig      `yaml:"driverPolicy"`
+	DriverReadiness     *DriverReadinessConfig   `yaml:"driverReadiness"`
+	Overlays            []OverlayConfig          `yaml:"overlays"`
+	FeatureGates        map[string]bool          `yaml:"featureGates"`
+	Log                 *l.LogConfig             `yaml:"log"`
+	Tracing             *tracing.TracingConfig   `yaml:"tracing"`
+	Audit               *AuditConfig             `yaml:"audit"`
+	DeviceAttributes    *DeviceAttributesConfig  `yaml:"deviceAttributes"`
+	DeviceCache         *DeviceCacheConfig       `yaml:"deviceCache"`
+}
+
+// WebAuthConfig Web API 的TLS和变更类接口认证配置
+type WebAuthConfig struct {
+	// Enabled : 是否要求只读接口也认证，/restart 等变更类接口和 /debug 排查接口总是需要认证
+	Enabled bool `yaml:"enabled"`
+	// TokenFile : bearer token 文件，每行为 "token,name"，name 用于审计日志；通常挂载自Secret，每次认证时重新读取
+	TokenFile string `yaml:"tokenFile"`
+	// CertFile : 服务端证书，与 KeyFile 同时设置时使用HTTPS
+	CertFile string `yaml:"certFile"`
+	// KeyFile : 服务端私钥
+	KeyFile string `yaml:"keyFile"`
+	// ClientCAFile : 客户端证书CA，设置后校验客户端证书，通过校验的证书CN作为调用者名称
+	ClientCAFile string `yaml:"clientCAFile"`
+	// ClientNames : 允许调用需要认证的接口的客户端证书CN，为空时允许所有通过校验的证书
+	ClientNames []string `yaml:"clientNames"`
+	// AllowInsecureTokens : 是否在未启用HTTPS时也接受 bearer token，token会以明文传输
+	AllowInsecureTokens bool `yaml:"allowInsecureTokens"`
+}
+
+// ResourcesConfig 资源名称及匹配设备的模式，为空时整块GPU使用 gpu 资源，mixed 策略下每种MIG配置使用 mig-<配置> 资源
+type ResourcesConfig struct {
+	// GPUs : 整块GPU的资源，none 和 single 策略使用，按顺序匹配GPU产品名称，第一个匹配的生效
+	GPUs []ResourcePatternConfig `yaml:"gpus"`
+	// MIG : MIG设备的资源，mixed 策略使用，按顺序匹配MIG配置名称，如 1g.10gb
+	MIG []ResourcePatternConfig `yaml:"mig"`
+	// Unmatched : GPU名称没有匹配 gpus 中任何模式时的处理方式：fail（所有资源都不提供）、skip（不提供该GPU）、
+	// default（以 defaultName 提供该GPU）
+	Unmatched string `yaml:"unmatched"`
+	// DefaultName : unmatched 为 default 时使用的资源名称，未指定前缀时使用 resourcePrefix
+	DefaultName string `yaml:"defaultName"`
+}
+
+// ResourcePatternConfig 资源及其匹配模式
+type ResourcePatternConfig struct {
+	// Pattern : 匹配GPU产品名称或MIG配置名称的模式，在名称的任意位置匹配
+	Pattern string `yaml:"pattern"`
+	// PatternType : wildcard（默认，* 匹配任意字符）或 regex（Go正则表达式，用 ^ 和 $ 匹配整个名称）
+	PatternType string `yaml:"patternType"`
+	// Name : 资源名称，未指定前缀时使用 resourcePrefix
+	Name string `yaml:"name"`
+}
+
+// PodResourcesConfig kubelet PodResources API 配置
+type PodResourcesConfig struct {
+	// Enabled : 是否启用
+	Enabled bool `yaml:"enabled"`
+	// Socket : kubelet PodResources socket 路径
+	Socket string `yaml:"socket"`
+	// Timeout : 查询超时时间
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// NVMLMetricsConfig GPU时钟、降频原因和PCIe链路状态指标配置
+type NVMLMetricsConfig struct {
+	// Enabled : 是否在 /metrics 采集时通过NVML查询
+	Enabled bool `yaml:"enabled"`
+}
+
+// KubernetesConfig Kubernetes API 配置
+type KubernetesConfig struct {
+	// Enabled : 是否启用in-cluster客户端
+	Enabled bool `yaml:"enabled"`
+	// NodeName : 当前节点名称，默认读取环境变量 NODE_NAME
+	NodeName string `yaml:"nodeName"`
+	// AllocationEvents : 分配被拒绝时是否向Pod发送事件
+	AllocationEvents bool `yaml:"allocationEvents"`
+	// NodeEvents : 设备变为不健康或插件重启时是否向节点发送事件
+	NodeEvents bool `yaml:"nodeEvents"`
+	// NodeAnnotations : 是否把GPU健康状况和驱动版本写入节点注解，需要节点的get和patch权限
+	NodeAnnotations bool `yaml:"nodeAnnotations"`
+	// AnnotationPrefix : 节点注解的前缀
+	AnnotationPrefix string `yaml:"annotationPrefix"`
+	// AnnotationInterval : 检查设备状态的间隔，状态变化时才更新节点
+	AnnotationInterval time.Duration `yaml:"annotationInterval"`
+	// FabricLabels : 是否把GPU所在的多节点NVLink clique和IMEX域写入节点标签，需要开启 NodeAnnotations
+	FabricLabels bool `yaml:"fabricLabels"`
+}
+
+// ShutdownConfig 退出时的注销配置
+type ShutdownConfig struct {
+	// MarkUnhealthy : 停止服务前是否通过ListAndWatch上报所有设备不健康
+	MarkUnhealthy bool `yaml:"markUnhealthy"`
+	// GracePeriod : 上报不健康后等待kubelet感知的时间
+	GracePeriod time.Duration `yaml:"gracePeriod"`
+	// PluginTimeout : 等待插件停止的最长时间，超时后继续关闭HTTP服务
+	PluginTimeout time.Duration `yaml:"pluginTimeout"`
+	// HTTPTimeout : 等待HTTP请求处理完成的最长时间
+	HTTPTimeout time.Duration `yaml:"httpTimeout"`
+	// NvmlTimeout : 等待NVML关闭的最长时间
+	NvmlTimeout time.Duration `yaml:"nvmlTimeout"`
+	// Timeout : 整个退出流程的最长时间，超时后直接以非0状态退出，0表示不限制
+	Timeout time.Duration `yaml:"timeout"`
+	// Resources : 各资源退出时的处理，按顺序匹配，第一个匹配的生效，没有匹配的资源按 markUnhealthy 处理
+	Resources []ShutdownResourceConfig `yaml:"resources"`
+}
+
+// ShutdownResourceConfig 单个资源退出时的处理
+type ShutdownResourceConfig struct {
+	// Name : 资源名称，可以使用通配符，如 nvidia.com/mig-*，未指定前缀时使用 resourcePrefix
+	Name string `yaml:"name"`
+	// MarkUnhealthy : 停止服务前是否上报设备不健康，未指定时使用 shutdown.markUnhealthy
+	MarkUnhealthy *bool `yaml:"markUnhealthy"`
+	// MaxSkew : 不上报不健康时，停止服务前继续以健康状态提供设备的最长时间，
+	// 滚动更新时新实例在此期间注册即可接管，设备不会变为不健康，0表示立即停止
+	MaxSkew time.Duration `yaml:"maxSkew"`
+}
+
+// SimulateConfig 模拟模式配置，使用虚拟GPU代替NVML，用于无GPU环境的开发和测试
+type SimulateConfig struct {
+	// Enabled : 是否启用模拟模式
+	Enabled bool `yaml:"enabled"`
+	// TopologyFile : 拓扑描述文件，指定后忽略以下GPU配置
+	TopologyFile string `yaml:"topologyFile"`
+	// Count : 虚拟GPU数量
+	Count int `yaml:"count"`
+	// ProductName : 虚拟GPU的产品名称
+	ProductName string `yaml:"productName"`
+	// MemoryMiB : 虚拟GPU的显存大小
+	MemoryMiB uint64 `yaml:"memoryMiB"`
+	// ComputeCapability : 虚拟GPU的计算能力
+	ComputeCapability string `yaml:"computeCapability"`
+	// MigProfiles : 每个虚拟GPU上创建的MIG设备，为空时不开启MIG
+	MigProfiles []string `yaml:"migProfiles"`
+}
+
+// AllocateConfig Allocate/GetPreferredAllocation 并发配置
+type AllocateConfig struct {
+	// MaxConcurrent : 所有插件同时处理的最大请求数，0表示不限制
+	MaxConcurrent int `yaml:"maxConcurrent"`
+	// QueueTimeout : 请求排队等待的最长时间，0表示只受kubelet请求超时限制
+	QueueTimeout time.Duration `yaml:"queueTimeout"`
+	// UnhealthyPolicy : 申请的设备不健康时的处理方式：reject, warn
+	UnhealthyPolicy string `yaml:"unhealthyPolicy"`
+	// CudaVisibleDevicesOrdinals : 是否额外设置按PCI总线顺序的容器内 CUDA_VISIBLE_DEVICES 序号，用于只支持序号的旧框架
+	CudaVisibleDevicesOrdinals bool `yaml:"cudaVisibleDevicesOrdinals"`
+	// NUMAPolicy : 分时共享设备的副本分配时如何考虑NUMA节点：none, pack, spread
+	NUMAPolicy string `yaml:"numaPolicy"`
+	// RequireSameClique : 多卡推荐分配是否只选择同一个多节点NVLink fabric clique（IMEX域）中的GPU
+	RequireSameClique bool `yaml:"requireSameClique"`
+	// GDSEnabled : 是否在分配结果中加入 GPUDirect Storage 的 /dev/nvidia-fs* 设备和 /run/udev 目录
+	GDSEnabled bool `yaml:"gdsEnabled"`
+	// RDMAEnabled : 是否使用 GPUDirect RDMA，启动时检查 nvidia_peermem 是否已加载；网卡设备节点由RDMA设备插件注入
+	RDMAEnabled bool `yaml:"rdmaEnabled"`
+	// NICAffinity : 是否优先分配与Pod申请的RDMA网卡在同一PCIe交换机下的GPU，Pod通过注解 <annotationPrefix>/nic-resource 指定网卡资源
+	NICAffinity bool `yaml:"nicAffinity"`
+	// PreferredAllocation : 是否向kubelet声明支持 GetPreferredAllocation，关闭后由kubelet（拓扑管理器）自行选择设备
+	PreferredAllocation bool `yaml:"preferredAllocation"`
+	// IdempotencyWindow : 该时间内同一组设备的 Allocate 返回之前的响应，用于kubelet超时重试，不重复执行分配的副作用；
+	// 分配到同一组设备的其它容器同样命中，0表示不缓存
+	IdempotencyWindow time.Duration `yaml:"idempotencyWindow"`
+	// AcceptEnvvarUnprivileged : 是否通过 NVIDIA_VISIBLE_DEVICES 传递分配的设备，关闭后使用 DeviceListStrategy，
+	// 需要在 nvidia-container-toolkit 中设置 accept-nvidia-visible-devices-envvar-when-unprivileged = false，容器无法再申请所有GPU
+	AcceptEnvvarUnprivileged bool `yaml:"acceptEnvvarUnprivileged"`
+	// DeviceListStrategy : 不接受环境变量时传递设备列表的方式：volume-mounts, cdi-annotations, cdi-cri
+	DeviceListStrategy string `yaml:"deviceListStrategy"`
+	// ToolkitConfig : nvidia-container-toolkit 的配置文件，用于在健康检查中确认toolkit的配置与插件一致
+	ToolkitConfig string `yaml:"toolkitConfig"`
+}
+
+// AuditConfig Allocate/GetPreferredAllocation 审计日志配置，与运行日志分开写入
+type AuditConfig struct {
+	// Enabled : 是否开启审计日志
+	Enabled bool `yaml:"enabled"`
+	// File : 审计日志文件，为空时不写文件
+	File string `yaml:"file"`
+	// Stdout : 是否同时输出到标准输出
+	Stdout bool `yaml:"stdout"`
+	// MaxSize : 单个日志文件大小（M）
+	MaxSize int `yaml:"maxSize"`
+	// MaxBackups : 最多保留的切片文件数
+	MaxBackups int `yaml:"maxBackups"`
+	// MaxAge : 日志文件保存的最大天数
+	MaxAge int `yaml:"maxAge"`
+	// RateLimit : 每秒最多写入的记录数，0表示不限制，超出的记录丢弃并计数
+	RateLimit float64 `yaml:"rateLimit"`
+	// Burst : 速率限制允许的突发记录数
+	Burst int `yaml:"burst"`
+	// PreferredAllocation : 是否记录 GetPreferredAllocation，只记录 Allocate 时可以关闭
+	PreferredAllocation bool `yaml:"preferredAllocation"`
+}
+
+// DeviceAttributesConfig 把分配设备的属性写入 Allocate 响应的注解，下游的mutating webhook或注入器据此设置框架参数，不必在容器中查询NVML
+type DeviceAttributesConfig struct {
+	// Enabled : 是否写入设备属性注解
+	Enabled bool `yaml:"enabled"`
+	// Prefix : 注解键的前缀，键为 <prefix>/<属性>
+	Prefix string `yaml:"prefix"`
+	// Attributes : 写入的属性：uuid, product, memory, computeCapability, migProfile, numaNode, clique
+	Attributes []string `yaml:"attributes"`
+}
+
+// DeviceCacheConfig 设备静态属性和NVML句柄的缓存配置，重启插件时清空缓存
+type DeviceCacheConfig struct {
+	// TTL : 缓存有效期，0表示不缓存
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// RegistrationConfig 注册状态检查配置
+type RegistrationConfig struct {
+	// CheckInterval : 检查已注册插件的间隔，0表示不检查
+	CheckInterval time.Duration `yaml:"checkInterval"`
+	// ConnectTimeout : 注册后等待kubelet调用ListAndWatch的最长时间，超时视为注册失败
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+	// APIVersions : 按优先顺序尝试的设备插件API版本，kubelet不支持时尝试下一个
+	APIVersions []string `yaml:"apiVersions"`
+	// DialTimeout : 连接kubelet socket和插件自身socket的超时时间
+	DialTimeout time.Duration `yaml:"dialTimeout"`
+	// RegisterTimeout : 向kubelet注册的超时时间
+	RegisterTimeout time.Duration `yaml:"registerTimeout"`
+	// StartupDeadline : 启动后所有插件必须完成注册的期限，超时后以非0状态退出由kubelet重启，0表示不限制
+	StartupDeadline time.Duration `yaml:"startupDeadline"`
+}
+
+// InventoryConfig 设备清单导出配置
+type InventoryConfig struct {
+	// Enabled : 是否把设备清单和健康状态写入本地文件
+	Enabled bool `yaml:"enabled"`
+	// Path : 导出文件路径，通常挂载为hostPath
+	Path string `yaml:"path"`
+	// Interval : 写入间隔
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ListAndWatchConfig ListAndWatch 推送配置
+type ListAndWatchConfig struct {
+	// InitialDelay : kubelet连接后推送第一次设备列表前的等待时间
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	// BatchWindow : 健康状态变化的合并窗口，窗口内的多个变化合并为一次推送，0表示每次变化立即推送
+	BatchWindow time.Duration `yaml:"batchWindow"`
+}
+
+// GRPCConfig 设备插件gRPC服务器配置
+type GRPCConfig struct {
+	// KeepaliveTime : 连接空闲多久后向kubelet发送ping，0表示使用gRPC默认值（2小时）
+	KeepaliveTime time.Duration `yaml:"keepaliveTime"`
+	// KeepaliveTimeout : 等待ping响应的时间，超时后关闭连接
+	KeepaliveTimeout time.Duration `yaml:"keepaliveTimeout"`
+	// KeepaliveMinTime : 允许客户端发送ping的最小间隔，0表示使用gRPC默认值（5分钟）
+	KeepaliveMinTime time.Duration `yaml:"keepaliveMinTime"`
+	// MaxConcurrentStreams : 每个连接的最大并发流数量，0表示不限制
+	MaxConcurrentStreams uint32 `yaml:"maxConcurrentStreams"`
+	// MaxRecvMsgSize : 最大接收消息大小，单位字节，0表示使用gRPC默认值（4MB）
+	MaxRecvMsgSize int `yaml:"maxRecvMsgSize"`
+	// MaxSendMsgSize : 最大发送消息大小，单位字节，0表示使用gRPC默认值
+	MaxSendMsgSize int `yaml:"maxSendMsgSize"`
+	// LogRequests : 是否记录每次gRPC调用，单次调用为debug级别，ListAndWatch等流式调用为info级别
+	LogRequests bool `yaml:"logRequests"`
+	// LogConnections : 是否记录kubelet连接的建立和断开
+	LogConnections bool `yaml:"logConnections"`
+	// SocketMode : 插件socket的权限，八进制，如 "0660"，为空时不修改
+	SocketMode string `yaml:"socketMode"`
+	// SocketUID : 插件socket的属主，-1表示不修改
+	SocketUID int `yaml:"socketUID"`
+	// SocketGID : 插件socket的属组，-1表示不修改
+	SocketGID int `yaml:"socketGID"`
+	// SELinuxLabel : 插件socket的SELinux标签，如 "system_u:object_r:container_file_t:s0"
+	SELinuxLabel string `yaml:"selinuxLabel"`
+	// RestoreSELinuxContext : 是否通过 restorecon 按策略恢复插件socket的SELinux标签
+	RestoreSELinuxContext bool `yaml:"restoreSELinuxContext"`
+}
+
+// DeviceHealthConfig 设备故障检查配置
+type DeviceHealthConfig struct {
+	// Enabled : 是否定期检查ECC错误、待退役显存页和行重映射状态
+	Enabled bool `yaml:"enabled"`
+	// Interval : 检查间隔
+	Interval time.Duration `yaml:"interval"`
+	// Xids : 是否监听XID严重错误事件，把发生错误的GPU或MIG设备标记为不健康
+	Xids bool `yaml:"xids"`
+	// IgnoredXids : 不标记设备不健康的XID，默认为应用程序自身错误引起的XID
+	IgnoredXids []uint64 `yaml:"ignoredXids"`
+	// SafetyMode : NVML与驱动版本不一致或运行中有设备从NVML消失时，把该资源的所有设备标记为不健康
+	SafetyMode bool `yaml:"safetyMode"`
+	// Checkers : 各健康检查器的开关和检查间隔，XID和温度检查分别由 xids 和 thermal 配置控制
+	Checkers HealthCheckersConfig `yaml:"checkers"`
+}
+
+// DCGMConfig healthBackend 为 dcgm 时连接节点上已运行的 nv-hostengine
+type DCGMConfig struct {
+	// HostEngine : nv-hostengine 地址，如 localhost:5555 或 unix socket 路径
+	HostEngine string `yaml:"hostEngine"`
+	// DiagLevel : 诊断级别，1为快速检查，2、3会占用GPU数分钟
+	DiagLevel int `yaml:"diagLevel"`
+	// DiagInterval : 诊断间隔，0表示不运行诊断
+	DiagInterval time.Duration `yaml:"diagInterval"`
+}
+
+// HealthCheckersConfig 内置健康检查器配置
+type HealthCheckersConfig struct {
+	// ECC : ECC错误、待退役显存页和行重映射检查
+	ECC HealthCheckerConfig `yaml:"ecc"`
+	// StuckProcess : 已退出进程仍占用GPU上下文的检查
+	StuckProcess StuckProcessCheckerConfig `yaml:"stuckProcess"`
+}
+
+// HealthCheckerConfig 健康检查器配置
+type HealthCheckerConfig struct {
+	// Enabled : 是否启用
+	Enabled bool `yaml:"enabled"`
+	// Interval : 检查间隔，0表示使用 deviceHealth.interval
+	Interval time.Duration `yaml:"interval"`
+}
+
+// StuckProcessCheckerConfig 残留进程检查器配置
+type StuckProcessCheckerConfig struct {
+	// Enabled : 是否启用，需要插件使用宿主机PID命名空间
+	Enabled bool `yaml:"enabled"`
+	// Interval : 检查间隔，0表示使用 deviceHealth.interval
+	Interval time.Duration `yaml:"interval"`
+	// StuckFor : 进程退出后仍占用GPU超过该时间时标记为不健康
+	StuckFor time.Duration `yaml:"stuckFor"`
+}
+
+// ThermalConfig 温度和功耗隔离策略配置
+type ThermalConfig struct {
+	// Enabled : 是否在温度或功耗持续超过阈值时把GPU标记为不健康
+	Enabled bool `yaml:"enabled"`
+	// Interval : 检查间隔
+	Interval time.Duration `yaml:"interval"`
+	// MaxTemperatureC : 温度阈值，单位摄氏度，0表示不检查温度
+	MaxTemperatureC uint32 `yaml:"maxTemperatureC"`
+	// TemperatureHysteresisC : 温度回落到阈值减去此值以下才视为恢复
+	TemperatureHysteresisC uint32 `yaml:"temperatureHysteresisC"`
+	// MaxPowerPercent : 功耗阈值，占功耗上限的百分比，0表示不检查功耗
+	MaxPowerPercent float64 `yaml:"maxPowerPercent"`
+	// PowerHysteresisPercent : 功耗回落到阈值减去此值以下才视为恢复
+	PowerHysteresisPercent float64 `yaml:"powerHysteresisPercent"`
+	// SustainFor : 持续超过阈值多久后隔离
+	SustainFor time.Duration `yaml:"sustainFor"`
+	// RecoverAfter : 持续低于恢复阈值多久后恢复
+	RecoverAfter time.Duration `yaml:"recoverAfter"`
+}
+
+// GPUMemoryConfig 显存资源配置
+type GPUMemoryConfig struct {
+	// Enabled : 是否把未开启MIG的GPU显存按分块作为可计数资源对外提供，用于没有MIG的推理负载粗粒度共享GPU
+	Enabled bool `yaml:"enabled"`
+	// ResourceName : 资源名称，未指定前缀时使用 resourcePrefix
+	ResourceName string `yaml:"resourceName"`
+	// ChunkMiB : 每个分块的显存大小
+	ChunkMiB uint64 `yaml:"chunkMiB"`
+}
+
+// MigAnyConfig 任意MIG配置的聚合资源配置
+type MigAnyConfig struct {
+	// Enabled : mixed 策略下是否额外提供包含所有MIG设备的资源，推荐分配时优先选择满足申请的最小配置
+	Enabled bool `yaml:"enabled"`
+	// ResourceName : 资源名称，未指定前缀时使用 resourcePrefix
+	ResourceName string `yaml:"resourceName"`
+}
+
+// SharingConfig GPU共享配置
+type SharingConfig struct {
+	// TimeSlicing : 分时共享，每个设备按副本数对外提供多个设备ID
+	TimeSlicing TimeSlicingConfig `yaml:"timeSlicing"`
+}
+
+// TimeSlicingConfig 分时共享配置
+type TimeSlicingConfig struct {
+	// RenameByDefault : 共享的资源是否加上 .shared 后缀，如 nvidia.com/gpu.shared，便于与独占的资源区分
+	RenameByDefault bool `yaml:"renameByDefault"`
+	// Resources : 各资源的副本数，按顺序匹配，第一个匹配的生效，没有匹配的资源不共享
+	Resources []ReplicatedResourceConfig `yaml:"resources"`
+}
+
+// ReplicatedResourceConfig 单个资源的共享配置
+type ReplicatedResourceConfig struct {
+	// Name : 资源名称，可以使用通配符，如 nvidia.com/mig-1g.*，未指定前缀时使用 resourcePrefix
+	Name string `yaml:"name"`
+	// Replicas : 每个设备的副本数，1表示不共享
+	Replicas int `yaml:"replicas"`
+	// Rename : 共享后对外提供的资源名称，如 nvidia.com/gpu.shared，未指定前缀时使用 resourcePrefix；
+	// 为空时按 renameByDefault 决定是否加上 .shared 后缀，只能用于不含通配符的名称
+	Rename string `yaml:"rename"`
+}
+
+// ModeDriftConfig GPU模式设置漂移检查配置
+type ModeDriftConfig struct {
+	// Enabled : 是否定期比较GPU的模式设置与期望状态
+	Enabled bool `yaml:"enabled"`
+	// Interval : 检查间隔
+	Interval time.Duration `yaml:"interval"`
+	// Remediate : 是否尝试把漂移的设置改回期望值，ECC和MIG模式需要重置GPU后生效
+	Remediate bool `yaml:"remediate"`
+	// Desired : 期望的模式设置
+	Desired DesiredModes `yaml:"desired"`
+}
+
+// HotplugConfig GPU热插拔检测配置
+type HotplugConfig struct {
+	// Enabled : 是否定期重新扫描GPU，把新接入或移除的设备增量推送给kubelet
+	Enabled bool `yaml:"enabled"`
+	// Interval : 扫描间隔
+	Interval time.Duration `yaml:"interval"`
+}
+
+// AllocationWebhookConfig allocationPolicy 为 webhook 时调用的外部接口配置
+type AllocationWebhookConfig struct {
+	// URL : 接收 POST 请求的HTTP(S)地址
+	URL string `yaml:"url"`
+	// Timeout : 单次调用的超时时间
+	Timeout time.Duration `yaml:"timeout"`
+	// FailurePolicy : 调用失败或返回的设备无效时的处理方式：fallback 使用内置策略，fail 返回错误
+	FailurePolicy string `yaml:"failurePolicy"`
+	// CAFile : 校验服务端证书的CA，为空时使用系统CA
+	CAFile string `yaml:"caFile"`
+	// TokenFile : bearer token 文件，每次调用时重新读取，为空时不认证
+	TokenFile string `yaml:"tokenFile"`
+}
+
+// ProfilingConfig 运行期间通过HTTP开启性能分析的配置
+type ProfilingConfig struct {
+	// Enabled : 是否注册 /debug/bench/* 和 /debug/pprof/* 接口，接口需要 webAuth 认证
+	Enabled bool `yaml:"enabled"`
+	// Dir : 分析文件的输出目录，为空时在当前目录下创建临时目录，启动时会清空
+	Dir string `yaml:"dir"`
+	// MaxDuration : 通过接口开始的单次分析的最长时间，超过后自动停止，0表示不限制
+	MaxDuration time.Duration `yaml:"maxDuration"`
+}
+
+// DesiredModes 期望的GPU模式设置，空值表示不检查
+type DesiredModes struct {
+	// ECC : enabled 或 disabled
+	ECC string `yaml:"ecc"`
+	// MIG : enabled 或 disabled
+	MIG string `yaml:"mig"`
+	// Persistence : enabled 或 disabled
+	Persistence string `yaml:"persistence"`
+	// ComputeMode : default、exclusiveProcess 或 prohibited
+	ComputeMode string `yaml:"computeMode"`
+}
+
+// MigWatchConfig MIG配置变化检测
+type MigWatchConfig struct {
+	// Enabled : 是否定期检查GPU的MIG模式和MIG设备，发生变化时只重启受影响资源的插件
+	Enabled bool `yaml:"enabled"`
+	// Interval : 检查间隔
+	Interval time.Duration `yaml:"interval"`
+}
+
+// StorageConfig 状态和审计记录的持久化配置
+type StorageConfig struct {
+	// Backend : 存储后端，file、bbolt、sqlite 或 memory
+	Backend string `yaml:"backend"`
+	// Dir : 数据目录，通常挂载为hostPath，使状态在插件重启后保留，memory 后端不使用
+	Dir string `yaml:"dir"`
+	// MaxAge : 审计等追加型记录的保留时间，0表示不限制
+	MaxAge time.Duration `yaml:"maxAge"`
+	// MaxRecords : 每类追加型记录最多保留的条数，0表示不限制
+	MaxRecords int `yaml:"maxRecords"`
+	// CompactInterval : 按保留策略清理记录的间隔
+	CompactInterval time.Duration `yaml:"compactInterval"`
+}
+
+// DriverPolicyConfig 驱动版本要求，节点驱动过旧时集群中的CUDA负载无法运行
+type DriverPolicyConfig struct {
+	// MinDriverVersion : 最低驱动版本，如 535.104.05，为空时不检查
+	MinDriverVersion string `yaml:"minDriverVersion"`
+	// MinCudaDriverVersion : 驱动支持的最低CUDA版本，如 12.2，为空时不检查
+	MinCudaDriverVersion string `yaml:"minCudaDriverVersion"`
+	// BlockedDriverVersions : 已知有问题的驱动版本
+	BlockedDriverVersions []string `yaml:"blockedDriverVersions"`
+	// Action : 不满足要求时的处理方式：unhealthy 上报所有设备不健康，withhold 不向kubelet注册
+	Action string `yaml:"action"`
+}
+
+// DriverReadinessConfig 发现设备前等待驱动就绪，避免插件先于驱动启动时一直提供0个设备
+type DriverReadinessConfig struct {
+	// Enabled : 是否等待驱动就绪，等待期间插件不注册、就绪检查失败
+	Enabled bool `yaml:"enabled"`
+	// DevicePath : 驱动加载后出现的设备文件，存在且NVML初始化成功视为就绪
+	DevicePath string `yaml:"devicePath"`
+	// Timeout : 最长等待时间，超时后按未发现设备处理（nonGpuNodeBehavior），0表示一直等待
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval : 重试间隔
+	Interval time.Duration `yaml:"interval"`
+}
+
+// NodeAPIConfig 节点本地gRPC API配置
+type NodeAPIConfig struct {
+	// Enabled : 是否在unix socket上提供只读的GPU状态查询，供同节点的其它DaemonSet使用
+	Enabled bool `yaml:"enabled"`
+	// Socket : socket路径，通常挂载为hostPath
+	Socket string `yaml:"socket"`
 }
 
 func SetDefaultConfig() {
-	viper.SetDefault("webListenAddress", "9002")
+	viper.SetDefault("webListenAddress", ":9002")
+	viper.SetDefault("webAuth.enabled", false)
+	viper.SetDefault("webAuth.tokenFile", "")
+	viper.SetDefault("webAuth.certFile", "")
+	viper.SetDefault("webAuth.keyFile", "")
+	viper.SetDefault("webAuth.clientCAFile", "")
+	viper.SetDefault("webAuth.clientNames", []string{})
+	viper.SetDefault("webAuth.allowInsecureTokens", false)
+	viper.SetDefault("instanceId", "")
+	viper.SetDefault("platform", "auto")
 	viper.SetDefault("migStrategy", "none")
+	viper.SetDefault("resourcePrefix", "nvidia.com")
+	viper.SetDefault("nonGpuNodeBehavior", "idle")
+	viper.SetDefault("nonGpuProbeInterval", "5m")
+	viper.SetDefault("includeDevices", []string{})
+	viper.SetDefault("excludeDevices", []string{})
+	viper.SetDefault("sysfsRoot", "/sys")
 	viper.SetDefault("benchmark", false)
+	viper.SetDefault("profiling.enabled", false)
+	viper.SetDefault("profiling.dir", "")
+	viper.SetDefault("profiling.maxDuration", "10m")
+	viper.SetDefault("resources.gpus", []ResourcePatternConfig{})
+	viper.SetDefault("resources.mig", []ResourcePatternConfig{})
+	viper.SetDefault("resources.unmatched", "fail")
+	viper.SetDefault("resources.defaultName", "gpu")
+	viper.SetDefault("podResources.enabled", false)
+	viper.SetDefault("podResources.socket", "/var/lib/kubelet/pod-resources/kubelet.sock")
+	viper.SetDefault("podResources.timeout", "5s")
+	viper.SetDefault("nvmlMetrics.enabled", true)
+	viper.SetDefault("kubernetes.enabled", false)
+	viper.SetDefault("kubernetes.nodeName", os.Getenv("NODE_NAME"))
+	viper.SetDefault("kubernetes.allocationEvents", false)
+	viper.SetDefault("kubernetes.nodeEvents", false)
+	viper.SetDefault("kubernetes.nodeAnnotations", false)
+	viper.SetDefault("kubernetes.annotationPrefix", "k8s-gpu-device-plugin")
+	viper.SetDefault("kubernetes.annotationInterval", "30s")
+	viper.SetDefault("kubernetes.fabricLabels", false)
+	viper.SetDefault("shutdown.markUnhealthy", true)
+	viper.SetDefault("shutdown.gracePeriod", "5s")
+	viper.SetDefault("shutdown.pluginTimeout", "30s")
+	viper.SetDefault("shutdown.httpTimeout", "10s")
+	viper.SetDefault("shutdown.nvmlTimeout", "5s")
+	viper.SetDefault("shutdown.timeout", "60s")
+	viper.SetDefault("simulate.enabled", false)
+	viper.SetDefault("simulate.topologyFile", "")
+	viper.SetDefault("simulate.count", 2)
+	viper.SetDefault("simulate.productName", "NVIDIA A100-SXM4-40GB")
+	viper.SetDefault("simulate.memoryMiB", 40960)
+	viper.SetDefault("simulate.computeCapability", "8.0")
+	viper.SetDefault("simulate.migProfiles", []string{})
+	viper.SetDefault("allocate.maxConcurrent", 4)
+	viper.SetDefault("allocate.queueTimeout", "30s")
+	viper.SetDefault("allocate.unhealthyPolicy", "reject")
+	viper.SetDefault("allocate.cudaVisibleDevicesOrdinals", false)
+	viper.SetDefault("allocate.numaPolicy", "none")
+	viper.SetDefault("allocate.requireSameClique", false)
+	viper.SetDefault("allocate.gdsEnabled", false)
+	viper.SetDefault("allocate.rdmaEnabled", false)
+	viper.SetDefault("allocate.nicAffinity", false)
+	viper.SetDefault("allocate.preferredAllocation", true)
+	viper.SetDefault("allocate.idempotencyWindow", "0s")
+	viper.SetDefault("allocate.acceptEnvvarUnprivileged", true)
+	viper.SetDefault("allocate.deviceListStrategy", "volume-mounts")
+	viper.SetDefault("allocate.toolkitConfig", "/etc/nvidia-container-runtime/config.toml")
+	viper.SetDefault("allocationPolicy", "builtin")
+	viper.SetDefault("allocationWebhook.url", "")
+	viper.SetDefault("allocationWebhook.timeout", "2s")
+	viper.SetDefault("allocationWebhook.failurePolicy", "fallback")
+	viper.SetDefault("allocationWebhook.caFile", "")
+	viper.SetDefault("allocationWebhook.tokenFile", "")
+	viper.SetDefault("registration.checkInterval", "30s")
+	viper.SetDefault("registration.connectTimeout", "1m")
+	viper.SetDefault("registration.apiVersions", []string{"v1beta1", "v1alpha2"})
+	viper.SetDefault("registration.dialTimeout", "5s")
+	viper.SetDefault("registration.registerTimeout", "10s")
+	viper.SetDefault("registration.startupDeadline", "0s")
+	viper.SetDefault("inventory.enabled", false)
+	viper.SetDefault("inventory.path", "/var/lib/k8s-gpu-device-plugin/inventory.json")
+	viper.SetDefault("inventory.interval", "30s")
+	viper.SetDefault("listAndWatch.initialDelay", "0s")
+	viper.SetDefault("listAndWatch.batchWindow", "100ms")
+	viper.SetDefault("grpc.keepaliveTime", "30s")
+	viper.SetDefault("grpc.keepaliveTimeout", "10s")
+	viper.SetDefault("grpc.keepaliveMinTime", "10s")
+	viper.SetDefault("grpc.maxConcurrentStreams", 0)
+	viper.SetDefault("grpc.maxRecvMsgSize", 0)
+	viper.SetDefault("grpc.maxSendMsgSize", 0)
+	viper.SetDefault("grpc.logRequests", false)
+	viper.SetDefault("grpc.logConnections", false)
+	viper.SetDefault("grpc.socketMode", "")
+	viper.SetDefault("grpc.socketUID", -1)
+	viper.SetDefault("grpc.socketGID", -1)
+	viper.SetDefault("grpc.selinuxLabel", "")
+	viper.SetDefault("grpc.restoreSELinuxContext", false)
+	viper.SetDefault("deviceHealth.enabled", true)
+	viper.SetDefault("deviceHealth.interval", "30s")
+	viper.SetDefault("deviceHealth.xids", true)
+	viper.SetDefault("deviceHealth.ignoredXids", []uint64{13, 31, 43, 45, 68, 109})
+	viper.SetDefault("deviceHealth.safetyMode", true)
+	viper.SetDefault("deviceHealth.checkers.ecc.enabled", true)
+	viper.SetDefault("deviceHealth.checkers.ecc.interval", "0s")
+	viper.SetDefault("deviceHealth.checkers.stuckProcess.enabled", false)
+	viper.SetDefault("deviceHealth.checkers.stuckProcess.interval", "1m")
+	viper.SetDefault("deviceHealth.checkers.stuckProcess.stuckFor", "5m")
+	viper.SetDefault("healthBackend", "nvml")
+	viper.SetDefault("dcgm.hostEngine", "localhost:5555")
+	viper.SetDefault("dcgm.diagLevel", 1)
+	viper.SetDefault("dcgm.diagInterval", "0s")
+	viper.SetDefault("thermal.enabled", false)
+	viper.SetDefault("thermal.interval", "10s")
+	viper.SetDefault("thermal.maxTemperatureC", 85)
+	viper.SetDefault("thermal.temperatureHysteresisC", 5)
+	viper.SetDefault("thermal.maxPowerPercent", 0)
+	viper.SetDefault("thermal.powerHysteresisPercent", 5)
+	viper.SetDefault("thermal.sustainFor", "1m")
+	viper.SetDefault("thermal.recoverAfter", "2m")
+	viper.SetDefault("gpuMemory.enabled", false)
+	viper.SetDefault("gpuMemory.resourceName", "gpu-memory")
+	viper.SetDefault("gpuMemory.chunkMiB", 1024)
+	viper.SetDefault("migAny.enabled", false)
+	viper.SetDefault("migAny.resourceName", "mig-any")
+	viper.SetDefault("sharing.timeSlicing.renameByDefault", false)
+	viper.SetDefault("sharing.timeSlicing.resources", []ReplicatedResourceConfig{})
+	viper.SetDefault("modeDrift.enabled", false)
+	viper.SetDefault("modeDrift.interval", "5m")
+	viper.SetDefault("modeDrift.remediate", false)
+	viper.SetDefault("modeDrift.desired.ecc", "")
+	viper.SetDefault("modeDrift.desired.mig", "")
+	viper.SetDefault("modeDrift.desired.persistence", "")
+	viper.SetDefault("modeDrift.desired.computeMode", "")
+	viper.SetDefault("hotplug.enabled", false)
+	viper.SetDefault("hotplug.interval", "30s")
+	viper.SetDefault("migWatch.enabled", false)
+	viper.SetDefault("migWatch.interval", "30s")
+	viper.SetDefault("storage.backend", "file")
+	viper.SetDefault("storage.dir", "/var/lib/k8s-gpu-device-plugin/state")
+	viper.SetDefault("storage.maxAge", "720h")
+	viper.SetDefault("storage.maxRecords", 100000)
+	viper.SetDefault("storage.compactInterval", "1h")
+	viper.SetDefault("nodeAPI.enabled", false)
+	viper.SetDefault("nodeAPI.socket", "/var/lib/k8s-gpu-device-plugin/nodeapi.sock")
+	viper.SetDefault("driverPolicy.minDriverVersion", "")
+	viper.SetDefault("driverPolicy.minCudaDriverVersion", "")
+	viper.SetDefault("driverPolicy.blockedDriverVersions", []string{})
+	viper.SetDefault("driverPolicy.action", "unhealthy")
+	viper.SetDefault("driverReadiness.enabled", false)
+	viper.SetDefault("driverReadiness.devicePath", "/dev/nvidiactl")
+	viper.SetDefault("driverReadiness.timeout", 10*time.Minute)
+	viper.SetDefault("driverReadiness.interval", 5*time.Second)
+	viper.SetDefault("overlays", []OverlayConfig{})
+	viper.SetDefault("featureGates", map[string]bool{})
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.endpoint", "localhost:4317")
+	viper.SetDefault("tracing.insecure", true)
+	viper.SetDefault("tracing.headers", map[string]string{})
+	viper.SetDefault("tracing.serviceName", "k8s-gpu-device-plugin")
+	viper.SetDefault("tracing.sampleRatio", 0.1)
+	viper.SetDefault("tracing.timeout", "10s")
+	viper.SetDefault("audit.enabled", false)
+	viper.SetDefault("audit.file", "./logs/k8s-gpu-device-plugin-audit.log")
+	viper.SetDefault("audit.stdout", false)
+	viper.SetDefault("audit.maxSize", 100)
+	viper.SetDefault("audit.maxBackups", 10)
+	viper.SetDefault("audit.maxAge", 90)
+	viper.SetDefault("audit.rateLimit", 100)
+	viper.SetDefault("audit.burst", 200)
+	viper.SetDefault("audit.preferredAllocation", true)
+	viper.SetDefault("deviceAttributes.enabled", false)
+	viper.SetDefault("deviceAttributes.prefix", "k8s-gpu-device-plugin")
+	viper.SetDefault("deviceAttributes.attributes", []string{"memory", "computeCapability", "migProfile"})
+	viper.SetDefault("deviceCache.ttl", "10m")
 	viper.SetDefault("log.level", "debug")
 	viper.SetDefault("log.filename", "./logs/log.log")
+	viper.SetDefault("log.file", true)
+	viper.SetDefault("log.stdout", false)
+	viper.SetDefault("log.encoding", "json")
+	viper.SetDefault("log.maxSize", 100)
+	viper.SetDefault("log.maxBackups", 60)
+	viper.SetDefault("log.maxAge", 30)
 }
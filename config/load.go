@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// BaseFile 配置目录中的基础配置文件
+const BaseFile = "config.yml"
+
+// OverlayConfig 按节点名称匹配的覆盖配置，用于同一ConfigMap为不同节点池提供不同的共享和副本配置
+type OverlayConfig struct {
+	// Nodes : 节点名称的通配符，如 gpu-a100-*，匹配任意一个时使用该覆盖配置
+	Nodes []string `yaml:"nodes"`
+	// File : 覆盖配置文件，相对于配置目录
+	File string `yaml:"file"`
+}
+
+// LoadDir 从配置目录加载基础配置，再依次合并 overlays 中匹配当前节点的文件和 node-<节点名称>.yml，返回按合并顺序排列的文件
+// 合并时map逐层覆盖，列表整体替换；节点名称取自基础配置的 kubernetes.nodeName（默认为 NODE_NAME）
+func LoadDir(dir string) ([]string, error) {
+	base := filepath.Join(dir, BaseFile)
+	viper.SetConfigFile(base)
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading base config %s: %w", base, err)
+	}
+	files := []string{base}
+	nodeName := viper.GetString("kubernetes.nodeName")
+	var overlays []OverlayConfig
+	if err := viper.UnmarshalKey("overlays", &overlays); err != nil {
+		return files, fmt.Errorf("invalid overlays: %w", err)
+	}
+	for i, o := range overlays {
+		if o.File == "" {
+			return files, fmt.Errorf("overlays[%d]: file is required", i)
+		}
+		ok, err := matchNode(o.Nodes, nodeName)
+		if err != nil {
+			return files, fmt.Errorf("overlays[%d]: %w", i, err)
+		}
+		if ok {
+			files = append(files, filepath.Join(dir, o.File))
+		}
+	}
+	if nodeName != "" {
+		nodeFile := filepath.Join(dir, "node-"+nodeName+".yml")
+		if _, err := os.Stat(nodeFile); err == nil {
+			files = append(files, nodeFile)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return files, fmt.Errorf("error reading node config %s: %w", nodeFile, err)
+		}
+	}
+	for _, f := range files[1:] {
+		viper.SetConfigFile(f)
+		if err := viper.MergeInConfig(); err != nil {
+			return files, fmt.Errorf("error merging config %s: %w", f, err)
+		}
+	}
+	return files, nil
+}
+
+// matchNode 节点名称是否匹配任意一个通配符，节点名称未知时不匹配
+func matchNode(patterns []string, nodeName string) (bool, error) {
+	if nodeName == "" {
+		return false, nil
+	}
+	for _, p := range patterns {
+		ok, err := filepath.Match(p, nodeName)
+		if err != nil {
+			return false, fmt.Errorf("invalid node pattern %q: %w", p, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted 替换敏感配置值
+const redacted = "REDACTED"
+
+// Sanitized 合并默认值后的配置，去除可能包含认证信息的值，用于附加到问题报告
+// tracing.headers 的值和URL中的用户信息被替换，token文件只是路径，保留
+func Sanitized(cfg *Config) (map[string]interface{}, error) {
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]interface{}
+	if err := yaml.Unmarshal(out, &res); err != nil {
+		return nil, err
+	}
+	if tracing, ok := res["tracing"].(map[string]interface{}); ok {
+		if headers, ok := tracing["headers"].(map[string]interface{}); ok {
+			for k := range headers {
+				headers[k] = redacted
+			}
+		}
+	}
+	if webhook, ok := res["allocationWebhook"].(map[string]interface{}); ok {
+		if raw, ok := webhook["url"].(string); ok {
+			if u, err := url.Parse(raw); err == nil && u.User != nil {
+				u.User = url.User(redacted)
+				webhook["url"] = u.String()
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/feature"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+)
+
+// 枚举配置项的可选值，与各模块中的常量保持一致
+var (
+	platforms            = []string{"auto", "linux", "windows"}
+	migStrategies        = []string{"none", "single", "mixed"}
+	nonGpuNodeBehaviors  = []string{"exit", "idle", "advertise-zero"}
+	unhealthyPolicies    = []string{"reject", "warn"}
+	numaPolicies         = []string{"none", "pack", "spread"}
+	deviceListStrategies = []string{"volume-mounts", "cdi-annotations", "cdi-cri"}
+	allocationPolicies   = []string{"builtin", "webhook"}
+	failurePolicies      = []string{"fallback", "fail"}
+	desiredStates        = []string{"", "enabled", "disabled"}
+	computeModes         = []string{"", "default", "exclusiveProcess", "prohibited"}
+	driverActions        = []string{"unhealthy", "withhold"}
+	apiVersions          = []string{"v1beta1", "v1alpha2"}
+	patternTypes         = []string{"", "wildcard", "regex"}
+	unmatchedPolicies    = []string{"fail", "skip", "default"}
+	healthBackends       = []string{"nvml", "dcgm"}
+	deviceAttributes     = []string{"uuid", "product", "memory", "computeCapability", "migProfile", "numaNode", "clique"}
+	logLevels            = []string{l.DEBUG, l.INFO, l.WARN, l.ERROR}
+	logEncodings         = []string{l.EncodingJSON, l.EncodingConsole}
+)
+
+// Validate 检查必填项、枚举值、地址和时间间隔，返回所有问题而不是第一个，便于一次改完
+func (c *Config) Validate() error {
+	v := &validator{}
+	v.address("webListenAddress", c.WebListenAddress)
+	v.oneOf("platform", c.Platform, platforms)
+	v.oneOf("migStrategy", c.MigStrategy, migStrategies)
+	v.required("resourcePrefix", c.ResourcePrefix)
+	if r := c.Resources; r != nil {
+		v.patterns("resources.gpus", r.GPUs)
+		v.patterns("resources.mig", r.MIG)
+		v.oneOf("resources.unmatched", r.Unmatched, unmatchedPolicies)
+		if r.Unmatched == "default" {
+			v.required("resources.defaultName", r.DefaultName)
+		}
+	}
+	v.required("sysfsRoot", c.SysfsRoot)
+	v.oneOf("nonGpuNodeBehavior", c.NonGpuNodeBehavior, nonGpuNodeBehaviors)
+	v.duration("nonGpuProbeInterval", c.NonGpuProbeInterval, false)
+	v.oneOf("allocationPolicy", c.AllocationPolicy, allocationPolicies)
+	if a := c.WebAuth; a != nil {
+		if a.Enabled && a.TokenFile == "" && a.ClientCAFile == "" {
+			v.add("webAuth", "enabled but neither tokenFile nor clientCAFile is set")
+		}
+		if (a.CertFile == "") != (a.KeyFile == "") {
+			v.add("webAuth", "certFile and keyFile must be set together")
+		}
+		if a.ClientCAFile != "" && a.CertFile == "" {
+			v.add("webAuth.clientCAFile", "requires certFile and keyFile")
+		}
+	}
+	if a := c.Allocate; a != nil {
+		v.oneOf("allocate.unhealthyPolicy", a.UnhealthyPolicy, unhealthyPolicies)
+		v.oneOf("allocate.numaPolicy", a.NUMAPolicy, numaPolicies)
+		v.nonNegative("allocate.maxConcurrent", a.MaxConcurrent)
+		v.duration("allocate.queueTimeout", a.QueueTimeout, false)
+		v.duration("allocate.idempotencyWindow", a.IdempotencyWindow, false)
+		if !a.AcceptEnvvarUnprivileged {
+			v.oneOf("allocate.deviceListStrategy", a.DeviceListStrategy, deviceListStrategies)
+		}
+	}
+	if g := c.GRPC; g != nil {
+		if g.SocketMode != "" {
+			if mode, err := strconv.ParseUint(g.SocketMode, 8, 32); err != nil || mode > 0o777 {
+				v.add("grpc.socketMode", fmt.Sprintf("%q is not an octal file mode like \"0660\"", g.SocketMode))
+			}
+		}
+		if g.SocketUID < -1 {
+			v.add("grpc.socketUID", fmt.Sprintf("%d must be -1 or a user ID", g.SocketUID))
+		}
+		if g.SocketGID < -1 {
+			v.add("grpc.socketGID", fmt.Sprintf("%d must be -1 or a group ID", g.SocketGID))
+		}
+		if g.SELinuxLabel != "" && g.RestoreSELinuxContext {
+			v.add("grpc.selinuxLabel", "cannot be used together with restoreSELinuxContext")
+		}
+	}
+	if w := c.AllocationWebhook; w != nil && c.AllocationPolicy == "webhook" {
+		v.required("allocationWebhook.url", w.URL)
+		v.duration("allocationWebhook.timeout", w.Timeout, true)
+		v.oneOf("allocationWebhook.failurePolicy", w.FailurePolicy, failurePolicies)
+	}
+	if p := c.PodResources; p != nil && p.Enabled {
+		v.required("podResources.socket", p.Socket)
+		v.duration("podResources.timeout", p.Timeout, true)
+	}
+	if k := c.Kubernetes; k != nil && k.FabricLabels && !k.NodeAnnotations {
+		v.add("kubernetes.fabricLabels", "requires nodeAnnotations")
+	}
+	if k := c.Kubernetes; k != nil && k.Enabled && k.NodeAnnotations {
+		v.required("kubernetes.annotationPrefix", k.AnnotationPrefix)
+		v.duration("kubernetes.annotationInterval", k.AnnotationInterval, true)
+	}
+	if s := c.Shutdown; s != nil {
+		v.duration("shutdown.gracePeriod", s.GracePeriod, false)
+		v.duration("shutdown.pluginTimeout", s.PluginTimeout, false)
+		v.duration("shutdown.httpTimeout", s.HTTPTimeout, false)
+		v.duration("shutdown.nvmlTimeout", s.NvmlTimeout, false)
+		v.duration("shutdown.timeout", s.Timeout, false)
+		for i, r := range s.Resources {
+			key := fmt.Sprintf("shutdown.resources[%d]", i)
+			v.required(key+".name", r.Name)
+			if _, err := path.Match(r.Name, ""); err != nil {
+				v.add(key+".name", fmt.Sprintf("invalid pattern %q", r.Name))
+			}
+			v.duration(key+".maxSkew", r.MaxSkew, false)
+			markUnhealthy := s.MarkUnhealthy
+			if r.MarkUnhealthy != nil {
+				markUnhealthy = *r.MarkUnhealthy
+			}
+			if r.MaxSkew > 0 && markUnhealthy {
+				v.add(key+".maxSkew", "only applies when markUnhealthy is false")
+			}
+			if r.MaxSkew > 0 && s.PluginTimeout > 0 && r.MaxSkew >= s.PluginTimeout {
+				v.add(key+".maxSkew", fmt.Sprintf("%s must be less than shutdown.pluginTimeout %s", r.MaxSkew, s.PluginTimeout))
+			}
+		}
+	}
+	if s := c.Simulate; s != nil && s.Enabled && s.TopologyFile == "" {
+		v.nonNegative("simulate.count", s.Count)
+	}
+	if r := c.Registration; r != nil {
+		v.duration("registration.checkInterval", r.CheckInterval, false)
+		v.duration("registration.connectTimeout", r.ConnectTimeout, false)
+		if len(r.APIVersions) == 0 {
+			v.add("registration.apiVersions", "is required")
+		}
+		for i, version := range r.APIVersions {
+			v.oneOf(fmt.Sprintf("registration.apiVersions[%d]", i), version, apiVersions)
+		}
+		v.duration("registration.dialTimeout", r.DialTimeout, true)
+		v.duration("registration.registerTimeout", r.RegisterTimeout, true)
+		v.duration("registration.startupDeadline", r.StartupDeadline, false)
+	}
+	if i := c.Inventory; i != nil && i.Enabled {
+		v.required("inventory.path", i.Path)
+		v.duration("inventory.interval", i.Interval, true)
+	}
+	if w := c.ListAndWatch; w != nil {
+		v.duration("listAndWatch.initialDelay", w.InitialDelay, false)
+		v.duration("listAndWatch.batchWindow", w.BatchWindow, false)
+	}
+	if h := c.DeviceHealth; h != nil && h.Enabled {
+		v.duration("deviceHealth.interval", h.Interval, true)
+		v.duration("deviceHealth.checkers.ecc.interval", h.Checkers.ECC.Interval, false)
+		if s := h.Checkers.StuckProcess; s.Enabled {
+			v.duration("deviceHealth.checkers.stuckProcess.interval", s.Interval, false)
+			v.duration("deviceHealth.checkers.stuckProcess.stuckFor", s.StuckFor, true)
+		}
+	}
+	v.oneOf("healthBackend", c.HealthBackend, healthBackends)
+	if d := c.DCGM; d != nil && c.HealthBackend == "dcgm" {
+		v.required("dcgm.hostEngine", d.HostEngine)
+		v.duration("dcgm.diagInterval", d.DiagInterval, false)
+		if d.DiagInterval > 0 && (d.DiagLevel < 1 || d.DiagLevel > 4) {
+			v.add("dcgm.diagLevel", fmt.Sprintf("%d must be between 1 and 4", d.DiagLevel))
+		}
+	}
+	if t := c.Thermal; t != nil && t.Enabled {
+		v.duration("thermal.interval", t.Interval, true)
+		if t.MaxPowerPercent < 0 || t.MaxPowerPercent > 100 {
+			v.add("thermal.maxPowerPercent", fmt.Sprintf("%v must be between 0 and 100", t.MaxPowerPercent))
+		}
+	}
+	if g := c.GPUMemory; g != nil && g.Enabled {
+		v.required("gpuMemory.resourceName", g.ResourceName)
+		if g.ChunkMiB == 0 {
+			v.add("gpuMemory.chunkMiB", "must be greater than 0")
+		}
+	}
+	if m := c.MigAny; m != nil && m.Enabled {
+		v.required("migAny.resourceName", m.ResourceName)
+		if c.MigStrategy != "mixed" {
+			v.add("migAny.enabled", fmt.Sprintf("requires migStrategy mixed, got %q", c.MigStrategy))
+		}
+	}
+	if s := c.Sharing; s != nil {
+		for i, r := range s.TimeSlicing.Resources {
+			v.required(fmt.Sprintf("sharing.timeSlicing.resources[%d].name", i), r.Name)
+			if r.Replicas < 1 {
+				v.add(fmt.Sprintf("sharing.timeSlicing.resources[%d].replicas", i), fmt.Sprintf("%d must be at least 1", r.Replicas))
+			}
+			if _, err := path.Match(r.Name, ""); err != nil {
+				v.add(fmt.Sprintf("sharing.timeSlicing.resources[%d].name", i), fmt.Sprintf("invalid pattern %q", r.Name))
+			}
+		}
+	}
+	if m := c.ModeDrift; m != nil && m.Enabled {
+		v.duration("modeDrift.interval", m.Interval, true)
+		v.oneOf("modeDrift.desired.ecc", m.Desired.ECC, desiredStates)
+		v.oneOf("modeDrift.desired.mig", m.Desired.MIG, desiredStates)
+		v.oneOf("modeDrift.desired.persistence", m.Desired.Persistence, desiredStates)
+		v.oneOf("modeDrift.desired.computeMode", m.Desired.ComputeMode, computeModes)
+	}
+	if h := c.Hotplug; h != nil && h.Enabled {
+		v.duration("hotplug.interval", h.Interval, true)
+	}
+	if m := c.MigWatch; m != nil && m.Enabled {
+		v.duration("migWatch.interval", m.Interval, true)
+	}
+	if s := c.Storage; s != nil {
+		v.required("storage.backend", s.Backend)
+		if s.Backend != "memory" {
+			v.required("storage.dir", s.Dir)
+		}
+		v.duration("storage.maxAge", s.MaxAge, false)
+		v.nonNegative("storage.maxRecords", s.MaxRecords)
+		v.duration("storage.compactInterval", s.CompactInterval, true)
+	}
+	if n := c.NodeAPI; n != nil && n.Enabled {
+		v.required("nodeAPI.socket", n.Socket)
+	}
+	if p := c.Profiling; p != nil && p.Enabled {
+		v.duration("profiling.maxDuration", p.MaxDuration, false)
+	}
+	if d := c.DriverPolicy; d != nil {
+		v.oneOf("driverPolicy.action", d.Action, driverActions)
+	}
+	if d := c.DriverReadiness; d != nil && d.Enabled {
+		v.required("driverReadiness.devicePath", d.DevicePath)
+		v.duration("driverReadiness.timeout", d.Timeout, false)
+		v.duration("driverReadiness.interval", d.Interval, true)
+	}
+	if t := c.Tracing; t != nil && t.Enabled {
+		v.required("tracing.endpoint", t.Endpoint)
+		v.required("tracing.serviceName", t.ServiceName)
+		v.duration("tracing.timeout", t.Timeout, false)
+		if t.SampleRatio < 0 || t.SampleRatio > 1 {
+			v.add("tracing.sampleRatio", fmt.Sprintf("%v must be between 0 and 1", t.SampleRatio))
+		}
+	}
+	if a := c.Audit; a != nil && a.Enabled {
+		if a.File == "" && !a.Stdout {
+			v.add("audit", "enabled but neither file nor stdout is set")
+		}
+		if a.RateLimit < 0 {
+			v.add("audit.rateLimit", fmt.Sprintf("%v must not be negative", a.RateLimit))
+		}
+		v.nonNegative("audit.burst", a.Burst)
+	}
+	if d := c.DeviceAttributes; d != nil && d.Enabled {
+		v.required("deviceAttributes.prefix", d.Prefix)
+		for i, a := range d.Attributes {
+			v.oneOf(fmt.Sprintf("deviceAttributes.attributes[%d]", i), a, deviceAttributes)
+		}
+	}
+	if d := c.DeviceCache; d != nil {
+		v.duration("deviceCache.ttl", d.TTL, false)
+	}
+	if lc := c.Log; lc != nil {
+		v.oneOf("log.level", strings.ToUpper(lc.Level), logLevels)
+		v.oneOf("log.encoding", lc.Encoding, logEncodings)
+	}
+	// 未知特性或修改被锁定的特性
+	if err := feature.Validate(c.FeatureGates); err != nil {
+		v.add("featureGates", err.Error())
+	}
+	return v.err()
+}
+
+// validator 收集配置问题
+type validator struct {
+	errs []error
+}
+
+// add 记录一个问题
+func (v *validator) add(key, msg string) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", key, msg))
+}
+
+// err 汇总所有问题，没有问题时返回空
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config:\n%w", errors.Join(v.errs...))
+}
+
+// required 必填项
+func (v *validator) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(key, "is required")
+	}
+}
+
+// oneOf 枚举值
+func (v *validator) oneOf(key, value string, allowed []string) {
+	if !slices.Contains(allowed, value) {
+		v.add(key, fmt.Sprintf("%q is not one of %s", value, strings.Join(quote(allowed), ", ")))
+	}
+}
+
+// nonNegative 不能为负数
+func (v *validator) nonNegative(key string, value int) {
+	if value < 0 {
+		v.add(key, fmt.Sprintf("%d must not be negative", value))
+	}
+}
+
+// duration 时间间隔不能为负数，positive 为真时还必须大于0
+func (v *validator) duration(key string, value time.Duration, positive bool) {
+	switch {
+	case value < 0:
+		v.add(key, fmt.Sprintf("%s must not be negative", value))
+	case positive && value == 0:
+		v.add(key, "must be greater than 0")
+	}
+}
+
+// patterns 资源模式，正则表达式在加载配置时编译，避免发现设备时才失败
+func (v *validator) patterns(key string, patterns []ResourcePatternConfig) {
+	for i, p := range patterns {
+		k := fmt.Sprintf("%s[%d]", key, i)
+		v.required(k+".name", p.Name)
+		v.required(k+".pattern", p.Pattern)
+		v.oneOf(k+".patternType", p.PatternType, patternTypes)
+		if p.PatternType != "regex" {
+			continue
+		}
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			v.add(k+".pattern", fmt.Sprintf("invalid regular expression: %v", err))
+		}
+	}
+}
+
+// address 监听地址，格式为 host:port，只写端口时提示加上冒号
+func (v *validator) address(key, value string) {
+	if value == "" {
+		v.add(key, "is required")
+		return
+	}
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		if _, perr := strconv.ParseUint(value, 10, 16); perr == nil {
+			v.add(key, fmt.Sprintf("%q is missing the colon, did you mean \":%s\"?", value, value))
+			return
+		}
+		v.add(key, fmt.Sprintf("%q is not a host:port address", value))
+		return
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		v.add(key, fmt.Sprintf("invalid port %q", port))
+	}
+}
+
+// quote 给可选值加上引号，空字符串也能显示出来
+func quote(values []string) []string {
+	res := make([]string, len(values))
+	for i, s := range values {
+		res[i] = strconv.Quote(s)
+	}
+	return res
+}
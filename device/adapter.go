@@ -0,0 +1,74 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/dxgi"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+)
+
+// adapterDevice 通过DXGI发现的显示适配器，没有NVML时使用
+type adapterDevice struct {
+	dxgi.Adapter
+}
+
+// GetUUID 适配器没有UUID，使用LUID作为设备ID
+func (d adapterDevice) GetUUID() (string, error) {
+	return d.LUID, nil
+}
+
+// GetPaths 适配器的设备路径
+func (d adapterDevice) GetPaths() ([]string, error) {
+	return adapterPaths(), nil
+}
+
+// GetNumaNode DXGI不提供NUMA信息
+func (d adapterDevice) GetNumaNode() (bool, int, error) {
+	return false, 0, nil
+}
+
+// GetTotalMemory 适配器的专用显存
+func (d adapterDevice) GetTotalMemory() (uint64, error) {
+	return d.DedicatedVideoMemory, nil
+}
+
+// GetComputeCapability DXGI不提供CUDA计算能力
+func (d adapterDevice) GetComputeCapability() (string, error) {
+	return "", nil
+}
+
+// NewAdapterDeviceMap 根据DXGI枚举的NVIDIA适配器创建资源名称到设备的映射，同时返回被过滤的设备
+// 适配器不支持MIG，按适配器描述匹配资源，过滤条目可以是索引或LUID
+func NewAdapterDeviceMap(adapters []dxgi.Adapter, resources []*resource.Resource, filter Filter) (DeviceMap, []ExcludedDevice, error) {
+	devices := make(DeviceMap)
+	var excluded []ExcludedDevice
+	var unmatched []string
+	for _, a := range adapters {
+		index := fmt.Sprintf("%v", a.Index)
+		if reason := filter.reason(deviceIdentity{index: index, uuid: a.LUID}); reason != "" {
+			excluded = append(excluded, ExcludedDevice{Index: index, UUID: a.LUID, Name: a.Description, Reason: reason})
+			continue
+		}
+		matched := false
+		for _, r := range resources {
+			if r.Matches(a.Description) {
+				if err := devices.setEntry(r.Name, index, a.Description, adapterDevice{a}, nil); err != nil {
+					return nil, nil, err
+				}
+				matched = true
+				break
+			}
+		}
+		switch {
+		case matched:
+		case filter.SkipUnmatched:
+			excluded = append(excluded, ExcludedDevice{Index: index, UUID: a.LUID, Name: a.Description, Reason: ReasonUnmatched})
+		default:
+			unmatched = append(unmatched, a.Description)
+		}
+	}
+	if len(unmatched) > 0 {
+		return nil, nil, unmatchedError("GPU names", unmatched, resources)
+	}
+	return devices, excluded, nil
+}
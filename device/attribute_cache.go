@@ -0,0 +1,141 @@
+package device
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// AttributeCache 按UUID缓存设备的静态属性和NVML句柄，减少重复发现设备和按UUID查询时的NVML调用
+// 设备的路径、NUMA节点、显存、算力和PCIe拓扑在驱动不变时不会变化，超过TTL或重启插件时重新查询；nil 表示不缓存
+type AttributeCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*attributeEntry
+	hits    uint64
+	misses  uint64
+}
+
+// attributeEntry 缓存的设备属性，device 和 handle 分别在第一次构建设备和查询句柄时填充
+type attributeEntry struct {
+	device  *Device
+	handle  nvml.Device
+	expires time.Time
+}
+
+// AttributeCacheStats 缓存的使用情况
+type AttributeCacheStats struct {
+	TTL     time.Duration `json:"ttl"`
+	Entries int           `json:"entries"`
+	Hits    uint64        `json:"hits"`
+	Misses  uint64        `json:"misses"`
+}
+
+// NewAttributeCache 创建设备属性缓存，ttl 为0时不缓存并返回nil
+func NewAttributeCache(ttl time.Duration) *AttributeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &AttributeCache{ttl: ttl, entries: make(map[string]*attributeEntry)}
+}
+
+// entry 未过期的缓存项，没有时创建，调用方持有锁
+func (c *AttributeCache) entry(uuid string) *attributeEntry {
+	now := time.Now()
+	e, ok := c.entries[uuid]
+	if !ok || now.After(e.expires) {
+		e = &attributeEntry{expires: now.Add(c.ttl)}
+		c.entries[uuid] = e
+	}
+	return e
+}
+
+// BuildDevice 与 BuildDevice 相同，缓存命中时只查询UUID，索引和健康状态总是使用本次发现的值
+func (c *AttributeCache) BuildDevice(index string, d deviceInfo) (*Device, error) {
+	if c == nil {
+		return BuildDevice(index, d)
+	}
+	uuid, err := d.GetUUID()
+	if err != nil {
+		return nil, fmt.Errorf("error getting UUID device: %v", err)
+	}
+	c.mu.Lock()
+	cached := c.entry(uuid).device
+	if cached != nil {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+	if cached != nil {
+		return cached.clone(index), nil
+	}
+	dev, err := BuildDevice(index, d)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entry(uuid).device = dev.clone(index)
+	c.mu.Unlock()
+	return dev, nil
+}
+
+// Handle 按UUID获取NVML句柄，MIG设备返回MIG设备的句柄
+func (c *AttributeCache) Handle(nvmllib nvml.Interface, uuid string) (nvml.Device, nvml.Return) {
+	if c == nil {
+		return nvmllib.DeviceGetHandleByUUID(uuid)
+	}
+	c.mu.Lock()
+	handle := c.entry(uuid).handle
+	if handle != nil {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+	if handle != nil {
+		return handle, nvml.SUCCESS
+	}
+	handle, ret := nvmllib.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, ret
+	}
+	c.mu.Lock()
+	c.entry(uuid).handle = handle
+	c.mu.Unlock()
+	return handle, nvml.SUCCESS
+}
+
+// Invalidate 清空缓存，重启插件、MIG配置或GPU变化时调用
+func (c *AttributeCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*attributeEntry)
+}
+
+// Stats 缓存的使用情况，未开启缓存时返回空
+func (c *AttributeCache) Stats() AttributeCacheStats {
+	if c == nil {
+		return AttributeCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return AttributeCacheStats{TTL: c.ttl, Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
+
+// clone 复制设备属性，使用新的索引并重置健康状态
+func (d *Device) clone(index string) *Device {
+	res := *d
+	res.Index = index
+	res.Health = pluginapi.Healthy
+	res.Paths = slices.Clone(d.Paths)
+	res.PCIePath = slices.Clone(d.PCIePath)
+	return &res
+}
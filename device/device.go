@@ -1,36 +1,32 @@
 package device
 
 import (
-	"bytes"
 	"fmt"
-	"os"
-	"strconv"
+	"math/bits"
 	"strings"
 
-	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 )
 
-// NVIDIA 相关的常量
-const (
-	nvidiaProcDriverPath   = "/proc/driver/nvidia"
-	nvidiaCapabilitiesPath = nvidiaProcDriverPath + "/capabilities"
-)
-
 // device wraps a nvml.Device to provide device specific functions.
 type nvmlDevice struct {
 	nvml.Device
+	// simulated is set for devices of a simulated NVML library, which have no
+	// device nodes or MIG capabilities on the host.
+	simulated bool
+	// fabric is set when NVML provides GPU fabric info (multi-node NVLink).
+	fabric bool
 }
 
 // nvmlMigDevice wraps a nvml.Device to provide MIG specific functions.
 type nvmlMigDevice nvmlDevice
 
-func newGPUDevice(i int, gpu nvml.Device) (string, nvmlDevice) {
-	return fmt.Sprintf("%v", i), nvmlDevice{gpu}
+func newGPUDevice(i int, gpu nvml.Device, simulated bool) (string, nvmlDevice) {
+	return fmt.Sprintf("%v", i), nvmlDevice{Device: gpu, simulated: simulated}
 }
 
-func newMigDevice(i int, j int, mig nvml.Device) (string, nvmlMigDevice) {
-	return fmt.Sprintf("%v:%v", i, j), nvmlMigDevice{mig}
+func newMigDevice(i int, j int, mig nvml.Device, simulated bool) (string, nvmlMigDevice) {
+	return fmt.Sprintf("%v:%v", i, j), nvmlMigDevice{Device: mig, simulated: simulated}
 }
 
 // GetUUID returns the UUID of the device
@@ -42,20 +38,6 @@ func (d nvmlDevice) GetUUID() (string, error) {
 	return uuid, nil
 }
 
-// GetPaths returns the paths for a GPU device
-func (d nvmlDevice) GetPaths() ([]string, error) {
-	isWsl, _ := info.New().HasDXCore()
-	if isWsl {
-		return []string{"/dev/dxg"}, nil
-	}
-	minor, ret := d.GetMinorNumber()
-	if ret != nvml.SUCCESS {
-		return nil, fmt.Errorf("error getting GPU device minor number: %v", ret)
-	}
-	path := fmt.Sprintf("/dev/nvidia%d", minor)
-	return []string{path}, nil
-}
-
 // GetComputeCapability returns the CUDA Compute Capability for the device.
 func (d nvmlDevice) GetComputeCapability() (string, error) {
 	major, minor, ret := d.Device.GetCudaComputeCapability()
@@ -67,29 +49,46 @@ func (d nvmlDevice) GetComputeCapability() (string, error) {
 
 // GetNumaNode returns the NUMA node associated with the GPU device
 func (d nvmlDevice) GetNumaNode() (bool, int, error) {
+	hasNuma, node, _, err := d.GetNumaNodeInfo()
+	return hasNuma, node, err
+}
+
+// GetNumaNodeInfo returns the NUMA node associated with the GPU device and a
+// warning when it could not be read from sysfs.
+func (d nvmlDevice) GetNumaNodeInfo() (bool, int, string, error) {
+	busID, err := d.busID()
+	if err != nil {
+		return false, 0, "", err
+	}
+	return d.getNumaNodeFromBusID(busID)
+}
+
+// busID returns the PCI bus ID of the device in the sysfs format (0000:3b:00.0).
+func (d nvmlDevice) busID() (string, error) {
 	info, ret := d.GetPciInfo()
 	if ret != nvml.SUCCESS {
-		return false, 0, fmt.Errorf("error getting PCI Bus Info of device: %v", ret)
+		return "", fmt.Errorf("error getting PCI Bus Info of device: %v", ret)
 	}
 
 	// Discard leading zeros.
-	busID := strings.ToLower(strings.TrimPrefix(int8Slice(info.BusId[:]).String(), "0000"))
+	return strings.ToLower(strings.TrimPrefix(int8Slice(info.BusId[:]).String(), "0000")), nil
+}
 
-	b, err := os.ReadFile(fmt.Sprintf("/sys/bus/pci/devices/%s/numa_node", busID))
-	if err != nil {
+// getNumaNodeFromMemoryAffinity falls back to the NVML memory affinity when
+// sysfs is not available (e.g. a simulated device or a Windows host).
+func (d nvmlDevice) getNumaNodeFromMemoryAffinity() (bool, int, error) {
+	const nodeSetSize = 4
+	nodeSet, ret := d.GetMemoryAffinity(nodeSetSize, nvml.AFFINITY_SCOPE_NODE)
+	if ret != nvml.SUCCESS {
 		return false, 0, nil
 	}
-
-	node, err := strconv.Atoi(string(bytes.TrimSpace(b)))
-	if err != nil {
-		return false, 0, fmt.Errorf("eror parsing value for NUMA node: %v", err)
-	}
-
-	if node < 0 {
-		return false, 0, nil
+	for i, word := range nodeSet {
+		if word == 0 {
+			continue
+		}
+		return true, i*bits.UintSize + bits.TrailingZeros(word), nil
 	}
-
-	return true, node, nil
+	return false, 0, nil
 }
 
 // GetTotalMemory returns the total memory available on the device.
@@ -112,63 +111,23 @@ func (d nvmlMigDevice) GetComputeCapability() (string, error) {
 	if ret != nvml.SUCCESS {
 		return "", fmt.Errorf("failed to get parent device: %w", ret)
 	}
-	return nvmlDevice{parent}.GetComputeCapability()
+	return nvmlDevice{Device: parent, simulated: d.simulated}.GetComputeCapability()
 }
 
 // GetNumaNode for a MIG device is the NUMA node of the parent device.
 func (d nvmlMigDevice) GetNumaNode() (bool, int, error) {
-	parent, ret := d.GetDeviceHandleFromMigDeviceHandle()
-	if ret != nvml.SUCCESS {
-		return false, 0, fmt.Errorf("error getting parent GPU device from MIG device: %v", ret)
-	}
-
-	return nvmlDevice{parent}.GetNumaNode()
+	hasNuma, node, _, err := d.GetNumaNodeInfo()
+	return hasNuma, node, err
 }
 
-// GetPaths returns the paths for a MIG device
-func (d nvmlMigDevice) GetPaths() ([]string, error) {
-	capDevicePaths, err := GetMigCapabilityDevicePaths()
-	if err != nil {
-		return nil, fmt.Errorf("error getting MIG capability device paths: %v", err)
-	}
-
-	gi, ret := d.GetGpuInstanceId()
-	if ret != nvml.SUCCESS {
-		return nil, fmt.Errorf("error getting GPU Instance ID: %v", ret)
-	}
-
-	ci, ret := d.GetComputeInstanceId()
-	if ret != nvml.SUCCESS {
-		return nil, fmt.Errorf("error getting Compute Instance ID: %v", ret)
-	}
-
+// GetNumaNodeInfo for a MIG device is the NUMA node info of the parent device.
+func (d nvmlMigDevice) GetNumaNodeInfo() (bool, int, string, error) {
 	parent, ret := d.GetDeviceHandleFromMigDeviceHandle()
 	if ret != nvml.SUCCESS {
-		return nil, fmt.Errorf("error getting parent device: %v", ret)
-	}
-	minor, ret := parent.GetMinorNumber()
-	if ret != nvml.SUCCESS {
-		return nil, fmt.Errorf("error getting GPU device minor number: %v", ret)
+		return false, 0, "", fmt.Errorf("error getting parent GPU device from MIG device: %v", ret)
 	}
-	parentPath := fmt.Sprintf("/dev/nvidia%d", minor)
 
-	giCapPath := fmt.Sprintf(nvidiaCapabilitiesPath+"/gpu%d/mig/gi%d/access", minor, gi)
-	if _, exists := capDevicePaths[giCapPath]; !exists {
-		return nil, fmt.Errorf("missing MIG GPU instance capability path: %v", giCapPath)
-	}
-
-	ciCapPath := fmt.Sprintf(nvidiaCapabilitiesPath+"/gpu%d/mig/gi%d/ci%d/access", minor, gi, ci)
-	if _, exists := capDevicePaths[ciCapPath]; !exists {
-		return nil, fmt.Errorf("missing MIG GPU instance capability path: %v", giCapPath)
-	}
-
-	devicePaths := []string{
-		parentPath,
-		capDevicePaths[giCapPath],
-		capDevicePaths[ciCapPath],
-	}
-
-	return devicePaths, nil
+	return nvmlDevice{Device: parent, simulated: d.simulated}.GetNumaNodeInfo()
 }
 
 // GetTotalMemory returns the total memory available on the device.
@@ -180,6 +139,11 @@ func (d nvmlMigDevice) GetTotalMemory() (uint64, error) {
 	return info.Total, nil
 }
 
+// PCIBusID returns the PCI bus ID reported by NVML (e.g. 00000000:3B:00.0).
+func PCIBusID(info nvml.PciInfo) string {
+	return int8Slice(info.BusId[:]).String()
+}
+
 // int8Slice wraps an []int8 with more functions.
 type int8Slice []int8
 
@@ -0,0 +1,126 @@
+package device
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// NVIDIA 相关的常量
+const (
+	nvidiaProcDriverPath   = "/proc/driver/nvidia"
+	nvidiaCapabilitiesPath = nvidiaProcDriverPath + "/capabilities"
+)
+
+// GetPaths returns the paths for a GPU device
+func (d nvmlDevice) GetPaths() ([]string, error) {
+	isWsl, _ := info.New().HasDXCore()
+	if isWsl {
+		return []string{"/dev/dxg"}, nil
+	}
+	minor, ret := d.GetMinorNumber()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting GPU device minor number: %v", ret)
+	}
+	path := fmt.Sprintf("/dev/nvidia%d", minor)
+	return []string{path}, nil
+}
+
+// GetPaths returns the paths for a MIG device
+func (d nvmlMigDevice) GetPaths() ([]string, error) {
+	// Simulated MIG devices only expose the parent device node.
+	if d.simulated {
+		parent, ret := d.GetDeviceHandleFromMigDeviceHandle()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting parent device: %v", ret)
+		}
+		return nvmlDevice{Device: parent, simulated: d.simulated}.GetPaths()
+	}
+
+	capDevicePaths, err := GetMigCapabilityDevicePaths()
+	if err != nil {
+		return nil, fmt.Errorf("error getting MIG capability device paths: %v", err)
+	}
+
+	gi, ret := d.GetGpuInstanceId()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting GPU Instance ID: %v", ret)
+	}
+
+	ci, ret := d.GetComputeInstanceId()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting Compute Instance ID: %v", ret)
+	}
+
+	parent, ret := d.GetDeviceHandleFromMigDeviceHandle()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting parent device: %v", ret)
+	}
+	minor, ret := parent.GetMinorNumber()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting GPU device minor number: %v", ret)
+	}
+	parentPath := fmt.Sprintf("/dev/nvidia%d", minor)
+
+	giCapPath := fmt.Sprintf(nvidiaCapabilitiesPath+"/gpu%d/mig/gi%d/access", minor, gi)
+	if _, exists := capDevicePaths[giCapPath]; !exists {
+		return nil, fmt.Errorf("missing MIG GPU instance capability path: %v", giCapPath)
+	}
+
+	ciCapPath := fmt.Sprintf(nvidiaCapabilitiesPath+"/gpu%d/mig/gi%d/ci%d/access", minor, gi, ci)
+	if _, exists := capDevicePaths[ciCapPath]; !exists {
+		return nil, fmt.Errorf("missing MIG GPU instance capability path: %v", giCapPath)
+	}
+
+	devicePaths := []string{
+		parentPath,
+		capDevicePaths[giCapPath],
+		capDevicePaths[ciCapPath],
+	}
+
+	return devicePaths, nil
+}
+
+// getNumaNodeFromBusID reads the NUMA node of the PCI device from sysfs.
+// When sysfs is not readable (e.g. masked /sys in a restricted container)
+// the NVML memory affinity is used instead and a warning describes why.
+func (d nvmlDevice) getNumaNodeFromBusID(busID string) (bool, int, string, error) {
+	path := SysfsPath("bus", "pci", "devices", busID, "numa_node")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		hasNuma, node, aerr := d.getNumaNodeFromMemoryAffinity()
+		if aerr != nil || d.simulated {
+			return hasNuma, node, "", aerr
+		}
+		return hasNuma, node, numaFallbackWarning(path, err, hasNuma, node), nil
+	}
+
+	node, err := strconv.Atoi(string(bytes.TrimSpace(b)))
+	if err != nil {
+		return false, 0, "", fmt.Errorf("eror parsing value for NUMA node: %v", err)
+	}
+
+	if node < 0 {
+		return false, 0, "", nil
+	}
+
+	return true, node, "", nil
+}
+
+// numaFallbackWarning describes a NUMA node that could not be read from sysfs.
+func numaFallbackWarning(path string, err error, hasNuma bool, node int) string {
+	if hasNuma {
+		return fmt.Sprintf("cannot read %s (%v), NUMA node %d taken from the NVML memory affinity", path, err, node)
+	}
+	return fmt.Sprintf("cannot read %s (%v) and NVML reports no memory affinity, NUMA node unknown", path, err)
+}
+
+// adapterPaths returns the paths for a DXGI adapter, which is only
+// reachable through the WSL DirectX device on Linux.
+func adapterPaths() []string {
+	return []string{"/dev/dxg"}
+}
@@ -2,10 +2,12 @@ package device
 
 import (
 	"fmt"
-	"regexp"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
 
 	"github.com/NVIDIA/go-nvlib/pkg/nvlib/device"
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
@@ -15,19 +17,43 @@ type deviceMapBuilder struct {
 	device.Interface
 	migStrategy string
 	resources   []*resource.Resource
+	simulated   bool
+	fabric      bool
+	filter      Filter
+	cache       *AttributeCache
+	excluded    []ExcludedDevice
+	// pending : 匹配到资源、等待查询属性的设备
+	pending []pendingEntry
+}
+
+// maxDiscoveryWorkers 并发查询设备属性的最大数量，NVML查询是线程安全的
+const maxDiscoveryWorkers = 8
+
+// pendingEntry 等待查询属性的设备
+type pendingEntry struct {
+	name    resource.ResourceName
+	index   string
+	product string
+	info    deviceInfo
 }
 
 // DeviceMap 存储每个资源名称的设备集
 type DeviceMap map[string]Devices
 
-// NewDeviceMap 为指定的 NVML 库和配置创建设备映射
-func NewDeviceMap(nvmllib nvml.Interface, resources []*resource.Resource, migStrategy string) (DeviceMap, error) {
+// NewDeviceMap 为指定的 NVML 库和配置创建设备映射，同时返回被过滤规则排除的设备
+// cache 不为空时从缓存读取设备的静态属性
+func NewDeviceMap(nvmllib nvml.Interface, resources []*resource.Resource, migStrategy string, filter Filter, cache *AttributeCache) (DeviceMap, []ExcludedDevice, error) {
 	b := deviceMapBuilder{
 		Interface:   device.New(nvmllib),
 		resources:   resources,
 		migStrategy: migStrategy,
+		simulated:   simulate.IsSimulated(nvmllib),
+		fabric:      hasFabricInfo(nvmllib),
+		filter:      filter,
+		cache:       cache,
 	}
-	return b.build()
+	devices, err := b.build()
+	return devices, b.excluded, err
 }
 
 // 资源名称与设备的映射
@@ -36,7 +62,7 @@ func (b *deviceMapBuilder) build() (DeviceMap, error) {
 	case resource.MigStrategyNone:
 		return b.buildGPUDeviceMap()
 	case resource.MigStrategySingle:
-		return b.buildGPUDeviceMap()
+		return b.buildSingleDeviceMap()
 	case resource.MigStrategyMixed:
 		return b.buildMigDeviceMap()
 	default:
@@ -47,11 +73,15 @@ func (b *deviceMapBuilder) build() (DeviceMap, error) {
 // 构建资源名称到 GPU 设备的映射
 func (b *deviceMapBuilder) buildGPUDeviceMap() (DeviceMap, error) {
 	devices := make(DeviceMap)
+	var unmatched []string
 	err := b.VisitDevices(func(i int, gpu device.Device) error {
 		name, ret := gpu.GetName()
 		if ret != nvml.SUCCESS {
 			return fmt.Errorf("error getting product name for GPU: %v", ret)
 		}
+		if excluded, err := b.exclude(name, i, gpu); excluded || err != nil {
+			return err
+		}
 		migEnabled, err := gpu.IsMigEnabled()
 		if err != nil {
 			return fmt.Errorf("error checking if MIG is enabled on GPU: %v", err)
@@ -60,66 +90,240 @@ func (b *deviceMapBuilder) buildGPUDeviceMap() (DeviceMap, error) {
 			return nil
 		}
 		for _, resource := range b.resources {
-			b, err := regexp.MatchString(wildCardToRegexp(string(resource.Pattern)), name)
-			if err != nil {
-				return fmt.Errorf("error matching resource pattern: %v", err)
+			if resource.Matches(name) {
+				index, info := newGPUDevice(i, gpu, b.simulated)
+				info.fabric = b.fabric
+				b.add(resource.Name, index, name, info)
+				return nil
 			}
-			if b {
-				index, info := newGPUDevice(i, gpu)
-				return devices.setEntry(resource.Name, index, info)
+		}
+		if b.filter.SkipUnmatched {
+			id, err := newDeviceIdentity(i, gpu)
+			if err != nil {
+				return err
 			}
+			b.record(name, id, ReasonUnmatched)
+			return nil
+		}
+		unmatched = append(unmatched, name)
+		return nil
+	})
+	if err == nil && len(unmatched) > 0 {
+		err = unmatchedError("GPU names", unmatched, b.resources)
+	}
+	if err == nil {
+		err = b.buildEntries(devices)
+	}
+	return devices, err
+}
+
+// 构建 single 策略下的设备映射
+// 所有GPU都未开启MIG时与 none 策略相同；全部开启MIG且MIG设备配置相同时，以GPU资源名称提供MIG设备；其它情况返回错误
+func (b *deviceMapBuilder) buildSingleDeviceMap() (DeviceMap, error) {
+	var enabled, disabled []int
+	err := b.VisitDevices(func(i int, gpu device.Device) error {
+		migEnabled, err := gpu.IsMigEnabled()
+		if err != nil {
+			return fmt.Errorf("error checking if MIG is enabled on GPU %d: %v", i, err)
+		}
+		if migEnabled {
+			enabled = append(enabled, i)
+		} else {
+			disabled = append(disabled, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(enabled) == 0 {
+		return b.buildGPUDeviceMap()
+	}
+	if len(disabled) > 0 {
+		return nil, fmt.Errorf("mig-strategy single requires MIG to be enabled on all GPUs or none, but MIG is enabled on GPUs %v and disabled on GPUs %v", enabled, disabled)
+	}
+	if len(b.resources) == 0 {
+		return nil, fmt.Errorf("mig-strategy single requires a GPU resource")
+	}
+
+	profiles := make(map[string][]string)
+	err = b.VisitMigDevices(func(i int, d device.Device, j int, mig device.MigDevice) error {
+		migProfile, err := mig.GetProfile()
+		if err != nil {
+			return fmt.Errorf("error getting MIG profile for MIG device at index '(%v, %v)': %v", i, j, err)
+		}
+		profiles[migProfile.String()] = append(profiles[migProfile.String()], fmt.Sprintf("%v:%v", i, j))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch len(profiles) {
+	case 0:
+		return nil, fmt.Errorf("mig-strategy single requires MIG devices, but MIG is enabled on GPUs %v without any MIG devices configured", enabled)
+	case 1:
+	default:
+		return nil, fmt.Errorf("mig-strategy single requires all MIG devices to use the same profile, found %v", profiles)
+	}
+
+	devices := make(DeviceMap)
+	resourceName := b.resources[0].Name
+	err = b.VisitMigDevices(func(i int, d device.Device, j int, mig device.MigDevice) error {
+		migProfile, err := mig.GetProfile()
+		if err != nil {
+			return fmt.Errorf("error getting MIG profile for MIG device at index '(%v, %v)': %v", i, j, err)
+		}
+		if excluded, err := b.excludeMig(migProfile.String(), i, d, j, mig); excluded || err != nil {
+			return err
 		}
-		return fmt.Errorf("GPU name '%v' does not match any resource patterns", name)
+		index, info := newMigDevice(i, j, mig, b.simulated)
+		info.fabric = b.fabric
+		b.add(resourceName, index, migProfile.String(), info)
+		return nil
 	})
+	if err == nil {
+		err = b.buildEntries(devices)
+	}
 	return devices, err
 }
 
 // 构建资源名称到 MIG 设备的映射
 func (b *deviceMapBuilder) buildMigDeviceMap() (DeviceMap, error) {
 	devices := make(DeviceMap)
+	var unmatched []string
 	err := b.VisitMigDevices(func(i int, d device.Device, j int, mig device.MigDevice) error {
 		migProfile, err := mig.GetProfile()
 		if err != nil {
 			return fmt.Errorf("error getting MIG profile for MIG device at index '(%v, %v)': %v", i, j, err)
 		}
+		if excluded, err := b.excludeMig(migProfile.String(), i, d, j, mig); excluded || err != nil {
+			return err
+		}
 		for _, resource := range b.resources {
-			b, err := regexp.MatchString(wildCardToRegexp(string(resource.Pattern)), migProfile.String())
-			if err != nil {
-				return fmt.Errorf("error matching resource pattern: %v", err)
-			}
-			if b {
-				index, info := newMigDevice(i, j, mig)
-				return devices.setEntry(resource.Name, index, info)
+			if resource.Matches(migProfile.String()) {
+				index, info := newMigDevice(i, j, mig, b.simulated)
+				info.fabric = b.fabric
+				b.add(resource.Name, index, migProfile.String(), info)
+				return nil
 			}
 		}
-		return fmt.Errorf("MIG profile '%v' does not match any resource patterns", migProfile)
+		unmatched = append(unmatched, migProfile.String())
+		return nil
 	})
+	if err == nil && len(unmatched) > 0 {
+		err = unmatchedError("MIG profiles", unmatched, b.resources)
+	}
+	if err == nil {
+		err = b.buildEntries(devices)
+	}
 	return devices, err
 }
 
-// 设置 DeviceMap
-func (d DeviceMap) setEntry(name resource.ResourceName, index string, device deviceInfo) error {
-	dev, err := BuildDevice(index, device)
+// unmatchedError 列出节点上没有匹配任何资源模式的名称和所有模式，便于修改 resources 配置
+func unmatchedError(kind string, names []string, resources []*resource.Resource) error {
+	slices.Sort(names)
+	names = slices.Compact(names)
+	patterns := make([]string, len(resources))
+	for i, r := range resources {
+		patterns[i] = fmt.Sprintf("%q (%s)", r.Pattern, r.Name)
+	}
+	return fmt.Errorf("%s %q discovered on the node do not match any resource patterns [%s]", kind, names, strings.Join(patterns, ", "))
+}
+
+// exclude 检查GPU是否被过滤，被过滤时记录原因
+func (b *deviceMapBuilder) exclude(name string, i int, gpu nvml.Device) (bool, error) {
+	if b.filter.Empty() {
+		return false, nil
+	}
+	id, err := newDeviceIdentity(i, gpu)
 	if err != nil {
-		return fmt.Errorf("error building Device: %v", err)
+		return false, err
 	}
-	if d[string(name)] == nil {
-		d[string(name)] = make(Devices)
+	return b.record(name, id, b.filter.reason(id)), nil
+}
+
+// excludeMig 检查MIG设备是否被过滤，父GPU或MIG设备自身匹配规则都会生效
+func (b *deviceMapBuilder) excludeMig(name string, i int, parent nvml.Device, j int, mig nvml.Device) (bool, error) {
+	if b.filter.Empty() {
+		return false, nil
 	}
-	d[string(name)][dev.ID] = dev
-	return nil
+	parentID, err := newDeviceIdentity(i, parent)
+	if err != nil {
+		return false, err
+	}
+	uuid, ret := mig.GetUUID()
+	if ret != nvml.SUCCESS {
+		return false, fmt.Errorf("error getting UUID of MIG device at index '(%v, %v)': %v", i, j, ret)
+	}
+	id := deviceIdentity{index: fmt.Sprintf("%v:%v", i, j), uuid: uuid, pciBusID: parentID.pciBusID}
+	return b.record(name, id, b.filter.reason(parentID, id)), nil
+}
+
+// record 记录被过滤的设备，reason为空表示不过滤
+func (b *deviceMapBuilder) record(name string, id deviceIdentity, reason string) bool {
+	if reason == "" {
+		return false
+	}
+	b.excluded = append(b.excluded, ExcludedDevice{
+		Index:    id.index,
+		UUID:     id.uuid,
+		PCIBusID: id.pciBusID,
+		Name:     name,
+		Reason:   reason,
+	})
+	return true
 }
 
-// 将通配符模式转换为正则表达式形式
-func wildCardToRegexp(pattern string) string {
-	var result strings.Builder
-	for i, literal := range strings.Split(pattern, "*") {
-		// 将 * 替换为 .*
-		if i > 0 {
-			result.WriteString(".*")
+// add 记录匹配到资源的设备，遍历完成后由 buildEntries 并发查询属性
+func (b *deviceMapBuilder) add(name resource.ResourceName, index, product string, info deviceInfo) {
+	b.pending = append(b.pending, pendingEntry{name: name, index: index, product: product, info: info})
+}
+
+// buildEntries 并发查询等待中的设备的属性并写入 DeviceMap，GPU和MIG设备较多的节点上逐个查询NVML耗时较长
+// 有设备失败时按遍历顺序返回第一个错误
+func (b *deviceMapBuilder) buildEntries(devices DeviceMap) error {
+	pending := b.pending
+	b.pending = nil
+	built := make([]*Device, len(pending))
+	errs := make([]error, len(pending))
+	sem := make(chan struct{}, maxDiscoveryWorkers)
+	var wg sync.WaitGroup
+	for i, e := range pending {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, e pendingEntry) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			built[i], errs[i] = b.cache.BuildDevice(e.index, e.info)
+		}(i, e)
+	}
+	wg.Wait()
+	for i, e := range pending {
+		if errs[i] != nil {
+			return fmt.Errorf("error building Device: %v", errs[i])
 		}
-		// 在文本中引用任何正则表达式字符
-		result.WriteString(regexp.QuoteMeta(literal))
+		devices.put(e.name, e.product, built[i])
 	}
-	return result.String()
+	return nil
+}
+
+// 设置 DeviceMap，product 为GPU产品名称或MIG配置名称
+func (d DeviceMap) setEntry(name resource.ResourceName, index, product string, device deviceInfo, cache *AttributeCache) error {
+	dev, err := cache.BuildDevice(index, device)
+	if err != nil {
+		return fmt.Errorf("error building Device: %v", err)
+	}
+	d.put(name, product, dev)
+	return nil
+}
+
+// put 把已查询属性的设备写入 DeviceMap
+func (d DeviceMap) put(name resource.ResourceName, product string, dev *Device) {
+	dev.Product = product
+	if d[string(name)] == nil {
+		d[string(name)] = make(Devices)
+	}
+	d[string(name)][dev.ID] = dev
 }
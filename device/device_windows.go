@@ -0,0 +1,37 @@
+package device
+
+import (
+	"fmt"
+)
+
+// WindowsDisplayAdapterClassPath 显示适配器设备接口类GUID，
+// Windows容器通过 class/<GUID> 形式的设备路径挂载GPU
+const WindowsDisplayAdapterClassPath = "class/5B45201D-F2F2-4F3B-85BB-30FF1F953599"
+
+// GetPaths returns the paths for a GPU device. Windows containers are given
+// GPUs through the display adapter device interface class.
+func (d nvmlDevice) GetPaths() ([]string, error) {
+	return []string{WindowsDisplayAdapterClassPath}, nil
+}
+
+// GetPaths returns the paths for a MIG device. MIG is not supported on
+// Windows, except for simulated devices which expose the parent device.
+func (d nvmlMigDevice) GetPaths() ([]string, error) {
+	if d.simulated {
+		return []string{WindowsDisplayAdapterClassPath}, nil
+	}
+	return nil, fmt.Errorf("MIG devices are not supported on Windows")
+}
+
+// getNumaNodeFromBusID uses the NVML memory affinity since sysfs is not
+// available on Windows.
+func (d nvmlDevice) getNumaNodeFromBusID(string) (bool, int, string, error) {
+	hasNuma, node, err := d.getNumaNodeFromMemoryAffinity()
+	return hasNuma, node, "", err
+}
+
+// adapterPaths returns the paths for a DXGI adapter, which is mounted
+// through the display adapter device interface class like NVML GPUs.
+func adapterPaths() []string {
+	return []string{WindowsDisplayAdapterClassPath}
+}
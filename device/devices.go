@@ -24,8 +24,23 @@ type Device struct {
 	Index             string
 	TotalMemory       uint64
 	ComputeCapability string
+	// Product GPU的产品名称，MIG设备为MIG配置名称，如 1g.10gb
+	Product string
 	// Replicas 存储此设备复制的总次数。如果这是 0 或 1，则设备不共享
 	Replicas int
+	// Clique 多节点NVLink的fabric clique，格式为 <clusterUUID>.<cliqueID>，不支持时为空
+	Clique string
+	// PCIePath 从根复合体到GPU的PCIe路径，用于计算与RDMA网卡的距离，无法读取sysfs时为空
+	PCIePath []string
+	// NIC PCIe拓扑上距离最近的RDMA网卡，没有时为空
+	NIC string
+	// NUMAWarning 无法从sysfs读取NUMA节点时的说明，此时NUMA节点来自NVML内存亲和性或未知
+	NUMAWarning string
+}
+
+// numaInfo 可选接口，返回NUMA节点的同时说明无法从sysfs读取的原因
+type numaInfo interface {
+	GetNumaNodeInfo() (bool, int, string, error)
 }
 
 // Devices 包装了一个 map[string]*Device 与一些函数
@@ -49,7 +64,14 @@ func BuildDevice(index string, d deviceInfo) (*Device, error) {
 		return nil, fmt.Errorf("error getting device paths: %v", err)
 	}
 
-	hasNuma, numa, err := d.GetNumaNode()
+	var hasNuma bool
+	var numa int
+	var numaWarning string
+	if n, ok := d.(numaInfo); ok {
+		hasNuma, numa, numaWarning, err = n.GetNumaNodeInfo()
+	} else {
+		hasNuma, numa, err = d.GetNumaNode()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error getting device NUMA node: %v", err)
 	}
@@ -67,6 +89,20 @@ func BuildDevice(index string, d deviceInfo) (*Device, error) {
 	dev := Device{
 		TotalMemory:       totalMemory,
 		ComputeCapability: computeCapability,
+		NUMAWarning:       numaWarning,
+	}
+	// fabric clique 只影响调度偏好，获取失败时视为不在fabric中
+	if c, ok := d.(cliqueInfo); ok {
+		if clique, err := c.GetClique(); err == nil {
+			dev.Clique = clique
+		}
+	}
+	// PCIe拓扑同样只影响调度偏好
+	if p, ok := d.(pcieInfo); ok {
+		if path, err := p.GetPCIePath(); err == nil && path != nil {
+			dev.PCIePath = path
+			dev.NIC = ClosestNIC(path, RDMANICs())
+		}
 	}
 	dev.ID = uuid
 	dev.Index = index
@@ -155,7 +191,56 @@ func (ds Devices) GetUUIDs() []string {
 	return res
 }
 
-// GetPluginDevices 获取所有设备的pluginapi.Device
+// Capacity 设备集的物理设备数和对外提供的可调度单元数
+// 分时共享时一个物理设备以多个副本对外提供，基于节点容量的扩缩容逻辑应使用物理设备数
+type Capacity struct {
+	// Physical : 物理设备数，同一设备的副本只计一次
+	Physical int `json:"physical"`
+	// Schedulable : 对外提供的可调度单元数，包含所有副本
+	Schedulable int `json:"schedulable"`
+	// HealthyPhysical : 至少有一个健康副本的物理设备数
+	HealthyPhysical int `json:"healthyPhysical"`
+	// HealthySchedulable : 健康的可调度单元数
+	HealthySchedulable int `json:"healthySchedulable"`
+}
+
+// ReplicaRatio 每个物理设备平均对外提供的可调度单元数，没有设备时返回0
+func (c Capacity) ReplicaRatio() float64 {
+	if c.Physical == 0 {
+		return 0
+	}
+	return float64(c.Schedulable) / float64(c.Physical)
+}
+
+// GetCapacity 统计设备集的物理设备数和可调度单元数
+func (ds Devices) GetCapacity() Capacity {
+	return CapacityOf(ds.GetPluginDevices())
+}
+
+// CapacityOf 根据推送给kubelet的设备列表统计物理设备数和可调度单元数
+func CapacityOf(devices []*pluginapi.Device) Capacity {
+	var c Capacity
+	physical := make(map[string]bool)
+	for _, d := range devices {
+		uuid := AnnotatedID(d.ID).GetID()
+		healthy := d.Health == pluginapi.Healthy
+		c.Schedulable++
+		if healthy {
+			c.HealthySchedulable++
+		}
+		wasHealthy, seen := physical[uuid]
+		if !seen {
+			c.Physical++
+		}
+		if healthy && !wasHealthy {
+			c.HealthyPhysical++
+		}
+		physical[uuid] = wasHealthy || healthy
+	}
+	return c
+}
+
+// GetPluginDevices 获取所有设备的pluginapi.Device，副本与原设备共用拓扑信息，拓扑信息创建后不再修改
 func (ds Devices) GetPluginDevices() []*pluginapi.Device {
 	var res []*pluginapi.Device
 	for _, device := range ds {
@@ -200,7 +285,8 @@ func (d Device) AlignedAllocationSupported() bool {
 	}
 
 	for _, p := range d.Paths {
-		if p == "/dev/dxg" {
+		// WSL的 /dev/dxg 和 Windows的设备类路径都对应节点上的所有GPU
+		if p == "/dev/dxg" || strings.HasPrefix(p, "class/") {
 			return false
 		}
 	}
@@ -0,0 +1,69 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/google/uuid"
+)
+
+// fabricSymbol 旧驱动不提供此接口，调用前需要检查
+const fabricSymbol = "nvmlDeviceGetGpuFabricInfo"
+
+// cliqueInfo 可选接口，支持多节点NVLink的设备返回所在的fabric clique
+type cliqueInfo interface {
+	GetClique() (string, error)
+}
+
+// hasFabricInfo NVML是否提供GPU fabric信息
+func hasFabricInfo(nvmllib nvml.Interface) bool {
+	return nvmllib.Extensions().LookupSymbol(fabricSymbol) == nil
+}
+
+// GetClique returns the NVLink fabric clique of the GPU as "<clusterUUID>.<cliqueID>".
+// GPUs in the same clique can reach each other over NVLink across nodes (IMEX domain).
+// It returns an empty string when the GPU is not part of a fabric or registration has not completed.
+func (d nvmlDevice) GetClique() (string, error) {
+	if !d.fabric {
+		return "", nil
+	}
+	info, ret := d.Device.GetGpuFabricInfo()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return "", nil
+	}
+	if ret != nvml.SUCCESS {
+		return "", fmt.Errorf("error getting GPU fabric info: %v", ret)
+	}
+	if info.State != nvml.GPU_FABRIC_STATE_COMPLETED || nvml.Return(info.Status) != nvml.SUCCESS {
+		return "", nil
+	}
+	var id uuid.UUID
+	for i, b := range info.ClusterUuid {
+		id[i] = byte(b)
+	}
+	if id == uuid.Nil {
+		return "", nil
+	}
+	return fmt.Sprintf("%s.%d", id, info.PartitionId), nil
+}
+
+// GetClique for a MIG device is the clique of the parent device.
+func (d nvmlMigDevice) GetClique() (string, error) {
+	if !d.fabric {
+		return "", nil
+	}
+	parent, ret := d.Device.GetDeviceHandleFromMigDeviceHandle()
+	if ret != nvml.SUCCESS {
+		return "", fmt.Errorf("error getting parent GPU device from MIG device: %v", ret)
+	}
+	return nvmlDevice{Device: parent, simulated: d.simulated, fabric: d.fabric}.GetClique()
+}
+
+// CliqueDomain 从clique ID中取出NVLink域（IMEX域）的UUID
+func CliqueDomain(clique string) string {
+	if i := strings.LastIndex(clique, "."); i >= 0 {
+		return clique[:i]
+	}
+	return clique
+}
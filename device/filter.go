@@ -0,0 +1,107 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// Filter 设备过滤规则，条目可以是GPU的UUID、索引或PCI总线ID
+// Include 不为空时只保留匹配的设备，之后再去掉匹配 Exclude 的设备
+type Filter struct {
+	Include []string
+	Exclude []string
+	// SkipUnmatched : 没有匹配任何资源模式的GPU记录为被过滤的设备，不返回错误
+	SkipUnmatched bool
+}
+
+// ReasonUnmatched 因没有匹配任何资源模式而未提供的GPU的原因
+const ReasonUnmatched = "GPU name matches no resource pattern (resources.unmatched: skip)"
+
+// ExcludedDevice 被过滤掉的设备及原因
+type ExcludedDevice struct {
+	Index    string `json:"index"`
+	UUID     string `json:"uuid"`
+	PCIBusID string `json:"pciBusID"`
+	Name     string `json:"name"`
+	Reason   string `json:"reason"`
+}
+
+// deviceIdentity 用于匹配过滤条目的设备标识
+type deviceIdentity struct {
+	index    string
+	uuid     string
+	pciBusID string
+}
+
+// newDeviceIdentity 获取GPU的索引、UUID和PCI总线ID
+func newDeviceIdentity(i int, gpu nvml.Device) (deviceIdentity, error) {
+	uuid, ret := gpu.GetUUID()
+	if ret != nvml.SUCCESS {
+		return deviceIdentity{}, fmt.Errorf("error getting UUID of GPU %d: %v", i, ret)
+	}
+	pciInfo, ret := gpu.GetPciInfo()
+	if ret != nvml.SUCCESS {
+		return deviceIdentity{}, fmt.Errorf("error getting PCI info of GPU %d: %v", i, ret)
+	}
+	return deviceIdentity{
+		index:    fmt.Sprintf("%d", i),
+		uuid:     uuid,
+		pciBusID: int8Slice(pciInfo.BusId[:]).String(),
+	}, nil
+}
+
+// matches 条目是否与设备的任一标识匹配
+func (id deviceIdentity) matches(entry string) bool {
+	entry = strings.TrimSpace(entry)
+	return entry == id.index ||
+		strings.EqualFold(entry, id.uuid) ||
+		(id.pciBusID != "" && normalizePCIBusID(entry) == normalizePCIBusID(id.pciBusID))
+}
+
+// Empty 是否没有任何过滤规则
+func (f Filter) Empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// reason 返回设备被过滤的原因，不过滤时返回空
+// 父设备和设备自身（如MIG设备）任一匹配即视为匹配
+func (f Filter) reason(ids ...deviceIdentity) string {
+	if len(f.Include) > 0 && firstMatch(f.Include, ids) == "" {
+		return "not listed in includeDevices"
+	}
+	if entry := firstMatch(f.Exclude, ids); entry != "" {
+		return fmt.Sprintf("matched excludeDevices entry '%s'", entry)
+	}
+	return ""
+}
+
+// firstMatch 返回第一个与任一设备标识匹配的条目
+func firstMatch(entries []string, ids []deviceIdentity) string {
+	for _, entry := range entries {
+		for _, id := range ids {
+			if id.matches(entry) {
+				return entry
+			}
+		}
+	}
+	return ""
+}
+
+// normalizePCIBusID 统一PCI总线ID格式，NVML使用8位域名（00000000:3B:00.0），sysfs使用4位（0000:3b:00.0），也允许省略域名
+func normalizePCIBusID(busID string) string {
+	busID = strings.ToLower(strings.TrimSpace(busID))
+	switch strings.Count(busID, ":") {
+	case 1:
+		return "0:" + busID
+	case 2:
+		parts := strings.SplitN(busID, ":", 2)
+		domain := strings.TrimLeft(parts[0], "0")
+		if domain == "" {
+			domain = "0"
+		}
+		return domain + ":" + parts[1]
+	}
+	return busID
+}
@@ -0,0 +1,61 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/device"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// MiB 显存分块的单位
+const MiB = 1024 * 1024
+
+// NewMemoryDevices 把每个未开启MIG的GPU按chunkMiB划分为多个显存分块，每个分块是GPU的一个副本
+// 分块ID为 <GPU UUID>::<分块编号>，被过滤规则排除的GPU不参与划分
+func NewMemoryDevices(nvmllib nvml.Interface, filter Filter, chunkMiB uint64, cache *AttributeCache) (Devices, error) {
+	if chunkMiB == 0 {
+		return nil, fmt.Errorf("memory chunk size must be greater than 0")
+	}
+	b := deviceMapBuilder{
+		Interface: device.New(nvmllib),
+		simulated: simulate.IsSimulated(nvmllib),
+		fabric:    hasFabricInfo(nvmllib),
+		filter:    filter,
+		cache:     cache,
+	}
+	devices := make(Devices)
+	err := b.VisitDevices(func(i int, gpu device.Device) error {
+		name, ret := gpu.GetName()
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("error getting product name for GPU: %v", ret)
+		}
+		if excluded, err := b.exclude(name, i, gpu); excluded || err != nil {
+			return err
+		}
+		migEnabled, err := gpu.IsMigEnabled()
+		if err != nil {
+			return fmt.Errorf("error checking if MIG is enabled on GPU: %v", err)
+		}
+		if migEnabled {
+			return nil
+		}
+		index, info := newGPUDevice(i, gpu, b.simulated)
+		info.fabric = b.fabric
+		dev, err := b.cache.BuildDevice(index, info)
+		if err != nil {
+			return fmt.Errorf("error building Device: %v", err)
+		}
+		dev.Product = name
+		chunks := int(dev.TotalMemory / (chunkMiB * MiB))
+		for j := 0; j < chunks; j++ {
+			chunk := *dev
+			chunk.ID = string(NewAnnotatedID(dev.ID, j))
+			chunk.Replicas = chunks
+			devices[chunk.ID] = &chunk
+		}
+		return nil
+	})
+	return devices, err
+}
@@ -0,0 +1,7 @@
+package device
+
+// GetMigCapabilityDevicePaths 获取 MIG 功能路径到设备节点路径的映射
+// Windows 下没有 nvidia-caps 设备节点，始终返回空
+func GetMigCapabilityDevicePaths() (map[string]string, error) {
+	return nil, nil
+}
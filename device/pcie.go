@@ -0,0 +1,64 @@
+package device
+
+import (
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// pcieInfo 可选接口，能从sysfs读取PCIe拓扑的设备返回从根复合体到设备的路径
+type pcieInfo interface {
+	GetPCIePath() ([]string, error)
+}
+
+// NIC 节点上的RDMA网卡
+type NIC struct {
+	// Name : RDMA设备名称，如 mlx5_0
+	Name string `json:"name"`
+	// PCIBusID : 网卡的PCI总线ID
+	PCIBusID string `json:"pciBusID"`
+	// PCIePath : 从根复合体到网卡的PCIe路径
+	PCIePath []string `json:"pciePath"`
+}
+
+// GetPCIePath returns the PCIe path of the GPU from the root complex, or nil when sysfs is not available.
+func (d nvmlDevice) GetPCIePath() ([]string, error) {
+	if d.simulated {
+		return nil, nil
+	}
+	busID, err := d.busID()
+	if err != nil {
+		return nil, err
+	}
+	return pciePath(busID), nil
+}
+
+// GetPCIePath for a MIG device is the PCIe path of the parent device.
+func (d nvmlMigDevice) GetPCIePath() ([]string, error) {
+	parent, ret := d.GetDeviceHandleFromMigDeviceHandle()
+	if ret != nvml.SUCCESS {
+		return nil, ret
+	}
+	return nvmlDevice{Device: parent, simulated: d.simulated}.GetPCIePath()
+}
+
+// PCIeAffinity 两个PCIe路径共同的上游节点数，0表示不在同一个根复合体下，
+// 1表示只共享根复合体，2表示共享根端口，更大表示共享PCIe交换机
+func PCIeAffinity(a, b []string) int {
+	n := 0
+	// 路径最后一项是设备本身，不计入
+	for n < len(a)-1 && n < len(b)-1 && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// ClosestNIC 与PCIe路径亲和度最高的网卡，亲和度相同时按名称排序，没有同一根复合体下的网卡时返回空
+func ClosestNIC(path []string, nics []NIC) string {
+	best, bestAffinity := "", 0
+	for _, nic := range nics {
+		a := PCIeAffinity(path, nic.PCIePath)
+		if a > bestAffinity || (a == bestAffinity && a > 0 && nic.Name < best) {
+			best, bestAffinity = nic.Name, a
+		}
+	}
+	return best
+}
@@ -0,0 +1,87 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sysfsPCIDevicesPath sysfs中PCI设备的目录
+func sysfsPCIDevicesPath() string {
+	return SysfsPath("bus", "pci", "devices")
+}
+
+// sysfsInfinibandPath sysfs中RDMA设备的目录
+func sysfsInfinibandPath() string {
+	return SysfsPath("class", "infiniband")
+}
+
+// pciePath 解析sysfs中PCI设备的链接，得到从根复合体（pci0000:00）到设备的路径，读取失败时返回空
+func pciePath(busID string) []string {
+	return resolvePCIePath(filepath.Join(sysfsPCIDevicesPath(), normalizeSysfsBusID(busID)))
+}
+
+// resolvePCIePath 解析 <sysfsRoot>/devices/pci0000:00/0000:00:01.0/0000:01:00.0 形式的真实路径
+func resolvePCIePath(link string) []string {
+	real, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return nil
+	}
+	var path []string
+	for _, part := range strings.Split(real, string(filepath.Separator)) {
+		if strings.HasPrefix(part, "pci") || isSysfsBusID(part) {
+			path = append(path, part)
+		}
+	}
+	if len(path) < 2 || !strings.HasPrefix(path[0], "pci") {
+		return nil
+	}
+	return path
+}
+
+// RDMANICs 节点上的RDMA网卡，没有网卡或无法读取sysfs时返回空
+func RDMANICs() []NIC {
+	entries, err := os.ReadDir(sysfsInfinibandPath())
+	if err != nil {
+		return nil
+	}
+	var nics []NIC
+	for _, e := range entries {
+		path := resolvePCIePath(filepath.Join(sysfsInfinibandPath(), e.Name(), "device"))
+		if path == nil {
+			continue
+		}
+		nics = append(nics, NIC{Name: e.Name(), PCIBusID: path[len(path)-1], PCIePath: path})
+	}
+	sort.Slice(nics, func(i, j int) bool { return nics[i].Name < nics[j].Name })
+	return nics
+}
+
+// NICPCIePath RDMA设备插件分配的网卡ID对应的PCIe路径，ID可以是RDMA设备名称（mlx5_0）或PCI总线ID（SR-IOV VF）
+func NICPCIePath(id string) []string {
+	if isSysfsBusID(normalizeSysfsBusID(id)) {
+		return pciePath(id)
+	}
+	return resolvePCIePath(filepath.Join(sysfsInfinibandPath(), filepath.Base(id), "device"))
+}
+
+// normalizeSysfsBusID 转换为sysfs使用的4位域名格式（0000:3b:00.0）
+func normalizeSysfsBusID(busID string) string {
+	busID = strings.ToLower(strings.TrimSpace(busID))
+	parts := strings.Split(busID, ":")
+	switch len(parts) {
+	case 2:
+		return "0000:" + busID
+	case 3:
+		domain := strings.TrimLeft(parts[0], "0")
+		return strings.Repeat("0", max(0, 4-len(domain))) + domain + ":" + parts[1] + ":" + parts[2]
+	}
+	return busID
+}
+
+// isSysfsBusID 是否为 0000:3b:00.0 格式的PCI总线ID
+func isSysfsBusID(s string) bool {
+	parts := strings.Split(s, ":")
+	return len(parts) == 3 && len(parts[0]) == 4 && len(parts[1]) == 2 && strings.Contains(parts[2], ".")
+}
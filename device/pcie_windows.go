@@ -0,0 +1,16 @@
+package device
+
+// pciePath Windows 上没有sysfs，不提供PCIe拓扑
+func pciePath(string) []string {
+	return nil
+}
+
+// RDMANICs Windows 上不支持GPUDirect RDMA
+func RDMANICs() []NIC {
+	return nil
+}
+
+// NICPCIePath Windows 上没有sysfs，不提供PCIe拓扑
+func NICPCIePath(string) []string {
+	return nil
+}
@@ -0,0 +1,24 @@
+package device
+
+import (
+	"path/filepath"
+)
+
+// defaultSysfsRoot sysfs的默认挂载点
+const defaultSysfsRoot = "/sys"
+
+// sysfsRoot sysfs的挂载点，容器中 /sys 被屏蔽时可以把宿主机的 /sys 挂载到其它目录（如 /host-sys）
+var sysfsRoot = defaultSysfsRoot
+
+// SetSysfsRoot 设置sysfs的挂载点，为空时使用 /sys，需要在发现设备之前调用
+func SetSysfsRoot(root string) {
+	if root == "" {
+		root = defaultSysfsRoot
+	}
+	sysfsRoot = filepath.Clean(root)
+}
+
+// SysfsPath sysfs中的路径，如 SysfsPath("bus", "pci", "devices") 为 <sysfsRoot>/bus/pci/devices
+func SysfsPath(elem ...string) string {
+	return filepath.Join(append([]string{sysfsRoot}, elem...)...)
+}
@@ -0,0 +1,162 @@
+package device
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// topologyHint kubelet拓扑管理器的设备提示，nodes 为NUMA节点集合
+type topologyHint struct {
+	nodes     []int64
+	preferred bool
+}
+
+// kubeletHints : 按kubelet设备管理器（pkg/kubelet/cm/devicemanager/topology_hints.go）的规则计算申请 request 个设备时的提示
+// 所有设备都没有拓扑信息时kubelet没有偏好，返回空
+func kubeletHints(devices []*pluginapi.Device, numaNodes []int64, request int) []topologyHint {
+	aligned := false
+	for _, d := range devices {
+		if d.Topology != nil {
+			aligned = true
+		}
+	}
+	if !aligned {
+		return nil
+	}
+	anySet := func(mask []int64, t *pluginapi.TopologyInfo) bool {
+		if t == nil {
+			return false
+		}
+		for _, n := range t.Nodes {
+			for _, m := range mask {
+				if n.ID == m {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	minAffinitySize := len(numaNodes)
+	var hints []topologyHint
+	for bits := 1; bits < 1<<len(numaNodes); bits++ {
+		var mask []int64
+		for i, n := range numaNodes {
+			if bits&(1<<i) != 0 {
+				mask = append(mask, n)
+			}
+		}
+		matching := 0
+		for _, d := range devices {
+			if anySet(mask, d.Topology) {
+				matching++
+			}
+		}
+		if len(mask) < minAffinitySize && matching >= request {
+			minAffinitySize = len(mask)
+		}
+		if matching < request {
+			continue
+		}
+		hints = append(hints, topologyHint{nodes: mask})
+	}
+	for i := range hints {
+		hints[i].preferred = len(hints[i].nodes) == minAffinitySize
+	}
+	return hints
+}
+
+// preferredHints : 优先的提示
+func preferredHints(hints []topologyHint) [][]int64 {
+	var res [][]int64
+	for _, h := range hints {
+		if h.preferred {
+			res = append(res, h.nodes)
+		}
+	}
+	return res
+}
+
+// numaGPU : 在NUMA节点上的模拟GPU
+func numaGPU(numa int) simulate.GPU {
+	return simulate.GPU{Name: "NVIDIA A100-SXM4-40GB", MemoryMiB: 40960, ComputeCapability: "8.0", NumaNode: numa}
+}
+
+// replicate : 按分时共享的方式把每个设备展开为 replicas 个副本
+func replicate(ds Devices, replicas int) Devices {
+	res := make(Devices)
+	for _, d := range ds {
+		for i := 0; i < replicas; i++ {
+			r := *d
+			r.ID = string(NewAnnotatedID(d.ID, i))
+			r.Replicas = replicas
+			res[r.ID] = &r
+		}
+	}
+	return res
+}
+
+// 副本和显存分块共用所在GPU的NUMA节点，kubelet能为只在一个NUMA节点上的申请给出单节点的优先提示
+func TestReplicaTopologyHints(t *testing.T) {
+	nvmllib, err := simulate.NewServer(&simulate.Topology{GPUs: []simulate.GPU{numaGPU(0), numaGPU(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nvmllib.Init()
+	defer nvmllib.Shutdown()
+	chunks, err := NewMemoryDevices(nvmllib, Filter{}, 10240, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpus := make(Devices)
+	for _, d := range chunks {
+		gpu := *d
+		gpu.ID = AnnotatedID(d.ID).GetID()
+		gpu.Replicas = 0
+		gpus[gpu.ID] = &gpu
+	}
+	numaNodes := []int64{0, 1}
+	tests := []struct {
+		name      string
+		devices   Devices
+		request   int
+		preferred [][]int64
+	}{
+		{"one replica", replicate(gpus, 4), 1, [][]int64{{0}, {1}}},
+		{"all replicas of one GPU", replicate(gpus, 4), 4, [][]int64{{0}, {1}}},
+		{"more replicas than one GPU has", replicate(gpus, 4), 5, [][]int64{{0, 1}}},
+		{"memory chunks of one GPU", chunks, 4, [][]int64{{0}, {1}}},
+		{"more memory than one GPU has", chunks, 6, [][]int64{{0, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices := tt.devices.GetPluginDevices()
+			for _, d := range devices {
+				parent := gpus[AnnotatedID(d.ID).GetID()]
+				if !reflect.DeepEqual(d.Topology, parent.Topology) {
+					t.Fatalf("%s: topology %v, GPU has %v", d.ID, d.Topology, parent.Topology)
+				}
+			}
+			got := preferredHints(kubeletHints(devices, numaNodes, tt.request))
+			if !reflect.DeepEqual(got, tt.preferred) {
+				t.Fatalf("preferred hints for %d devices: got %v, want %v", tt.request, got, tt.preferred)
+			}
+		})
+	}
+}
+
+// 没有NUMA信息的设备不影响kubelet的拓扑对齐
+func TestTopologyHintsWithoutNUMA(t *testing.T) {
+	ds := make(Devices)
+	for i := 0; i < 2; i++ {
+		id := fmt.Sprintf("GPU-%d", i)
+		ds[id] = &Device{Device: pluginapi.Device{ID: id, Health: pluginapi.Healthy}}
+	}
+	if hints := kubeletHints(replicate(ds, 2).GetPluginDevices(), []int64{0, 1}, 1); hints != nil {
+		t.Fatalf("expected no topology preference, got %v", hints)
+	}
+}
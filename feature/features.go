@@ -0,0 +1,59 @@
+package feature
+
+// 特性列表
+// 新增实验性子系统时在此注册为Alpha，稳定后改为Beta、GA，GA后锁定并在后续版本移除开关；
+// 旧实现移除前先注册为Deprecated并默认关闭，给使用者留出迁移时间
+const (
+	// GPUMemoryResource : 按显存分块对外提供GPU资源
+	GPUMemoryResource Feature = "GPUMemoryResource"
+	// HotplugRescan : 定期重新扫描GPU并增量更新设备列表
+	HotplugRescan Feature = "HotplugRescan"
+	// MigAnyResource : mixed 策略下提供可使用任意MIG配置的聚合资源
+	MigAnyResource Feature = "MigAnyResource"
+	// ModeDriftRemediation : 把漂移的GPU模式设置改回期望值
+	ModeDriftRemediation Feature = "ModeDriftRemediation"
+	// TimeSlicing : 按副本数分时共享GPU
+	TimeSlicing Feature = "TimeSlicing"
+)
+
+// defaultFeatures 所有已知特性的定义
+var defaultFeatures = map[Feature]Spec{
+	GPUMemoryResource: {
+		Default:     false,
+		Stage:       Alpha,
+		Description: "Advertise the memory of non-MIG GPUs as a countable resource (gpuMemory).",
+	},
+	HotplugRescan: {
+		Default:     false,
+		Stage:       Alpha,
+		Description: "Rescan GPUs periodically and push added or removed devices without restarting plugins (hotplug).",
+	},
+	MigAnyResource: {
+		Default:     false,
+		Stage:       Alpha,
+		Description: "Advertise an aggregate resource of all MIG devices in mixed mode that prefers the smallest profile (migAny).",
+	},
+	ModeDriftRemediation: {
+		Default:     false,
+		Stage:       Alpha,
+		Description: "Change drifted GPU mode settings back to the desired state (modeDrift.remediate).",
+	},
+	TimeSlicing: {
+		Default:     false,
+		Stage:       Alpha,
+		Description: "Advertise each device as several replicas that share it by time-slicing (sharing.timeSlicing).",
+	},
+}
+
+// DefaultGate 全局特性开关，启动时根据配置设置
+var DefaultGate = NewGate(defaultFeatures)
+
+// Enabled 特性在全局特性开关中是否开启
+func Enabled(name Feature) bool {
+	return DefaultGate.Enabled(name)
+}
+
+// Validate 检查特性开关配置，不修改全局特性开关
+func Validate(flags map[string]bool) error {
+	return NewGate(defaultFeatures).Set(flags)
+}
@@ -0,0 +1,158 @@
+package feature
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Feature 特性名称
+type Feature string
+
+// Stage 特性成熟度
+type Stage string
+
+// 特性成熟度
+// Alpha 默认关闭，可能随时修改或移除；Beta 默认开启；GA 固定开启，不能再关闭；Deprecated 将在后续版本移除
+const (
+	Alpha      Stage = "alpha"
+	Beta       Stage = "beta"
+	GA         Stage = "ga"
+	Deprecated Stage = "deprecated"
+)
+
+var featureEnabled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "feature_enabled",
+	Help:      "Whether a feature gate is enabled, labeled with its maturity stage.",
+}, []string{"feature", "stage"})
+
+// Spec 特性的定义
+type Spec struct {
+	// Default : 未配置时是否开启
+	Default bool
+	// Stage : 成熟度
+	Stage Stage
+	// LockToDefault : 是否禁止修改默认值，特性GA后或旧实现移除前使用
+	LockToDefault bool
+	// Description : 说明
+	Description string
+}
+
+// State 特性的当前状态
+type State struct {
+	Name        Feature `json:"name"`
+	Stage       Stage   `json:"stage"`
+	Enabled     bool    `json:"enabled"`
+	Default     bool    `json:"default"`
+	Description string  `json:"description"`
+}
+
+// Gate 特性开关
+type Gate struct {
+	mu      sync.RWMutex
+	known   map[Feature]Spec
+	enabled map[Feature]bool
+}
+
+// NewGate 创建特性开关，所有特性使用默认值
+func NewGate(known map[Feature]Spec) *Gate {
+	g := &Gate{
+		known:   make(map[Feature]Spec, len(known)),
+		enabled: make(map[Feature]bool, len(known)),
+	}
+	for name, spec := range known {
+		g.known[name] = spec
+		g.enabled[name] = spec.Default
+	}
+	return g
+}
+
+// Set 根据配置设置特性开关，名称不区分大小写
+// 未知特性或修改被锁定的特性时返回错误，此时不修改任何特性
+func (g *Gate) Set(flags map[string]bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	enabled := make(map[Feature]bool, len(g.enabled))
+	for name, value := range g.enabled {
+		enabled[name] = value
+	}
+	for key, value := range flags {
+		name, ok := g.lookup(key)
+		if !ok {
+			return fmt.Errorf("unknown feature gate %q", key)
+		}
+		spec := g.known[name]
+		if spec.LockToDefault && value != spec.Default {
+			return fmt.Errorf("feature gate %s is locked to %t", name, spec.Default)
+		}
+		enabled[name] = value
+	}
+	g.enabled = enabled
+	return nil
+}
+
+// Enabled 特性是否开启，未知特性视为关闭
+func (g *Gate) Enabled(name Feature) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.enabled[name]
+}
+
+// States 按名称顺序返回所有特性的状态
+func (g *Gate) States() []State {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	states := make([]State, 0, len(g.known))
+	for name, spec := range g.known {
+		states = append(states, State{
+			Name:        name,
+			Stage:       spec.Stage,
+			Enabled:     g.enabled[name],
+			Default:     spec.Default,
+			Description: spec.Description,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+// Report 记录开启的特性并更新监控指标，开启的实验性和即将移除的特性输出警告
+func (g *Gate) Report() {
+	var enabled []string
+	for _, s := range g.States() {
+		value := 0.0
+		if s.Enabled {
+			value = 1
+			enabled = append(enabled, string(s.Name))
+		}
+		featureEnabled.WithLabelValues(string(s.Name), string(s.Stage)).Set(value)
+		switch {
+		case s.Enabled && s.Stage == Alpha:
+			l.Logger.Warn("alpha feature enabled, it may change or be removed without notice", zap.String("feature", string(s.Name)))
+		case s.Enabled && s.Stage == Deprecated:
+			l.Logger.Warn("deprecated feature enabled, it will be removed in a future release", zap.String("feature", string(s.Name)))
+		}
+	}
+	l.Logger.Info("feature gates", zap.Strings("enabled", enabled))
+}
+
+// lookup 不区分大小写查找特性，配置文件中的键会被转换为小写
+func (g *Gate) lookup(key string) (Feature, bool) {
+	for name := range g.known {
+		if strings.EqualFold(string(name), key) {
+			return name, true
+		}
+	}
+	return "", false
+}
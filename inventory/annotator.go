@@ -0,0 +1,234 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+
+	"go.uber.org/zap"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 节点注解名称，使用时加上前缀
+const (
+	annotationDevicesTotal      = "devices-total"
+	annotationDevicesHealthy    = "devices-healthy"
+	annotationUnhealthy         = "unhealthy"
+	annotationDriverVersion     = "driver-version"
+	annotationCudaDriverVersion = "cuda-driver-version"
+)
+
+// 节点标签名称，使用时加上前缀
+const (
+	labelFabricClique = "fabric-clique"
+	labelIMEXDomain   = "imex-domain"
+)
+
+// 由 Annotator 维护的注解和标签，前缀可能与其它组件共用，只接管这些名称
+var (
+	managedAnnotations = []string{annotationDevicesTotal, annotationDevicesHealthy, annotationUnhealthy, annotationDriverVersion, annotationCudaDriverVersion}
+	managedLabels      = []string{labelFabricClique, labelIMEXDomain}
+)
+
+// Annotator 把GPU健康状况和驱动版本写入节点注解，调度器和运维工具无需访问插件的HTTP接口
+// 开启 fabricLabels 时还把GPU所在的多节点NVLink clique写入节点标签，供跨节点任务的亲和性调度使用
+type Annotator struct {
+	client       *kube.Client
+	nodeName     string
+	prefix       string
+	interval     time.Duration
+	fabricLabels bool
+	source       Source
+	// seeded : 是否已从节点读取上次写入的注解和标签
+	seeded     bool
+	last       map[string]string
+	lastLabels map[string]string
+}
+
+// NewAnnotator 创建节点注解更新器
+func NewAnnotator(client *kube.Client, nodeName, prefix string, interval time.Duration, fabricLabels bool, source Source) *Annotator {
+	return &Annotator{
+		client:       client,
+		nodeName:     nodeName,
+		prefix:       prefix,
+		interval:     interval,
+		fabricLabels: fabricLabels,
+		source:       source,
+	}
+}
+
+// Run 立即更新一次，之后按间隔检查，状态变化时更新节点，直到ctx结束
+func (a *Annotator) Run(ctx context.Context) error {
+	if a.nodeName == "" {
+		return fmt.Errorf("node annotations need the node name, set kubernetes.nodeName or NODE_NAME")
+	}
+	l.Logger.Info("annotating node with GPU state", zap.String("node", a.nodeName), zap.String("prefix", a.prefix), zap.Duration("interval", a.interval))
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Update(ctx); err != nil {
+			l.Logger.Error("failed to annotate node", zap.String("node", a.nodeName), zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Update 根据当前设备清单更新节点注解和标签，与上次写入的内容相同时不更新
+func (a *Annotator) Update(ctx context.Context) error {
+	if !a.seeded {
+		if err := a.seed(ctx); err != nil {
+			return fmt.Errorf("error reading node %s: %w", a.nodeName, err)
+		}
+	}
+	inv := a.source.Inventory()
+	annotations, err := a.annotations(inv)
+	if err != nil {
+		return err
+	}
+	if !equalAnnotations(annotations, a.last) {
+		if err := a.client.PatchNodeAnnotations(ctx, a.nodeName, mergePatch(annotations, a.last)); err != nil {
+			return err
+		}
+		a.last = annotations
+	}
+	// 关闭 fabricLabels 后删除之前写入的标签
+	labels := map[string]string{}
+	if a.fabricLabels {
+		labels = a.labels(inv)
+	}
+	if equalAnnotations(labels, a.lastLabels) {
+		return nil
+	}
+	if err := a.client.PatchNodeLabels(ctx, a.nodeName, mergePatch(labels, a.lastLabels)); err != nil {
+		return err
+	}
+	a.lastLabels = labels
+	return nil
+}
+
+// seed 从节点读取上次运行写入的注解和标签，插件重启后本次不再需要的注解和标签（如GPU已不在clique中）也会被删除
+func (a *Annotator) seed(ctx context.Context) error {
+	node, err := a.client.GetNode(ctx, a.nodeName)
+	if err != nil {
+		return err
+	}
+	a.last = a.managed(node.Metadata.Annotations, managedAnnotations)
+	a.lastLabels = a.managed(node.Metadata.Labels, managedLabels)
+	a.seeded = true
+	return nil
+}
+
+// managed 节点上由 Annotator 维护的键值
+func (a *Annotator) managed(values map[string]string, names []string) map[string]string {
+	res := make(map[string]string)
+	for _, name := range names {
+		if v, ok := values[a.key(name)]; ok {
+			res[a.key(name)] = v
+		}
+	}
+	return res
+}
+
+// labels 节点上所有GPU都在同一个fabric clique中时的clique和NVLink域标签，否则不设置
+func (a *Annotator) labels(inv plugin.Inventory) map[string]string {
+	clique := ""
+	for _, r := range inv.Resources {
+		for _, d := range r.Devices {
+			if d.Clique == "" {
+				continue
+			}
+			if clique != "" && d.Clique != clique {
+				l.Logger.Warn("GPUs on the node are in different fabric cliques, not labeling", zap.String("node", a.nodeName))
+				return map[string]string{}
+			}
+			clique = d.Clique
+		}
+	}
+	if clique == "" {
+		return map[string]string{}
+	}
+	return map[string]string{
+		a.key(labelFabricClique): clique,
+		a.key(labelIMEXDomain):   device.CliqueDomain(clique),
+	}
+}
+
+// mergePatch 生成合并补丁，上次存在但本次不存在的键置空删除
+func mergePatch(cur, last map[string]string) map[string]*string {
+	patch := make(map[string]*string, len(cur))
+	for k, v := range cur {
+		v := v
+		patch[k] = &v
+	}
+	for k := range last {
+		if _, ok := cur[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
+
+// annotations 汇总设备健康状况，同一设备的多个副本只计一次
+func (a *Annotator) annotations(inv plugin.Inventory) (map[string]string, error) {
+	total := make(map[string]bool)
+	unhealthy := make(map[string]string)
+	for _, r := range inv.Resources {
+		for _, d := range r.Devices {
+			id := device.AnnotatedID(d.ID).GetID()
+			total[id] = true
+			if d.Health == pluginapi.Healthy {
+				continue
+			}
+			reason := d.Reason
+			if reason == "" {
+				reason = d.Health
+			}
+			unhealthy[id] = reason
+		}
+	}
+	data, err := json.Marshal(unhealthy)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding unhealthy devices: %w", err)
+	}
+	res := map[string]string{
+		a.key(annotationDevicesTotal):   strconv.Itoa(len(total)),
+		a.key(annotationDevicesHealthy): strconv.Itoa(len(total) - len(unhealthy)),
+		a.key(annotationUnhealthy):      string(data),
+	}
+	if inv.Driver.DriverVersion != "" {
+		res[a.key(annotationDriverVersion)] = inv.Driver.DriverVersion
+	}
+	if inv.Driver.CudaDriverVersion != "" {
+		res[a.key(annotationCudaDriverVersion)] = inv.Driver.CudaDriverVersion
+	}
+	return res, nil
+}
+
+// key 加上前缀的注解名称
+func (a *Annotator) key(name string) string {
+	return a.prefix + "/" + name
+}
+
+// equalAnnotations 比较两组注解是否相同
+func equalAnnotations(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
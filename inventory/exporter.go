@@ -0,0 +1,70 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+
+	"go.uber.org/zap"
+)
+
+// Source 设备清单的来源
+type Source interface {
+	Inventory() plugin.Inventory
+}
+
+// Exporter 定期把设备清单写入本地文件，供无法访问Pod网络的节点代理读取
+type Exporter struct {
+	path     string
+	interval time.Duration
+	source   Source
+}
+
+// NewExporter 创建设备清单导出器
+func NewExporter(path string, interval time.Duration, source Source) *Exporter {
+	return &Exporter{
+		path:     path,
+		interval: interval,
+		source:   source,
+	}
+}
+
+// Run 立即写入一次，之后按间隔写入，直到ctx结束
+func (e *Exporter) Run(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		return fmt.Errorf("error creating inventory directory: %w", err)
+	}
+	l.Logger.Info("exporting device inventory", zap.String("path", e.path), zap.Duration("interval", e.interval))
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Write(); err != nil {
+			l.Logger.Error("failed to export device inventory", zap.String("path", e.path), zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Write 写入当前的设备清单
+// 先写入同目录下的临时文件再重命名，读取方不会看到写了一半的文件
+func (e *Exporter) Write() error {
+	data, err := json.MarshalIndent(e.source.Inventory(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding inventory: %w", err)
+	}
+	if err := util.WriteFileAtomic(e.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing inventory file: %w", err)
+	}
+	return nil
+}
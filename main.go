@@ -2,24 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	bmk "github.com/uppercaveman/k8s-gpu-device-plugin/benchmark"
-	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/feature"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/inventory"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
 	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/tracing"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/nodeapi"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/podresources"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/server"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/store"
 
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"github.com/oklog/run"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/spf13/pflag"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -28,27 +38,30 @@ func init() {
 }
 
 func main() {
-	pflag.String("configFile", "config", "name of config file (without extension)")
-
-	pflag.Parse()
-	viper.BindPFlags(pflag.CommandLine)
-
-	// 默认配置
-	config.SetDefaultConfig()
+	if cmd, args, ok := lookupCommand(os.Args[1:]); ok {
+		os.Exit(cmd.run(args))
+	}
+	// 未指定子命令时启动服务，兼容旧的启动参数
+	serve(os.Args[1:])
+}
 
-	viper.AddConfigPath(".")
-	viper.SetConfigName(viper.GetString("configFile"))
-	viper.SetConfigType("yml")
-	err := viper.ReadInConfig()
-	if err != nil {
-		log.Printf("fatal error config file: %s \n", err.Error())
+// serve : 启动插件服务，直到收到退出信号
+func serve(args []string) {
+	flags := pflag.NewFlagSet("serve", pflag.ExitOnError)
+	addConfigFlags(flags)
+	validateOnly := flags.Bool("validate-config", false, "same as the validate command")
+	flags.Duration("kubelet-registration-timeout", 0, "timeout for registering with kubelet, overrides registration.registerTimeout")
+	flags.Duration("startup-deadline", 0, "exit non-zero if plugins are not registered within this time, overrides registration.startupDeadline")
+	flags.Parse(args)
+	bindFlag(flags, "kubelet-registration-timeout", "registration.registerTimeout")
+	bindFlag(flags, "startup-deadline", "registration.startupDeadline")
+	if *validateOnly {
+		os.Exit(printValidatedConfig(flags))
 	}
 
-	cfg := new(config.Config)
-	err = viper.Unmarshal(cfg)
+	cfg, configFiles, err := loadConfig(flags, false)
 	if err != nil {
-		log.Panic("fatal unmarshal config", err.Error())
-		return
+		log.Fatal(err)
 	}
 
 	// log
@@ -57,31 +70,127 @@ func main() {
 		log.Panic("init logger failed", err.Error())
 		return
 	}
-	l.Logger.Info("Starting k8s-gpu-device-plugin Server...")
+	l.Logger.Info("Starting k8s-gpu-device-plugin Server...", zap.Strings("configFiles", configFiles))
+
+	// feature gates，已在加载配置时校验
+	if err := feature.DefaultGate.Set(cfg.FeatureGates); err != nil {
+		log.Fatal(err)
+	}
+	feature.DefaultGate.Report()
+
+	// tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), *cfg.Tracing, cfg.Kubernetes.NodeName)
+	if err != nil {
+		l.Logger.Warn("failed to set up tracing, tracing disabled", zap.Error(err))
+		cfg.Tracing.Enabled = false
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.HTTPTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			l.Logger.Warn("failed to flush traces", zap.Error(err))
+		}
+	}()
 
-	// plugin manager Ready
-	pluginReady := &util.CloseOnce{
+	// plugin manager loaded
+	pluginLoaded := &util.CloseOnce{
 		C: make(chan struct{}),
 	}
 
-	pluginReady.Close = func() {
-		pluginReady.Once.Do(func() {
-			close(pluginReady.C)
+	pluginLoaded.Close = func() {
+		pluginLoaded.Once.Do(func() {
+			close(pluginLoaded.C)
 		})
 	}
 
-	// plugin manager
-	pluginManager := plugin.NewPluginManager(cfg.MigStrategy, pluginReady)
+	// kubernetes client
+	var kubeClient *kube.Client
+	if cfg.Kubernetes.Enabled {
+		kubeClient, err = kube.NewInClusterClient()
+		if err != nil {
+			l.Logger.Warn("failed to create kubernetes client, kubernetes integration disabled", zap.Error(err))
+			kubeClient = nil
+		}
+	}
+
+	// nvml
+	var nvmllib nvml.Interface = nvml.New()
+	if cfg.Simulate.Enabled {
+		nvmllib, err = simulate.New(cfg.Simulate)
+		if err != nil {
+			log.Panic("init simulated nvml failed", err.Error())
+			return
+		}
+		l.Logger.Warn("simulate mode enabled, using fake GPUs instead of NVML")
+	}
+	// storage
+	stateStore, err := store.Open(cfg.Storage.Backend, store.Options{Dir: cfg.Storage.Dir})
+	if err != nil {
+		l.Logger.Warn("failed to open storage, state will not survive restarts", zap.Error(err))
+		stateStore, _ = store.Open(store.BackendMemory, store.Options{})
+	}
+	defer stateStore.Close()
+
+	// kubelet PodResources
+	var podResources *podresources.Client
+	if cfg.PodResources.Enabled {
+		podResources = podresources.NewClient(cfg.PodResources.Socket, cfg.PodResources.Timeout, cfg.ResourcePrefix)
+		prometheus.MustRegister(podresources.NewCollector(podResources))
+	}
+
+	// plugin manager，负责初始化NVML，退出时最后关闭
+	pluginManager := plugin.NewPluginManager(cfg, nvmllib, kubeClient, podResources, stateStore, pluginLoaded)
+	if cfg.NVMLMetrics.Enabled {
+		prometheus.MustRegister(pluginManager.NVMLCollector())
+	}
+
+	// benchmark，启动时开始或通过HTTP接口开启
+	var bench, webBench *bmk.Benchmark
+	if cfg.Benchmark || cfg.Profiling.Enabled {
+		bench, err = bmk.NewBenchmark(l.Logger.With(zap.String("component", "benchmark")), cfg.Profiling.Dir)
+		if err != nil {
+			log.Fatal("new benchmark err : ", err.Error())
+			os.Exit(1)
+		}
+		bench.SetMaxDuration(cfg.Profiling.MaxDuration)
+		if cfg.Profiling.Enabled {
+			webBench = bench
+		}
+	}
 
 	// web server
-	webServer := server.New(cfg.WebListenAddress, pluginManager)
-	ctxWeb, cancelWeb := context.WithCancel(context.Background())
+	webServer := server.New(cfg.WebListenAddress, cfg.Shutdown.HTTPTimeout, *cfg.WebAuth, pluginManager, podResources, webBench, cfg.Tracing.Enabled)
+
+	// 根context，退出流程的最后一步取消，其它组件随之停止
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctxWeb, cancelWeb := context.WithCancel(ctx)
+	pluginsStopped := make(chan struct{})
+	webStopped := make(chan struct{})
+	// 退出顺序：关闭HTTP服务 -> 向kubelet上报设备不健康并停止插件 -> 停止其它组件 -> 关闭NVML
+	// 收到退出信号或任一组件退出时执行一次，超过 shutdown.timeout 仍未完成时直接以非0状态退出
+	var shutdownOnce sync.Once
+	shutdown := func() {
+		shutdownOnce.Do(func() {
+			if cfg.Shutdown.Timeout > 0 {
+				time.AfterFunc(cfg.Shutdown.Timeout, func() {
+					l.Logger.Error("shutdown timed out, exiting", zap.Duration("timeout", cfg.Shutdown.Timeout))
+					os.Exit(1)
+				})
+			}
+			cancelWeb()
+			waitStage("drain HTTP", webStopped, cfg.Shutdown.HTTPTimeout)
+			pluginManager.Stop()
+			waitStage("stop advertising devices", pluginsStopped, cfg.Shutdown.PluginTimeout)
+			cancel()
+		})
+	}
 	var g run.Group
 	{
 		// Termination handler.
 		term := make(chan os.Signal, 1)
 		signal.Notify(term, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
-		cancel := make(chan struct{})
 		g.Add(
 			func() error {
 				select {
@@ -98,14 +207,14 @@ func main() {
 					default:
 						log.Printf("messaged %s, exiting gracefully...", sig.String())
 					}
-				case <-cancel:
-					pluginReady.Close()
+				case <-ctx.Done():
+					pluginLoaded.Close()
 					log.Println("canceled, exiting gracefully...")
 				}
 				return nil
 			},
 			func(err error) {
-				close(cancel)
+				shutdown()
 			},
 		)
 	}
@@ -113,11 +222,11 @@ func main() {
 		// Plugin Manager.
 		g.Add(
 			func() error {
-				pluginManager.Start()
-				return nil
+				defer close(pluginsStopped)
+				return pluginManager.Start()
 			},
 			func(err error) {
-				pluginManager.Stop()
+				shutdown()
 			},
 		)
 	}
@@ -125,38 +234,149 @@ func main() {
 		// Web Server.
 		g.Add(
 			func() error {
-				<-pluginReady.C
+				defer close(webStopped)
+				// 插件加载后或开始等待驱动时启动，注册期间 /ready 返回503，/health 和 /metrics 仍可访问
+				select {
+				case <-pluginLoaded.C:
+				case <-pluginManager.DriverWait():
+				case <-ctxWeb.Done():
+					return nil
+				}
 				if err := webServer.Run(ctxWeb); err != nil {
 					return fmt.Errorf("error starting web server : %s", err)
 				}
 				return nil
 			},
 			func(err error) {
-				cancelWeb()
+				shutdown()
 			},
 		)
 	}
 
-	// Benchmark.
-	if cfg.Benchmark {
-		// benchmark
-		bench, err := bmk.NewBenchmark(l.Logger.With(zap.String("component", "benchmark")), "")
-		if err != nil {
-			log.Fatal("new benchmark err : ", err.Error())
-			os.Exit(1)
+	// Inventory Exporter.
+	if cfg.Inventory.Enabled {
+		exporter := inventory.NewExporter(cfg.Inventory.Path, cfg.Inventory.Interval, pluginManager)
+		g.Add(
+			func() error {
+				// 所有插件注册后才导出设备清单
+				select {
+				case <-pluginManager.Registered():
+				case <-ctx.Done():
+					return nil
+				}
+				return exporter.Run(ctx)
+			},
+			func(err error) {
+				shutdown()
+			},
+		)
+	}
+
+	// Node Annotations.
+	if kubeClient != nil && cfg.Kubernetes.NodeAnnotations {
+		annotator := inventory.NewAnnotator(kubeClient, cfg.Kubernetes.NodeName, cfg.Kubernetes.AnnotationPrefix, cfg.Kubernetes.AnnotationInterval, cfg.Kubernetes.FabricLabels, pluginManager)
+		g.Add(
+			func() error {
+				select {
+				case <-pluginManager.Registered():
+				case <-ctx.Done():
+					return nil
+				}
+				if err := annotator.Run(ctx); err != nil {
+					// 节点注解不是必需功能，出错时不退出
+					l.Logger.Warn("node annotations disabled", zap.Error(err))
+					<-ctx.Done()
+				}
+				return nil
+			},
+			func(err error) {
+				shutdown()
+			},
+		)
+	}
+
+	// Node API.
+	if cfg.NodeAPI.Enabled {
+		var lister nodeapi.AllocationLister
+		if podResources != nil {
+			lister = podResources
 		}
+		nodeAPI := nodeapi.NewServer(cfg.NodeAPI.Socket, pluginManager, lister)
+		g.Add(
+			func() error {
+				// 所有插件注册后才对其它DaemonSet提供查询
+				select {
+				case <-pluginManager.Registered():
+				case <-ctx.Done():
+					return nil
+				}
+				return nodeAPI.Run(ctx)
+			},
+			func(err error) {
+				shutdown()
+			},
+		)
+	}
 
+	// Storage Compaction.
+	if cfg.Storage.CompactInterval > 0 {
+		retention := store.Retention{MaxAge: cfg.Storage.MaxAge, MaxRecords: cfg.Storage.MaxRecords}
+		g.Add(
+			func() error {
+				return store.RunCompaction(ctx, stateStore, retention, cfg.Storage.CompactInterval)
+			},
+			func(err error) {
+				shutdown()
+			},
+		)
+	}
+
+	// Benchmark.
+	if cfg.Benchmark {
 		if err := bench.Run(); err != nil {
 			log.Fatal(err.Error())
 			os.Exit(1)
 		}
+	}
+	if bench != nil {
+		// 退出时停止仍在运行的分析并写入分析文件
 		defer bench.Stop()
 	}
 
-	if err := g.Run(); err != nil {
-		log.Fatal(err.Error())
+	runErr := g.Run()
+
+	// 最后关闭NVML
+	nvmlClosed := make(chan struct{})
+	go func() {
+		defer close(nvmlClosed)
+		pluginManager.ShutdownNVML()
+	}()
+	waitStage("close NVML", nvmlClosed, cfg.Shutdown.NvmlTimeout)
+	if n := pluginManager.NVMLReferences(); n > 0 {
+		l.Logger.Warn("NVML is still referenced on exit", zap.Int("references", n))
+	}
+
+	// 未发现设备时按配置退出，退出码为0，不作为崩溃处理
+	if errors.Is(runErr, plugin.ErrNoDevices) {
+		l.Logger.Info("no devices found on node, exiting", zap.String("nonGpuNodeBehavior", cfg.NonGpuNodeBehavior))
+		runErr = nil
+	}
+	if runErr != nil {
+		log.Fatal(runErr.Error())
 		os.Exit(1)
 	}
 
 	log.Println("see you next time!")
 }
+
+// waitStage 等待退出阶段完成，超时后记录日志并继续下一阶段
+func waitStage(stage string, done <-chan struct{}, timeout time.Duration) {
+	start := time.Now()
+	l.Logger.Info("shutdown stage started", zap.String("stage", stage), zap.Duration("timeout", timeout))
+	select {
+	case <-done:
+		l.Logger.Info("shutdown stage finished", zap.String("stage", stage), zap.Duration("elapsed", time.Since(start)))
+	case <-time.After(timeout):
+		l.Logger.Warn("shutdown stage timed out", zap.String("stage", stage), zap.Duration("timeout", timeout))
+	}
+}
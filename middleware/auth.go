@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Authenticator Web接口的认证，支持 bearer token 和客户端证书
+// 变更类和排查接口总是需要认证，启用认证后只读接口也需要认证
+type Authenticator struct {
+	cfg         config.WebAuthConfig
+	clientNames map[string]bool
+}
+
+// NewAuthenticator : 创建认证器，启用认证但未配置任何认证方式时返回错误
+func NewAuthenticator(cfg config.WebAuthConfig) (*Authenticator, error) {
+	if cfg.Enabled && cfg.TokenFile == "" && cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("webAuth is enabled but neither tokenFile nor clientCAFile is set")
+	}
+	if cfg.ClientCAFile != "" && (cfg.CertFile == "" || cfg.KeyFile == "") {
+		return nil, fmt.Errorf("webAuth.clientCAFile requires certFile and keyFile")
+	}
+	a := &Authenticator{cfg: cfg, clientNames: make(map[string]bool)}
+	for _, name := range cfg.ClientNames {
+		a.clientNames[name] = true
+	}
+	return a, nil
+}
+
+// TLSConfig : 服务端TLS配置，未配置证书时返回空，不强制要求客户端证书，使健康检查和监控无需证书
+func (a *Authenticator) TLSConfig() (*tls.Config, error) {
+	if a.cfg.CertFile == "" || a.cfg.KeyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(a.cfg.CertFile, a.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if a.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(a.cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", a.cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// ReadOnly : 只读接口的认证，启用认证时要求认证，只记录被拒绝的请求；未启用认证时允许匿名调用
+func (a *Authenticator) ReadOnly() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !a.cfg.Enabled {
+				return next(c)
+			}
+			user, method, err := a.authenticate(c)
+			if err != nil {
+				l.Logger.Warn("audit: request denied", a.auditFields(c, user, method, zap.Error(err))...)
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// Required : 无论是否启用认证都要求认证并记录审计日志，用于变更类接口和暴露日志、配置、进程等内部信息的接口；
+// 未配置 tokenFile 或 clientCAFile 时这些接口不可用
+func (a *Authenticator) Required() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, method, err := a.authenticate(c)
+			if err != nil {
+				l.Logger.Warn("audit: request denied", a.auditFields(c, user, method, zap.Error(err))...)
+				return err
+			}
+			err = next(c)
+			l.Logger.Info("audit: request handled", a.auditFields(c, user, method, zap.Int("status", c.Response().Status), zap.NamedError("error", err))...)
+			return err
+		}
+	}
+}
+
+// auditFields : 审计日志的字段
+func (a *Authenticator) auditFields(c echo.Context, user, method string, extra ...zap.Field) []zap.Field {
+	return append([]zap.Field{
+		zap.String("requestId", GetRequestID(c)),
+		zap.String("user", user),
+		zap.String("authMethod", method),
+		zap.String("remoteAddr", c.Request().RemoteAddr),
+		zap.String("method", c.Request().Method),
+		zap.String("path", c.Path()),
+	}, extra...)
+}
+
+// authenticate : 返回调用者名称和认证方式，优先使用已校验的客户端证书
+// bearer token 只在HTTPS上接受，除非配置了 allowInsecureTokens，避免token在明文HTTP上被截获
+func (a *Authenticator) authenticate(c echo.Context) (string, string, error) {
+	if state := c.Request().TLS; state != nil && len(state.VerifiedChains) > 0 {
+		name := state.VerifiedChains[0][0].Subject.CommonName
+		if len(a.clientNames) > 0 && !a.clientNames[name] {
+			return name, "mtls", util.ForbiddenError(fmt.Sprintf("client %q is not allowed", name))
+		}
+		return name, "mtls", nil
+	}
+	if token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok && a.cfg.TokenFile != "" {
+		if c.Request().TLS == nil && !a.cfg.AllowInsecureTokens {
+			return "", "token", util.UnauthorizedError("bearer tokens are only accepted over HTTPS, configure webAuth.certFile and keyFile")
+		}
+		name, err := a.lookupToken(strings.TrimSpace(token))
+		if err != nil {
+			return "", "token", err
+		}
+		return name, "token", nil
+	}
+	if a.cfg.TokenFile == "" && a.cfg.ClientCAFile == "" {
+		return "", "none", util.UnauthorizedError("authentication required, configure webAuth.tokenFile or webAuth.clientCAFile to use this endpoint")
+	}
+	return "", "none", util.UnauthorizedError("authentication required")
+}
+
+// lookupToken : 在token文件中查找token对应的名称，每次调用时重新读取文件以支持Secret轮换
+func (a *Authenticator) lookupToken(token string) (string, error) {
+	data, err := os.ReadFile(a.cfg.TokenFile)
+	if err != nil {
+		return "", util.InternalError(fmt.Errorf("error reading token file: %w", err))
+	}
+	found := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		t, name, _ := strings.Cut(line, ",")
+		// 比较所有token，避免通过响应时间猜测
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(t)), []byte(token)) == 1 && found == "" {
+			found = strings.TrimSpace(name)
+			if found == "" {
+				found = "token"
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", util.InternalError(fmt.Errorf("error reading token file: %w", err))
+	}
+	if found == "" {
+		return "", util.UnauthorizedError("invalid token")
+	}
+	return found, nil
+}
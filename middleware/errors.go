@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// HeaderRequestID 请求ID的请求头和响应头
+const HeaderRequestID = "X-Request-ID"
+
+// requestIDKey 请求ID在echo.Context中的键
+const requestIDKey = "requestID"
+
+// RequestID : 为每个请求分配请求ID，请求中已带有时沿用，并写入响应头和请求的context，
+// 处理函数通过 l.FromContext 记录的日志带有该请求ID
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			rid := c.Request().Header.Get(HeaderRequestID)
+			if rid == "" {
+				if id, err := util.NewID(); err == nil {
+					rid = id
+				}
+			}
+			c.Set(requestIDKey, rid)
+			c.SetRequest(c.Request().WithContext(l.NewContext(c.Request().Context(), rid)))
+			c.Response().Header().Set(HeaderRequestID, rid)
+			return next(c)
+		}
+	}
+}
+
+// GetRequestID : 获取当前请求的请求ID
+func GetRequestID(c echo.Context) string {
+	rid, _ := c.Get(requestIDKey).(string)
+	return rid
+}
+
+// ErrorHandler : 把处理函数返回的错误和recover捕获的panic转换为带错误类型和请求ID的响应
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	apiErr := toAPIError(err)
+	rid := GetRequestID(c)
+	if apiErr.Status >= http.StatusInternalServerError {
+		l.Logger.Error("web api error", zap.String("requestId", rid), zap.String("method", c.Request().Method), zap.String("path", c.Path()), zap.String("type", apiErr.Type), zap.Error(err))
+	}
+	if apiErr.Status < http.StatusBadRequest || c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiErr.Status)
+	} else {
+		err = c.JSON(apiErr.Status, util.ErrorResponse(apiErr, rid))
+	}
+	if err != nil {
+		l.Logger.Warn("failed to write error response", zap.String("requestId", rid), zap.Error(err))
+	}
+}
+
+// toAPIError : 转换为Web API错误，未分类的错误视为内部错误，不向调用方暴露细节
+func toAPIError(err error) *util.Error {
+	var apiErr *util.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		message := http.StatusText(he.Code)
+		if he.Message != nil {
+			message = fmt.Sprint(he.Message)
+		}
+		switch {
+		case he.Code == http.StatusUnauthorized:
+			return util.NewError(he.Code, util.ErrorTypeUnauthorized, message, nil)
+		case he.Code == http.StatusForbidden:
+			return util.NewError(he.Code, util.ErrorTypeForbidden, message, nil)
+		case he.Code == http.StatusNotFound:
+			return util.NewError(he.Code, util.ErrorTypeNotFound, message, nil)
+		case he.Code == http.StatusServiceUnavailable:
+			return util.NewError(he.Code, util.ErrorTypeNotReady, message, nil)
+		case he.Code < http.StatusInternalServerError:
+			return util.NewError(he.Code, util.ErrorTypeBadRequest, message, nil)
+		}
+		return util.NewError(he.Code, util.ErrorTypeInternal, message, he.Internal)
+	}
+	return util.InternalError(err)
+}
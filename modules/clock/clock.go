@@ -0,0 +1,62 @@
+package clock
+
+import (
+	"time"
+)
+
+// Clock 时间来源，定时相关的逻辑通过它获取时间和定时器，测试时可替换为 FakeClock
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Until(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+	Sleep(d time.Duration)
+}
+
+// Ticker 周期定时器
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock 使用系统时间的 Clock
+type RealClock struct{}
+
+// Now : time.Now
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Since : time.Since
+func (RealClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// Until : time.Until
+func (RealClock) Until(t time.Time) time.Duration {
+	return time.Until(t)
+}
+
+// After : time.After
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewTicker : time.NewTicker
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{Ticker: time.NewTicker(d)}
+}
+
+// Sleep : time.Sleep
+func (RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
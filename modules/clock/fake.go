@@ -0,0 +1,143 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock 手动推进的 Clock，定时器只在 Step/SetTime 时触发
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter 等待触发的定时器，period大于0时为周期定时器
+type fakeWaiter struct {
+	target time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+// NewFakeClock 创建从t开始的 FakeClock
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Now : 当前的模拟时间
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since : 模拟时间与t的差值
+func (f *FakeClock) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Until : t与模拟时间的差值
+func (f *FakeClock) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+// After 模拟时间推进d后触发
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.addWaiter(d, 0).c
+}
+
+// NewTicker 模拟时间每推进d触发一次，推进跨越多个周期时只保留一次触发，与 time.Ticker 一致
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return &fakeTicker{clock: f, waiter: f.addWaiter(d, d)}
+}
+
+// Sleep 阻塞到模拟时间推进d
+func (f *FakeClock) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// Step 推进模拟时间并触发到期的定时器
+func (f *FakeClock) Step(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setTimeLocked(f.now.Add(d))
+}
+
+// SetTime 设置模拟时间并触发到期的定时器
+func (f *FakeClock) SetTime(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setTimeLocked(t)
+}
+
+// Waiters 尚未触发的定时器数量，测试中用于等待被测代码进入等待状态
+func (f *FakeClock) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (f *FakeClock) addWaiter(d, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{
+		target: f.now.Add(d),
+		period: period,
+		c:      make(chan time.Time, 1),
+	}
+	if d <= 0 && period == 0 {
+		w.c <- f.now
+		return w
+	}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+func (f *FakeClock) setTimeLocked(t time.Time) {
+	f.now = t
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.target.After(t) {
+			waiters = append(waiters, w)
+			continue
+		}
+		select {
+		case w.c <- t:
+		default:
+		}
+		if w.period > 0 {
+			for !w.target.After(t) {
+				w.target = w.target.Add(w.period)
+			}
+			waiters = append(waiters, w)
+		}
+	}
+	f.waiters = waiters
+}
+
+func (f *FakeClock) removeWaiter(w *fakeWaiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, o := range f.waiters {
+		if o == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.removeWaiter(t.waiter)
+}
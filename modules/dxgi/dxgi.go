@@ -0,0 +1,48 @@
+// Package dxgi 通过DXGI枚举Windows节点上的显示适配器，用于没有NVML的节点发现GPU
+package dxgi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NvidiaVendorID NVIDIA的PCI厂商ID
+const NvidiaVendorID = 0x10DE
+
+// ErrUnsupported 当前平台不支持DXGI
+var ErrUnsupported = errors.New("DXGI is only available on Windows")
+
+// Adapter DXGI显示适配器，字段对应 DXGI_ADAPTER_DESC1
+type Adapter struct {
+	// Index : EnumAdapters1 的枚举序号
+	Index                int    `json:"index"`
+	Description          string `json:"description"`
+	VendorID             uint32 `json:"vendorId"`
+	DeviceID             uint32 `json:"deviceId"`
+	SubSysID             uint32 `json:"subSysId"`
+	Revision             uint32 `json:"revision"`
+	DedicatedVideoMemory uint64 `json:"dedicatedVideoMemory"`
+	// LUID : 适配器的本地唯一标识，重启系统后会变化
+	LUID     string `json:"luid"`
+	Software bool   `json:"software"`
+}
+
+// NvidiaAdapters 枚举NVIDIA的硬件适配器，跳过 Microsoft Basic Render Driver 等软件适配器
+func NvidiaAdapters() ([]Adapter, error) {
+	adapters, err := Adapters()
+	if err != nil {
+		return nil, err
+	}
+	var res []Adapter
+	for _, a := range adapters {
+		if a.VendorID == NvidiaVendorID && !a.Software {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+// formatLUID 按 LUID-<高位>-<低位> 格式化适配器LUID
+func formatLUID(high int32, low uint32) string {
+	return fmt.Sprintf("LUID-%08x-%08x", uint32(high), low)
+}
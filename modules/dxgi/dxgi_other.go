@@ -0,0 +1,8 @@
+//go:build !windows
+
+package dxgi
+
+// Adapters 枚举所有显示适配器，非Windows平台始终返回 ErrUnsupported
+func Adapters() ([]Adapter, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,109 @@
+//go:build windows
+
+package dxgi
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modDXGI                = syscall.NewLazyDLL("dxgi.dll")
+	procCreateDXGIFactory1 = modDXGI.NewProc("CreateDXGIFactory1")
+)
+
+// iidIDXGIFactory1 IDXGIFactory1 的接口ID
+var iidIDXGIFactory1 = syscall.GUID{
+	Data1: 0x770aae78,
+	Data2: 0xf26f,
+	Data3: 0x4dba,
+	Data4: [8]byte{0xa8, 0x29, 0x25, 0x3c, 0x83, 0xd1, 0xb3, 0x87},
+}
+
+// COM虚函数表中用到的方法序号
+const (
+	vtblRelease        = 2
+	vtblEnumAdapters1  = 12
+	vtblAdapterGetDesc = 10
+)
+
+// DXGI返回值和适配器标志
+const (
+	dxgiErrorNotFound       = 0x887A0002
+	dxgiAdapterFlagSoftware = 0x2
+)
+
+// comObject COM对象，首个字段为虚函数表指针
+type comObject struct {
+	vtbl *[16]uintptr
+}
+
+// call 调用COM对象的虚函数
+func (o *comObject) call(method int, args ...uintptr) uintptr {
+	ret, _, _ := syscall.SyscallN(o.vtbl[method], append([]uintptr{uintptr(unsafe.Pointer(o))}, args...)...)
+	return ret
+}
+
+// release 释放COM对象
+func (o *comObject) release() {
+	o.call(vtblRelease)
+}
+
+// adapterDesc1 DXGI_ADAPTER_DESC1
+type adapterDesc1 struct {
+	Description           [128]uint16
+	VendorID              uint32
+	DeviceID              uint32
+	SubSysID              uint32
+	Revision              uint32
+	DedicatedVideoMemory  uintptr
+	DedicatedSystemMemory uintptr
+	SharedSystemMemory    uintptr
+	LUIDLowPart           uint32
+	LUIDHighPart          int32
+	Flags                 uint32
+}
+
+// Adapters 通过 CreateDXGIFactory1 和 EnumAdapters1 枚举所有显示适配器
+func Adapters() ([]Adapter, error) {
+	if err := procCreateDXGIFactory1.Find(); err != nil {
+		return nil, fmt.Errorf("error loading dxgi.dll: %w", err)
+	}
+	var factory *comObject
+	hr, _, _ := procCreateDXGIFactory1.Call(uintptr(unsafe.Pointer(&iidIDXGIFactory1)), uintptr(unsafe.Pointer(&factory)))
+	if int32(hr) < 0 || factory == nil {
+		return nil, fmt.Errorf("CreateDXGIFactory1 failed: 0x%08x", uint32(hr))
+	}
+	defer factory.release()
+
+	var adapters []Adapter
+	for i := 0; ; i++ {
+		var adapter *comObject
+		hr := factory.call(vtblEnumAdapters1, uintptr(i), uintptr(unsafe.Pointer(&adapter)))
+		if uint32(hr) == dxgiErrorNotFound {
+			break
+		}
+		if int32(hr) < 0 || adapter == nil {
+			return nil, fmt.Errorf("EnumAdapters1(%d) failed: 0x%08x", i, uint32(hr))
+		}
+		var desc adapterDesc1
+		hr = adapter.call(vtblAdapterGetDesc, uintptr(unsafe.Pointer(&desc)))
+		adapter.release()
+		if int32(hr) < 0 {
+			return nil, fmt.Errorf("GetDesc1 of adapter %d failed: 0x%08x", i, uint32(hr))
+		}
+		adapters = append(adapters, Adapter{
+			Index:                i,
+			Description:          syscall.UTF16ToString(desc.Description[:]),
+			VendorID:             desc.VendorID,
+			DeviceID:             desc.DeviceID,
+			SubSysID:             desc.SubSysID,
+			Revision:             desc.Revision,
+			DedicatedVideoMemory: uint64(desc.DedicatedVideoMemory),
+			LUID:                 formatLUID(desc.LUIDHighPart, desc.LUIDLowPart),
+			Software:             desc.Flags&dxgiAdapterFlagSoftware != 0,
+		})
+	}
+	return adapters, nil
+}
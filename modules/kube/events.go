@@ -0,0 +1,81 @@
+package kube
+
+import (
+	"context"
+	"time"
+)
+
+// 事件类型
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+)
+
+// Recorder 以指定组件的名义向 Kubernetes 发送事件
+type Recorder struct {
+	client    *Client
+	component string
+	nodeName  string
+}
+
+// NewRecorder 创建事件记录器
+func NewRecorder(client *Client, component, nodeName string) *Recorder {
+	return &Recorder{
+		client:    client,
+		component: component,
+		nodeName:  nodeName,
+	}
+}
+
+// NodeName 事件记录器所在节点
+func (r *Recorder) NodeName() string {
+	return r.nodeName
+}
+
+// Client 事件记录器使用的客户端
+func (r *Recorder) Client() *Client {
+	return r.client
+}
+
+// Event 为指定对象创建事件
+func (r *Recorder) Event(ctx context.Context, obj ObjectReference, eventType, reason, message string) error {
+	now := time.Now()
+	ev := &Event{
+		Metadata: ObjectMeta{
+			GenerateName: obj.Name + ".",
+			Namespace:    obj.Namespace,
+		},
+		InvolvedObject: obj,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source: EventSource{
+			Component: r.component,
+			Host:      r.nodeName,
+		},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	return r.client.CreateEvent(ctx, ev)
+}
+
+// PodReference 获取Pod的对象引用
+func PodReference(pod Pod) ObjectReference {
+	return ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Metadata.Name,
+		Namespace:  pod.Metadata.Namespace,
+		UID:        pod.Metadata.UID,
+	}
+}
+
+// NodeReference 获取节点的对象引用
+func NodeReference(nodeName string) ObjectReference {
+	return ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       nodeName,
+	}
+}
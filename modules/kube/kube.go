@@ -0,0 +1,226 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// in-cluster 服务账号相关的路径
+const (
+	serviceAccountPath      = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceAccountTokenPath = serviceAccountPath + "/token"
+	serviceAccountCAPath    = serviceAccountPath + "/ca.crt"
+)
+
+// Client 访问 Kubernetes API 的轻量客户端，仅支持 in-cluster 配置
+type Client struct {
+	host      string
+	tokenPath string
+	http      *http.Client
+}
+
+// NewInClusterClient 使用 Pod 的服务账号创建客户端
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("unable to load in-cluster configuration, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be defined")
+	}
+	ca, err := os.ReadFile(serviceAccountCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", serviceAccountCAPath)
+	}
+	return &Client{
+		host:      "https://" + net.JoinHostPort(host, port),
+		tokenPath: serviceAccountTokenPath,
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			},
+		},
+	}, nil
+}
+
+// NodeName 从环境变量获取当前节点名称
+func NodeName() string {
+	return os.Getenv("NODE_NAME")
+}
+
+// ObjectMeta 对象元数据
+type ObjectMeta struct {
+	Name         string            `json:"name,omitempty"`
+	GenerateName string            `json:"generateName,omitempty"`
+	Namespace    string            `json:"namespace,omitempty"`
+	UID          string            `json:"uid,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// ObjectReference 事件关联的对象
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	UID        string `json:"uid,omitempty"`
+}
+
+// EventSource 事件来源
+type EventSource struct {
+	Component string `json:"component,omitempty"`
+	Host      string `json:"host,omitempty"`
+}
+
+// Event core/v1 Event
+type Event struct {
+	Metadata       ObjectMeta      `json:"metadata"`
+	InvolvedObject ObjectReference `json:"involvedObject"`
+	Reason         string          `json:"reason,omitempty"`
+	Message        string          `json:"message,omitempty"`
+	Type           string          `json:"type,omitempty"`
+	Source         EventSource     `json:"source,omitempty"`
+	FirstTimestamp time.Time       `json:"firstTimestamp,omitempty"`
+	LastTimestamp  time.Time       `json:"lastTimestamp,omitempty"`
+	Count          int32           `json:"count,omitempty"`
+}
+
+// Container Pod中的容器，只保留资源相关字段
+type Container struct {
+	Name      string `json:"name"`
+	Resources struct {
+		Limits   map[string]string `json:"limits,omitempty"`
+		Requests map[string]string `json:"requests,omitempty"`
+	} `json:"resources"`
+}
+
+// Pod core/v1 Pod，只保留需要的字段
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		NodeName   string      `json:"nodeName,omitempty"`
+		Containers []Container `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase,omitempty"`
+	} `json:"status"`
+}
+
+// Requests 检查Pod中是否有容器申请了指定资源
+func (p Pod) Requests(resourceName string) bool {
+	for _, c := range p.Spec.Containers {
+		if _, ok := c.Resources.Limits[resourceName]; ok {
+			return true
+		}
+		if _, ok := c.Resources.Requests[resourceName]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Node core/v1 Node，只保留元数据
+type Node struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// GetNode 获取节点
+func (c *Client) GetNode(ctx context.Context, nodeName string) (*Node, error) {
+	node := new(Node)
+	if err := c.do(ctx, http.MethodGet, "/api/v1/nodes/"+url.PathEscape(nodeName), "", nil, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// ListPods 获取所有命名空间中符合字段选择器的Pod
+func (c *Client) ListPods(ctx context.Context, fieldSelector string) ([]Pod, error) {
+	var list struct {
+		Items []Pod `json:"items"`
+	}
+	path := "/api/v1/pods?fieldSelector=" + url.QueryEscape(fieldSelector)
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// PatchNodeAnnotations 使用merge patch更新节点注解，值为空的注解会被删除
+func (c *Client) PatchNodeAnnotations(ctx context.Context, nodeName string, annotations map[string]*string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	}
+	return c.do(ctx, http.MethodPatch, "/api/v1/nodes/"+url.PathEscape(nodeName), "application/merge-patch+json", patch, nil)
+}
+
+// PatchNodeLabels 合并更新节点标签，值为空的标签会被删除
+func (c *Client) PatchNodeLabels(ctx context.Context, nodeName string, labels map[string]*string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labels,
+		},
+	}
+	return c.do(ctx, http.MethodPatch, "/api/v1/nodes/"+url.PathEscape(nodeName), "application/merge-patch+json", patch, nil)
+}
+
+// CreateEvent 创建事件
+func (c *Client) CreateEvent(ctx context.Context, ev *Event) error {
+	ns := ev.Metadata.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+	return c.do(ctx, http.MethodPost, "/api/v1/namespaces/"+ns+"/events", "application/json", ev, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, body)
+	if err != nil {
+		return err
+	}
+	token, err := os.ReadFile(c.tokenPath)
+	if err != nil {
+		return fmt.Errorf("error reading service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,44 @@
+package log
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AuditLogConfig 审计日志的输出和切割
+type AuditLogConfig struct {
+	File       string //审计日志文件，为空时不写文件
+	Stdout     bool   //是否同时输出到标准输出
+	MaxSize    int    //日志文件小大（M）
+	MaxBackups int    //最多存在多少个切片文件
+	MaxAge     int    //保存的最大天数
+}
+
+// NewAuditLogger : 创建独立于运行日志的审计日志，JSON编码，不受日志等级影响
+func NewAuditLogger(config AuditLogConfig) (*zap.Logger, error) {
+	if config.File == "" && !config.Stdout {
+		return nil, errors.New("no audit log output enabled")
+	}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	encoder := zapcore.NewJSONEncoder(encoderConfig)
+	var cores []zapcore.Core
+	if config.File != "" {
+		ws := zapcore.AddSync(&lumberjack.Logger{
+			Filename:   config.File,
+			MaxSize:    config.MaxSize,
+			MaxBackups: config.MaxBackups,
+			MaxAge:     config.MaxAge,
+			Compress:   true,
+			LocalTime:  true,
+		})
+		cores = append(cores, zapcore.NewCore(encoder, ws, zapcore.InfoLevel))
+	}
+	if config.Stdout {
+		cores = append(cores, zapcore.NewCore(encoder, debugConsoleWS, zapcore.InfoLevel))
+	}
+	return zap.New(zapcore.NewTee(cores...)), nil
+}
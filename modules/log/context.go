@@ -0,0 +1,33 @@
+package log
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// requestIDKey 请求ID在context中的键
+type requestIDKey struct{}
+
+// NewContext : 在context中记录请求ID，FromContext 返回的日志带有该请求ID
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID : context中的请求ID，没有时为空
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext : 带有请求ID字段的日志，用于关联同一请求在kubelet、插件和Web API中的日志，
+// context中没有请求ID时返回全局日志
+func FromContext(ctx context.Context) *zap.Logger {
+	if id := RequestID(ctx); id != "" {
+		return Logger.With(zap.String("requestId", id))
+	}
+	return Logger
+}
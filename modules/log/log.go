@@ -21,6 +21,12 @@ const (
 	ERROR = "ERROR"
 )
 
+// log encoding
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+)
+
 var (
 	Logger                         *zap.Logger
 	l                              *logger
@@ -35,6 +41,18 @@ type LogConfig struct {
 	Level string `yaml:"level"`
 	// fileDir : 日志文件保存目录
 	FileDir string `yaml:"fileDir"`
+	// file : 是否按等级写入日志文件
+	File bool `yaml:"file"`
+	// stdout : 是否输出到标准输出
+	Stdout bool `yaml:"stdout"`
+	// encoding : json, console
+	Encoding string `yaml:"encoding"`
+	// maxSize : 单个日志文件大小（M）
+	MaxSize int `yaml:"maxSize"`
+	// maxBackups : 最多保留的切片文件数
+	MaxBackups int `yaml:"maxBackups"`
+	// maxAge : 日志文件保存的最大天数
+	MaxAge int `yaml:"maxAge"`
 }
 
 type Options struct {
@@ -49,6 +67,9 @@ type Options struct {
 	MaxBackups    int           //最多存在多少个切片文件
 	MaxAge        int           //保存的最大天数
 	Development   bool          //是否是开发模式
+	DisableFile   bool          //是否关闭日志文件
+	Stdout        bool          //是否输出到标准输出
+	Encoding      string        //日志编码 json, console
 	zap.Config
 }
 
@@ -68,7 +89,34 @@ func InitLogger(config LogConfig, serv string) error {
 	if err != nil {
 		return err
 	}
-	Logger = NewLogger(SetAppName(serv), SetLevel(level), SetLogFileDir(config.FileDir))
+	encoding := strings.ToLower(config.Encoding)
+	if encoding == "" {
+		encoding = EncodingJSON
+	}
+	if encoding != EncodingJSON && encoding != EncodingConsole {
+		return errors.New("invalid log encoding")
+	}
+	if !config.File && !config.Stdout {
+		return errors.New("no log output enabled")
+	}
+	mod := []ModOptions{
+		SetAppName(serv),
+		SetLevel(level),
+		SetLogFileDir(config.FileDir),
+		SetDisableFile(!config.File),
+		SetStdout(config.Stdout),
+		SetEncoding(encoding),
+	}
+	if config.MaxSize > 0 {
+		mod = append(mod, SetMaxSize(config.MaxSize))
+	}
+	if config.MaxBackups > 0 {
+		mod = append(mod, SetMaxBackups(config.MaxBackups))
+	}
+	if config.MaxAge > 0 {
+		mod = append(mod, SetMaxAge(config.MaxAge))
+	}
+	Logger = NewLogger(mod...)
 	return nil
 }
 
@@ -91,6 +139,7 @@ func NewLogger(mod ...ModOptions) *zap.Logger {
 		MaxSize:       100,
 		MaxBackups:    60,
 		MaxAge:        30,
+		Encoding:      EncodingJSON,
 	}
 	for _, fn := range mod {
 		fn(l.Opts)
@@ -119,7 +168,9 @@ func NewLogger(mod ...ModOptions) *zap.Logger {
 }
 
 func (l *logger) init() {
-	l.setSyncs()
+	if !l.Opts.DisableFile {
+		l.setSyncs()
+	}
 	var err error
 	l.Logger, err = l.zapConfig.Build(l.cores())
 	if err != nil {
@@ -147,6 +198,12 @@ func (l *logger) setSyncs() {
 
 func (l *logger) cores() zap.Option {
 	fileEncoder := zapcore.NewJSONEncoder(l.zapConfig.EncoderConfig)
+	if l.Opts.Encoding == EncodingConsole {
+		plainConfig := l.zapConfig.EncoderConfig
+		plainConfig.EncodeTime = timeEncoder
+		plainConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		fileEncoder = zapcore.NewConsoleEncoder(plainConfig)
+	}
 	encoderConfig := zap.NewDevelopmentEncoderConfig()
 	encoderConfig.EncodeTime = timeEncoder
 	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
@@ -164,11 +221,18 @@ func (l *logger) cores() zap.Option {
 	debugPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
 		return lvl == zapcore.DebugLevel && zapcore.DebugLevel-l.zapConfig.Level.Level() > -1
 	})
-	cores := []zapcore.Core{
-		zapcore.NewCore(fileEncoder, errWS, errPriority),
-		zapcore.NewCore(fileEncoder, warnWS, warnPriority),
-		zapcore.NewCore(fileEncoder, infoWS, infoPriority),
-		zapcore.NewCore(fileEncoder, debugWS, debugPriority),
+	var cores []zapcore.Core
+	if !l.Opts.DisableFile {
+		cores = append(cores, []zapcore.Core{
+			zapcore.NewCore(fileEncoder, errWS, errPriority),
+			zapcore.NewCore(fileEncoder, warnWS, warnPriority),
+			zapcore.NewCore(fileEncoder, infoWS, infoPriority),
+			zapcore.NewCore(fileEncoder, debugWS, debugPriority),
+		}...)
+	}
+	// 标准输出使用与日志文件相同的编码，所有等级写入同一输出，便于容器日志采集
+	if l.Opts.Stdout && !l.Opts.Development {
+		cores = append(cores, zapcore.NewCore(fileEncoder, debugConsoleWS, l.zapConfig.Level))
 	}
 	if l.Opts.Development {
 		cores = append(cores, []zapcore.Core{
@@ -249,12 +313,62 @@ func SetDebugFileName(DebugFileName string) ModOptions {
 	}
 }
 
+func SetDisableFile(DisableFile bool) ModOptions {
+	return func(option *Options) {
+		option.DisableFile = DisableFile
+	}
+}
+
+func SetStdout(Stdout bool) ModOptions {
+	return func(option *Options) {
+		option.Stdout = Stdout
+	}
+}
+
+func SetEncoding(Encoding string) ModOptions {
+	return func(option *Options) {
+		option.Encoding = Encoding
+	}
+}
+
 func SetDevelopment(Development bool) ModOptions {
 	return func(option *Options) {
 		option.Development = Development
 	}
 }
 
+// AtomicLevel : 运行日志的等级，修改后立即对文件和标准输出生效
+func AtomicLevel() zap.AtomicLevel {
+	return l.zapConfig.Level
+}
+
+// GetLevel : 当前的日志等级：DEBUG, INFO, WARN, ERROR
+func GetLevel() string {
+	return strings.ToUpper(AtomicLevel().Level().String())
+}
+
+// ChangeLevel : 运行时修改日志等级，不需要重启服务
+func ChangeLevel(lvl string) error {
+	level, err := getZapLevel(lvl)
+	if err != nil {
+		return err
+	}
+	AtomicLevel().SetLevel(level)
+	return nil
+}
+
+// Files : 当前写入的日志文件，按错误、警告、信息、调试排列，未写入文件时为空
+func Files() []string {
+	if l == nil || l.Opts == nil || l.Opts.DisableFile {
+		return nil
+	}
+	var files []string
+	for _, name := range []string{l.Opts.ErrorFileName, l.Opts.WarnFileName, l.Opts.InfoFileName, l.Opts.DebugFileName} {
+		files = append(files, l.Opts.LogFileDir+sp+l.Opts.AppName+"-"+name)
+	}
+	return files
+}
+
 func getZapLevel(lvl string) (zapcore.Level, error) {
 	var zapLevel zapcore.Level
 	switch strings.ToUpper(lvl) {
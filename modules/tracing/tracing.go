@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName 插件创建span时使用的tracer名称
+const TracerName = "github.com/uppercaveman/k8s-gpu-device-plugin"
+
+type TracingConfig struct {
+	// enabled : 是否开启OpenTelemetry链路追踪
+	Enabled bool `yaml:"enabled"`
+	// endpoint : OTLP gRPC接收端地址，如 otel-collector.monitoring:4317
+	Endpoint string `yaml:"endpoint"`
+	// insecure : 是否不使用TLS连接接收端
+	Insecure bool `yaml:"insecure"`
+	// headers : 发送给接收端的额外请求头，如认证信息
+	Headers map[string]string `yaml:"headers"`
+	// serviceName : 上报的服务名称
+	ServiceName string `yaml:"serviceName"`
+	// sampleRatio : 没有上游span时的采样比例，0-1；有上游span时跟随上游的采样决定
+	SampleRatio float64 `yaml:"sampleRatio"`
+	// timeout : 单次导出的超时时间
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Setup 创建OTLP导出器并设置全局的 TracerProvider 和 W3C trace context 传播方式
+// 返回的函数在退出时调用，导出剩余的span；未开启时返回空操作
+func Setup(ctx context.Context, config TracingConfig, nodeName string) (func(context.Context) error, error) {
+	if !config.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(config.Endpoint),
+		otlptracegrpc.WithHeaders(config.Headers),
+	}
+	if config.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if config.Timeout > 0 {
+		opts = append(opts, otlptracegrpc.WithTimeout(config.Timeout))
+	}
+	// 不阻塞等待连接，接收端不可用时span被丢弃，不影响设备分配
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+	}
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(config.ServiceName),
+		semconv.ServiceVersion(version.Version),
+	}
+	if nodeName != "" {
+		attrs = append(attrs, semconv.K8SNodeName(nodeName))
+	}
+	if host, err := os.Hostname(); err == nil {
+		attrs = append(attrs, semconv.HostName(host))
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, attrs...)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Tracer 插件的tracer，未开启链路追踪时创建的span不做任何事
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
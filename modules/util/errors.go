@@ -0,0 +1,103 @@
+package util
+
+import (
+	"net/http"
+)
+
+// Web API 错误类型，失败响应的 error 字段取以下值之一
+const (
+	// ErrorTypeConfig : 请求的功能未在配置中启用或配置错误
+	ErrorTypeConfig = "config_error"
+	// ErrorTypeNVML : NVML不可用或查询失败
+	ErrorTypeNVML = "nvml_error"
+	// ErrorTypeKubelet : kubelet socket 或 PodResources API 不可用
+	ErrorTypeKubelet = "kubelet_error"
+	// ErrorTypeNotReady : 插件尚未启动完成或处于降级状态
+	ErrorTypeNotReady = "not_ready"
+	// ErrorTypeNotFound : 路径或资源不存在
+	ErrorTypeNotFound = "not_found"
+	// ErrorTypeUnauthorized : 缺少或无效的认证信息
+	ErrorTypeUnauthorized = "unauthorized"
+	// ErrorTypeForbidden : 调用者无权访问
+	ErrorTypeForbidden = "forbidden"
+	// ErrorTypeBadRequest : 请求参数错误
+	ErrorTypeBadRequest = "bad_request"
+	// ErrorTypeConflict : 与当前状态冲突，如重复开始已在运行的任务
+	ErrorTypeConflict = "conflict"
+	// ErrorTypeInternal : 未预期的内部错误，包括处理请求时的panic
+	ErrorTypeInternal = "internal_error"
+)
+
+// Error : Web API 错误，包含HTTP状态码和错误类型
+type Error struct {
+	Status  int
+	Type    string
+	Message string
+	Err     error
+}
+
+// NewError : 创建Web API错误
+func NewError(status int, errorType string, message string, err error) *Error {
+	return &Error{Status: status, Type: errorType, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError : 功能未启用或配置错误，返回404
+func ConfigError(message string) *Error {
+	return NewError(http.StatusNotFound, ErrorTypeConfig, message, nil)
+}
+
+// NVMLError : NVML查询失败，返回503
+func NVMLError(message string, err error) *Error {
+	return NewError(http.StatusServiceUnavailable, ErrorTypeNVML, message, err)
+}
+
+// KubeletError : 访问kubelet失败，返回502
+func KubeletError(message string, err error) *Error {
+	return NewError(http.StatusBadGateway, ErrorTypeKubelet, message, err)
+}
+
+// NotReadyError : 服务尚未就绪，返回503
+func NotReadyError(message string) *Error {
+	return NewError(http.StatusServiceUnavailable, ErrorTypeNotReady, message, nil)
+}
+
+// NotFoundError : 资源不存在，返回404
+func NotFoundError(message string) *Error {
+	return NewError(http.StatusNotFound, ErrorTypeNotFound, message, nil)
+}
+
+// UnauthorizedError : 认证失败，返回401
+func UnauthorizedError(message string) *Error {
+	return NewError(http.StatusUnauthorized, ErrorTypeUnauthorized, message, nil)
+}
+
+// ForbiddenError : 无权访问，返回403
+func ForbiddenError(message string) *Error {
+	return NewError(http.StatusForbidden, ErrorTypeForbidden, message, nil)
+}
+
+// BadRequestError : 请求参数错误，返回400
+func BadRequestError(message string) *Error {
+	return NewError(http.StatusBadRequest, ErrorTypeBadRequest, message, nil)
+}
+
+// ConflictError : 与当前状态冲突，返回409
+func ConflictError(message string) *Error {
+	return NewError(http.StatusConflict, ErrorTypeConflict, message, nil)
+}
+
+// InternalError : 内部错误，返回500
+func InternalError(err error) *Error {
+	return NewError(http.StatusInternalServerError, ErrorTypeInternal, "internal server error", err)
+}
@@ -1,9 +1,11 @@
 package util
 
 type Response struct {
-	Code    int         `json:"code"`
-	Data    interface{} `json:"data"`
-	Message string      `json:"msg"`
+	Code      int         `json:"code"`
+	Data      interface{} `json:"data"`
+	Message   string      `json:"msg"`
+	Error     string      `json:"error,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
 }
 
 func Success(data interface{}) Response {
@@ -13,3 +15,12 @@ func Success(data interface{}) Response {
 func Failed(code int, msg string) Response {
 	return Response{Code: code, Message: msg, Data: nil}
 }
+
+// ErrorResponse : 失败响应，code为HTTP状态码，error为错误类型，内部错误不返回错误详情
+func ErrorResponse(e *Error, requestID string) Response {
+	message := e.Error()
+	if e.Type == ErrorTypeInternal {
+		message = e.Message
+	}
+	return Response{Code: e.Status, Message: message, Error: e.Type, RequestID: requestID}
+}
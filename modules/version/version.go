@@ -1,5 +1,44 @@
 package version
 
-const (
-	Version = "0.0.1"
+import (
+	"runtime"
 )
+
+// 构建信息，通过 -ldflags 注入，例如：
+//
+//	go build -ldflags "-X github.com/uppercaveman/k8s-gpu-device-plugin/modules/version.GitCommit=$(git rev-parse HEAD) \
+//	  -X github.com/uppercaveman/k8s-gpu-device-plugin/modules/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "0.0.1"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// Driver 节点上NVIDIA驱动相关的版本
+type Driver struct {
+	DriverVersion     string `json:"driverVersion,omitempty"`
+	NvmlVersion       string `json:"nvmlVersion,omitempty"`
+	CudaDriverVersion string `json:"cudaDriverVersion,omitempty"`
+}
+
+// Info 版本信息
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+	Driver
+}
+
+// Get 获取插件的构建信息及驱动版本
+func Get(driver Driver) Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Driver:    driver,
+	}
+}
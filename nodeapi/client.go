@@ -0,0 +1,67 @@
+package nodeapi
+
+import (
+	"context"
+	"net"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Client 节点API客户端，供Go编写的DaemonSet使用
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// Dial 连接节点API的unix socket
+func Dial(ctx context.Context, socket string) (*Client, error) {
+	conn, err := grpc.DialContext(ctx, socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close 关闭连接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Inventory 获取设备清单和健康状态
+func (c *Client) Inventory(ctx context.Context) (plugin.Inventory, error) {
+	var res plugin.Inventory
+	err := c.invoke(ctx, MethodGetInventory, &res)
+	return res, err
+}
+
+// Health 获取插件健康检查结果
+func (c *Client) Health(ctx context.Context) (plugin.HealthReport, error) {
+	var res plugin.HealthReport
+	err := c.invoke(ctx, MethodGetHealth, &res)
+	return res, err
+}
+
+// Allocations 获取容器已分配的GPU设备和共享GPU的占用情况
+func (c *Client) Allocations(ctx context.Context) (Allocations, error) {
+	var res Allocations
+	err := c.invoke(ctx, MethodGetAllocations, &res)
+	return res, err
+}
+
+func (c *Client) invoke(ctx context.Context, method string, v interface{}) error {
+	out := &structpb.Struct{}
+	if err := c.conn.Invoke(ctx, method, &emptypb.Empty{}, out); err != nil {
+		return err
+	}
+	return fromStruct(out, v)
+}
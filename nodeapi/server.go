@@ -0,0 +1,61 @@
+package nodeapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Server 在hostPath下的unix socket上提供只读的节点GPU状态查询
+// 同节点的其它DaemonSet不需要依赖HTTP端口或Kubernetes API
+type Server struct {
+	socket string
+	server *grpc.Server
+}
+
+// NewServer 创建节点API服务，podResources为空时只返回共享GPU的占用情况
+func NewServer(socket string, source Source, podResources AllocationLister) *Server {
+	s := &Server{
+		socket: socket,
+		server: grpc.NewServer([]grpc.ServerOption{}...),
+	}
+	s.server.RegisterService(&serviceDesc, &nodeStateServer{source: source, podResources: podResources})
+	return s
+}
+
+// Run 监听socket并提供服务，直到ctx结束
+func (s *Server) Run(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Dir(s.socket), 0755); err != nil {
+		return fmt.Errorf("error creating node API directory: %w", err)
+	}
+	if err := os.Remove(s.socket); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing stale node API socket: %w", err)
+	}
+	sock, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return fmt.Errorf("error listening on node API socket: %w", err)
+	}
+	defer os.Remove(s.socket)
+
+	errCh := make(chan error, 1)
+	go func() {
+		l.Logger.Info("node API started", zap.String("socket", s.socket))
+		errCh <- s.server.Serve(sock)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		s.server.GracefulStop()
+		l.Logger.Info("node API stopped")
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package nodeapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/podresources"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// 服务和方法名称，与 nodeapi.proto 一致
+const (
+	ServiceName              = "gpu.deviceplugin.v1.NodeState"
+	MethodGetInventory       = "/" + ServiceName + "/GetInventory"
+	MethodGetHealth          = "/" + ServiceName + "/GetHealth"
+	MethodGetAllocations     = "/" + ServiceName + "/GetAllocations"
+	methodNameGetInventory   = "GetInventory"
+	methodNameGetHealth      = "GetHealth"
+	methodNameGetAllocations = "GetAllocations"
+)
+
+// Source 节点GPU状态的来源
+type Source interface {
+	Inventory() plugin.Inventory
+	Health() plugin.HealthReport
+	LedgerClaims() map[string]string
+}
+
+// AllocationLister 获取kubelet当前的设备分配情况
+type AllocationLister interface {
+	List(ctx context.Context) ([]podresources.Allocation, error)
+}
+
+// Allocations GetAllocations 的响应内容
+type Allocations struct {
+	// Pods : 容器已分配的GPU设备，未启用PodResources时为空
+	Pods []podresources.Allocation `json:"pods"`
+	// Claims : 共享GPU当前被哪个资源占用
+	Claims map[string]string `json:"claims"`
+}
+
+// nodeStateServer NodeState 服务的实现
+type nodeStateServer struct {
+	source       Source
+	podResources AllocationLister
+}
+
+func (s *nodeStateServer) getInventory(ctx context.Context) (*structpb.Struct, error) {
+	return toStruct(s.source.Inventory())
+}
+
+func (s *nodeStateServer) getHealth(ctx context.Context) (*structpb.Struct, error) {
+	return toStruct(s.source.Health())
+}
+
+func (s *nodeStateServer) getAllocations(ctx context.Context) (*structpb.Struct, error) {
+	res := Allocations{
+		Pods:   []podresources.Allocation{},
+		Claims: s.source.LedgerClaims(),
+	}
+	if s.podResources != nil {
+		pods, err := s.podResources.List(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "error listing pod resources: %v", err)
+		}
+		res.Pods = pods
+	}
+	return toStruct(res)
+}
+
+// toStruct 通过JSON转换为 structpb.Struct，字段名与HTTP接口一致
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error encoding response: %v", err)
+	}
+	res := &structpb.Struct{}
+	if err := res.UnmarshalJSON(data); err != nil {
+		return nil, status.Errorf(codes.Internal, "error encoding response: %v", err)
+	}
+	return res, nil
+}
+
+// fromStruct 把 structpb.Struct 转换回Go类型
+func fromStruct(s *structpb.Struct, v interface{}) error {
+	data, err := s.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// unaryHandler 把无参数的方法包装为gRPC方法处理函数
+func unaryHandler(method string, fn func(*nodeStateServer, context.Context) (*structpb.Struct, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(emptypb.Empty)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			s := srv.(*nodeStateServer)
+			if interceptor == nil {
+				return fn(s, ctx)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+			return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return fn(s, ctx)
+			})
+		},
+	}
+}
+
+// serviceDesc NodeState 服务描述，按 nodeapi.proto 手写，避免引入生成代码
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler(methodNameGetInventory, (*nodeStateServer).getInventory),
+		unaryHandler(methodNameGetHealth, (*nodeStateServer).getHealth),
+		unaryHandler(methodNameGetAllocations, (*nodeStateServer).getAllocations),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "nodeapi/nodeapi.proto",
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+var allocateCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "allocate_cache_hits_total",
+	Help:      "Number of container allocations answered with a previous response for the same set of devices within allocate.idempotencyWindow.",
+}, []string{"resource"})
+
+// allocateCache 最近的 Allocate 响应，按申请的设备集合记录
+// kubelet超时后可能为同一容器重试 Allocate，窗口内重复的请求直接返回之前的响应，不再重复执行有副作用的步骤。
+// 请求中没有Pod信息，窗口内分配到同一组设备的其它容器同样命中，因此默认关闭
+type allocateCache struct {
+	window  time.Duration
+	clock   clock.Clock
+	mu      sync.Mutex
+	entries map[string]allocateCacheEntry
+}
+
+// allocateCacheEntry 一次容器分配的响应
+type allocateCacheEntry struct {
+	response *pluginapi.ContainerAllocateResponse
+	at       time.Time
+}
+
+// newAllocateCache : 创建响应缓存，window 不大于0时不缓存，返回空
+func newAllocateCache(window time.Duration, clk clock.Clock) *allocateCache {
+	if window <= 0 {
+		return nil
+	}
+	return &allocateCache{window: window, clock: clk, entries: make(map[string]allocateCacheEntry)}
+}
+
+// allocateKey : 设备集合的键，与申请顺序无关
+func allocateKey(ids []string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// get : 窗口内同一设备集合的响应，同时清理过期的记录
+func (c *allocateCache) get(ids []string) (*pluginapi.ContainerAllocateResponse, time.Duration, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	for key, e := range c.entries {
+		if now.Sub(e.at) > c.window {
+			delete(c.entries, key)
+		}
+	}
+	e, ok := c.entries[allocateKey(ids)]
+	if !ok {
+		return nil, 0, false
+	}
+	return e.response, now.Sub(e.at), true
+}
+
+// put : 记录设备集合的响应
+func (c *allocateCache) put(ids []string, response *pluginapi.ContainerAllocateResponse) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[allocateKey(ids)] = allocateCacheEntry{response: response, at: c.clock.Now()}
+}
+
+// reset : 设备列表变化或插件重启后清空，之前的响应可能已经不对应当前的设备
+func (c *allocateCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]allocateCacheEntry)
+}
+
+// cachedAllocation : 窗口内同一组设备的请求返回之前的响应，可能是kubelet重试，也可能是分配到同一组设备的其它容器
+func (plugin *NvidiaDevicePlugin) cachedAllocation(ctx context.Context, ids []string) (*pluginapi.ContainerAllocateResponse, bool) {
+	response, age, ok := plugin.allocations.get(ids)
+	if !ok {
+		return nil, false
+	}
+	allocateCacheHits.WithLabelValues(string(plugin.resourceName)).Inc()
+	l.FromContext(ctx).Debug("returning the cached Allocate response for the same devices", zap.String("resourceName", string(plugin.resourceName)), zap.Strings("deviceIDs", ids), zap.Duration("age", age))
+	return response, true
+}
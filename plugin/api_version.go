@@ -0,0 +1,190 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/kubelet/pkg/apis/deviceplugin/v1alpha"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// apiVersion 设备插件API版本的兼容信息
+type apiVersion struct {
+	Version string
+	// Kubelet : 接受该版本注册的kubelet版本
+	Kubelet string
+	// Implemented : 本插件是否实现了该版本
+	Implemented bool
+	// Features : 该版本支持的功能
+	Features []string
+	// register : 按该版本向kubelet注册
+	register func(ctx context.Context, plugin *NvidiaDevicePlugin, conn *grpc.ClientConn) error
+	// serve : 在gRPC服务器上注册该版本的设备插件服务
+	serve func(plugin *NvidiaDevicePlugin, server *grpc.Server)
+}
+
+// apiVersions 设备插件API版本兼容表，新版本发布后在这里增加注册和服务的实现
+var apiVersions = []apiVersion{
+	{
+		Version:     "v1",
+		Kubelet:     "not released",
+		Implemented: false,
+	},
+	{
+		Version:     pluginapi.Version,
+		Kubelet:     ">= 1.10",
+		Implemented: true,
+		Features:    []string{"ListAndWatch", "Allocate", "GetPreferredAllocation", "PreStartContainer", "Topology", "CDI"},
+		register:    registerV1beta1,
+		serve: func(plugin *NvidiaDevicePlugin, server *grpc.Server) {
+			pluginapi.RegisterDevicePluginServer(server, plugin)
+		},
+	},
+	{
+		Version:     v1alpha.Version,
+		Kubelet:     "1.8 - 1.9",
+		Implemented: true,
+		Features:    []string{"ListAndWatch", "Allocate"},
+		register:    registerV1alpha,
+		serve: func(plugin *NvidiaDevicePlugin, server *grpc.Server) {
+			v1alpha.RegisterDevicePluginServer(server, &v1alphaServer{plugin: plugin})
+		},
+	},
+}
+
+// findAPIVersion : 按版本号查找兼容信息
+func findAPIVersion(version string) (apiVersion, bool) {
+	for _, v := range apiVersions {
+		if v.Version == version {
+			return v, v.Implemented
+		}
+	}
+	return apiVersion{}, false
+}
+
+// logAPIVersions : 启动时输出API版本兼容表以及配置的尝试顺序
+func logAPIVersions(enabled []string) {
+	for _, v := range apiVersions {
+		l.Logger.Info("device plugin API version",
+			zap.String("version", v.Version),
+			zap.String("kubelet", v.Kubelet),
+			zap.Bool("implemented", v.Implemented),
+			zap.Bool("enabled", slices.Contains(enabled, v.Version)),
+			zap.Strings("features", v.Features))
+	}
+	l.Logger.Info("device plugin API versions tried in order", zap.Strings("apiVersions", enabled))
+}
+
+// versionUnsupported : kubelet是否因不支持该API版本而拒绝注册
+// 没有该版本的注册服务时返回 Unimplemented，有注册服务但不接受该版本时返回错误信息
+func versionUnsupported(err error) bool {
+	if status.Code(err) == codes.Unimplemented {
+		return true
+	}
+	return strings.Contains(err.Error(), "is not supported by kubelet")
+}
+
+// registerV1beta1 : 按v1beta1向kubelet注册
+func registerV1beta1(ctx context.Context, plugin *NvidiaDevicePlugin, conn *grpc.ClientConn) error {
+	client := pluginapi.NewRegistrationClient(conn)
+	reqt := &pluginapi.RegisterRequest{
+		Version:      pluginapi.Version,
+		Endpoint:     path.Base(plugin.socket),
+		ResourceName: string(plugin.resourceName),
+		Options: &pluginapi.DevicePluginOptions{
+			GetPreferredAllocationAvailable: plugin.preferredAllocationAvailable,
+		},
+	}
+	_, err := client.Register(ctx, reqt)
+	return err
+}
+
+// registerV1alpha : 按v1alpha向kubelet注册，只能提供 ListAndWatch 和 Allocate
+func registerV1alpha(ctx context.Context, plugin *NvidiaDevicePlugin, conn *grpc.ClientConn) error {
+	client := v1alpha.NewRegistrationClient(conn)
+	reqt := &v1alpha.RegisterRequest{
+		Version:      v1alpha.Version,
+		Endpoint:     path.Base(plugin.socket),
+		ResourceName: string(plugin.resourceName),
+	}
+	_, err := client.Register(ctx, reqt)
+	return err
+}
+
+// negotiateRegister : 按配置的顺序尝试API版本，返回kubelet接受的版本
+// kubelet明确不支持某个版本时尝试下一个，其它错误直接返回，所有尝试共用 ctx 的超时时间
+func (plugin *NvidiaDevicePlugin) negotiateRegister(ctx context.Context, conn *grpc.ClientConn) (string, error) {
+	var errs []error
+	for _, version := range plugin.apiVersions {
+		v, ok := findAPIVersion(version)
+		if !ok {
+			continue
+		}
+		err := v.register(ctx, plugin, conn)
+		if err == nil {
+			return version, nil
+		}
+		if !versionUnsupported(err) {
+			return "", err
+		}
+		l.Logger.Info("kubelet does not support device plugin API version, trying the next one", zap.String("resourceName", string(plugin.resourceName)), zap.String("version", version), zap.Error(err))
+		errs = append(errs, fmt.Errorf("%s: %w", version, err))
+	}
+	return "", fmt.Errorf("kubelet supports none of the device plugin API versions %v: %w", plugin.apiVersions, errors.Join(errs...))
+}
+
+// v1alphaServer 把v1alpha的设备插件请求转换为v1beta1处理
+type v1alphaServer struct {
+	plugin *NvidiaDevicePlugin
+}
+
+// ListAndWatch 更新设备列表
+func (s *v1alphaServer) ListAndWatch(e *v1alpha.Empty, stream v1alpha.DevicePlugin_ListAndWatchServer) error {
+	return s.plugin.ListAndWatch(&pluginapi.Empty{}, &v1alphaListAndWatchStream{stream})
+}
+
+// Allocate 分配设备，v1alpha每次请求只对应一个容器，CDI设备不会传给kubelet
+func (s *v1alphaServer) Allocate(ctx context.Context, reqs *v1alpha.AllocateRequest) (*v1alpha.AllocateResponse, error) {
+	resp, err := s.plugin.Allocate(ctx, &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: reqs.DevicesIDs}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.ContainerResponses) == 0 {
+		return &v1alpha.AllocateResponse{}, nil
+	}
+	c := resp.ContainerResponses[0]
+	res := &v1alpha.AllocateResponse{Envs: c.Envs, Annotations: c.Annotations}
+	for _, m := range c.Mounts {
+		res.Mounts = append(res.Mounts, &v1alpha.Mount{ContainerPath: m.ContainerPath, HostPath: m.HostPath, ReadOnly: m.ReadOnly})
+	}
+	for _, d := range c.Devices {
+		res.Devices = append(res.Devices, &v1alpha.DeviceSpec{ContainerPath: d.ContainerPath, HostPath: d.HostPath, Permissions: d.Permissions})
+	}
+	return res, nil
+}
+
+// v1alphaListAndWatchStream 把v1beta1的设备列表转换为v1alpha发送
+type v1alphaListAndWatchStream struct {
+	v1alpha.DevicePlugin_ListAndWatchServer
+}
+
+// Send 发送设备列表，v1alpha没有拓扑信息
+func (s *v1alphaListAndWatchStream) Send(resp *pluginapi.ListAndWatchResponse) error {
+	devices := make([]*v1alpha.Device, len(resp.Devices))
+	for i, d := range resp.Devices {
+		devices[i] = &v1alpha.Device{ID: d.ID, Health: d.Health}
+	}
+	return s.DevicePlugin_ListAndWatchServer.Send(&v1alpha.ListAndWatchResponse{Devices: devices})
+}
@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+)
+
+// 可写入 Allocate 响应注解的设备属性
+const (
+	AttributeUUID              = "uuid"
+	AttributeProduct           = "product"
+	AttributeMemory            = "memory"
+	AttributeComputeCapability = "computeCapability"
+	AttributeMigProfile        = "migProfile"
+	AttributeNUMANode          = "numaNode"
+	AttributeClique            = "clique"
+)
+
+// attributeValue : 单个设备的属性值，设备没有该属性时返回空
+func attributeValue(d *device.Device, attribute string) string {
+	switch attribute {
+	case AttributeUUID:
+		return d.GetUUID()
+	case AttributeProduct:
+		return d.Product
+	case AttributeMemory:
+		return strconv.FormatUint(d.TotalMemory/device.MiB, 10)
+	case AttributeComputeCapability:
+		return d.ComputeCapability
+	case AttributeMigProfile:
+		if d.IsMigDevice() {
+			return d.Product
+		}
+	case AttributeNUMANode:
+		if d.Topology != nil && len(d.Topology.Nodes) > 0 {
+			return strconv.FormatInt(d.Topology.Nodes[0].ID, 10)
+		}
+	case AttributeClique:
+		return d.Clique
+	}
+	return ""
+}
+
+// deviceAnnotations : 分配设备的属性注解，键为 <prefix>/<属性>，值按申请顺序列出每个GPU或MIG设备的属性，副本只计一次
+// 所有设备都没有某个属性时不写该注解，未配置属性时返回空
+func (plugin *NvidiaDevicePlugin) deviceAnnotations(ids []string) map[string]string {
+	if len(plugin.attributes) == 0 {
+		return nil
+	}
+	var devices []*device.Device
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		d := plugin.Devices().GetByID(id)
+		if d == nil || seen[d.GetUUID()] {
+			continue
+		}
+		seen[d.GetUUID()] = true
+		devices = append(devices, d)
+	}
+	res := make(map[string]string)
+	for _, a := range plugin.attributes {
+		values := make([]string, len(devices))
+		empty := true
+		for i, d := range devices {
+			values[i] = attributeValue(d, a)
+			empty = empty && values[i] == ""
+		}
+		if !empty {
+			res[plugin.attributePrefix+"/"+a] = strings.Join(values, ",")
+		}
+	}
+	return res
+}
@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 审计记录的写入结果
+const (
+	auditWritten = "written"
+	auditDropped = "dropped"
+)
+
+var auditRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "audit_records_total",
+	Help:      "Number of Allocate and GetPreferredAllocation audit records, by whether they were written or dropped by the rate limit.",
+}, []string{"resource", "method", "result"})
+
+// AuditContainer 审计记录中单个容器的请求和返回
+type AuditContainer struct {
+	// RequestedIDs : kubelet请求的设备ID，推荐分配时为必须包含的设备
+	RequestedIDs []string `json:"requestedIDs,omitempty"`
+	// AvailableIDs : 推荐分配时可选的设备ID
+	AvailableIDs []string `json:"availableIDs,omitempty"`
+	// Size : 推荐分配的设备数量
+	Size int `json:"size,omitempty"`
+	// DeviceIDs : 返回的设备ID，推荐分配时为推荐的设备
+	DeviceIDs []string `json:"deviceIDs,omitempty"`
+	// UUIDs : 设备ID对应的物理GPU或MIG设备
+	UUIDs       []string                `json:"uuids,omitempty"`
+	Envs        map[string]string       `json:"envs,omitempty"`
+	Mounts      []*pluginapi.Mount      `json:"mounts,omitempty"`
+	Devices     []*pluginapi.DeviceSpec `json:"devices,omitempty"`
+	Annotations map[string]string       `json:"annotations,omitempty"`
+}
+
+// Auditor 记录每次 Allocate 和 GetPreferredAllocation 的审计日志，超过速率限制的记录丢弃并计数，
+// 下一条写入的记录带上丢弃的数量，便于多租户集群的合规审查
+type Auditor struct {
+	logger              *zap.Logger
+	limiter             *rate.Limiter
+	preferredAllocation bool
+	dropped             atomic.Int64
+}
+
+// NewAuditor 创建审计日志
+func NewAuditor(cfg config.AuditConfig) (*Auditor, error) {
+	logger, err := l.NewAuditLogger(l.AuditLogConfig{
+		File:       cfg.File,
+		Stdout:     cfg.Stdout,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+	})
+	if err != nil {
+		return nil, err
+	}
+	limit := rate.Inf
+	if cfg.RateLimit > 0 {
+		limit = rate.Limit(cfg.RateLimit)
+	}
+	return &Auditor{
+		logger:              logger,
+		limiter:             rate.NewLimiter(limit, max(cfg.Burst, 1)),
+		preferredAllocation: cfg.PreferredAllocation,
+	}, nil
+}
+
+// Allocate : 记录一次分配请求，审计日志未开启时忽略
+func (a *Auditor) Allocate(ctx context.Context, resourceName string, reqs *pluginapi.AllocateRequest, resp *pluginapi.AllocateResponse, err error, latency time.Duration) {
+	if a == nil {
+		return
+	}
+	containers := make([]AuditContainer, len(reqs.GetContainerRequests()))
+	for i, req := range reqs.GetContainerRequests() {
+		containers[i] = AuditContainer{
+			RequestedIDs: req.DevicesIDs,
+			UUIDs:        device.AnnotatedIDs(req.DevicesIDs).GetIDs(),
+		}
+		if err == nil && i < len(resp.GetContainerResponses()) {
+			r := resp.ContainerResponses[i]
+			containers[i].Envs = r.Envs
+			containers[i].Mounts = r.Mounts
+			containers[i].Devices = r.Devices
+			containers[i].Annotations = r.Annotations
+		}
+	}
+	a.write(ctx, resourceName, methodAllocate, containers, err, latency)
+}
+
+// PreferredAllocation : 记录一次推荐分配请求，审计日志未开启或未配置记录推荐分配时忽略
+func (a *Auditor) PreferredAllocation(ctx context.Context, resourceName string, reqs *pluginapi.PreferredAllocationRequest, resp *pluginapi.PreferredAllocationResponse, err error, latency time.Duration) {
+	if a == nil || !a.preferredAllocation {
+		return
+	}
+	containers := make([]AuditContainer, len(reqs.GetContainerRequests()))
+	for i, req := range reqs.GetContainerRequests() {
+		containers[i] = AuditContainer{
+			RequestedIDs: req.MustIncludeDeviceIDs,
+			AvailableIDs: req.AvailableDeviceIDs,
+			Size:         int(req.AllocationSize),
+		}
+		if err == nil && i < len(resp.GetContainerResponses()) {
+			ids := resp.ContainerResponses[i].DeviceIDs
+			containers[i].DeviceIDs = ids
+			containers[i].UUIDs = device.AnnotatedIDs(ids).GetIDs()
+		}
+	}
+	a.write(ctx, resourceName, methodGetPreferredAllocation, containers, err, latency)
+}
+
+// write : 按速率限制写入一条审计记录
+func (a *Auditor) write(ctx context.Context, resourceName, method string, containers []AuditContainer, err error, latency time.Duration) {
+	if !a.limiter.Allow() {
+		a.dropped.Add(1)
+		auditRecords.WithLabelValues(resourceName, method, auditDropped).Inc()
+		return
+	}
+	auditRecords.WithLabelValues(resourceName, method, auditWritten).Inc()
+	fields := []zap.Field{
+		zap.String("resourceName", resourceName),
+		zap.String("method", method),
+		zap.Any("containers", containers),
+		zap.Duration("latency", latency),
+		zap.Bool("success", err == nil),
+	}
+	if id := l.RequestID(ctx); id != "" {
+		fields = append(fields, zap.String("requestId", id))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	if dropped := a.dropped.Swap(0); dropped > 0 {
+		fields = append(fields, zap.Int64("droppedSinceLast", dropped))
+	}
+	a.logger.Info("audit", fields...)
+}
+
+// Sync : 写入缓冲的审计记录
+func (a *Auditor) Sync() {
+	if a == nil {
+		return
+	}
+	_ = a.logger.Sync()
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// benchmarkResourceName 压测插件的资源名称，与正式资源区分监控指标
+const benchmarkResourceName = "gpu-benchmark"
+
+// BenchmarkPlugin 基于模拟GPU的压测插件，不向kubelet注册
+type BenchmarkPlugin struct {
+	*NvidiaDevicePlugin
+	// Available : 所有模拟设备的ID
+	Available []string
+	nvmllib   *simulate.Server
+}
+
+// Close 关闭模拟的NVML库
+func (b *BenchmarkPlugin) Close() {
+	b.nvmllib.Shutdown()
+}
+
+// NewBenchmarkPlugin : 用模拟GPU创建与当前插件分配策略相同的压测插件
+// 使用独立的并发限制，不向Pod或节点发送事件，不写审计日志，不调用外部分配策略，不影响正在运行的插件
+func (p *PluginManager) NewBenchmarkPlugin(sim *config.SimulateConfig) (*BenchmarkPlugin, error) {
+	nvmllib, err := simulate.New(sim)
+	if err != nil {
+		return nil, fmt.Errorf("error creating simulated GPUs: %w", err)
+	}
+	if ret := nvmllib.Init(); ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error initializing simulated NVML: %v", ret)
+	}
+	r := resource.NewResource("*", benchmarkResourceName, p.resourcePrefix)
+	dmp, _, err := device.NewDeviceMap(nvmllib, []*resource.Resource{r}, resource.MigStrategyNone, device.Filter{}, nil)
+	if err != nil {
+		nvmllib.Shutdown()
+		return nil, fmt.Errorf("error creating benchmark devices: %w", err)
+	}
+	devices := dmp[string(r.Name)]
+	// 只复制影响分配结果的选项，事件、审计、外部策略、维护状态、网卡亲和性等会访问生产环境的依赖不传入
+	opts := Options{
+		Clock:                      p.clock,
+		Limiter:                    NewLimiter(p.allocate.MaxConcurrent, p.allocate.QueueTimeout),
+		InstanceID:                 benchmarkResourceName,
+		UnhealthyPolicy:            p.pluginOptions.UnhealthyPolicy,
+		CudaVisibleDevicesOrdinals: p.pluginOptions.CudaVisibleDevicesOrdinals,
+		DeviceListStrategy:         p.pluginOptions.DeviceListStrategy,
+		NUMAPolicy:                 p.pluginOptions.NUMAPolicy,
+		RequireSameClique:          p.pluginOptions.RequireSameClique,
+		GDS:                        p.pluginOptions.GDS,
+		DeviceAttributes:           p.pluginOptions.DeviceAttributes,
+		AttributePrefix:            p.pluginOptions.AttributePrefix,
+		IdempotencyWindow:          p.pluginOptions.IdempotencyWindow,
+	}
+	pl, err := NewNvidiaDevicePlugin(r.Name, devices, nvmllib, opts)
+	if err != nil {
+		nvmllib.Shutdown()
+		return nil, err
+	}
+	b := &BenchmarkPlugin{NvidiaDevicePlugin: pl, nvmllib: nvmllib}
+	for _, d := range devices {
+		b.Available = append(b.Available, d.ID)
+	}
+	sort.Strings(b.Available)
+	return b, nil
+}
@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 检查点在存储中的位置
+const (
+	checkpointBucket = "checkpoint"
+	checkpointKey    = "devices"
+)
+
+// checkpointVersion 检查点格式版本，格式不兼容时递增
+const checkpointVersion = 1
+
+// checkpointTimeout 启动时查询已分配设备的超时时间
+const checkpointTimeout = 5 * time.Second
+
+var checkpointOrphaned = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "checkpoint_orphaned_devices",
+	Help:      "Number of device IDs from the previous checkpoint that are no longer advertised but still allocated to pods.",
+}, []string{"resource"})
+
+// Checkpoint 插件状态检查点，记录对外提供的设备ID、显存副本和排空状态
+// 插件重启后与之比较，发现仍被Pod使用的设备ID不再存在时告警
+type Checkpoint struct {
+	Version        int                 `json:"version"`
+	Time           time.Time           `json:"time"`
+	ConfigHash     string              `json:"configHash"`
+	MemoryChunkMiB uint64              `json:"memoryChunkMiB,omitempty"`
+	Resources      map[string][]string `json:"resources"`
+	Replicas       map[string]int      `json:"replicas,omitempty"`
+	Drained        []string            `json:"drained,omitempty"`
+}
+
+// Checkpoint : 最近写入的检查点，未写入时返回空
+func (p *PluginManager) Checkpoint() *Checkpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.checkpoint == nil {
+		return nil
+	}
+	c := *p.checkpoint
+	return &c
+}
+
+// configHash : 影响设备ID的配置摘要，配置变化时副本ID可能随之变化
+func (p *PluginManager) configHash(chunkMiB uint64) string {
+	resources := make([]string, 0, len(p.resources))
+	for _, r := range p.resources {
+		resources = append(resources, string(r.Pattern)+"="+string(r.Name))
+	}
+	var sharing []string
+	for _, r := range p.timeSlicing.Resources {
+		sharing = append(sharing, fmt.Sprintf("%s=%d", r.Name, r.Replicas))
+	}
+	data, _ := json.Marshal(struct {
+		MigStrategy     string   `json:"migStrategy"`
+		Platform        string   `json:"platform"`
+		Include         []string `json:"include"`
+		Exclude         []string `json:"exclude"`
+		Resources       []string `json:"resources"`
+		MemoryResource  string   `json:"memoryResource,omitempty"`
+		MemoryChunkMiB  uint64   `json:"memoryChunkMiB,omitempty"`
+		Sharing         []string `json:"sharing,omitempty"`
+		RenameByDefault bool     `json:"renameByDefault,omitempty"`
+	}{p.migStrategy, p.platform, p.filter.Include, p.filter.Exclude, resources, string(p.memoryResource), chunkMiB, sharing, p.timeSlicing.RenameByDefault})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// loadCheckpoint : 从存储中读取上次的检查点，不存在或格式不兼容时返回空
+func (p *PluginManager) loadCheckpoint() *Checkpoint {
+	if p.store == nil {
+		return nil
+	}
+	data, err := p.store.Get(checkpointBucket, checkpointKey)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			l.Logger.Warn("failed to load checkpoint", zap.Error(err))
+		}
+		return nil
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		l.Logger.Warn("invalid checkpoint, ignoring", zap.Error(err))
+		return nil
+	}
+	if c.Version != checkpointVersion {
+		l.Logger.Warn("unsupported checkpoint version, ignoring", zap.Int("version", c.Version))
+		return nil
+	}
+	return &c
+}
+
+// restoreCheckpoint : 首次加载插件前恢复上次的显存分块大小
+// 分块大小变化会改变显存副本的ID，仍有Pod使用旧副本时沿用旧的分块大小，待这些Pod结束后重启插件再生效，调用方持有 p.mu
+func (p *PluginManager) restoreCheckpoint() {
+	prev := p.loadCheckpoint()
+	p.checkpoint = prev
+	if prev == nil {
+		return
+	}
+	l.Logger.Info("restored checkpoint", zap.Time("time", prev.Time), zap.String("configHash", prev.ConfigHash))
+	if p.memory == nil || prev.MemoryChunkMiB == 0 || prev.MemoryChunkMiB == p.gpuMemory.ChunkMiB {
+		return
+	}
+	inUse := p.allocatedIDs(string(p.memoryResource), prev.Resources[string(p.memoryResource)])
+	if len(inUse) == 0 {
+		return
+	}
+	l.Logger.Warn("GPU memory chunk size changed while chunks are still allocated, keeping the previous chunk size until they are released and the plugin restarts",
+		zap.Uint64("chunkMiB", p.gpuMemory.ChunkMiB), zap.Uint64("previousChunkMiB", prev.MemoryChunkMiB), zap.Int("allocated", len(inUse)))
+	p.gpuMemory.ChunkMiB = prev.MemoryChunkMiB
+	p.memory = NewMemoryTracker(string(p.memoryResource), p.gpuMemory.ChunkMiB, p.lister, p.clock)
+}
+
+// saveCheckpoint : 设备变化后写入检查点，并报告上次检查点中仍被使用但已不存在的设备ID，调用方持有 p.mu
+func (p *PluginManager) saveCheckpoint() {
+	c := p.newCheckpoint()
+	if prev := p.checkpoint; prev != nil {
+		if prev.ConfigHash != c.ConfigHash {
+			l.Logger.Info("device configuration changed since the last checkpoint", zap.String("previous", prev.ConfigHash), zap.String("current", c.ConfigHash))
+		}
+		p.reportOrphaned(prev, c)
+	}
+	p.checkpoint = c
+	if p.store == nil {
+		return
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		l.Logger.Warn("error encoding checkpoint", zap.Error(err))
+		return
+	}
+	if err := p.store.Put(checkpointBucket, checkpointKey, data); err != nil {
+		l.Logger.Warn("failed to write checkpoint", zap.Error(err))
+	}
+}
+
+// newCheckpoint : 根据当前设备生成检查点，调用方持有 p.mu
+func (p *PluginManager) newCheckpoint() *Checkpoint {
+	c := &Checkpoint{
+		Version:    checkpointVersion,
+		Time:       p.clock.Now(),
+		ConfigHash: p.configHash(p.gpuMemory.ChunkMiB),
+		Resources:  make(map[string][]string, len(p.devices)),
+	}
+	for name, devices := range p.devices {
+		ids := make([]string, 0, len(devices))
+		for id := range devices {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		c.Resources[name] = ids
+	}
+	if p.memory != nil {
+		c.MemoryChunkMiB = p.gpuMemory.ChunkMiB
+		c.Replicas = make(map[string]int)
+		for id := range p.devices[string(p.memoryResource)] {
+			c.Replicas[device.AnnotatedID(id).GetID()]++
+		}
+	}
+	p.drainMu.Lock()
+	for uuid := range p.drains {
+		c.Drained = append(c.Drained, uuid)
+	}
+	p.drainMu.Unlock()
+	sort.Strings(c.Drained)
+	return c
+}
+
+// reportOrphaned : 上次检查点中不再提供、但仍分配给Pod的设备ID，这些Pod持有的设备kubelet已无法核对
+func (p *PluginManager) reportOrphaned(prev, cur *Checkpoint) {
+	for name, ids := range prev.Resources {
+		current := make(map[string]bool, len(cur.Resources[name]))
+		for _, id := range cur.Resources[name] {
+			current[id] = true
+		}
+		var gone []string
+		for _, id := range ids {
+			if !current[id] {
+				gone = append(gone, id)
+			}
+		}
+		orphaned := p.allocatedIDs(name, gone)
+		checkpointOrphaned.WithLabelValues(name).Set(float64(len(orphaned)))
+		if len(orphaned) > 0 {
+			l.Logger.Warn("device IDs from the previous checkpoint are gone but still allocated to pods", zap.String("resourceName", name), zap.Strings("ids", orphaned))
+		}
+	}
+}
+
+// allocatedIDs : ids中仍分配给Pod的设备ID，无法查询分配情况时返回空
+func (p *PluginManager) allocatedIDs(resourceName string, ids []string) []string {
+	if p.lister == nil || len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, checkpointTimeout)
+	defer cancel()
+	allocations, err := p.lister.List(ctx)
+	if err != nil {
+		l.Logger.Warn("failed to list allocated devices", zap.Error(err))
+		return nil
+	}
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var res []string
+	for _, a := range allocations {
+		if a.ResourceName != resourceName {
+			continue
+		}
+		for _, id := range a.DeviceIDs {
+			if wanted[id] {
+				res = append(res, id)
+				delete(wanted, id)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+)
+
+// Acknowledgement kubelet最近一次通过 ListAndWatch 成功收到的设备列表
+type Acknowledgement struct {
+	Devices int       `json:"devices"`
+	Healthy int       `json:"healthy"`
+	At      time.Time `json:"at"`
+}
+
+// ResourceConvergence 单个资源期望提供的设备数与实际注册、kubelet已收到的设备数
+type ResourceConvergence struct {
+	ResourceName string `json:"resourceName"`
+	// Desired : 根据配置和设备发现期望提供的设备数，包含副本
+	Desired int `json:"desired"`
+	// Registered : 已向kubelet注册的插件提供的设备数，未注册时为0
+	Registered   int              `json:"registered"`
+	State        string           `json:"state"`
+	Acknowledged *Acknowledgement `json:"acknowledged,omitempty"`
+	Converged    bool             `json:"converged"`
+	Reason       string           `json:"reason,omitempty"`
+}
+
+// Convergence 节点上的资源是否都已按期望提供给kubelet
+type Convergence struct {
+	Converged bool                  `json:"converged"`
+	Resources []ResourceConvergence `json:"resources"`
+}
+
+// setAcknowledged 记录kubelet最近一次收到的设备列表
+func (plugin *NvidiaDevicePlugin) setAcknowledged(capacity device.Capacity) {
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	plugin.status.Acknowledged = &Acknowledgement{Devices: capacity.Schedulable, Healthy: capacity.HealthySchedulable, At: plugin.clock.Now()}
+}
+
+// Convergence : 比较期望提供的资源、已注册的插件以及kubelet通过 ListAndWatch 收到的设备
+// 用于发布后确认节点已收敛，插件尚未加载时返回未收敛且没有资源
+func (p *PluginManager) Convergence() Convergence {
+	res := Convergence{Resources: make([]ResourceConvergence, 0)}
+	if !p.Loaded() {
+		return res
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	desired := make(map[string]int)
+	for name, devices := range p.devices {
+		desired[name] = len(devices)
+	}
+	for _, pl := range p.plugins {
+		if p.shouldServe(pl) {
+			if _, ok := desired[pl.Status().ResourceName]; !ok {
+				desired[pl.Status().ResourceName] = 0
+			}
+		}
+	}
+	res.Converged = true
+	for _, name := range sortedKeys(desired) {
+		r := ResourceConvergence{ResourceName: name, Desired: desired[name], State: StateStopped}
+		pl := p.findPlugin(name)
+		if pl != nil {
+			status := pl.Status()
+			r.State = status.State
+			r.Acknowledged = status.Acknowledged
+			if status.State == StateRegistered {
+				r.Registered = len(pl.Devices())
+			}
+		}
+		switch {
+		case p.withheld():
+			r.Reason = "withheld by driver policy"
+		case pl == nil:
+			r.Reason = "no plugin for resource"
+		case r.State != StateRegistered:
+			r.Reason = "plugin is not registered with kubelet"
+		case !pl.Status().Watching || r.Acknowledged == nil:
+			r.Reason = "kubelet is not watching the device list"
+		case r.Acknowledged.Devices != r.Desired:
+			r.Reason = fmt.Sprintf("kubelet received %d of %d devices", r.Acknowledged.Devices, r.Desired)
+		default:
+			r.Converged = true
+		}
+		res.Converged = res.Converged && r.Converged
+		res.Resources = append(res.Resources, r)
+	}
+	return res
+}
@@ -0,0 +1,309 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 设备健康状态的来源
+const (
+	HealthBackendNVML = "nvml"
+	HealthBackendDCGM = "dcgm"
+)
+
+// DCGM健康监控的状态，Failure 时把GPU标记为不健康，Warning 只记录
+const (
+	dcgmHealthWarning = "Warning"
+	dcgmHealthFailure = "Failure"
+)
+
+// dcgmDiagFail DCGM诊断测试失败的状态
+const dcgmDiagFail = "Fail"
+
+var (
+	dcgmUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "dcgm",
+		Name:      "up",
+		Help:      "Whether the last DCGM health check against nv-hostengine succeeded.",
+	})
+	dcgmHealthIncidents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "dcgm",
+		Name:      "health_incidents",
+		Help:      "DCGM health watch incidents of the last check by GPU, system (e.g. PCIe, Memory, Thermal) and health (Warning or Failure).",
+	}, []string{"uuid", "system", "health"})
+	dcgmDiagPassed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "dcgm",
+		Name:      "diag_passed",
+		Help:      "Whether the GPU passed the DCGM diagnostic test in the last completed run (1) or failed it (0).",
+	}, []string{"uuid", "test"})
+	dcgmDiagTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "dcgm",
+		Name:      "diag_last_run_timestamp_seconds",
+		Help:      "Unix time the last DCGM diagnostic run finished.",
+	})
+)
+
+// DCGMIncident DCGM健康监控发现的问题
+type DCGMIncident struct {
+	// GPU : DCGM的GPU ID，不一定与NVML索引一致，按UUID匹配设备
+	GPU  uint   `json:"gpu"`
+	UUID string `json:"uuid,omitempty"`
+	// System : 子系统的健康监控，如 PCIe watches、Memory watches
+	System string `json:"system"`
+	// Health : Warning 或 Failure
+	Health  string `json:"health"`
+	Message string `json:"message,omitempty"`
+}
+
+// DCGMDiagResult DCGM诊断中一块GPU的一项测试结果
+type DCGMDiagResult struct {
+	GPU     uint   `json:"gpu"`
+	UUID    string `json:"uuid,omitempty"`
+	Test    string `json:"test"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// DCGMDiagStatus 最近一次DCGM诊断
+type DCGMDiagStatus struct {
+	Level    int              `json:"level"`
+	Running  bool             `json:"running"`
+	Started  time.Time        `json:"started,omitempty"`
+	Finished time.Time        `json:"finished,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Results  []DCGMDiagResult `json:"results"`
+}
+
+// DCGMStatus 使用DCGM作为健康状态来源时的检查结果
+type DCGMStatus struct {
+	Backend    string          `json:"backend"`
+	HostEngine string          `json:"hostEngine,omitempty"`
+	LastCheck  time.Time       `json:"lastCheck,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Incidents  []DCGMIncident  `json:"incidents"`
+	Diag       *DCGMDiagStatus `json:"diag,omitempty"`
+}
+
+// dcgmClient DCGM的访问接口，Linux上通过 go-dcgm 连接节点上已运行的 nv-hostengine
+type dcgmClient interface {
+	// Health : 所有DCGM支持的GPU的健康监控问题
+	Health() ([]DCGMIncident, error)
+	// Diag : 对所有DCGM支持的GPU运行诊断，返回各GPU的测试结果，诊断期间阻塞
+	Diag(level int) ([]DCGMDiagResult, error)
+	// Close : 断开与 nv-hostengine 的连接
+	Close()
+}
+
+// dcgmHealthChecker 通过DCGM健康监控检查GPU，每轮检查前一次获取所有GPU的结果，按UUID匹配到设备，
+// 不在插件中注册NVML事件，避免与节点上的DCGM重复消费
+type dcgmHealthChecker struct {
+	client      dcgmClient
+	clock       clock.Clock
+	mu          sync.RWMutex
+	lastCheck   time.Time
+	err         error
+	incidents   []DCGMIncident
+	incidentsOf map[string][]DCGMIncident
+}
+
+// Name : 检查器名称
+func (c *dcgmHealthChecker) Name() string {
+	return HealthCheckerDCGM
+}
+
+// Recoverable : DCGM不再报告问题后恢复，需要重置的故障DCGM会持续报告
+func (c *dcgmHealthChecker) Recoverable() bool {
+	return true
+}
+
+// Prepare : 获取所有GPU的健康监控结果
+func (c *dcgmHealthChecker) Prepare(_ context.Context) error {
+	incidents, err := c.client.Health()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCheck = c.clock.Now()
+	c.err = err
+	if err != nil {
+		dcgmUp.Set(0)
+		return err
+	}
+	dcgmUp.Set(1)
+	dcgmHealthIncidents.Reset()
+	c.incidents = incidents
+	c.incidentsOf = make(map[string][]DCGMIncident)
+	for _, i := range incidents {
+		dcgmHealthIncidents.WithLabelValues(i.UUID, i.System, i.Health).Set(1)
+		c.incidentsOf[i.UUID] = append(c.incidentsOf[i.UUID], i)
+	}
+	return nil
+}
+
+// Check : DCGM对GPU报告 Failure 时标记为不健康
+func (c *dcgmHealthChecker) Check(_ context.Context, gpu HealthTarget) (HealthResult, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var failures []string
+	for _, i := range c.incidentsOf[gpu.UUID] {
+		if i.Health == dcgmHealthFailure {
+			failures = append(failures, i.System+": "+i.Message)
+		}
+	}
+	if len(failures) == 0 {
+		return HealthResult{}, nil
+	}
+	return HealthResult{Reason: HealthReason{Code: HealthReasonDCGM, Message: "DCGM health failure: " + strings.Join(failures, "; ")}}, nil
+}
+
+// status : 最近一次检查的结果
+func (c *dcgmHealthChecker) status(s *DCGMStatus) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s.LastCheck = c.lastCheck
+	if c.err != nil {
+		s.Error = c.err.Error()
+	}
+	s.Incidents = append(s.Incidents, c.incidents...)
+}
+
+// dcgmDiagChecker 定期运行DCGM诊断，把测试失败的GPU标记为不健康，直到下一次诊断通过
+// 诊断可能运行数分钟，在后台运行，完成后通过 done 触发一次检查以应用结果
+type dcgmDiagChecker struct {
+	client   dcgmClient
+	clock    clock.Clock
+	level    int
+	interval time.Duration
+	done     func()
+	mu       sync.Mutex
+	diag     DCGMDiagStatus
+	// failed : 最近一次完成的诊断中失败的测试，按GPU UUID
+	failed map[string][]string
+}
+
+// Name : 检查器名称
+func (c *dcgmDiagChecker) Name() string {
+	return HealthCheckerDCGMDiag
+}
+
+// Recoverable : 下一次诊断通过后恢复
+func (c *dcgmDiagChecker) Recoverable() bool {
+	return true
+}
+
+// Prepare : 距上次开始诊断已超过间隔时在后台开始新的诊断，检查使用最近一次完成的结果
+func (c *dcgmDiagChecker) Prepare(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.diag.Running && (c.diag.Started.IsZero() || c.clock.Since(c.diag.Started) >= c.interval) {
+		c.diag.Running = true
+		c.diag.Started = c.clock.Now()
+		go c.run()
+	}
+	return nil
+}
+
+// run : 运行诊断并保存结果
+func (c *dcgmDiagChecker) run() {
+	l.Logger.Info("starting DCGM diagnostic", zap.Int("level", c.level))
+	results, err := c.client.Diag(c.level)
+	c.mu.Lock()
+	c.diag.Running = false
+	c.diag.Finished = c.clock.Now()
+	c.diag.Error = ""
+	if err != nil {
+		c.diag.Error = err.Error()
+		c.mu.Unlock()
+		l.Logger.Warn("DCGM diagnostic failed", zap.Error(err))
+		return
+	}
+	dcgmDiagPassed.Reset()
+	c.failed = make(map[string][]string)
+	for _, r := range results {
+		passed := 1.0
+		if r.Status == dcgmDiagFail {
+			passed = 0
+			msg := r.Test
+			if r.Message != "" {
+				msg += " (" + r.Message + ")"
+			}
+			c.failed[r.UUID] = append(c.failed[r.UUID], msg)
+		}
+		dcgmDiagPassed.WithLabelValues(r.UUID, r.Test).Set(passed)
+	}
+	c.diag.Results = results
+	dcgmDiagTimestamp.Set(float64(c.diag.Finished.Unix()))
+	c.mu.Unlock()
+	l.Logger.Info("DCGM diagnostic finished", zap.Int("level", c.level), zap.Int("results", len(results)))
+	c.done()
+}
+
+// Check : 最近一次诊断中有测试失败的GPU标记为不健康
+func (c *dcgmDiagChecker) Check(_ context.Context, gpu HealthTarget) (HealthResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	failed := c.failed[gpu.UUID]
+	if len(failed) == 0 {
+		return HealthResult{}, nil
+	}
+	return HealthResult{Reason: HealthReason{Code: HealthReasonDCGMDiag, Message: "DCGM diagnostic failed: " + strings.Join(failed, "; ")}}, nil
+}
+
+// status : 最近一次诊断
+func (c *dcgmDiagChecker) status() *DCGMDiagStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.diag
+	s.Level = c.level
+	s.Results = append([]DCGMDiagResult{}, c.diag.Results...)
+	return &s
+}
+
+// registerDCGMCheckers : 注册DCGM健康和诊断检查器
+func (p *PluginManager) registerDCGMCheckers(interval time.Duration) {
+	p.dcgm = newDCGMClient(p.dcgmConfig.HostEngine)
+	p.dcgmHealth = &dcgmHealthChecker{client: p.dcgm, clock: p.clock}
+	p.RegisterHealthChecker(p.dcgmHealth, interval)
+	if p.dcgmConfig.DiagInterval > 0 {
+		p.dcgmDiag = &dcgmDiagChecker{
+			client:   p.dcgm,
+			clock:    p.clock,
+			level:    p.dcgmConfig.DiagLevel,
+			interval: p.dcgmConfig.DiagInterval,
+			done:     func() { p.requestHealthCheck(HealthCheckerDCGMDiag) },
+		}
+		p.RegisterHealthChecker(p.dcgmDiag, p.dcgmConfig.DiagInterval)
+	}
+}
+
+// closeDCGM : 断开与 nv-hostengine 的连接
+func (p *PluginManager) closeDCGM() {
+	if p.dcgm != nil {
+		p.dcgm.Close()
+	}
+}
+
+// DCGMStatus : DCGM健康监控和诊断的最近结果，健康状态来源不是DCGM时只有 backend
+func (p *PluginManager) DCGMStatus() DCGMStatus {
+	s := DCGMStatus{Backend: p.healthBackend, Incidents: make([]DCGMIncident, 0)}
+	if p.dcgmHealth == nil {
+		return s
+	}
+	s.HostEngine = p.dcgmConfig.HostEngine
+	p.dcgmHealth.status(&s)
+	if p.dcgmDiag != nil {
+		s.Diag = p.dcgmDiag.status()
+	}
+	return s
+}
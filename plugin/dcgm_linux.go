@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"go.uber.org/zap"
+)
+
+// 诊断中没有运行的测试，不记录结果
+var dcgmDiagSkipped = map[string]bool{"": true, "skipped": true, "notrun": true}
+
+// hostEngineClient 通过 go-dcgm 连接节点上已运行的 nv-hostengine，连接在第一次使用时建立，出错后下次使用时重连
+// 健康监控和诊断都在插件自己创建的GPU组上进行，不修改 nv-hostengine 上其他组件使用的组
+type hostEngineClient struct {
+	address string
+	mu      sync.Mutex
+	// connected : 是否已连接，go-dcgm 的连接是进程级的
+	connected bool
+	// uuids : DCGM GPU ID 对应的GPU UUID
+	uuids map[uint]string
+}
+
+// newDCGMClient : 创建 nv-hostengine 客户端，address 为 host:port 或 unix socket 路径
+func newDCGMClient(address string) dcgmClient {
+	return &hostEngineClient{address: address}
+}
+
+// connect : 连接 nv-hostengine 并获取所有支持的GPU的UUID，返回GPU ID和UUID
+func (c *hostEngineClient) connect() (map[uint]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		return c.uuids, nil
+	}
+	socket := "0"
+	if strings.HasPrefix(c.address, "/") {
+		socket = "1"
+	}
+	if _, err := dcgm.Init(dcgm.Standalone, c.address, socket); err != nil {
+		return nil, fmt.Errorf("error connecting to nv-hostengine at %s: %w", c.address, err)
+	}
+	gpus, err := dcgm.GetSupportedDevices()
+	if err != nil {
+		dcgm.Shutdown()
+		return nil, fmt.Errorf("error listing DCGM GPUs: %w", err)
+	}
+	uuids := make(map[uint]string, len(gpus))
+	for _, gpu := range gpus {
+		info, err := dcgm.GetDeviceInfo(gpu)
+		if err != nil {
+			dcgm.Shutdown()
+			return nil, fmt.Errorf("error getting DCGM GPU %d: %w", gpu, err)
+		}
+		uuids[gpu] = info.UUID
+	}
+	l.Logger.Info("connected to nv-hostengine", zap.String("address", c.address), zap.Int("gpus", len(uuids)))
+	c.connected = true
+	c.uuids = uuids
+	return uuids, nil
+}
+
+// reset : 断开连接，nv-hostengine 重启后旧连接失效，下次使用时重连并重新获取GPU列表
+func (c *hostEngineClient) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		dcgm.Shutdown()
+		c.connected = false
+		c.uuids = nil
+	}
+}
+
+// Health : 逐块GPU检查所有健康监控，go-dcgm 为每次检查创建临时组并在其上设置监控
+func (c *hostEngineClient) Health() ([]DCGMIncident, error) {
+	uuids, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	var incidents []DCGMIncident
+	for _, gpu := range sortedGPUs(uuids) {
+		h, err := dcgm.HealthCheckByGpuId(gpu)
+		if err != nil {
+			c.reset()
+			return nil, fmt.Errorf("error checking health of DCGM GPU %d: %w", gpu, err)
+		}
+		for _, w := range h.Watches {
+			if w.Status != dcgmHealthWarning && w.Status != dcgmHealthFailure {
+				continue
+			}
+			incidents = append(incidents, DCGMIncident{GPU: gpu, UUID: uuids[gpu], System: w.Type, Health: w.Status, Message: w.Error})
+		}
+	}
+	return incidents, nil
+}
+
+// Diag : 在插件自己创建的组上运行诊断，结束后删除该组
+func (c *hostEngineClient) Diag(level int) ([]DCGMDiagResult, error) {
+	uuids, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	group, err := dcgm.CreateGroup(fmt.Sprintf("k8s-gpu-device-plugin-diag-%d", os.Getpid()))
+	if err != nil {
+		c.reset()
+		return nil, err
+	}
+	defer dcgm.DestroyGroup(group)
+	for _, gpu := range sortedGPUs(uuids) {
+		if err := dcgm.AddToGroup(group, gpu); err != nil {
+			return nil, fmt.Errorf("error adding DCGM GPU %d to the diagnostic group: %w", gpu, err)
+		}
+	}
+	diag, err := dcgm.RunDiag(dcgm.DiagType(level), group)
+	if err != nil {
+		return nil, fmt.Errorf("error running DCGM diagnostic: %w", err)
+	}
+	var results []DCGMDiagResult
+	for _, g := range diag.PerGpu {
+		for _, r := range g.DiagResults {
+			if dcgmDiagSkipped[r.Status] || r.TestName == "" {
+				continue
+			}
+			results = append(results, DCGMDiagResult{GPU: g.GPU, UUID: uuids[g.GPU], Test: r.TestName, Status: r.Status, Message: r.ErrorMessage})
+		}
+	}
+	return results, nil
+}
+
+// Close : 断开与 nv-hostengine 的连接
+func (c *hostEngineClient) Close() {
+	c.reset()
+}
+
+// sortedGPUs : 按GPU ID排序的DCGM GPU
+func sortedGPUs(uuids map[uint]string) []uint {
+	gpus := make([]uint, 0, len(uuids))
+	for gpu := range uuids {
+		gpus = append(gpus, gpu)
+	}
+	sort.Slice(gpus, func(i, j int) bool { return gpus[i] < gpus[j] })
+	return gpus
+}
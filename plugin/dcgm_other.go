@@ -0,0 +1,31 @@
+//go:build !linux
+
+package plugin
+
+import (
+	"errors"
+)
+
+// errDCGMUnsupported DCGM只支持Linux
+var errDCGMUnsupported = errors.New("DCGM is only supported on Linux")
+
+// unsupportedDCGMClient 非Linux平台的DCGM客户端，所有检查都返回错误
+type unsupportedDCGMClient struct{}
+
+// newDCGMClient : 非Linux平台不支持DCGM
+func newDCGMClient(string) dcgmClient {
+	return unsupportedDCGMClient{}
+}
+
+// Health : 不支持
+func (unsupportedDCGMClient) Health() ([]DCGMIncident, error) {
+	return nil, errDCGMUnsupported
+}
+
+// Diag : 不支持
+func (unsupportedDCGMClient) Diag(int) ([]DCGMDiagResult, error) {
+	return nil, errDCGMUnsupported
+}
+
+// Close : 无需处理
+func (unsupportedDCGMClient) Close() {}
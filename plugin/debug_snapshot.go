@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
+)
+
+// DebugResource 配置的资源及匹配设备的模式
+type DebugResource struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// DebugSnapshot 设备发现和插件状态的快照，用于附加到问题报告
+type DebugSnapshot struct {
+	Time        time.Time           `json:"time"`
+	NodeName    string              `json:"nodeName"`
+	Version     version.Info        `json:"version"`
+	Driver      DriverCompatibility `json:"driver"`
+	MigStrategy string              `json:"migStrategy"`
+	Resources   []DebugResource     `json:"resources"`
+	// DeviceMap : 各资源发现的设备，共享的设备已展开为副本
+	DeviceMap         json.RawMessage         `json:"deviceMap"`
+	Excluded          []device.ExcludedDevice `json:"excluded"`
+	Plugins           []Status                `json:"plugins"`
+	Capacity          []ResourceCapacity      `json:"capacity"`
+	SharingMismatches []SharingMismatch       `json:"sharingMismatches"`
+	NVMLFaults        []NVMLFault             `json:"nvmlFaults"`
+	Drains            []DrainState            `json:"drains"`
+	Maintenance       MaintenanceStatus       `json:"maintenance"`
+}
+
+// EffectiveConfig : 合并默认值后的运行配置，去除认证信息
+func (p *PluginManager) EffectiveConfig() (map[string]interface{}, error) {
+	return config.Sanitized(p.config)
+}
+
+// DebugSnapshot : 当前的设备发现结果、资源和插件状态
+func (p *PluginManager) DebugSnapshot() (DebugSnapshot, error) {
+	p.mu.RLock()
+	s := DebugSnapshot{
+		Time:        p.clock.Now(),
+		NodeName:    p.config.Kubernetes.NodeName,
+		MigStrategy: p.migStrategy,
+		Resources:   make([]DebugResource, 0, len(p.resources)),
+		Excluded:    append([]device.ExcludedDevice{}, p.excluded...),
+	}
+	for _, r := range p.resources {
+		s.Resources = append(s.Resources, DebugResource{Name: string(r.Name), Pattern: string(r.Pattern)})
+	}
+	// 设备在锁内序列化，避免与重新发现设备并发
+	devices, err := json.Marshal(p.devices)
+	p.mu.RUnlock()
+	if err != nil {
+		return DebugSnapshot{}, fmt.Errorf("error encoding devices: %w", err)
+	}
+	s.DeviceMap = devices
+	s.Version = version.Get(p.DriverVersions())
+	s.Driver = p.DriverCompatibility()
+	s.Plugins = p.PluginStatuses()
+	s.Capacity = p.Capacity()
+	s.SharingMismatches = p.SharingMismatches()
+	s.NVMLFaults = p.NVMLFaults()
+	s.Drains = p.Drains()
+	s.Maintenance = p.Maintenance()
+	return s, nil
+}
@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 重启前后设备的变化类型
+const (
+	DeviceAdded   = "added"
+	DeviceRemoved = "removed"
+	DeviceChanged = "changed"
+)
+
+var restartDeviceDelta = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "restart_device_delta",
+	Help:      "Change in the number of advertised devices across the last plugin restart, by resource.",
+}, []string{"resource"})
+
+// DeviceChange 重启前后单个设备的变化
+type DeviceChange struct {
+	Resource string `json:"resource"`
+	ID       string `json:"id"`
+	Change   string `json:"change"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// DeviceMapDiff 重启前后的设备映射差异，用于确认驱动升级等操作后没有设备丢失
+type DeviceMapDiff struct {
+	Before  map[string]int `json:"before"`
+	After   map[string]int `json:"after"`
+	Changes []DeviceChange `json:"changes,omitempty"`
+}
+
+// Empty 设备没有变化
+func (d DeviceMapDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// DiffDeviceMaps 比较重启前后的设备映射，excluded 为重启后被过滤的设备，用于说明设备被移除的原因
+func DiffDeviceMaps(before, after device.DeviceMap, excluded []device.ExcludedDevice) DeviceMapDiff {
+	diff := DeviceMapDiff{Before: make(map[string]int), After: make(map[string]int)}
+	names := make(map[string]bool)
+	for name, devices := range before {
+		names[name] = true
+		diff.Before[name] = len(devices)
+	}
+	for name, devices := range after {
+		names[name] = true
+		diff.After[name] = len(devices)
+	}
+	excludedReasons := make(map[string]string, len(excluded))
+	for _, d := range excluded {
+		excludedReasons[d.UUID] = d.Reason
+	}
+	for _, name := range sortedKeys(names) {
+		added, removed := diffDevices(before[name], after[name])
+		for _, id := range removed {
+			reason := "no longer discovered"
+			if other := findResource(after, id, name); other != "" {
+				reason = "moved to " + other
+			} else if r, ok := excludedReasons[device.AnnotatedID(id).GetID()]; ok {
+				reason = "excluded: " + r
+			}
+			diff.Changes = append(diff.Changes, DeviceChange{Resource: name, ID: id, Change: DeviceRemoved, Reason: reason})
+		}
+		for _, id := range added {
+			reason := "newly discovered"
+			if other := findResource(before, id, name); other != "" {
+				reason = "moved from " + other
+			}
+			diff.Changes = append(diff.Changes, DeviceChange{Resource: name, ID: id, Change: DeviceAdded, Reason: reason})
+		}
+		ids := make([]string, 0, len(after[name]))
+		for id := range after[name] {
+			if _, ok := before[name][id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if reasons := deviceDifferences(before[name][id], after[name][id]); len(reasons) > 0 {
+				diff.Changes = append(diff.Changes, DeviceChange{Resource: name, ID: id, Change: DeviceChanged, Reason: strings.Join(reasons, ", ")})
+			}
+		}
+	}
+	return diff
+}
+
+// findResource 设备ID所在的其它资源，不存在时返回空
+func findResource(dmp device.DeviceMap, id, except string) string {
+	names := make(map[string]bool, len(dmp))
+	for name := range dmp {
+		names[name] = name != except
+	}
+	for _, name := range sortedKeys(names) {
+		if !names[name] {
+			continue
+		}
+		if _, ok := dmp[name][id]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// deviceDifferences 同一设备ID前后不同的属性
+func deviceDifferences(a, b *device.Device) []string {
+	var res []string
+	if a.Index != b.Index {
+		res = append(res, fmt.Sprintf("index %s -> %s", a.Index, b.Index))
+	}
+	if a.TotalMemory != b.TotalMemory {
+		res = append(res, fmt.Sprintf("memory %d -> %d", a.TotalMemory, b.TotalMemory))
+	}
+	if a.ComputeCapability != b.ComputeCapability {
+		res = append(res, fmt.Sprintf("compute capability %s -> %s", a.ComputeCapability, b.ComputeCapability))
+	}
+	if a.Replicas != b.Replicas {
+		res = append(res, fmt.Sprintf("replicas %d -> %d", a.Replicas, b.Replicas))
+	}
+	if !slices.Equal(a.Paths, b.Paths) {
+		res = append(res, fmt.Sprintf("paths %v -> %v", a.Paths, b.Paths))
+	}
+	if an, bn := numaOf(a), numaOf(b); an != bn {
+		res = append(res, fmt.Sprintf("NUMA node %s -> %s", an, bn))
+	}
+	if a.Clique != b.Clique {
+		res = append(res, fmt.Sprintf("fabric clique %q -> %q", a.Clique, b.Clique))
+	}
+	if a.NIC != b.NIC {
+		res = append(res, fmt.Sprintf("closest NIC %q -> %q", a.NIC, b.NIC))
+	}
+	return res
+}
+
+// numaOf 设备所在的NUMA节点，没有拓扑信息时为 none
+func numaOf(d *device.Device) string {
+	if d.Topology == nil || len(d.Topology.Nodes) == 0 {
+		return "none"
+	}
+	return fmt.Sprint(d.Topology.Nodes[0].ID)
+}
+
+// logDeviceMapDiff : 记录重启前后的设备变化并更新设备数量变化的指标
+func logDeviceMapDiff(diff DeviceMapDiff) {
+	names := make(map[string]bool)
+	for name := range diff.Before {
+		names[name] = true
+	}
+	for name := range diff.After {
+		names[name] = true
+	}
+	for name := range names {
+		restartDeviceDelta.WithLabelValues(name).Set(float64(diff.After[name] - diff.Before[name]))
+	}
+	if diff.Empty() {
+		l.Logger.Info("device map unchanged across restart", zap.Any("devices", diff.After))
+		return
+	}
+	l.Logger.Warn("device map changed across restart", zap.Any("before", diff.Before), zap.Any("after", diff.After), zap.Int("changes", len(diff.Changes)))
+	for _, c := range diff.Changes {
+		l.Logger.Info("device "+c.Change, zap.String("resourceName", c.Resource), zap.String("id", c.ID), zap.String("reason", c.Reason))
+	}
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// HealthCheckDeviceList 分配结果传递设备列表的方式是否与 nvidia-container-toolkit 的配置一致
+const HealthCheckDeviceList = "deviceList"
+
+// 向容器传递设备列表的方式
+const (
+	// DeviceListStrategyEnvvar : 通过 NVIDIA_VISIBLE_DEVICES 环境变量传递
+	DeviceListStrategyEnvvar = "envvar"
+	// DeviceListStrategyVolumeMounts : 通过挂载到 /var/run/nvidia-container-devices 下的空文件传递
+	DeviceListStrategyVolumeMounts = "volume-mounts"
+	// DeviceListStrategyCDIAnnotations : 通过容器的CDI注解传递
+	DeviceListStrategyCDIAnnotations = "cdi-annotations"
+	// DeviceListStrategyCDICRI : 通过 Allocate 响应的CDI设备字段传递，需要kubelet开启 DevicePluginCDIDevices
+	DeviceListStrategyCDICRI = "cdi-cri"
+)
+
+const (
+	// deviceListVolumeMountRoot 容器内设备列表的挂载目录，NVIDIA_VISIBLE_DEVICES 指向该目录时 toolkit 从挂载点读取设备
+	deviceListVolumeMountRoot = "/var/run/nvidia-container-devices"
+	// visibleDevicesVoid 使镜像中的 NVIDIA_VISIBLE_DEVICES 失效，设备由CDI注入
+	visibleDevicesVoid = "void"
+	// cdiAnnotationPrefix CDI注解前缀
+	cdiAnnotationPrefix = "cdi.k8s.io/"
+	// cdiKind nvidia-ctk cdi generate 生成的设备类型
+	cdiKind = "nvidia.com/gpu"
+)
+
+// nvidia-container-toolkit 配置项
+const (
+	toolkitAcceptEnvvarUnprivileged = "accept-nvidia-visible-devices-envvar-when-unprivileged"
+	toolkitAcceptVolumeMounts       = "accept-nvidia-visible-devices-as-volume-mounts"
+)
+
+// applyDeviceList : 不接受非特权容器的 NVIDIA_VISIBLE_DEVICES 时，改用挂载或CDI传递分配的设备，
+// 同时覆盖镜像中的 NVIDIA_VISIBLE_DEVICES，容器无法再通过 NVIDIA_VISIBLE_DEVICES=all 绕过插件
+func (plugin *NvidiaDevicePlugin) applyDeviceList(resp *pluginapi.ContainerAllocateResponse, ids []string) {
+	if plugin.deviceListStrategy == "" || plugin.deviceListStrategy == DeviceListStrategyEnvvar {
+		return
+	}
+	uuids := strings.Split(visibleDevices(ids), ",")
+	switch plugin.deviceListStrategy {
+	case DeviceListStrategyVolumeMounts:
+		resp.Envs["NVIDIA_VISIBLE_DEVICES"] = deviceListVolumeMountRoot
+		for _, uuid := range uuids {
+			resp.Mounts = append(resp.Mounts, &pluginapi.Mount{ContainerPath: filepath.Join(deviceListVolumeMountRoot, uuid), HostPath: "/dev/null", ReadOnly: true})
+		}
+	case DeviceListStrategyCDIAnnotations:
+		resp.Envs["NVIDIA_VISIBLE_DEVICES"] = visibleDevicesVoid
+		names := make([]string, len(uuids))
+		for i, uuid := range uuids {
+			names[i] = cdiKind + "=" + uuid
+		}
+		if resp.Annotations == nil {
+			resp.Annotations = make(map[string]string)
+		}
+		resp.Annotations[cdiAnnotationPrefix+plugin.resourceName.PluginName()] = strings.Join(names, ",")
+	case DeviceListStrategyCDICRI:
+		resp.Envs["NVIDIA_VISIBLE_DEVICES"] = visibleDevicesVoid
+		for _, uuid := range uuids {
+			resp.CDIDevices = append(resp.CDIDevices, &pluginapi.CDIDevice{Name: cdiKind + "=" + uuid})
+		}
+	}
+}
+
+// toolkitSettings : 读取 nvidia-container-toolkit 配置中与设备列表相关的配置项，未设置时使用toolkit的默认值
+func toolkitSettings(file string) (acceptEnvvar bool, acceptMounts bool, err error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("toml")
+	v.SetDefault(toolkitAcceptEnvvarUnprivileged, true)
+	v.SetDefault(toolkitAcceptVolumeMounts, false)
+	if err := v.ReadInConfig(); err != nil {
+		return false, false, err
+	}
+	return v.GetBool(toolkitAcceptEnvvarUnprivileged), v.GetBool(toolkitAcceptVolumeMounts), nil
+}
+
+// checkDeviceList : 传递设备列表的方式是否与 nvidia-container-toolkit 的配置一致
+// 不接受 NVIDIA_VISIBLE_DEVICES 时toolkit也必须忽略它，否则容器仍然可以申请所有GPU；
+// toolkit忽略它而插件仍然使用它时，分配的GPU不会注入容器
+func (p *PluginManager) checkDeviceList() HealthCheck {
+	c := HealthCheck{Name: HealthCheckDeviceList, Healthy: true}
+	strategy := p.pluginOptions.DeviceListStrategy
+	if strategy == "" {
+		strategy = DeviceListStrategyEnvvar
+	}
+	if p.platform == PlatformWindows {
+		c.Message = "not applicable on platform windows"
+		return c
+	}
+	acceptEnvvar, acceptMounts, err := toolkitSettings(p.allocate.ToolkitConfig)
+	if err != nil {
+		c.Message = fmt.Sprintf("using %s, cannot verify the nvidia-container-toolkit config: %v", strategy, err)
+		return c
+	}
+	switch {
+	case strategy == DeviceListStrategyEnvvar && !acceptEnvvar:
+		c.Healthy = false
+		c.Message = fmt.Sprintf("%s sets %s = false, devices passed via NVIDIA_VISIBLE_DEVICES are not injected into unprivileged containers; set allocate.acceptEnvvarUnprivileged: false", p.allocate.ToolkitConfig, toolkitAcceptEnvvarUnprivileged)
+	case strategy == DeviceListStrategyEnvvar:
+		c.Message = "using envvar, unprivileged containers setting NVIDIA_VISIBLE_DEVICES=all can access every GPU"
+	case acceptEnvvar:
+		c.Healthy = false
+		c.Message = fmt.Sprintf("using %s, but unprivileged containers can still request every GPU with NVIDIA_VISIBLE_DEVICES=all; set %s = false in %s", strategy, toolkitAcceptEnvvarUnprivileged, p.allocate.ToolkitConfig)
+	case strategy == DeviceListStrategyVolumeMounts && !acceptMounts:
+		c.Healthy = false
+		c.Message = fmt.Sprintf("using volume-mounts, but %s does not set %s = true, allocated GPUs are not injected", p.allocate.ToolkitConfig, toolkitAcceptVolumeMounts)
+	default:
+		c.Message = fmt.Sprintf("using %s, NVIDIA_VISIBLE_DEVICES from unprivileged containers is ignored", strategy)
+	}
+	return c
+}
@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// GPUDirect Storage 需要的设备节点和目录，nvidia-container-runtime 不会注入
+const (
+	nvidiaFSGlob = "/dev/nvidia-fs*"
+	udevDir      = "/run/udev"
+)
+
+// deviceSpecs 容器需要挂载的设备
+// Linux 下GPU设备节点由 nvidia-container-runtime 根据 NVIDIA_VISIBLE_DEVICES 注入，这里只返回
+// 开启 gdsEnabled 时的 /dev/nvidia-fs*。GPUDirect RDMA 的 nvidia_peermem 没有设备节点，
+// 网卡的 /dev/infiniband/* 由RDMA设备插件按Pod申请的网卡注入，这里不挂载，避免绕过租户间的网卡隔离
+func (plugin *NvidiaDevicePlugin) deviceSpecs([]string) []*pluginapi.DeviceSpec {
+	var specs []*pluginapi.DeviceSpec
+	if plugin.gds {
+		specs = append(specs, globDeviceSpecs(nvidiaFSGlob)...)
+	}
+	return specs
+}
+
+// checkPeermem : 开启 rdmaEnabled 时检查 nvidia_peermem 是否已加载，未加载时GPUDirect RDMA 退回经主机内存拷贝
+func checkPeermem() {
+	if !exists(device.SysfsPath("module", "nvidia_peermem")) {
+		l.Logger.Warn("rdmaEnabled is set but the nvidia_peermem module is not loaded, GPUDirect RDMA is unavailable")
+	}
+}
+
+// mounts 容器需要挂载的目录，cuFile 通过 /run/udev 发现 nvidia-fs 设备
+func (plugin *NvidiaDevicePlugin) mounts() []*pluginapi.Mount {
+	if !plugin.gds || !exists(udevDir) {
+		return nil
+	}
+	return []*pluginapi.Mount{{ContainerPath: udevDir, HostPath: udevDir, ReadOnly: true}}
+}
+
+// globDeviceSpecs 匹配的设备节点，按路径排序
+func globDeviceSpecs(pattern string) []*pluginapi.DeviceSpec {
+	paths, _ := filepath.Glob(pattern)
+	specs := make([]*pluginapi.DeviceSpec, 0, len(paths))
+	for _, p := range paths {
+		specs = append(specs, &pluginapi.DeviceSpec{ContainerPath: p, HostPath: p, Permissions: "rw"})
+	}
+	return specs
+}
+
+// exists 路径是否存在
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
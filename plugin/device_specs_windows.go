@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"sort"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// deviceSpecs 容器需要挂载的设备
+// Windows 容器通过设备接口类GUID挂载GPU，HostPath 为 class/<GUID>，ContainerPath 为空
+func (plugin *NvidiaDevicePlugin) deviceSpecs(ids []string) []*pluginapi.DeviceSpec {
+	paths := make(map[string]bool)
+	for _, p := range plugin.Devices().Subset(ids).GetPaths() {
+		paths[p] = true
+	}
+	var specs []*pluginapi.DeviceSpec
+	for p := range paths {
+		specs = append(specs, &pluginapi.DeviceSpec{HostPath: p})
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].HostPath < specs[j].HostPath })
+	return specs
+}
+
+// checkPeermem : Windows 不支持 GPUDirect RDMA
+func checkPeermem() {}
+
+// mounts 容器需要挂载的目录，Windows 不支持 GPUDirect Storage
+func (plugin *NvidiaDevicePlugin) mounts() []*pluginapi.Mount {
+	return nil
+}
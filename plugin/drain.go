@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+)
+
+// drainBucket 保存排空状态的bucket，键为GPU UUID
+const drainBucket = "drains"
+
+// healthReason 排空设备在插件中的不健康原因，说明中带上管理员填写的原因
+func (s DrainState) healthReason() HealthReason {
+	if s.Reason == "" {
+		return HealthReason{Code: HealthReasonDrained, Message: "drained by admin"}
+	}
+	return HealthReason{Code: HealthReasonDrained, Message: "drained by admin: " + s.Reason}
+}
+
+// 设备排空事件类型
+const (
+	EventDrained   = "drained"
+	EventUndrained = "undrained"
+)
+
+// ErrUnknownDevice 设备不存在
+var ErrUnknownDevice = errors.New("unknown device")
+
+// DrainState 被管理员排空的GPU
+type DrainState struct {
+	UUID   string    `json:"uuid"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// loadDrains : 从存储中恢复排空状态
+func (p *PluginManager) loadDrains() {
+	p.drains = make(map[string]DrainState)
+	if p.store == nil {
+		return
+	}
+	keys, err := p.store.Keys(drainBucket)
+	if err != nil {
+		l.Logger.Warn("failed to load drained devices", zap.Error(err))
+		return
+	}
+	for _, key := range keys {
+		data, err := p.store.Get(drainBucket, key)
+		if err != nil {
+			l.Logger.Warn("failed to load drained device", zap.String("uuid", key), zap.Error(err))
+			continue
+		}
+		var s DrainState
+		if err := json.Unmarshal(data, &s); err != nil {
+			l.Logger.Warn("invalid drained device state", zap.String("uuid", key), zap.Error(err))
+			continue
+		}
+		p.drains[s.UUID] = s
+	}
+	if len(p.drains) > 0 {
+		l.Logger.Info("restored drained devices", zap.Int("count", len(p.drains)))
+	}
+}
+
+// Drains : 被排空的GPU，按UUID排序
+func (p *PluginManager) Drains() []DrainState {
+	p.drainMu.Lock()
+	defer p.drainMu.Unlock()
+	res := make([]DrainState, 0, len(p.drains))
+	for _, s := range p.drains {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].UUID < res[j].UUID })
+	return res
+}
+
+// Drain : 把GPU（或单个MIG设备）及其上的MIG设备和副本标记为不健康，停止向其调度新的Pod，已运行的Pod不受影响
+// 排空状态写入存储，插件和进程重启后保持
+func (p *PluginManager) Drain(uuid string, reason string) (DrainState, error) {
+	members := p.gpuMembers(uuid)
+	if len(members) == 0 {
+		return DrainState{}, fmt.Errorf("%w: %s", ErrUnknownDevice, uuid)
+	}
+	s := DrainState{UUID: uuid, Reason: reason, Time: p.clock.Now()}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return DrainState{}, err
+	}
+	if p.store != nil {
+		if err := p.store.Put(drainBucket, uuid, data); err != nil {
+			return DrainState{}, fmt.Errorf("error saving drain state: %w", err)
+		}
+	}
+	p.drainMu.Lock()
+	p.drains[uuid] = s
+	p.drainMu.Unlock()
+	for _, m := range members {
+		m.plugin.MarkDeviceUnhealthy(m.id, s.healthReason())
+	}
+	l.Logger.Info("device drained", zap.String("uuid", uuid), zap.String("reason", reason))
+	p.events.Add(DeviceEvent{Time: s.Time, Type: EventDrained, UUID: uuid, Reason: HealthReasonDrained, Message: reason})
+	return s, nil
+}
+
+// Undrain : 恢复被排空的GPU，设备因其它原因不健康时保持不健康
+func (p *PluginManager) Undrain(uuid string) error {
+	p.drainMu.Lock()
+	_, drained := p.drains[uuid]
+	p.drainMu.Unlock()
+	if !drained {
+		return fmt.Errorf("%w: %s is not drained", ErrUnknownDevice, uuid)
+	}
+	if p.store != nil {
+		if err := p.store.Delete(drainBucket, uuid); err != nil {
+			return fmt.Errorf("error deleting drain state: %w", err)
+		}
+	}
+	p.drainMu.Lock()
+	delete(p.drains, uuid)
+	p.drainMu.Unlock()
+	for _, m := range p.gpuMembers(uuid) {
+		m.plugin.MarkDeviceHealthy(m.id, HealthReasonDrained)
+	}
+	l.Logger.Info("device undrained", zap.String("uuid", uuid))
+	p.events.Add(DeviceEvent{Time: p.clock.Now(), Type: EventUndrained, UUID: uuid, Reason: HealthReasonDrained})
+	return nil
+}
+
+// drainMember 属于某块GPU的设备
+type drainMember struct {
+	plugin Interface
+	id     string
+}
+
+// gpuMembers : 查找属于GPU的所有设备，包括MIG设备和共享的副本；uuid为MIG设备时只包括该MIG设备
+func (p *PluginManager) gpuMembers(uuid string) []drainMember {
+	p.mu.RLock()
+	plugins := append([]Interface(nil), p.plugins...)
+	p.mu.RUnlock()
+	return p.members(plugins, uuid)
+}
+
+// members : 在插件中查找属于GPU的设备，调用方持有 p.mu
+func (p *PluginManager) members(plugins []Interface, uuid string) []drainMember {
+	var res []drainMember
+	for _, pl := range plugins {
+		for _, d := range pl.Devices() {
+			if device.AnnotatedID(d.ID).GetID() == uuid || p.deviceGPU(d.ID) == uuid {
+				res = append(res, drainMember{plugin: pl, id: d.ID})
+			}
+		}
+	}
+	return res
+}
+
+// deviceGPU : 设备所在GPU的UUID，NVML不可用时使用去除副本标记后的设备ID
+func (p *PluginManager) deviceGPU(id string) string {
+	if _, uuid, err := p.parentGPU(id); err == nil {
+		return uuid
+	}
+	return device.AnnotatedID(id).GetID()
+}
+
+// applyDrains : 插件重新加载或设备变化后重新标记被排空的设备，调用方持有 p.mu
+func (p *PluginManager) applyDrains() {
+	p.drainMu.Lock()
+	drains := make([]DrainState, 0, len(p.drains))
+	for _, s := range p.drains {
+		drains = append(drains, s)
+	}
+	p.drainMu.Unlock()
+	for _, s := range drains {
+		for _, m := range p.members(p.plugins, s.UUID) {
+			m.plugin.MarkDeviceUnhealthy(m.id, s.healthReason())
+		}
+	}
+}
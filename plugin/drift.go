@@ -0,0 +1,294 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 模式漂移事件类型
+const (
+	EventModeDrift  = "mode_drift"
+	EventRemediated = "mode_remediated"
+)
+
+// 模式设置名称
+const (
+	settingECC         = "ecc"
+	settingMIG         = "mig"
+	settingPersistence = "persistence"
+	settingComputeMode = "computeMode"
+)
+
+// 开关类模式的取值
+const (
+	modeEnabled  = "enabled"
+	modeDisabled = "disabled"
+)
+
+// 修复结果
+const (
+	remediationApplied      = "applied"
+	remediationPendingReset = "pending_reset"
+	remediationFailed       = "failed"
+)
+
+var (
+	modeDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "mode_drift",
+		Help:      "Whether a GPU mode setting differs from the desired state in the configuration.",
+	}, []string{"uuid", "setting"})
+	modeRemediations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "mode_remediations_total",
+		Help:      "Number of attempts to change a GPU mode setting back to the desired state by result.",
+	}, []string{"setting", "result"})
+)
+
+// computeModeNames 计算模式名称与NVML值的映射
+var computeModeNames = map[string]nvml.ComputeMode{
+	"default":          nvml.COMPUTEMODE_DEFAULT,
+	"exclusiveProcess": nvml.COMPUTEMODE_EXCLUSIVE_PROCESS,
+	"prohibited":       nvml.COMPUTEMODE_PROHIBITED,
+}
+
+// ModeDrift GPU模式设置与期望状态的差异
+type ModeDrift struct {
+	UUID    string `json:"uuid"`
+	Setting string `json:"setting"`
+	Desired string `json:"desired"`
+	Current string `json:"current"`
+	// Pending : 重置GPU后生效的值，只有ECC和MIG模式有
+	Pending string `json:"pending,omitempty"`
+	// Remediation : 最近一次修复的结果
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// modeSetting 一项可检查的模式设置
+type modeSetting struct {
+	name string
+	// get 返回当前值和重置后生效的值
+	get func(gpu nvml.Device) (string, string, nvml.Return)
+	// set 修改设置，返回是否需要重置GPU才能生效
+	set func(gpu nvml.Device, desired string) (bool, nvml.Return)
+}
+
+var modeSettings = []modeSetting{
+	{
+		name: settingECC,
+		get: func(gpu nvml.Device) (string, string, nvml.Return) {
+			current, pending, ret := gpu.GetEccMode()
+			return enableStateName(current), enableStateName(pending), ret
+		},
+		set: func(gpu nvml.Device, desired string) (bool, nvml.Return) {
+			return true, gpu.SetEccMode(toEnableState(desired))
+		},
+	},
+	{
+		name: settingMIG,
+		get: func(gpu nvml.Device) (string, string, nvml.Return) {
+			current, pending, ret := gpu.GetMigMode()
+			return migModeName(current), migModeName(pending), ret
+		},
+		set: func(gpu nvml.Device, desired string) (bool, nvml.Return) {
+			mode := nvml.DEVICE_MIG_DISABLE
+			if desired == modeEnabled {
+				mode = nvml.DEVICE_MIG_ENABLE
+			}
+			ret, _ := gpu.SetMigMode(mode)
+			return true, ret
+		},
+	},
+	{
+		name: settingPersistence,
+		get: func(gpu nvml.Device) (string, string, nvml.Return) {
+			current, ret := gpu.GetPersistenceMode()
+			return enableStateName(current), enableStateName(current), ret
+		},
+		set: func(gpu nvml.Device, desired string) (bool, nvml.Return) {
+			return false, gpu.SetPersistenceMode(toEnableState(desired))
+		},
+	},
+	{
+		name: settingComputeMode,
+		get: func(gpu nvml.Device) (string, string, nvml.Return) {
+			current, ret := gpu.GetComputeMode()
+			name := computeModeName(current)
+			return name, name, ret
+		},
+		set: func(gpu nvml.Device, desired string) (bool, nvml.Return) {
+			return false, gpu.SetComputeMode(computeModeNames[desired])
+		},
+	},
+}
+
+// ValidateDesiredModes 检查期望的模式设置
+func ValidateDesiredModes(desired config.DesiredModes) error {
+	for setting, value := range desiredModes(desired) {
+		switch {
+		case value == "":
+		case setting == settingComputeMode:
+			if _, ok := computeModeNames[value]; !ok {
+				return fmt.Errorf("invalid desired %s '%s'", setting, value)
+			}
+		case value != modeEnabled && value != modeDisabled:
+			return fmt.Errorf("invalid desired %s '%s', must be %s or %s", setting, value, modeEnabled, modeDisabled)
+		}
+	}
+	return nil
+}
+
+// desiredModes 期望状态按设置名称索引，空值表示不检查
+func desiredModes(desired config.DesiredModes) map[string]string {
+	return map[string]string{
+		settingECC:         desired.ECC,
+		settingMIG:         desired.MIG,
+		settingPersistence: desired.Persistence,
+		settingComputeMode: desired.ComputeMode,
+	}
+}
+
+// checkModeDrift : 比较每个GPU的模式设置与期望状态，记录漂移，开启修复时尝试改回期望值
+// ECC和MIG模式修改后需要重置GPU才生效，待生效的值已经是期望值时不重复修改
+func (p *PluginManager) checkModeDrift() {
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return
+	}
+	count, ret := p.nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		l.Logger.Warn("failed to get device count for mode drift check", zap.Error(ret))
+		return
+	}
+	desired := desiredModes(p.modeDrift.Desired)
+	now := p.clock.Now()
+	var drifts []ModeDrift
+	for i := 0; i < count; i++ {
+		gpu, ret := p.nvmllib.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			l.Logger.Warn("failed to get device for mode drift check", zap.Int("index", i), zap.Error(ret))
+			continue
+		}
+		uuid, ret := gpu.GetUUID()
+		if ret != nvml.SUCCESS {
+			l.Logger.Warn("failed to get device UUID for mode drift check", zap.Int("index", i), zap.Error(ret))
+			continue
+		}
+		for _, s := range modeSettings {
+			want := desired[s.name]
+			if want == "" {
+				continue
+			}
+			current, pending, ret := s.get(gpu)
+			if ret == nvml.ERROR_NOT_SUPPORTED {
+				continue
+			}
+			if ret != nvml.SUCCESS {
+				l.Logger.Warn("failed to get GPU mode", zap.String("uuid", uuid), zap.String("setting", s.name), zap.Error(ret))
+				continue
+			}
+			if current == want {
+				modeDrift.WithLabelValues(uuid, s.name).Set(0)
+				continue
+			}
+			modeDrift.WithLabelValues(uuid, s.name).Set(1)
+			d := ModeDrift{UUID: uuid, Setting: s.name, Desired: want, Current: current}
+			if pending != current {
+				d.Pending = pending
+			}
+			key := uuid + "/" + s.name
+			if !p.drifted[key] {
+				reason := fmt.Sprintf("%s is %s, desired %s", s.name, current, want)
+				l.Logger.Warn("GPU mode drift detected", zap.String("uuid", uuid), zap.String("setting", s.name), zap.String("current", current), zap.String("desired", want))
+				p.events.Add(DeviceEvent{Time: now, Type: EventModeDrift, UUID: uuid, Reason: reason})
+			}
+			if p.modeDrift.Remediate {
+				d.Remediation = p.remediateMode(gpu, uuid, s, d)
+			}
+			drifts = append(drifts, d)
+		}
+	}
+	drifted := make(map[string]bool, len(drifts))
+	for _, d := range drifts {
+		drifted[d.UUID+"/"+d.Setting] = true
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].UUID != drifts[j].UUID {
+			return drifts[i].UUID < drifts[j].UUID
+		}
+		return drifts[i].Setting < drifts[j].Setting
+	})
+	p.driftMu.Lock()
+	p.drifted = drifted
+	p.drifts = drifts
+	p.driftMu.Unlock()
+}
+
+// remediateMode : 把模式改回期望值，返回修复结果
+func (p *PluginManager) remediateMode(gpu nvml.Device, uuid string, s modeSetting, d ModeDrift) string {
+	if d.Pending == d.Desired {
+		return remediationPendingReset
+	}
+	needsReset, ret := s.set(gpu, d.Desired)
+	result := remediationApplied
+	if ret != nvml.SUCCESS {
+		result = remediationFailed
+		l.Logger.Warn("failed to remediate GPU mode", zap.String("uuid", uuid), zap.String("setting", s.name), zap.String("desired", d.Desired), zap.Error(ret))
+	} else if needsReset {
+		result = remediationPendingReset
+	}
+	modeRemediations.WithLabelValues(s.name, result).Inc()
+	if ret == nvml.SUCCESS {
+		l.Logger.Info("remediated GPU mode", zap.String("uuid", uuid), zap.String("setting", s.name), zap.String("desired", d.Desired), zap.String("result", result))
+		p.events.Add(DeviceEvent{Time: p.clock.Now(), Type: EventRemediated, UUID: uuid, Reason: fmt.Sprintf("%s set to %s", s.name, d.Desired), Message: result})
+	}
+	return result
+}
+
+// ModeDrifts : 最近一次检查发现的模式漂移
+func (p *PluginManager) ModeDrifts() []ModeDrift {
+	p.driftMu.Lock()
+	defer p.driftMu.Unlock()
+	return append([]ModeDrift{}, p.drifts...)
+}
+
+func enableStateName(state nvml.EnableState) string {
+	if state == nvml.FEATURE_ENABLED {
+		return modeEnabled
+	}
+	return modeDisabled
+}
+
+func toEnableState(name string) nvml.EnableState {
+	if name == modeEnabled {
+		return nvml.FEATURE_ENABLED
+	}
+	return nvml.FEATURE_DISABLED
+}
+
+func migModeName(mode int) string {
+	if mode == nvml.DEVICE_MIG_ENABLE {
+		return modeEnabled
+	}
+	return modeDisabled
+}
+
+func computeModeName(mode nvml.ComputeMode) string {
+	for name, m := range computeModeNames {
+		if m == mode {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown(%d)", mode)
+}
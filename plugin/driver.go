@@ -0,0 +1,40 @@
+package plugin
+
+import (
+	"fmt"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"go.uber.org/zap"
+)
+
+// DriverVersions : NVML 报告的驱动版本，NVML不可用时返回空值
+// 驱动版本在进程运行期间不会变化，获取成功后缓存
+func (p *PluginManager) DriverVersions() version.Driver {
+	p.driverMu.Lock()
+	defer p.driverMu.Unlock()
+	if p.driver != nil {
+		return *p.driver
+	}
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return version.Driver{}
+	}
+	driverVersion, ret := p.nvmllib.SystemGetDriverVersion()
+	if ret != nvml.SUCCESS {
+		l.Logger.Warn("failed to get driver version", zap.Error(ret))
+		return version.Driver{}
+	}
+	d := version.Driver{DriverVersion: driverVersion}
+	if nvmlVersion, ret := p.nvmllib.SystemGetNVMLVersion(); ret == nvml.SUCCESS {
+		d.NvmlVersion = nvmlVersion
+	}
+	if cudaVersion, ret := p.nvmllib.SystemGetCudaDriverVersion(); ret == nvml.SUCCESS {
+		d.CudaDriverVersion = fmt.Sprintf("%d.%d", cudaVersion/1000, cudaVersion%1000/10)
+	}
+	p.driver = &d
+	return d
+}
@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 驱动不满足要求时的处理方式
+const (
+	DriverPolicyUnhealthy = "unhealthy"
+	DriverPolicyWithhold  = "withhold"
+)
+
+// EventReasonDriverIncompatible 驱动不满足要求时的节点事件原因
+const EventReasonDriverIncompatible = "GPUDriverIncompatible"
+
+var driverCompatible = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "driver_compatible",
+	Help:      "Whether the node driver satisfies driverPolicy (1) or not (0).",
+})
+
+// DriverCompatibility 驱动版本检查结果
+type DriverCompatibility struct {
+	Compatible bool   `json:"compatible"`
+	Reason     string `json:"reason,omitempty"`
+	Action     string `json:"action,omitempty"`
+	version.Driver
+}
+
+// DriverCompatibility : 最近一次驱动版本检查的结果
+func (p *PluginManager) DriverCompatibility() DriverCompatibility {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	res := DriverCompatibility{Compatible: p.driverIncompatible == "", Reason: p.driverIncompatible, Driver: p.DriverVersions()}
+	if !res.Compatible {
+		res.Action = p.driverPolicy.Action
+	}
+	return res
+}
+
+// CheckDriver 检查驱动版本是否满足要求，返回不满足的原因；版本未知时不检查
+func CheckDriver(policy config.DriverPolicyConfig, d version.Driver) string {
+	if d.DriverVersion == "" {
+		return ""
+	}
+	for _, v := range policy.BlockedDriverVersions {
+		if CompareVersions(d.DriverVersion, v) == 0 {
+			return fmt.Sprintf("driver %s is on the blocked list", d.DriverVersion)
+		}
+	}
+	if policy.MinDriverVersion != "" && CompareVersions(d.DriverVersion, policy.MinDriverVersion) < 0 {
+		return fmt.Sprintf("driver %s is older than the minimum %s", d.DriverVersion, policy.MinDriverVersion)
+	}
+	if policy.MinCudaDriverVersion != "" && d.CudaDriverVersion != "" && CompareVersions(d.CudaDriverVersion, policy.MinCudaDriverVersion) < 0 {
+		return fmt.Sprintf("driver supports CUDA %s, older than the minimum %s", d.CudaDriverVersion, policy.MinCudaDriverVersion)
+	}
+	return ""
+}
+
+// CompareVersions 按数字逐段比较点分隔的版本号，缺少的段视为0，非数字的段按字符串比较
+func CompareVersions(a, b string) int {
+	as := strings.Split(strings.TrimSpace(a), ".")
+	bs := strings.Split(strings.TrimSpace(b), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case (xerr != nil || yerr != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+// applyDriverPolicy : 加载插件后检查驱动版本，不满足要求时按策略标记设备不健康或不对外提供，调用方持有 p.mu
+func (p *PluginManager) applyDriverPolicy() {
+	reason := CheckDriver(p.driverPolicy, p.DriverVersions())
+	if reason == "" {
+		driverCompatible.Set(1)
+		p.driverIncompatible = ""
+		return
+	}
+	driverCompatible.Set(0)
+	first := p.driverIncompatible == ""
+	p.driverIncompatible = reason
+	if first {
+		l.Logger.Error("node driver does not satisfy the driver policy", zap.String("reason", reason), zap.String("action", p.driverPolicy.Action))
+		action := "marked unhealthy"
+		if p.driverPolicy.Action == DriverPolicyWithhold {
+			action = "not advertised"
+		}
+		emitNodeEvent(p.nodeEvents, kube.EventTypeWarning, EventReasonDriverIncompatible, fmt.Sprintf("GPU resources are %s: %s", action, reason))
+	}
+	if p.driverPolicy.Action != DriverPolicyUnhealthy {
+		return
+	}
+	for _, pl := range p.plugins {
+		for _, d := range pl.Devices() {
+			pl.MarkDeviceUnhealthy(d.ID, HealthReason{Code: HealthReasonDriver, Message: reason})
+		}
+	}
+}
+
+// withheld : 驱动不满足要求且策略为不对外提供，调用方持有 p.mu
+func (p *PluginManager) withheld() bool {
+	return p.driverIncompatible != "" && p.driverPolicy.Action == DriverPolicyWithhold
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"os"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var driverReady = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "driver_ready",
+	Help:      "Whether the NVIDIA driver is ready (1) or the plugin is still waiting for it (0).",
+})
+
+// DriverWait : 开始等待驱动时关闭的通道，等待期间HTTP服务即可访问
+func (p *PluginManager) DriverWait() <-chan struct{} {
+	return p.driverWait
+}
+
+// driverReady : 驱动设备文件存在且NVML初始化成功，模拟模式不检查设备文件
+func (p *PluginManager) driverReady() bool {
+	if !simulate.IsSimulated(p.nvmllib) {
+		if _, err := os.Stat(p.driverReadiness.DevicePath); err != nil {
+			return false
+		}
+	}
+	return p.initNVML()
+}
+
+// waitForDriver : 发现设备前等待驱动就绪，GPU Operator管理的节点上插件经常先于驱动启动
+// 按间隔重试直到就绪、超时或停止，超时后按未发现设备处理；停止时返回false
+func (p *PluginManager) waitForDriver() bool {
+	if !p.driverReadiness.Enabled || p.platform == PlatformWindows || p.driverReady() {
+		driverReady.Set(1)
+		return true
+	}
+	driverReady.Set(0)
+	p.waitingForDriver.Store(true)
+	close(p.driverWait)
+	defer p.waitingForDriver.Store(false)
+	l.Logger.Info("waiting for the NVIDIA driver", zap.String("devicePath", p.driverReadiness.DevicePath), zap.Duration("timeout", p.driverReadiness.Timeout))
+	start := p.clock.Now()
+	var timeout <-chan time.Time
+	if p.driverReadiness.Timeout > 0 {
+		timeout = p.clock.After(p.driverReadiness.Timeout)
+	}
+	ticker := p.clock.NewTicker(p.driverReadiness.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			if p.driverReady() {
+				driverReady.Set(1)
+				l.Logger.Info("NVIDIA driver is ready", zap.Duration("waited", p.clock.Since(start)))
+				// mixed 策略的MIG资源需要查询NVML，驱动就绪后重新生成
+				resources := resource.NewResources(p.nvmllib, p.migStrategy, p.resourcePrefix, p.resourcePatterns)
+				p.mu.Lock()
+				p.resources = resources
+				p.mu.Unlock()
+				return true
+			}
+			l.Logger.Debug("NVIDIA driver not ready yet", zap.Duration("waited", p.clock.Since(start)))
+		case <-timeout:
+			l.Logger.Warn("timed out waiting for the NVIDIA driver, continuing without it", zap.Duration("timeout", p.driverReadiness.Timeout))
+			return true
+		case <-p.ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"sync"
+	"time"
+)
+
+// maxDeviceEvents 内存中保留的设备事件数量
+const maxDeviceEvents = 256
+
+// 设备事件类型
+const (
+	EventCordoned   = "cordoned"
+	EventUncordoned = "uncordoned"
+)
+
+// DeviceEvent 设备状态变化事件，如温度隔离和模式漂移
+type DeviceEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	UUID    string    `json:"uuid"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message,omitempty"`
+}
+
+// EventLog 最近的设备事件，超出容量时丢弃最早的事件
+type EventLog struct {
+	mu     sync.Mutex
+	events []DeviceEvent
+	size   int
+}
+
+// NewEventLog 创建设备事件记录，size小于等于0时使用默认容量
+func NewEventLog(size int) *EventLog {
+	if size <= 0 {
+		size = maxDeviceEvents
+	}
+	return &EventLog{size: size}
+}
+
+// Add 记录事件
+func (e *EventLog) Add(event DeviceEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+	if len(e.events) > e.size {
+		e.events = append([]DeviceEvent(nil), e.events[len(e.events)-e.size:]...)
+	}
+}
+
+// List 按时间顺序返回所有事件
+func (e *EventLog) List() []DeviceEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]DeviceEvent{}, e.events...)
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+)
+
+// cliqueCandidates : 要求多卡分配在同一fabric clique中时，把可用设备限制在一个clique内
+// 有必须分配的设备时使用其所在的clique；否则选择可用设备足够的clique中最小的一个，减少碎片
+// 设备都不在fabric中时不做限制
+func (plugin *NvidiaDevicePlugin) cliqueCandidates(available, required []string, size int) ([]string, error) {
+	if !plugin.requireSameClique || size <= 1 {
+		return available, nil
+	}
+	devices := plugin.Devices()
+	byClique := make(map[string][]string)
+	for _, id := range available {
+		if d := devices.GetByID(id); d != nil && d.Clique != "" {
+			byClique[d.Clique] = append(byClique[d.Clique], id)
+		}
+	}
+	if len(byClique) == 0 {
+		return available, nil
+	}
+	wanted := ""
+	for _, id := range required {
+		d := devices.GetByID(id)
+		if d == nil {
+			continue
+		}
+		if wanted != "" && d.Clique != wanted {
+			return nil, fmt.Errorf("required devices are in different fabric cliques")
+		}
+		wanted = d.Clique
+	}
+	if wanted != "" {
+		if len(byClique[wanted]) < size {
+			return nil, fmt.Errorf("fabric clique %s has %d available devices, %d requested", wanted, len(byClique[wanted]), size)
+		}
+		return byClique[wanted], nil
+	}
+	cliques := make([]string, 0, len(byClique))
+	for c, ids := range byClique {
+		if len(ids) >= size {
+			cliques = append(cliques, c)
+		}
+	}
+	if len(cliques) == 0 {
+		return nil, fmt.Errorf("no fabric clique has %d available devices", size)
+	}
+	sort.Slice(cliques, func(i, j int) bool {
+		if len(byClique[cliques[i]]) != len(byClique[cliques[j]]) {
+			return len(byClique[cliques[i]]) < len(byClique[cliques[j]])
+		}
+		return cliques[i] < cliques[j]
+	})
+	return byClique[cliques[0]], nil
+}
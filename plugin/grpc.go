@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// HeaderRequestID 请求ID的gRPC元数据和HTTP请求头，与Web API的请求ID一致
+const HeaderRequestID = "X-Request-ID"
+
+// serverOptions : 根据配置创建插件gRPC服务器的参数
+func (plugin *NvidiaDevicePlugin) serverOptions() []grpc.ServerOption {
+	cfg := plugin.grpcConfig
+	// 请求ID在其它拦截器之前分配，请求日志也能带上
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(plugin.correlate)}
+	if cfg.KeepaliveTime > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}))
+	}
+	if cfg.KeepaliveMinTime > 0 {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.KeepaliveMinTime,
+			PermitWithoutStream: true,
+		}))
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+	if cfg.LogRequests {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(plugin.logUnary),
+			grpc.ChainStreamInterceptor(plugin.logStream),
+		)
+	}
+	if cfg.LogConnections {
+		opts = append(opts, grpc.StatsHandler(&connLogger{resourceName: string(plugin.resourceName)}))
+	}
+	// 链路追踪，kubelet传入trace context时与kubelet的span关联
+	if plugin.tracing {
+		opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	}
+	return opts
+}
+
+// correlate : 为每次调用分配请求ID，调用方在元数据中带有请求ID时沿用，
+// 请求ID写入日志、审计记录和响应头，并附加在返回给kubelet的错误中，kubelet日志中的错误可以对应到插件的日志
+func (plugin *NvidiaDevicePlugin) correlate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(HeaderRequestID); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id, _ = util.NewID()
+	}
+	ctx = l.NewContext(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(HeaderRequestID, id))
+	resp, err := handler(ctx, req)
+	if err != nil {
+		s := status.Convert(err)
+		err = status.Error(s.Code(), fmt.Sprintf("%s (requestId %s)", s.Message(), id))
+	}
+	return resp, err
+}
+
+// logUnary : 记录单次调用的方法、耗时和结果
+func (plugin *NvidiaDevicePlugin) logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	l.FromContext(ctx).Debug("gRPC request", zap.String("resourceName", string(plugin.resourceName)), zap.String("method", info.FullMethod),
+		zap.Duration("duration", time.Since(start)), zap.String("code", status.Code(err).String()), zap.Error(err))
+	return resp, err
+}
+
+// logStream : 记录流式调用的建立和结束，kubelet的ListAndWatch连接断开时可以从日志中看到原因
+func (plugin *NvidiaDevicePlugin) logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	l.Logger.Info("gRPC stream opened", zap.String("resourceName", string(plugin.resourceName)), zap.String("method", info.FullMethod))
+	err := handler(srv, ss)
+	l.Logger.Info("gRPC stream closed", zap.String("resourceName", string(plugin.resourceName)), zap.String("method", info.FullMethod),
+		zap.Duration("duration", time.Since(start)), zap.String("code", status.Code(err).String()), zap.Error(err))
+	return err
+}
+
+// connLogger 记录gRPC连接的建立和断开
+type connLogger struct {
+	resourceName string
+}
+
+var _ stats.Handler = (*connLogger)(nil)
+
+func (c *connLogger) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connLogger) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (c *connLogger) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connLogger) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		l.Logger.Info("gRPC connection opened", zap.String("resourceName", c.resourceName))
+	case *stats.ConnEnd:
+		l.Logger.Info("gRPC connection closed", zap.String("resourceName", c.resourceName))
+	}
+}
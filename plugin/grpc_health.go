@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// setServing : 设置插件socket上gRPC健康检查服务的状态，服务名为空和资源名称的状态保持一致
+func (plugin *NvidiaDevicePlugin) setServing(serving bool) {
+	if plugin.healthServer == nil {
+		return
+	}
+	s := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		s = healthpb.HealthCheckResponse_SERVING
+	}
+	plugin.healthServer.SetServingStatus("", s)
+	plugin.healthServer.SetServingStatus(string(plugin.resourceName), s)
+}
+
+// managerHealthServer 管理器socket上的gRPC健康检查服务，每次检查时实时计算状态
+// 服务名为空时返回管理器整体健康状态，服务名为资源名称时返回该资源的插件是否已注册
+type managerHealthServer struct {
+	healthpb.UnimplementedHealthServer
+	manager *PluginManager
+}
+
+// Check 检查管理器或资源插件的状态
+func (s *managerHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	serving := false
+	if req.Service == "" {
+		serving = s.manager.Health().Healthy
+	} else {
+		s.manager.mu.RLock()
+		pl := s.manager.findPlugin(req.Service)
+		s.manager.mu.RUnlock()
+		if pl == nil {
+			return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+		}
+		serving = pl.Status().State == StateRegistered
+	}
+	if serving {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+}
+
+// serveHealth : 在管理器socket上提供gRPC健康检查服务，便于节点上的调试工具独立于HTTP服务探测
+func (p *PluginManager) serveHealth() error {
+	os.Remove(p.socket)
+	sock, err := net.Listen("unix", p.socket)
+	if err != nil {
+		return err
+	}
+	if err := applySocketPermissions(p.socket, p.pluginOptions.GRPC); err != nil {
+		sock.Close()
+		return err
+	}
+	p.healthServer = grpc.NewServer()
+	healthpb.RegisterHealthServer(p.healthServer, &managerHealthServer{manager: p})
+	go func(server *grpc.Server) {
+		if err := server.Serve(sock); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			l.Logger.Error("gRPC health server stopped", zap.String("socket", p.socket), zap.Error(err))
+		}
+	}(p.healthServer)
+	l.Logger.Info("serving gRPC health checks", zap.String("socket", p.socket))
+	return nil
+}
+
+// stopHealth : 停止管理器socket上的健康检查服务并删除socket
+func (p *PluginManager) stopHealth() {
+	if p.healthServer == nil {
+		return
+	}
+	p.healthServer.Stop()
+	p.healthServer = nil
+	if err := os.Remove(p.socket); err != nil && !os.IsNotExist(err) {
+		l.Logger.Warn("failed to remove socket", zap.String("socket", p.socket), zap.Error(err))
+	}
+}
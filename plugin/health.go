@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 健康检查项
+const (
+	HealthCheckNvml    = "nvml"
+	HealthCheckPlugins = "plugins"
+	HealthCheckDevices = "devices"
+	HealthCheckKubelet = "kubelet"
+)
+
+// HealthReport 服务健康状况，任一检查项失败时为降级状态
+type HealthReport struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// HealthCheck 单个检查项的结果
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+}
+
+// Health : 汇总NVML、GPU发现、插件注册、设备健康、共享配置、NVML安全模式、设备列表传递方式和kubelet socket的状态
+func (p *PluginManager) Health() HealthReport {
+	checks := []HealthCheck{
+		p.checkNvml(),
+		p.checkGPUs(),
+		p.checkPlugins(),
+		p.checkDevices(),
+		p.checkSharing(),
+		p.checkNvmlSafety(),
+		p.checkDeviceList(),
+		checkKubeletSocket(),
+	}
+	report := HealthReport{Healthy: true, Checks: checks}
+	for _, c := range checks {
+		if !c.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// checkNvml : NVML是否已初始化并可以查询设备，节点未安装NVML时不检查
+func (p *PluginManager) checkNvml() HealthCheck {
+	c := HealthCheck{Name: HealthCheckNvml}
+	if hasNVML, reason := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		c.Healthy = true
+		c.Message = "NVML not present: " + reason
+		return c
+	}
+	count, ret := p.nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		c.Message = fmt.Sprintf("NVML not usable: %v", ret)
+		return c
+	}
+	c.Healthy = true
+	c.Message = fmt.Sprintf("NVML initialized, %d devices", count)
+	return c
+}
+
+// checkPlugins : 需要启动的插件是否都已注册
+func (p *PluginManager) checkPlugins() HealthCheck {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	expected, registered := 0, 0
+	for _, pl := range p.plugins {
+		if !p.shouldServe(pl) {
+			continue
+		}
+		expected++
+		if pl.Status().State == StateRegistered {
+			registered++
+		}
+	}
+	return HealthCheck{
+		Name:    HealthCheckPlugins,
+		Healthy: registered == expected,
+		Message: fmt.Sprintf("%d of %d plugins registered", registered, expected),
+	}
+}
+
+// checkDevices : 设备健康状况，只有全部设备都不健康时才视为降级，避免单块GPU故障使整个节点的插件不可用
+func (p *PluginManager) checkDevices() HealthCheck {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	total, unhealthy := 0, 0
+	for _, pl := range p.plugins {
+		for _, d := range pl.Devices() {
+			total++
+			if d.Health != pluginapi.Healthy {
+				unhealthy++
+			}
+		}
+	}
+	return HealthCheck{
+		Name:    HealthCheckDevices,
+		Healthy: total == 0 || unhealthy < total,
+		Message: fmt.Sprintf("%d of %d devices unhealthy", unhealthy, total),
+	}
+}
+
+// checkKubeletSocket : kubelet的注册socket是否存在
+func checkKubeletSocket() HealthCheck {
+	c := HealthCheck{Name: HealthCheckKubelet}
+	if _, err := os.Stat(kubeletSocket); err != nil {
+		c.Message = fmt.Sprintf("kubelet socket unavailable: %v", err)
+		return c
+	}
+	c.Healthy = true
+	c.Message = "kubelet socket present"
+	return c
+}
@@ -0,0 +1,264 @@
+package plugin
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 内置的健康检查器
+const (
+	HealthCheckerECC          = "ecc"
+	HealthCheckerXid          = "xid"
+	HealthCheckerThermal      = "thermal"
+	HealthCheckerStuckProcess = "stuckProcess"
+	HealthCheckerDCGM         = "dcgm"
+	HealthCheckerDCGMDiag     = "dcgmDiag"
+)
+
+// 健康检查结果
+const (
+	healthCheckHealthy   = "healthy"
+	healthCheckUnhealthy = "unhealthy"
+	healthCheckError     = "error"
+)
+
+var (
+	healthChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "health_checks_total",
+		Help:      "Number of per-GPU health checks by checker and result (healthy, unhealthy, error).",
+	}, []string{"checker", "result"})
+	healthCheckDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "health_check_duration_seconds",
+		Help:      "Time a health checker took to check all GPUs of the node.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"checker"})
+)
+
+// HealthTarget 健康检查的对象，MIG设备按其所在的物理GPU检查
+type HealthTarget struct {
+	UUID   string
+	Device nvml.Device
+}
+
+// HealthResult 检查器对一块GPU的检查结果
+type HealthResult struct {
+	// Reason : 不健康的原因，Code 为空表示没有发现问题
+	Reason HealthReason
+	// GpuInstances : 只影响这些MIG GPU实例上的设备，为空时影响整块GPU上的所有设备
+	GpuInstances []int
+}
+
+// HealthChecker 设备健康检查器，由管理器按检查间隔统一调度，新增检查项时实现该接口并通过
+// RegisterHealthChecker 注册，不需要修改插件
+type HealthChecker interface {
+	// Name : 检查器名称，用于配置、日志和指标
+	Name() string
+	// Recoverable : 问题消失后是否把设备恢复为健康，硬件故障需要重置GPU，不自动恢复
+	Recoverable() bool
+	// Check : 检查一块GPU，返回错误表示无法完成检查，不改变设备状态
+	Check(ctx context.Context, gpu HealthTarget) (HealthResult, error)
+}
+
+// HealthPreparer 可选接口，检查器在每轮逐个检查GPU之前一次性获取数据，如DCGM一次返回所有GPU的结果
+// 返回错误时跳过本轮检查，不改变设备状态
+type HealthPreparer interface {
+	Prepare(ctx context.Context) error
+}
+
+// scheduledChecker 注册的检查器及其调度状态
+type scheduledChecker struct {
+	checker  HealthChecker
+	interval time.Duration
+	next     time.Time
+	// faults : 上次检查发现问题的GPU及原因代码，用于问题消失后恢复设备
+	faults map[string]string
+}
+
+// RegisterHealthChecker : 注册健康检查器，interval 为0时只在被触发时检查（如XID事件），需要在 Start 之前调用
+func (p *PluginManager) RegisterHealthChecker(c HealthChecker, interval time.Duration) {
+	l.Logger.Info("registering health checker", zap.String("checker", c.Name()), zap.Duration("interval", interval))
+	p.healthCheckers = append(p.healthCheckers, &scheduledChecker{checker: c, interval: interval, faults: make(map[string]string)})
+}
+
+// registerHealthCheckers : 按配置注册内置的健康检查器，未指定间隔的检查器使用 deviceHealth.interval
+func (p *PluginManager) registerHealthCheckers() {
+	interval := func(d time.Duration) time.Duration {
+		if d > 0 {
+			return d
+		}
+		return p.deviceHealth.Interval
+	}
+	if p.deviceHealth.Enabled {
+		switch p.healthBackend {
+		case HealthBackendDCGM:
+			// ECC和XID由DCGM的健康监控覆盖，不再注册NVML事件
+			p.registerDCGMCheckers(p.deviceHealth.Interval)
+		default:
+			if c := p.deviceHealth.Checkers.ECC; c.Enabled {
+				p.RegisterHealthChecker(&eccChecker{}, interval(c.Interval))
+			}
+			if p.deviceHealth.Xids {
+				p.xids = newXidChecker()
+				p.RegisterHealthChecker(p.xids, 0)
+			}
+		}
+		if c := p.deviceHealth.Checkers.StuckProcess; c.Enabled {
+			p.RegisterHealthChecker(newStuckProcessChecker(p.clock, c.StuckFor), interval(c.Interval))
+		}
+	}
+	if p.thermalConfig.Enabled {
+		p.RegisterHealthChecker(&thermalChecker{p: p}, interval(p.thermalConfig.Interval))
+	}
+}
+
+// nextHealthCheck : 下一个定期检查器到期的通道，没有定期检查器时为空
+func (p *PluginManager) nextHealthCheck() <-chan time.Time {
+	var next time.Time
+	found := false
+	for _, s := range p.healthCheckers {
+		if s.interval > 0 && (!found || s.next.Before(next)) {
+			next, found = s.next, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return p.clock.After(p.clock.Until(next))
+}
+
+// runHealthChecks : 运行到期的定期检查器
+func (p *PluginManager) runHealthChecks() {
+	now := p.clock.Now()
+	var due []*scheduledChecker
+	for _, s := range p.healthCheckers {
+		if s.interval > 0 && !s.next.After(now) {
+			due = append(due, s)
+			s.next = now.Add(s.interval)
+		}
+	}
+	p.checkHealth(due)
+}
+
+// triggerHealthCheck : 立即运行指定的检查器，如收到XID事件后，返回值同 checkHealth
+func (p *PluginManager) triggerHealthCheck(name string) bool {
+	for _, s := range p.healthCheckers {
+		if s.checker.Name() == name {
+			return p.checkHealth([]*scheduledChecker{s})
+		}
+	}
+	return false
+}
+
+// requestHealthCheck : 请求控制循环立即运行指定的检查器，用于在后台完成检查的检查器
+func (p *PluginManager) requestHealthCheck(name string) {
+	select {
+	case p.healthTrigger <- name:
+	default:
+		l.Logger.Warn("health check request dropped, too many pending", zap.String("checker", name))
+	}
+}
+
+// checkHealth : 按物理GPU运行检查器，把有问题的GPU上的设备标记为不健康，可恢复的问题消失后恢复
+// 返回检查器是否检查了所有提供设备的GPU，未运行或有设备找不到所属GPU时返回 false
+func (p *PluginManager) checkHealth(checkers []*scheduledChecker) bool {
+	if len(checkers) == 0 {
+		return false
+	}
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return false
+	}
+	if p.detectNVMLFaults() {
+		return false
+	}
+	p.mu.RLock()
+	plugins := append([]Interface(nil), p.plugins...)
+	p.mu.RUnlock()
+
+	// 按物理GPU分组，MIG设备随其所在的GPU一起检查
+	gpus := make(map[string]nvml.Device)
+	members := make(map[string][]drainMember)
+	complete := true
+	for _, pl := range plugins {
+		for _, d := range pl.Devices() {
+			gpu, uuid, err := p.parentGPU(d.ID)
+			if err != nil {
+				l.Logger.Warn("failed to get device for health check", zap.String("deviceID", d.ID), zap.Error(err))
+				complete = false
+				continue
+			}
+			gpus[uuid] = gpu
+			members[uuid] = append(members[uuid], drainMember{plugin: pl, id: d.ID})
+		}
+	}
+	uuids := make([]string, 0, len(gpus))
+	for uuid := range gpus {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	for _, s := range checkers {
+		name := s.checker.Name()
+		start := p.clock.Now()
+		if pr, ok := s.checker.(HealthPreparer); ok {
+			if err := pr.Prepare(p.ctx); err != nil {
+				healthChecks.WithLabelValues(name, healthCheckError).Inc()
+				l.Logger.Warn("health check failed", zap.String("checker", name), zap.Error(err))
+				complete = false
+				continue
+			}
+		}
+		for _, uuid := range uuids {
+			res, err := s.checker.Check(p.ctx, HealthTarget{UUID: uuid, Device: gpus[uuid]})
+			switch {
+			case err != nil:
+				complete = false
+				healthChecks.WithLabelValues(name, healthCheckError).Inc()
+				l.Logger.Warn("health check failed", zap.String("checker", name), zap.String("uuid", uuid), zap.Error(err))
+			case res.Reason.Code != "":
+				healthChecks.WithLabelValues(name, healthCheckUnhealthy).Inc()
+				s.faults[uuid] = res.Reason.Code
+				p.markMembers(members[uuid], res)
+			default:
+				healthChecks.WithLabelValues(name, healthCheckHealthy).Inc()
+				code, faulted := s.faults[uuid]
+				if !faulted {
+					continue
+				}
+				delete(s.faults, uuid)
+				if s.checker.Recoverable() {
+					for _, m := range members[uuid] {
+						m.plugin.MarkDeviceHealthy(m.id, code)
+					}
+				}
+			}
+		}
+		healthCheckDuration.WithLabelValues(name).Observe(p.clock.Since(start).Seconds())
+	}
+	return complete
+}
+
+// markMembers : 把受影响的设备标记为不健康，每次检查都重新标记，插件重启后重新创建的设备也保持不健康
+// 每种原因单独记录，可恢复的问题消失后只清除该原因，不会掩盖硬件故障或排空
+func (p *PluginManager) markMembers(members []drainMember, res HealthResult) {
+	for _, m := range members {
+		if len(res.GpuInstances) > 0 && !slices.ContainsFunc(res.GpuInstances, func(gi int) bool { return p.onGpuInstance(m.id, gi) }) {
+			continue
+		}
+		m.plugin.MarkDeviceUnhealthy(m.id, res.Reason)
+	}
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// eccChecker 通过NVML检查ECC错误、待退役显存页和行重映射状态，这些故障需要重置GPU，不自动恢复
+type eccChecker struct{}
+
+// Name : 检查器名称
+func (c *eccChecker) Name() string {
+	return HealthCheckerECC
+}
+
+// Recoverable : 硬件故障需要重置GPU
+func (c *eccChecker) Recoverable() bool {
+	return false
+}
+
+// Check : 检查GPU的显存故障
+func (c *eccChecker) Check(_ context.Context, gpu HealthTarget) (HealthResult, error) {
+	return HealthResult{Reason: deviceFault(gpu.Device)}, nil
+}
+
+// parentGPU : 根据设备ID获取GPU句柄，MIG设备返回其所在的GPU，副本使用去除标记后的UUID
+func (p *PluginManager) parentGPU(id string) (nvml.Device, string, error) {
+	d, ret := p.attributes.Handle(p.nvmllib, device.AnnotatedID(id).GetID())
+	if ret != nvml.SUCCESS {
+		return nil, "", fmt.Errorf("error getting device handle: %v", ret)
+	}
+	isMig, ret := d.IsMigDeviceHandle()
+	if ret != nvml.SUCCESS {
+		return nil, "", fmt.Errorf("error checking if device is a MIG device: %v", ret)
+	}
+	if isMig {
+		d, ret = d.GetDeviceHandleFromMigDeviceHandle()
+		if ret != nvml.SUCCESS {
+			return nil, "", fmt.Errorf("error getting parent device: %v", ret)
+		}
+	}
+	uuid, ret := d.GetUUID()
+	if ret != nvml.SUCCESS {
+		return nil, "", fmt.Errorf("error getting device UUID: %v", ret)
+	}
+	return d, uuid, nil
+}
+
+// deviceFault : 返回GPU的故障原因，没有故障或不支持查询时返回空
+func deviceFault(gpu nvml.Device) HealthReason {
+	if count, ret := gpu.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_UNCORRECTED, nvml.VOLATILE_ECC); ret == nvml.SUCCESS && count > 0 {
+		return HealthReason{Code: HealthReasonECC, Message: fmt.Sprintf("%d uncorrectable ECC errors", count)}
+	}
+	if pending, ret := gpu.GetRetiredPagesPendingStatus(); ret == nvml.SUCCESS && pending == nvml.FEATURE_ENABLED {
+		return HealthReason{Code: HealthReasonRetiredPages, Message: "retired pages pending, GPU reset required"}
+	}
+	if _, _, pending, failed, ret := gpu.GetRemappedRows(); ret == nvml.SUCCESS {
+		if failed {
+			return HealthReason{Code: HealthReasonRowRemap, Message: "row remapping failed"}
+		}
+		if pending {
+			return HealthReason{Code: HealthReasonRowRemap, Message: "row remapping pending, GPU reset required"}
+		}
+	}
+	return HealthReason{}
+}
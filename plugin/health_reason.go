@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 设备不健康的原因代码
+const (
+	HealthReasonXid             = "xid"
+	HealthReasonECC             = "ecc"
+	HealthReasonRetiredPages    = "retiredPages"
+	HealthReasonRowRemap        = "rowRemap"
+	HealthReasonThermal         = "thermal"
+	HealthReasonDrained         = "drained"
+	HealthReasonDriver          = "driver"
+	HealthReasonVersionMismatch = "versionMismatch"
+	HealthReasonMissing         = "missing"
+	HealthReasonStuckProcess    = "stuckProcess"
+	HealthReasonMaintenance     = "maintenance"
+	HealthReasonDCGM            = "dcgm"
+	HealthReasonDCGMDiag        = "dcgmDiag"
+)
+
+// healthReasonCodes 所有原因代码，用于把没有设备的原因的指标置0
+var healthReasonCodes = []string{HealthReasonXid, HealthReasonECC, HealthReasonRetiredPages, HealthReasonRowRemap, HealthReasonThermal, HealthReasonDrained, HealthReasonDriver, HealthReasonVersionMismatch, HealthReasonMissing, HealthReasonStuckProcess, HealthReasonMaintenance, HealthReasonDCGM, HealthReasonDCGMDiag}
+
+var unhealthyDevices = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "unhealthy_devices",
+	Help:      "Number of devices marked unhealthy by resource and reason code.",
+}, []string{"resource", "reason"})
+
+// HealthReason 设备被标记为不健康的原因
+type HealthReason struct {
+	// Code : 原因代码，如 xid、ecc、thermal、drained
+	Code string `json:"code"`
+	// Xid : 触发的XID错误号，只有 xid 原因时有值
+	Xid uint64 `json:"xid,omitempty"`
+	// Message : 具体说明
+	Message string `json:"message"`
+}
+
+// String 原因的文字说明，XID原因带上错误号
+func (r HealthReason) String() string {
+	switch {
+	case r.Code == "":
+		return ""
+	case r.Code == HealthReasonXid:
+		return fmt.Sprintf("xid %d: %s", r.Xid, r.Message)
+	case r.Message == "":
+		return r.Code
+	}
+	return r.Message
+}
+
+// updateUnhealthyMetric : 按原因统计不健康的设备数，有多个原因的设备在每个原因下各计一次，调用方持有 plugin.mu
+func (plugin *NvidiaDevicePlugin) updateUnhealthyMetric() {
+	counts := make(map[string]int)
+	for _, reasons := range plugin.unhealthy {
+		for _, r := range reasons {
+			counts[r.Code]++
+		}
+	}
+	for _, code := range healthReasonCodes {
+		unhealthyDevices.WithLabelValues(string(plugin.resourceName), code).Set(float64(counts[code]))
+	}
+}
@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"sort"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 热插拔事件类型
+const (
+	EventAttached = "attached"
+	EventDetached = "detached"
+)
+
+var hotplugEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "hotplug_events_total",
+	Help:      "Number of devices added to or removed from advertised resources by the periodic rescan.",
+}, []string{"resource", "type"})
+
+// rescanDevices : 重新扫描GPU，把新接入或移除的设备增量推送给对应插件，不重启其它插件
+func (p *PluginManager) rescanDevices() {
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return
+	}
+	dmp, excluded, err := p.buildDevices()
+	if err != nil {
+		l.Logger.Warn("failed to rescan devices", zap.Error(err))
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make(map[string]bool)
+	for name := range dmp {
+		names[name] = true
+	}
+	for name := range p.devices {
+		names[name] = true
+	}
+	changed := false
+	for _, name := range sortedKeys(names) {
+		added, removed := diffDevices(p.devices[name], dmp[name])
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		changed = true
+		p.recordHotplug(name, EventAttached, added)
+		p.recordHotplug(name, EventDetached, removed)
+
+		devices := dmp[name]
+		if devices == nil {
+			devices = make(device.Devices)
+		}
+		if pl := p.findPlugin(name); pl != nil {
+			pl.UpdateDevices(devices)
+			// 启动时没有设备的插件未提供服务
+			if pl.Status().State == StateStopped && len(devices) > 0 {
+				p.startPlugin(pl)
+			}
+			continue
+		}
+		pl, err := p.newPlugin(resource.ResourceName(name), devices)
+		if err != nil {
+			l.Logger.Error("failed to create device plugin", zap.String("resourceName", name), zap.Error(err))
+			continue
+		}
+		p.plugins = append(p.plugins, pl)
+		p.startPlugin(pl)
+	}
+	if !changed {
+		return
+	}
+	// 移除的设备的句柄不再有效
+	p.attributes.Invalidate()
+	p.devices = dmp
+	p.excluded = excluded
+	p.ledger.Track(p.devices)
+	// 重新接入的设备保持排空
+	p.applyDrains()
+	p.applyMaintenance()
+	p.applyDriverPolicy()
+	p.saveCheckpoint()
+}
+
+// findPlugin : 查找资源对应的插件
+func (p *PluginManager) findPlugin(resourceName string) Interface {
+	for _, pl := range p.plugins {
+		if pl.Status().ResourceName == resourceName {
+			return pl
+		}
+	}
+	return nil
+}
+
+// startPlugin : 启动热插拔时新增的插件，失败后按退避时间重试
+func (p *PluginManager) startPlugin(pl Interface) {
+	if !p.started || p.withheld() {
+		return
+	}
+	if err := pl.Start(); err != nil {
+		l.Logger.Error("Failed to start plugin", zap.String("resourceName", pl.Status().ResourceName), zap.Error(err))
+		p.scheduleRetry()
+	}
+}
+
+// recordHotplug : 记录设备接入或移除
+func (p *PluginManager) recordHotplug(resourceName string, event string, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	l.Logger.Info("devices "+event, zap.String("resourceName", resourceName), zap.Strings("ids", ids))
+	hotplugEvents.WithLabelValues(resourceName, event).Add(float64(len(ids)))
+	now := p.clock.Now()
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		uuid := device.AnnotatedID(id).GetID()
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+		p.events.Add(DeviceEvent{Time: now, Type: event, UUID: uuid, Reason: resourceName})
+	}
+}
+
+// diffDevices 比较两次扫描的设备，返回新增和移除的设备ID
+func diffDevices(old, current device.Devices) ([]string, []string) {
+	var added, removed []string
+	for id := range current {
+		if _, ok := old[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for id := range old {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// sortedKeys 按字母顺序返回集合中的键
+func sortedKeys[V any](set map[string]V) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
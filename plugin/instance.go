@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// instanceIDRegexp 实例ID会作为socket文件名前缀，只允许小写字母、数字和中划线
+var instanceIDRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+// competingDialTimeout 探测其它实例的socket是否仍在服务的超时时间
+const competingDialTimeout = time.Second
+
+// ValidateInstanceID 检查实例ID，空表示不区分实例
+// 以nvidia开头的实例ID无法与资源名称区分，不允许使用
+func ValidateInstanceID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if !instanceIDRegexp.MatchString(id) {
+		return fmt.Errorf("invalid instanceId %q: must be at most 32 lowercase letters, digits or '-', starting and ending with a letter or digit", id)
+	}
+	if strings.HasPrefix(id, "nvidia") {
+		return fmt.Errorf("invalid instanceId %q: must not start with \"nvidia\"", id)
+	}
+	return nil
+}
+
+// socketName 插件socket文件名，设置实例ID时以实例ID为前缀，使多个实例的socket不冲突
+func socketName(instanceID string, pluginName string) string {
+	if instanceID == "" {
+		return pluginName + ".sock"
+	}
+	return instanceID + "-" + pluginName + ".sock"
+}
+
+// competingSocket : 查找其它实例为同一资源提供服务且仍在监听的socket，没有时返回空
+// kubelet只保留最后注册的插件，两个实例同时注册同一资源会互相覆盖
+func (plugin *NvidiaDevicePlugin) competingSocket() string {
+	dir := filepath.Dir(plugin.socket)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	suffix := plugin.resourceName.PluginName() + ".sock"
+	for _, e := range entries {
+		name := e.Name()
+		path := filepath.Join(dir, name)
+		if path == plugin.socket {
+			continue
+		}
+		if name != suffix {
+			prefix, ok := strings.CutSuffix(name, "-"+suffix)
+			if !ok || ValidateInstanceID(prefix) != nil {
+				continue
+			}
+		}
+		// 无法连接的socket是已退出实例的残留
+		conn, err := net.DialTimeout("unix", path, competingDialTimeout)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		return path
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"sort"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
+)
+
+// Inventory 节点的设备清单及健康状态快照
+type Inventory struct {
+	Time      time.Time           `json:"time"`
+	Driver    version.Driver      `json:"driver"`
+	Resources []ResourceInventory `json:"resources"`
+}
+
+// ResourceInventory 单个资源的插件状态和设备
+type ResourceInventory struct {
+	ResourceName string            `json:"resourceName"`
+	State        string            `json:"state"`
+	Capacity     device.Capacity   `json:"capacity"`
+	ReplicaRatio float64           `json:"replicaRatio"`
+	Devices      []DeviceInventory `json:"devices"`
+}
+
+// DeviceInventory 单个设备的信息和健康状态
+type DeviceInventory struct {
+	ID                string   `json:"id"`
+	Index             string   `json:"index"`
+	Health            string   `json:"health"`
+	Reason            string   `json:"reason,omitempty"`
+	ReasonCode        string   `json:"reasonCode,omitempty"`
+	NumaNodes         []int64  `json:"numaNodes,omitempty"`
+	TotalMemory       uint64   `json:"totalMemory"`
+	ComputeCapability string   `json:"computeCapability"`
+	Replicas          int      `json:"replicas,omitempty"`
+	Clique            string   `json:"clique,omitempty"`
+	NIC               string   `json:"nic,omitempty"`
+	Paths             []string `json:"paths"`
+}
+
+// Inventory : 所有插件的设备清单快照，资源和设备按名称排序，便于比较
+func (p *PluginManager) Inventory() Inventory {
+	inv := Inventory{
+		Time:      p.clock.Now(),
+		Driver:    p.DriverVersions(),
+		Resources: make([]ResourceInventory, 0),
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, pl := range p.plugins {
+		status := pl.Status()
+		r := ResourceInventory{
+			ResourceName: status.ResourceName,
+			State:        status.State,
+			Capacity:     pl.Devices().GetCapacity(),
+			Devices:      make([]DeviceInventory, 0),
+		}
+		r.ReplicaRatio = r.Capacity.ReplicaRatio()
+		unhealthy := pl.UnhealthyDevices()
+		for _, d := range pl.Devices() {
+			di := DeviceInventory{
+				ID:                d.ID,
+				Index:             d.Index,
+				Health:            d.Health,
+				Reason:            unhealthy[d.ID].String(),
+				ReasonCode:        unhealthy[d.ID].Code,
+				TotalMemory:       d.TotalMemory,
+				ComputeCapability: d.ComputeCapability,
+				Replicas:          d.Replicas,
+				Clique:            d.Clique,
+				NIC:               d.NIC,
+				Paths:             d.Paths,
+			}
+			if d.Topology != nil {
+				for _, n := range d.Topology.Nodes {
+					di.NumaNodes = append(di.NumaNodes, n.ID)
+				}
+			}
+			r.Devices = append(r.Devices, di)
+		}
+		sort.Slice(r.Devices, func(i, j int) bool { return r.Devices[i].ID < r.Devices[j].ID })
+		inv.Resources = append(inv.Resources, r)
+	}
+	sort.Slice(inv.Resources, func(i, j int) bool { return inv.Resources[i].ResourceName < inv.Resources[j].ResourceName })
+	return inv
+}
+
+// ResourceCapacity 单个资源的物理设备数和可调度单元数
+type ResourceCapacity struct {
+	ResourceName string `json:"resourceName"`
+	device.Capacity
+	ReplicaRatio float64 `json:"replicaRatio"`
+}
+
+// Capacity : 各资源的物理设备数和可调度单元数，按资源名称排序
+func (p *PluginManager) Capacity() []ResourceCapacity {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	res := make([]ResourceCapacity, 0, len(p.plugins))
+	for _, pl := range p.plugins {
+		c := pl.Devices().GetCapacity()
+		res = append(res, ResourceCapacity{
+			ResourceName: pl.Status().ResourceName,
+			Capacity:     c,
+			ReplicaRatio: c.ReplicaRatio(),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ResourceName < res[j].ResourceName })
+	return res
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"os"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 插件socket所在的目录和kubelet的注册socket，测试时指向临时目录
+var (
+	devicePluginPath = pluginapi.DevicePluginPath
+	kubeletSocket    = pluginapi.KubeletSocket
+)
+
+var kubeletSocketPresent = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "kubelet_socket_present",
+	Help:      "Whether the kubelet registration socket exists (1) or kubelet is stopped and the plugins wait to re-register (0).",
+})
+
+// setKubeletPresent : 记录kubelet的注册socket是否存在
+func (p *PluginManager) setKubeletPresent(present bool) {
+	p.kubeletPresent.Store(present)
+	if present {
+		kubeletSocketPresent.Set(1)
+	} else {
+		kubeletSocketPresent.Set(0)
+	}
+}
+
+// checkKubeletPresent : 启动时检查kubelet的注册socket
+func (p *PluginManager) checkKubeletPresent() {
+	_, err := os.Stat(kubeletSocket)
+	p.setKubeletPresent(err == nil)
+}
+
+// kubeletStopped : kubelet的注册socket被删除或改名，kubelet已停止
+// 暂停所有插件的ListAndWatch推送并进入等待重新注册的状态，socket重新创建后重启插件
+func (p *PluginManager) kubeletStopped() {
+	if !p.kubeletPresent.Load() {
+		return
+	}
+	p.setKubeletPresent(false)
+	l.Logger.Warn("kubelet socket removed, pausing device updates until kubelet is back", zap.String("socket", kubeletSocket))
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, pl := range p.plugins {
+		pl.PauseUpdates()
+	}
+}
+
+// PauseUpdates 暂停ListAndWatch推送，已注册的插件进入等待kubelet重新注册的状态
+// 暂停期间的变化不再推送，插件重新启动后恢复
+func (plugin *NvidiaDevicePlugin) PauseUpdates() {
+	plugin.paused.Store(true)
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	if plugin.status.State == StateRegistered {
+		plugin.status.State = StateWaitingKubelet
+	}
+}
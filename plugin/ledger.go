@@ -0,0 +1,211 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/podresources"
+
+	"go.uber.org/zap"
+)
+
+// claimGracePeriod 新的占用在此时间内即使未出现在 PodResources 中也不会被释放，
+// 因为kubelet在Allocate之后才会创建容器并记录分配
+const claimGracePeriod = time.Minute
+
+// AllocationLister 获取kubelet当前的设备分配情况
+type AllocationLister interface {
+	List(ctx context.Context) ([]podresources.Allocation, error)
+}
+
+// claim 物理GPU被某个资源占用的记录
+type claim struct {
+	resourceName string
+	since        time.Time
+}
+
+// Ledger 共享分配账本
+// 当同一块物理GPU同时以多个资源对外提供时，记录其当前被哪个资源占用，避免不同插件重复分配同一块GPU
+type Ledger struct {
+	mu     sync.Mutex
+	shared map[string][]string
+	claims map[string]claim
+	lister AllocationLister
+	clock  clock.Clock
+}
+
+// NewLedger 创建共享分配账本，lister为空时无法得知Pod何时结束、占用无法释放，因此不做协调
+func NewLedger(lister AllocationLister, clk clock.Clock) *Ledger {
+	return &Ledger{
+		shared: make(map[string][]string),
+		claims: make(map[string]claim),
+		lister: lister,
+		clock:  clk,
+	}
+}
+
+// Track 根据设备映射找出被多个资源共享的物理GPU，只有这些GPU需要记账
+func (lg *Ledger) Track(devices device.DeviceMap) {
+	shared := make(map[string][]string)
+	for resourceName, devs := range devices {
+		seen := make(map[string]bool)
+		for id := range devs {
+			uuid := device.AnnotatedID(id).GetID()
+			if seen[uuid] {
+				continue
+			}
+			seen[uuid] = true
+			shared[uuid] = append(shared[uuid], resourceName)
+		}
+	}
+	for uuid, resources := range shared {
+		if len(resources) < 2 {
+			delete(shared, uuid)
+			continue
+		}
+		sort.Strings(resources)
+		l.Logger.Info("GPU is shared by multiple resources", zap.String("uuid", uuid), zap.Strings("resources", resources))
+	}
+
+	if len(shared) > 0 && lg.lister == nil {
+		l.Logger.Warn("GPUs are shared by multiple resources but podResources is disabled, allocations across these resources are not coordinated")
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	lg.shared = shared
+	for uuid := range lg.claims {
+		if _, ok := shared[uuid]; !ok {
+			delete(lg.claims, uuid)
+		}
+	}
+}
+
+// Available 过滤掉已被其它资源占用的设备
+func (lg *Ledger) Available(resourceName string, ids []string) []string {
+	if lg.lister == nil {
+		return ids
+	}
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	var res []string
+	for _, id := range ids {
+		if lg.conflict(resourceName, device.AnnotatedID(id).GetID()) == "" {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// Claim 为资源占用设备对应的物理GPU，返回此前未被该资源占用的GPU，分配失败时用于 Release
+// 如果GPU已被其它资源占用，会先从 PodResources 同步一次，仍然冲突则返回错误
+func (lg *Ledger) Claim(ctx context.Context, resourceName string, ids []string) ([]string, error) {
+	if lg.lister == nil {
+		return nil, nil
+	}
+	uuids := device.AnnotatedIDs(ids).GetIDs()
+
+	lg.mu.Lock()
+	owner, uuid := lg.firstConflict(resourceName, uuids)
+	lg.mu.Unlock()
+	if owner != "" {
+		if err := lg.sync(ctx); err != nil {
+			l.Logger.Warn("failed to sync allocation ledger", zap.Error(err))
+		}
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	if owner, uuid = lg.firstConflict(resourceName, uuids); owner != "" {
+		return nil, fmt.Errorf("GPU %s is already allocated through %s", uuid, owner)
+	}
+	now := lg.clock.Now()
+	var claimed []string
+	for _, uuid := range uuids {
+		if _, ok := lg.shared[uuid]; !ok {
+			continue
+		}
+		if c, ok := lg.claims[uuid]; !ok || c.resourceName != resourceName {
+			claimed = append(claimed, uuid)
+		}
+		lg.claims[uuid] = claim{resourceName: resourceName, since: now}
+	}
+	return claimed, nil
+}
+
+// Release 释放资源对GPU的占用，用于同一Allocate请求中后续容器分配失败时回滚
+func (lg *Ledger) Release(resourceName string, uuids []string) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	for _, uuid := range uuids {
+		if c, ok := lg.claims[uuid]; ok && c.resourceName == resourceName {
+			delete(lg.claims, uuid)
+		}
+	}
+}
+
+// Claims 当前被占用的共享GPU及其占用资源
+func (lg *Ledger) Claims() map[string]string {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	res := make(map[string]string, len(lg.claims))
+	for uuid, c := range lg.claims {
+		res[uuid] = c.resourceName
+	}
+	return res
+}
+
+// sync 根据 PodResources 中的实际分配重建占用记录，保留宽限期内的新占用
+func (lg *Ledger) sync(ctx context.Context) error {
+	allocations, err := lg.lister.List(ctx)
+	if err != nil {
+		return err
+	}
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	now := lg.clock.Now()
+	claims := make(map[string]claim)
+	for uuid, c := range lg.claims {
+		if now.Sub(c.since) < claimGracePeriod {
+			claims[uuid] = c
+		}
+	}
+	for _, a := range allocations {
+		for _, uuid := range a.UUIDs {
+			if _, ok := lg.shared[uuid]; !ok {
+				continue
+			}
+			if _, ok := claims[uuid]; ok {
+				continue
+			}
+			claims[uuid] = claim{resourceName: a.ResourceName, since: now.Add(-claimGracePeriod)}
+		}
+	}
+	lg.claims = claims
+	return nil
+}
+
+// firstConflict 找到第一个被其它资源占用的GPU
+func (lg *Ledger) firstConflict(resourceName string, uuids []string) (string, string) {
+	for _, uuid := range uuids {
+		if owner := lg.conflict(resourceName, uuid); owner != "" {
+			return owner, uuid
+		}
+	}
+	return "", ""
+}
+
+// conflict 返回占用GPU的其它资源，未被占用或被当前资源占用时返回空
+func (lg *Ledger) conflict(resourceName string, uuid string) string {
+	c, ok := lg.claims[uuid]
+	if !ok || c.resourceName == resourceName {
+		return ""
+	}
+	return c.resourceName
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 受并发限制的gRPC方法
+const (
+	methodAllocate               = "Allocate"
+	methodGetPreferredAllocation = "GetPreferredAllocation"
+)
+
+var (
+	allocateQueueLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "allocate_queue_length",
+		Help:      "Number of Allocate/GetPreferredAllocation requests waiting for a concurrency slot.",
+	}, []string{"resource", "method"})
+	allocateInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "allocate_in_flight",
+		Help:      "Number of Allocate/GetPreferredAllocation requests currently being processed.",
+	}, []string{"resource", "method"})
+	allocateQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "allocate_queue_wait_seconds",
+		Help:      "Time Allocate/GetPreferredAllocation requests spent waiting for a concurrency slot.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"resource", "method"})
+)
+
+// Limiter 限制所有插件同时处理的 Allocate/GetPreferredAllocation 请求数，超出的请求排队等待
+type Limiter struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// NewLimiter 创建并发限制器，maxConcurrent小于等于0时不限制
+func NewLimiter(maxConcurrent int, queueTimeout time.Duration) *Limiter {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &Limiter{
+		slots:   make(chan struct{}, maxConcurrent),
+		timeout: queueTimeout,
+	}
+}
+
+// Acquire 等待空闲的处理槽位，返回释放函数
+// 限制器为空时直接返回；等待超过排队时间或ctx结束时返回错误
+func (lm *Limiter) Acquire(ctx context.Context, resourceName, method string) (func(), error) {
+	inFlight := allocateInFlight.WithLabelValues(resourceName, method)
+	if lm == nil {
+		inFlight.Inc()
+		return inFlight.Dec, nil
+	}
+	if lm.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lm.timeout)
+		defer cancel()
+	}
+	queue := allocateQueueLength.WithLabelValues(resourceName, method)
+	queue.Inc()
+	start := time.Now()
+	select {
+	case lm.slots <- struct{}{}:
+		queue.Dec()
+		allocateQueueWait.WithLabelValues(resourceName, method).Observe(time.Since(start).Seconds())
+		inFlight.Inc()
+		return func() {
+			inFlight.Dec()
+			<-lm.slots
+		}, nil
+	case <-ctx.Done():
+		queue.Dec()
+		allocateQueueWait.WithLabelValues(resourceName, method).Observe(time.Since(start).Seconds())
+		return nil, fmt.Errorf("timed out waiting for a free %s slot after %v: %w", method, time.Since(start).Round(time.Millisecond), ctx.Err())
+	}
+}
@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 维护状态在存储中的bucket和键
+const (
+	maintenanceBucket = "maintenance"
+	maintenanceKey    = "state"
+)
+
+// 节点维护事件类型
+const (
+	EventMaintenanceEntered = "maintenanceEntered"
+	EventMaintenanceExited  = "maintenanceExited"
+)
+
+// EventReasonMaintenance 进入或退出维护时节点事件的原因
+const EventReasonMaintenance = "GPUMaintenance"
+
+var maintenanceMode = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "maintenance",
+	Help:      "Whether the node is in GPU maintenance mode (all devices unhealthy, allocations refused).",
+})
+
+// MaintenanceState 节点维护状态
+type MaintenanceState struct {
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// MaintenanceStatus 是否在维护中及维护状态
+type MaintenanceStatus struct {
+	InMaintenance bool `json:"inMaintenance"`
+	*MaintenanceState
+}
+
+// healthReason 维护期间设备在插件中的不健康原因
+func (s MaintenanceState) healthReason() HealthReason {
+	if s.Reason == "" {
+		return HealthReason{Code: HealthReasonMaintenance, Message: "node in maintenance"}
+	}
+	return HealthReason{Code: HealthReasonMaintenance, Message: "node in maintenance: " + s.Reason}
+}
+
+// Maintenance 节点维护状态，由管理器和所有插件共享，维护期间插件拒绝所有分配请求
+type Maintenance struct {
+	mu    sync.RWMutex
+	state *MaintenanceState
+}
+
+// NewMaintenance 创建维护状态，初始不在维护中
+func NewMaintenance() *Maintenance {
+	return &Maintenance{}
+}
+
+// State : 当前维护状态，第二个返回值表示是否在维护中
+func (m *Maintenance) State() (MaintenanceState, bool) {
+	if m == nil {
+		return MaintenanceState{}, false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.state == nil {
+		return MaintenanceState{}, false
+	}
+	return *m.state, true
+}
+
+// set : 设置维护状态，为空时退出维护
+func (m *Maintenance) set(s *MaintenanceState) {
+	m.mu.Lock()
+	m.state = s
+	m.mu.Unlock()
+	if s != nil {
+		maintenanceMode.Set(1)
+	} else {
+		maintenanceMode.Set(0)
+	}
+}
+
+// loadMaintenance : 从存储中恢复维护状态
+func (p *PluginManager) loadMaintenance() {
+	if p.store == nil {
+		return
+	}
+	data, err := p.store.Get(maintenanceBucket, maintenanceKey)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			l.Logger.Warn("failed to load maintenance state", zap.Error(err))
+		}
+		return
+	}
+	var s MaintenanceState
+	if err := json.Unmarshal(data, &s); err != nil {
+		l.Logger.Warn("invalid maintenance state", zap.Error(err))
+		return
+	}
+	p.maintenance.set(&s)
+	l.Logger.Warn("node is in GPU maintenance, all devices stay unhealthy", zap.String("reason", s.Reason), zap.Time("since", s.Time))
+}
+
+// Maintenance : 节点是否在GPU维护中
+func (p *PluginManager) Maintenance() MaintenanceStatus {
+	s, ok := p.maintenance.State()
+	if !ok {
+		return MaintenanceStatus{}
+	}
+	return MaintenanceStatus{InMaintenance: true, MaintenanceState: &s}
+}
+
+// EnterMaintenance : 节点进入GPU维护，把所有设备标记为不健康并拒绝新的分配，已运行的Pod不受影响，
+// 用于驱动升级等只涉及GPU的维护，不需要cordon整个节点。维护状态写入存储，插件和进程重启后保持；
+// 已在维护中时返回原来的状态
+func (p *PluginManager) EnterMaintenance(reason string) (MaintenanceState, error) {
+	if s, ok := p.maintenance.State(); ok {
+		return s, nil
+	}
+	s := MaintenanceState{Reason: reason, Time: p.clock.Now()}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return MaintenanceState{}, err
+	}
+	if p.store != nil {
+		if err := p.store.Put(maintenanceBucket, maintenanceKey, data); err != nil {
+			return MaintenanceState{}, fmt.Errorf("error saving maintenance state: %w", err)
+		}
+	}
+	p.maintenance.set(&s)
+	p.mu.RLock()
+	p.applyMaintenance()
+	p.mu.RUnlock()
+	l.Logger.Warn("node entered GPU maintenance", zap.String("reason", reason))
+	p.events.Add(DeviceEvent{Time: s.Time, Type: EventMaintenanceEntered, Reason: HealthReasonMaintenance, Message: reason})
+	emitNodeEvent(p.nodeEvents, kube.EventTypeNormal, EventReasonMaintenance, "GPU maintenance started, all GPUs marked unhealthy: "+s.healthReason().Message)
+	return s, nil
+}
+
+// ExitMaintenance : 节点退出GPU维护，恢复设备，被排空或因其它原因不健康的设备保持不健康；不在维护中时不做处理
+func (p *PluginManager) ExitMaintenance() error {
+	if _, ok := p.maintenance.State(); !ok {
+		return nil
+	}
+	if p.store != nil {
+		if err := p.store.Delete(maintenanceBucket, maintenanceKey); err != nil {
+			return fmt.Errorf("error deleting maintenance state: %w", err)
+		}
+	}
+	p.maintenance.set(nil)
+	p.mu.Lock()
+	for _, pl := range p.plugins {
+		for _, d := range pl.Devices() {
+			pl.MarkDeviceHealthy(d.ID, HealthReasonMaintenance)
+		}
+	}
+	// 排空和驱动策略的原因与维护原因分别记录，重新应用以覆盖维护期间重建的插件
+	p.applyDrains()
+	p.applyDriverPolicy()
+	p.mu.Unlock()
+	l.Logger.Warn("node exited GPU maintenance")
+	p.events.Add(DeviceEvent{Time: p.clock.Now(), Type: EventMaintenanceExited, Reason: HealthReasonMaintenance})
+	emitNodeEvent(p.nodeEvents, kube.EventTypeNormal, EventReasonMaintenance, "GPU maintenance finished")
+	return nil
+}
+
+// applyMaintenance : 维护期间把所有设备标记为不健康，插件重新加载或设备变化后重新标记，调用方持有 p.mu
+func (p *PluginManager) applyMaintenance() {
+	s, ok := p.maintenance.State()
+	if !ok {
+		return
+	}
+	for _, pl := range p.plugins {
+		for _, d := range pl.Devices() {
+			pl.MarkDeviceUnhealthy(d.ID, s.healthReason())
+		}
+	}
+}
@@ -2,193 +2,1195 @@ package plugin
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/feature"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
 	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/watch"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/podresources"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/store"
 
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"github.com/fsnotify/fsnotify"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
+// 未发现GPU设备时的处理方式
+const (
+	NonGpuNodeBehaviorExit          = "exit"
+	NonGpuNodeBehaviorIdle          = "idle"
+	NonGpuNodeBehaviorAdvertiseZero = "advertise-zero"
+)
+
+// ErrNoDevices 未发现设备且配置为 exit 时 Start 返回的错误，属于正常退出，调用方不应按失败处理
+var ErrNoDevices = errors.New("no devices found on node")
+
 type PluginManager struct {
-	server         *grpc.Server
-	socket         string
-	migStrategy    string
-	devices        device.DeviceMap
-	nvmllib        nvml.Interface
-	resources      []*resource.Resource
-	plugins        []Interface
-	started        bool
-	restart        bool
-	restartTimeout <-chan time.Time
-	ctx            context.Context
-	cancel         context.CancelFunc
-	ready          *util.CloseOnce
-}
-
-func NewPluginManager(migStrategy string, ready *util.CloseOnce) *PluginManager {
+	socket              string
+	healthServer        *grpc.Server
+	config              *config.Config
+	migStrategy         string
+	resourcePrefix      string
+	platform            string
+	nonGpuNodeBehavior  string
+	nonGpuProbeInterval time.Duration
+	noGPU               *NoGPU
+	devices             device.DeviceMap
+	filter              device.Filter
+	excluded            []device.ExcludedDevice
+	nvmllib             nvml.Interface
+	resources           []*resource.Resource
+	resourcePatterns    config.ResourcesConfig
+	plugins             []Interface
+	pluginOptions       Options
+	allocate            config.AllocateConfig
+	ledger              *Ledger
+	shutdown            config.ShutdownConfig
+	registration        config.RegistrationConfig
+	deviceHealth        config.DeviceHealthConfig
+	thermalConfig       config.ThermalConfig
+	thermal             *ThermalPolicy
+	healthCheckers      []*scheduledChecker
+	healthTrigger       chan string
+	xids                *xidChecker
+	healthBackend       string
+	dcgmConfig          config.DCGMConfig
+	dcgm                dcgmClient
+	dcgmHealth          *dcgmHealthChecker
+	dcgmDiag            *dcgmDiagChecker
+	gpuMemory           config.GPUMemoryConfig
+	memoryResource      resource.ResourceName
+	migAnyResource      resource.ResourceName
+	memory              *MemoryTracker
+	timeSlicing         config.TimeSlicingConfig
+	sharingMismatches   []SharingMismatch
+	modeDrift           config.ModeDriftConfig
+	hotplug             config.HotplugConfig
+	migWatch            config.MigWatchConfig
+	migLayouts          map[string]string
+	drifted             map[string]bool
+	drifts              []ModeDrift
+	driftMu             sync.Mutex
+	events              *EventLog
+	store               store.Store
+	drains              map[string]DrainState
+	drainMu             sync.Mutex
+	maintenance         *Maintenance
+	driverPolicy        config.DriverPolicyConfig
+	driverIncompatible  string
+	driverReadiness     config.DriverReadinessConfig
+	waitingForDriver    atomic.Bool
+	kubeletPresent      atomic.Bool
+	driverWait          chan struct{}
+	nvmlRefs            int
+	attributes          *device.AttributeCache
+	nvmlFaults          map[string]NVMLFault
+	nvmlFaultMu         sync.Mutex
+	nvmlHeld            bool
+	nvmlMu              sync.Mutex
+	checkpoint          *Checkpoint
+	lister              AllocationLister
+	nodeEvents          *kube.Recorder
+	started             bool
+	restarts            *RestartJobs
+	restartCh           chan struct{}
+	restartTimeout      <-chan time.Time
+	ctx                 context.Context
+	cancel              context.CancelFunc
+	loaded              *util.CloseOnce
+	registered          *util.CloseOnce
+	mu                  sync.RWMutex
+	driver              *version.Driver
+	driverMu            sync.Mutex
+	clock               clock.Clock
+}
+
+// ManagerOption 创建插件管理器的可选设置
+type ManagerOption func(*PluginManager)
+
+// WithClock : 使用指定的时间来源，测试时传入 clock.FakeClock 控制重试、健康检查等定时逻辑
+func WithClock(c clock.Clock) ManagerOption {
+	return func(p *PluginManager) {
+		p.clock = c
+	}
+}
+
+func NewPluginManager(cfg *config.Config, nvmllib nvml.Interface, kubeClient *kube.Client, podResources *podresources.Client, stateStore store.Store, loaded *util.CloseOnce, opts ...ManagerOption) *PluginManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	// 插件路径
-	pluginPath := pluginapi.DevicePluginPath + "k8s-gpu-device-plugin.sock"
+	pluginPath := filepath.Join(devicePluginPath, socketName(cfg.InstanceID, "k8s-gpu-device-plugin"))
 	// 创建插件管理器
 	pm := new(PluginManager)
-	pm.server = grpc.NewServer([]grpc.ServerOption{}...)
+	pm.clock = clock.RealClock{}
+	for _, opt := range opts {
+		opt(pm)
+	}
 	pm.socket = pluginPath
-	pm.nvmllib = nvml.New()
-	pm.migStrategy = migStrategy
-	pm.resources = resource.NewResources(pm.nvmllib, pm.migStrategy)
+	pm.nvmllib = nvmllib
+	pm.attributes = device.NewAttributeCache(cfg.DeviceCache.TTL)
+	// 运行期间保持NVML初始化，驱动未就绪时在启动时重试
+	pm.initNVML()
+	pm.config = cfg
+	pm.migStrategy = cfg.MigStrategy
+	pm.resourcePrefix = cfg.ResourcePrefix
+	pm.resourcePatterns = *cfg.Resources
+	pm.platform = resolvePlatform(cfg.Platform, nvmllib)
+	if pm.platform == PlatformWindows {
+		l.Logger.Info("discovering GPUs through DXGI", zap.String("platform", pm.platform))
+	}
+	pm.nonGpuNodeBehavior = cfg.NonGpuNodeBehavior
+	pm.nonGpuProbeInterval = cfg.NonGpuProbeInterval
+	pm.filter = device.Filter{Include: cfg.IncludeDevices, Exclude: cfg.ExcludeDevices, SkipUnmatched: cfg.Resources.Unmatched == resource.UnmatchedSkip}
+	// NUMA节点和PCIe拓扑从sysfs读取，在发现设备之前设置
+	device.SetSysfsRoot(cfg.SysfsRoot)
+	pm.shutdown = *cfg.Shutdown
+	pm.registration = *cfg.Registration
+	pm.deviceHealth = *cfg.DeviceHealth
+	pm.healthBackend = cfg.HealthBackend
+	pm.dcgmConfig = *cfg.DCGM
+	pm.healthTrigger = make(chan string, 4)
+	pm.nvmlFaults = make(map[string]NVMLFault)
+	pm.thermalConfig = *cfg.Thermal
+	pm.thermal = NewThermalPolicy(pm.thermalConfig)
+	pm.events = NewEventLog(0)
+	pm.store = stateStore
+	pm.loadDrains()
+	pm.maintenance = NewMaintenance()
+	pm.loadMaintenance()
+	pm.driverPolicy = *cfg.DriverPolicy
+	pm.driverReadiness = *cfg.DriverReadiness
+	pm.driverWait = make(chan struct{})
+	if pm.driverPolicy.Action != DriverPolicyUnhealthy && pm.driverPolicy.Action != DriverPolicyWithhold {
+		l.Logger.Warn("unknown driver policy action, marking devices unhealthy", zap.String("action", cfg.DriverPolicy.Action))
+		pm.driverPolicy.Action = DriverPolicyUnhealthy
+	}
+	pm.hotplug = *cfg.Hotplug
+	if pm.hotplug.Enabled && !feature.Enabled(feature.HotplugRescan) {
+		l.Logger.Warn("hotplug rescan requires the HotplugRescan feature gate, disabled")
+		pm.hotplug.Enabled = false
+	}
+	pm.timeSlicing = cfg.Sharing.TimeSlicing
+	if len(pm.timeSlicing.Resources) > 0 && !feature.Enabled(feature.TimeSlicing) {
+		l.Logger.Warn("time-slicing requires the TimeSlicing feature gate, disabled")
+		pm.timeSlicing = config.TimeSlicingConfig{}
+	}
+	pm.migWatch = *cfg.MigWatch
+	pm.modeDrift = *cfg.ModeDrift
+	if pm.modeDrift.Remediate && !feature.Enabled(feature.ModeDriftRemediation) {
+		l.Logger.Warn("mode drift remediation requires the ModeDriftRemediation feature gate, only reporting drift")
+		pm.modeDrift.Remediate = false
+	}
+	if err := ValidateDesiredModes(pm.modeDrift.Desired); err != nil {
+		l.Logger.Warn("invalid desired GPU modes, mode drift check disabled", zap.Error(err))
+		pm.modeDrift.Enabled = false
+	}
+	pm.resources = resource.NewResources(pm.nvmllib, pm.migStrategy, pm.resourcePrefix, pm.resourcePatterns)
 	pm.plugins = make([]Interface, 0)
+	pm.pluginOptions.Clock = pm.clock
+	pm.registerHealthCheckers()
+	pm.pluginOptions.InitialSendDelay = cfg.ListAndWatch.InitialDelay
+	pm.pluginOptions.HealthBatchWindow = cfg.ListAndWatch.BatchWindow
+	pm.pluginOptions.UnhealthyPolicy = cfg.Allocate.UnhealthyPolicy
+	pm.pluginOptions.IdempotencyWindow = cfg.Allocate.IdempotencyWindow
+	pm.pluginOptions.CudaVisibleDevicesOrdinals = cfg.Allocate.CudaVisibleDevicesOrdinals
+	pm.pluginOptions.NUMAPolicy = cfg.Allocate.NUMAPolicy
+	pm.pluginOptions.GDS = cfg.Allocate.GDSEnabled
+	if cfg.Allocate.RDMAEnabled {
+		checkPeermem()
+	}
+	pm.pluginOptions.Tracing = cfg.Tracing.Enabled
+	pm.pluginOptions.DisablePreferredAllocation = !cfg.Allocate.PreferredAllocation
+	pm.pluginOptions.APIVersions = cfg.Registration.APIVersions
+	pm.pluginOptions.DialTimeout = cfg.Registration.DialTimeout
+	pm.pluginOptions.RegisterTimeout = cfg.Registration.RegisterTimeout
+	logAPIVersions(pm.pluginOptions.APIVersions)
+	if pm.pluginOptions.DisablePreferredAllocation {
+		l.Logger.Info("GetPreferredAllocation disabled, kubelet picks devices itself and the allocation policy is not used")
+	}
+	if cfg.DeviceAttributes.Enabled {
+		pm.pluginOptions.DeviceAttributes = cfg.DeviceAttributes.Attributes
+		pm.pluginOptions.AttributePrefix = cfg.DeviceAttributes.Prefix
+	}
+	if cfg.Audit.Enabled {
+		audit, err := NewAuditor(*cfg.Audit)
+		if err != nil {
+			l.Logger.Warn("failed to create audit log, allocation requests are not audited", zap.Error(err))
+		} else {
+			pm.pluginOptions.Audit = audit
+		}
+	}
+	switch pm.pluginOptions.NUMAPolicy {
+	case NUMAPolicyNone, NUMAPolicyPack, NUMAPolicySpread:
+	default:
+		l.Logger.Warn("unknown NUMA policy, ignoring NUMA nodes", zap.String("numaPolicy", cfg.Allocate.NUMAPolicy))
+		pm.pluginOptions.NUMAPolicy = NUMAPolicyNone
+	}
+	pm.pluginOptions.RequireSameClique = cfg.Allocate.RequireSameClique
+	pm.pluginOptions.InstanceID = cfg.InstanceID
+	pm.pluginOptions.GRPC = *cfg.GRPC
+	if pm.pluginOptions.UnhealthyPolicy != UnhealthyPolicyReject && pm.pluginOptions.UnhealthyPolicy != UnhealthyPolicyWarn {
+		l.Logger.Warn("unknown unhealthy device policy, rejecting unhealthy devices", zap.String("unhealthyPolicy", pm.pluginOptions.UnhealthyPolicy))
+		pm.pluginOptions.UnhealthyPolicy = UnhealthyPolicyReject
+	}
+	// 共享分配账本，可通过 PodResources 释放已结束Pod的占用
+	var lister AllocationLister
+	if podResources != nil {
+		lister = podResources
+	}
+	pm.lister = lister
+	pm.ledger = NewLedger(lister, pm.clock)
+	pm.gpuMemory = *cfg.GPUMemory
+	if pm.gpuMemory.Enabled && !feature.Enabled(feature.GPUMemoryResource) {
+		l.Logger.Warn("GPU memory resource requires the GPUMemoryResource feature gate, disabled")
+		pm.gpuMemory.Enabled = false
+	}
+	if pm.gpuMemory.Enabled && pm.platform == PlatformWindows {
+		l.Logger.Warn("GPU memory resource requires NVML, disabled on platform windows")
+		pm.gpuMemory.Enabled = false
+	}
+	if pm.gpuMemory.Enabled {
+		pm.memoryResource = resource.NewResource("", pm.gpuMemory.ResourceName, pm.resourcePrefix).Name
+		pm.memory = NewMemoryTracker(string(pm.memoryResource), pm.gpuMemory.ChunkMiB, lister, pm.clock)
+	}
+	if m := cfg.MigAny; m != nil && m.Enabled {
+		switch {
+		case !feature.Enabled(feature.MigAnyResource):
+			l.Logger.Warn("MIG aggregate resource requires the MigAnyResource feature gate, disabled")
+		case pm.migStrategy != resource.MigStrategyMixed:
+			l.Logger.Warn("MIG aggregate resource requires migStrategy mixed, disabled", zap.String("migStrategy", pm.migStrategy))
+		default:
+			pm.migAnyResource = resource.NewResource("", m.ResourceName, pm.resourcePrefix).Name
+		}
+	}
+	pm.pluginOptions.Ledger = pm.ledger
+	pm.pluginOptions.Maintenance = pm.maintenance
+	pm.allocate = *cfg.Allocate
+	if !pm.allocate.AcceptEnvvarUnprivileged {
+		if pm.platform == PlatformWindows {
+			l.Logger.Warn("allocate.acceptEnvvarUnprivileged has no effect on platform windows")
+		} else {
+			pm.pluginOptions.DeviceListStrategy = pm.allocate.DeviceListStrategy
+		}
+	}
+	switch cfg.AllocationPolicy {
+	case AllocationPolicyBuiltin, "":
+	case AllocationPolicyWebhook:
+		policy, err := NewWebhookPolicy(*cfg.AllocationWebhook)
+		if err != nil {
+			l.Logger.Warn("invalid allocation webhook, using builtin allocation policy", zap.Error(err))
+			break
+		}
+		pm.pluginOptions.Policy = policy
+		pm.pluginOptions.PolicyFailure = cfg.AllocationWebhook.FailurePolicy
+		if pm.pluginOptions.PolicyFailure != PolicyFailureFallback && pm.pluginOptions.PolicyFailure != PolicyFailureFail {
+			l.Logger.Warn("unknown allocation webhook failure policy, falling back to builtin policy on failures", zap.String("failurePolicy", cfg.AllocationWebhook.FailurePolicy))
+			pm.pluginOptions.PolicyFailure = PolicyFailureFallback
+		}
+	default:
+		l.Logger.Warn("unknown allocation policy, using builtin allocation policy", zap.String("allocationPolicy", cfg.AllocationPolicy))
+	}
+	pm.pluginOptions.Limiter = NewLimiter(cfg.Allocate.MaxConcurrent, cfg.Allocate.QueueTimeout)
+	if kubeClient != nil && cfg.Kubernetes.AllocationEvents {
+		pm.pluginOptions.Events = kube.NewRecorder(kubeClient, "k8s-gpu-device-plugin", cfg.Kubernetes.NodeName)
+	}
+	if kubeClient != nil && cfg.Kubernetes.NodeEvents {
+		if cfg.Kubernetes.NodeName == "" {
+			l.Logger.Warn("node events need the node name, set kubernetes.nodeName or NODE_NAME, disabled")
+		} else {
+			pm.nodeEvents = kube.NewRecorder(kubeClient, "k8s-gpu-device-plugin", cfg.Kubernetes.NodeName)
+			pm.pluginOptions.NodeEvents = pm.nodeEvents
+		}
+	}
+	if cfg.Allocate.NICAffinity {
+		switch {
+		case kubeClient == nil || podResources == nil:
+			l.Logger.Warn("NIC affinity needs the kubernetes client and podResources, disabled")
+		case cfg.Kubernetes.NodeName == "":
+			l.Logger.Warn("NIC affinity needs the node name, set kubernetes.nodeName or NODE_NAME, disabled")
+		default:
+			pm.pluginOptions.NICAffinity = NewNICAffinity(kubeClient, cfg.Kubernetes.NodeName, cfg.Kubernetes.AnnotationPrefix, podResources)
+		}
+	}
 	pm.started = false
-	pm.restart = false
+	pm.restarts = NewRestartJobs(pm.clock)
+	pm.restartCh = make(chan struct{}, 1)
 	pm.restartTimeout = nil
 	pm.ctx = ctx
 	pm.cancel = cancel
+	pm.loaded = loaded
+	pm.registered = &util.CloseOnce{C: make(chan struct{})}
+	pm.registered.Close = func() {
+		pm.registered.Once.Do(func() {
+			close(pm.registered.C)
+		})
+	}
 	return pm
 }
 
-func (p *PluginManager) Start() {
+func (p *PluginManager) Start() error {
 	l.Logger.Info("starting plugin server...")
+	started := p.clock.Now()
 	// 监听文件系统
-	watcher, err := watch.Files(pluginapi.DevicePluginPath)
+	watcher, err := watch.Files(devicePluginPath)
 	if err != nil {
-		l.Logger.Error("failed to create FS watcher", zap.String("DevicePluginPath", pluginapi.DevicePluginPath), zap.Error(err))
-		return
+		l.Logger.Error("failed to create FS watcher", zap.String("DevicePluginPath", devicePluginPath), zap.Error(err))
+		return err
+	}
+	p.checkKubeletPresent()
+	// 等待驱动就绪
+	if !p.waitForDriver() {
+		watcher.Close()
+		l.Logger.Info("plugin server stopped")
+		return nil
+	}
+	// 插件运行期间持有NVML引用，重启插件不会重复初始化NVML
+	if p.acquireNVML() {
+		defer p.releaseNVML()
+	}
+	// 清理崩溃实例残留的socket
+	if err := p.cleanupSockets(); err != nil {
+		l.Logger.Error("failed to clean up plugin sockets", zap.Error(err))
+		watcher.Close()
+		return err
+	}
+	// gRPC健康检查
+	if err := p.serveHealth(); err != nil {
+		l.Logger.Warn("failed to serve gRPC health checks", zap.String("socket", p.socket), zap.Error(err))
 	}
 	// 加载插件
 	err = p.loadPlugins()
 	if err != nil {
 		l.Logger.Error("failed to load plugins", zap.Error(err))
-		return
+		watcher.Close()
+		return err
 	}
-	// 启动插件
+	// 未发现设备且配置为退出
+	if len(p.devices) == 0 && p.nonGpuNodeBehavior == NonGpuNodeBehaviorExit {
+		l.Logger.Info("No devices found. Exiting.", zap.String("nonGpuNodeBehavior", p.nonGpuNodeBehavior))
+		watcher.Close()
+		return ErrNoDevices
+	}
+	// 启动插件，标记已加载后再检查注册状态，未加载时 Readiness 总是未就绪
 	p.startPlugins()
-	p.ready.Close()
+	p.loaded.Close()
+	p.checkRegistered()
+	// 定期检查插件注册状态
+	var watchdog <-chan time.Time
+	if p.registration.CheckInterval > 0 {
+		ticker := p.clock.NewTicker(p.registration.CheckInterval)
+		defer ticker.Stop()
+		watchdog = ticker.C()
+	}
+	// 按各检查器的间隔检查设备健康
+	healthDue := p.nextHealthCheck()
+	// 监听XID严重错误
+	xids := p.watchXids()
+	// 定期检查GPU模式设置漂移
+	var driftCheck <-chan time.Time
+	if p.modeDrift.Enabled && p.modeDrift.Interval > 0 {
+		p.checkModeDrift()
+		ticker := p.clock.NewTicker(p.modeDrift.Interval)
+		defer ticker.Stop()
+		driftCheck = ticker.C()
+	}
+	// 定期重新扫描GPU
+	var hotplugScan <-chan time.Time
+	if p.hotplug.Enabled && p.hotplug.Interval > 0 {
+		ticker := p.clock.NewTicker(p.hotplug.Interval)
+		defer ticker.Stop()
+		hotplugScan = ticker.C()
+	}
+	// 定期检查MIG配置变化
+	var migCheck <-chan time.Time
+	if p.migWatch.Enabled && p.migWatch.Interval > 0 {
+		p.checkMigLayout()
+		ticker := p.clock.NewTicker(p.migWatch.Interval)
+		defer ticker.Stop()
+		migCheck = ticker.C()
+	}
+	// 无GPU节点定期重新探测
+	var gpuProbe <-chan time.Time
+	if p.nonGpuProbeInterval > 0 {
+		ticker := p.clock.NewTicker(p.nonGpuProbeInterval)
+		defer ticker.Stop()
+		gpuProbe = ticker.C()
+	}
+	// 启动期限，从启动开始计算，包含等待驱动的时间
+	var startupDeadline <-chan time.Time
+	if p.registration.StartupDeadline > 0 {
+		startupDeadline = p.clock.After(p.registration.StartupDeadline - p.clock.Since(started))
+	}
 	for {
 		select {
-		// 报错重新启动插件
+		// 重新启动失败的插件
 		case <-p.restartTimeout:
-			p.startPlugins()
+			start := p.clock.Now()
 			p.restartTimeout = nil
+			p.retryPlugins()
+			p.observeLoop(loopEventRetry, start)
+		// 注册失效的插件停止后按退避时间重试
+		case <-watchdog:
+			start := p.clock.Now()
+			p.verifyRegistrations()
+			p.observeLoop(loopEventWatchdog, start)
+		// 运行到期的健康检查器，把有问题的设备标记为不健康
+		case <-healthDue:
+			start := p.clock.Now()
+			p.runHealthChecks()
+			healthDue = p.nextHealthCheck()
+			p.observeLoop(loopEventHealth, start)
+		// 后台完成的检查（如DCGM诊断）请求立即应用结果
+		case name := <-p.healthTrigger:
+			start := p.clock.Now()
+			p.triggerHealthCheck(name)
+			p.observeLoop(loopEventHealth, start)
+		// 把发生XID严重错误的设备标记为不健康
+		case e, ok := <-xids:
+			if !ok {
+				xids = nil
+				continue
+			}
+			start := p.clock.Now()
+			p.handleXid(e)
+			p.observeLoop(loopEventXid, start)
+		// 检查GPU模式设置是否偏离期望状态
+		case <-driftCheck:
+			start := p.clock.Now()
+			p.checkModeDrift()
+			p.observeLoop(loopEventDrift, start)
+		// 增量更新新接入或移除的设备
+		case <-hotplugScan:
+			start := p.clock.Now()
+			p.rescanDevices()
+			p.checkRegistered()
+			p.observeLoop(loopEventHotplug, start)
+		// MIG重新划分后只重启受影响资源的插件
+		case <-migCheck:
+			start := p.clock.Now()
+			p.checkMigLayout()
+			p.checkRegistered()
+			p.observeLoop(loopEventMig, start)
 		// 通过监听'kubelet.socket'文件来检测kubelet重新启动。当发生这种情况时，重新启动所有插件
 		case event := <-watcher.Events:
-			if event.Name == pluginapi.KubeletSocket && event.Op&fsnotify.Create == fsnotify.Create {
+			start := p.clock.Now()
+			watcherEvents.WithLabelValues(event.Op.String()).Inc()
+			if event.Name == kubeletSocket && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				p.kubeletStopped()
+			}
+			if event.Name == kubeletSocket && event.Op&fsnotify.Create == fsnotify.Create {
+				p.setKubeletPresent(true)
 				l.Logger.Info("restart plugins", zap.String("event", event.String()), zap.String("name", event.Name))
-				p.restartPlugins()
+				kubeletRestarts.Inc()
+				p.restartPlugins(p.restarts.Start(RestartTriggerKubelet, nil))
 			}
+			p.observeLoop(loopEventWatcher, start)
 		// 记录监听事件错误
 		case err := <-watcher.Errors:
+			watcherErrors.Inc()
 			l.Logger.Error("fs error", zap.Error(err))
+		// 启动期限到达时仍有插件从未注册，以错误退出由kubelet重启，避免停留在半初始化状态
+		case <-startupDeadline:
+			startupDeadline = nil
+			// 插件可能在两次检查之间完成注册，先按当前状态重新检查
+			p.checkRegistered()
+			select {
+			case <-p.registered.C:
+				continue
+			default:
+			}
+			pending := p.Readiness().Pending
+			l.Logger.Error("plugins not registered within the startup deadline, exiting", zap.Duration("startupDeadline", p.registration.StartupDeadline), zap.Strings("pending", pending))
+			watcher.Close()
+			p.shutdownPlugins()
+			p.stopHealth()
+			return fmt.Errorf("plugins not registered within the startup deadline of %s: %s", p.registration.StartupDeadline, strings.Join(pending, ", "))
+		// 驱动安装或GPU接入后开始提供资源
+		case <-gpuProbe:
+			start := p.clock.Now()
+			p.probeGPUs()
+			p.checkRegistered()
+			p.observeLoop(loopEventProbe, start)
+		// 执行通过API请求的重启
+		case <-p.restartCh:
+			if job := p.restarts.Take(); job != nil {
+				start := p.clock.Now()
+				p.restartPlugins(job)
+				p.observeLoop(loopEventRestart, start)
+			}
 		// 退出
 		case <-p.ctx.Done():
-			l.Logger.Info("plugin server stopped")
 			watcher.Close()
-			p.stopPlugins()
-		default:
-			if p.restart {
-				p.restartPlugins()
-			}
+			p.shutdownPlugins()
+			p.stopHealth()
+			p.closeDCGM()
+			l.Logger.Info("plugin server stopped")
+			return nil
 		}
 	}
 }
 
+// Loaded : 插件是否已加载并启动，不代表已向kubelet注册
+func (p *PluginManager) Loaded() bool {
+	select {
+	case <-p.loaded.C:
+		return true
+	default:
+		return false
+	}
+}
+
 // Stop : 停止服务
 func (p *PluginManager) Stop() {
 	l.Logger.Info("stopping plugin server...")
 	p.cancel()
 }
 
-// Restart : 重启服务
-func (p *PluginManager) Restart() {
-	p.restart = true
+// Restart : 请求异步重启插件，返回重启任务，尚未开始执行的重启请求合并为一个任务
+// 指定资源时只重启这些资源的插件，未指定时重启全部插件
+func (p *PluginManager) Restart(resources ...string) (RestartJob, error) {
+	p.mu.RLock()
+	for _, name := range resources {
+		if p.findPlugin(name) == nil {
+			p.mu.RUnlock()
+			return RestartJob{}, fmt.Errorf("%w: %s", ErrUnknownResource, name)
+		}
+	}
+	p.mu.RUnlock()
+	job, created, err := p.restarts.Request(RestartTriggerAPI, resources)
+	if err != nil {
+		return job, err
+	}
+	if created {
+		l.Logger.Info("plugin restart requested", zap.String("jobId", job.ID), zap.Strings("resources", job.Resources))
+		// 通道已满说明主循环尚未处理上一次通知，届时会一并执行
+		select {
+		case p.restartCh <- struct{}{}:
+		default:
+		}
+	} else {
+		l.Logger.Info("plugin restart already pending, request coalesced", zap.String("jobId", job.ID), zap.Int("requests", job.Requests))
+	}
+	return job, nil
+}
+
+// RestartJob : 获取重启任务
+func (p *PluginManager) RestartJob(id string) (RestartJob, bool) {
+	return p.restarts.Get(id)
+}
+
+// RestartJobs : 最近的重启任务
+func (p *PluginManager) RestartJobs() []RestartJob {
+	return p.restarts.List()
 }
 
-// startPlugins : 启动插件
-func (p *PluginManager) startPlugins() {
+// startPlugins : 启动插件，返回启动失败的插件数量
+func (p *PluginManager) startPlugins() int {
 	// 如果插件已启动，则停止插件
 	if p.started {
 		p.stopPlugins()
 	}
 	p.started = true
 	started := 0
-	restart := false
-	for _, p := range p.plugins {
-		if len(p.Devices()) == 0 {
+	failed := 0
+	for _, pl := range p.plugins {
+		if !p.shouldServe(pl) {
 			continue
 		}
-		if err := p.Start(); err != nil {
-			restart = true
-			l.Logger.Error("Failed to start plugin", zap.Error(err))
-			break
+		if err := pl.Start(); err != nil {
+			failed++
+			l.Logger.Error("Failed to start plugin", zap.String("resourceName", pl.Status().ResourceName), zap.Error(err))
+			continue
 		}
 		started++
 	}
-	if started == 0 {
-		l.Logger.Info("No devices found. Waiting indefinitely.")
+	if started == 0 && failed == 0 {
+		l.Logger.Info("No devices found. Idling until GPUs are detected.", zap.String("nonGpuNodeBehavior", p.nonGpuNodeBehavior), zap.Duration("probeInterval", p.nonGpuProbeInterval))
+	}
+	p.scheduleRetry()
+	if failed == 0 {
+		l.Logger.Info("All plugins started.")
+	}
+	p.checkRegistered()
+	return failed
+}
+
+// retryPlugins : 重新启动已到重试时间的失败插件
+func (p *PluginManager) retryPlugins() {
+	if !p.kubeletPresent.Load() {
+		return
+	}
+	now := p.clock.Now()
+	for _, pl := range p.plugins {
+		status := pl.Status()
+		if status.State != StateError || status.NextRetry.After(now) {
+			continue
+		}
+		l.Logger.Info("Retrying plugin", zap.String("resourceName", status.ResourceName), zap.Int("failures", status.Failures))
+		pluginRestarts.WithLabelValues(status.ResourceName).Inc()
+		if err := pl.Start(); err != nil {
+			l.Logger.Error("Failed to start plugin", zap.String("resourceName", status.ResourceName), zap.Error(err))
+		}
+	}
+	p.scheduleRetry()
+	p.checkRegistered()
+}
+
+// verifyRegistrations : 检查已注册插件的注册状态，有插件失效时重新安排重试
+func (p *PluginManager) verifyRegistrations() {
+	// kubelet停止期间插件socket可能被清理，等待kubelet重新启动后统一重启
+	if !p.kubeletPresent.Load() {
+		return
+	}
+	lost := 0
+	for _, pl := range p.plugins {
+		if !p.shouldServe(pl) {
+			continue
+		}
+		if err := pl.VerifyRegistration(p.registration.ConnectTimeout); err != nil {
+			lost++
+		}
+	}
+	if lost > 0 {
+		p.scheduleRetry()
+	}
+	p.checkRegistered()
+}
+
+// scheduleRetry : 按最早的重试时间设置重启定时器
+func (p *PluginManager) scheduleRetry() {
+	var next time.Time
+	for _, pl := range p.plugins {
+		status := pl.Status()
+		if status.State != StateError {
+			continue
+		}
+		if next.IsZero() || status.NextRetry.Before(next) {
+			next = status.NextRetry
+		}
+	}
+	if next.IsZero() {
+		p.restartTimeout = nil
+		return
+	}
+	wait := p.clock.Until(next)
+	l.Logger.Info("Failed to start one or more plugins. Retrying later.", zap.Duration("retryIn", wait))
+	p.restartTimeout = p.clock.After(wait)
+}
+
+// PluginStatuses : 所有插件的运行状态
+func (p *PluginManager) PluginStatuses() []Status {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	statuses := make([]Status, 0, len(p.plugins))
+	for _, pl := range p.plugins {
+		statuses = append(statuses, pl.Status())
+	}
+	return statuses
+}
+
+// DeviceList 对外提供的设备和被过滤的设备
+type DeviceList struct {
+	Advertised map[string][]string     `json:"advertised"`
+	Excluded   []device.ExcludedDevice `json:"excluded"`
+	Unhealthy  []UnhealthyDevice       `json:"unhealthy"`
+	Warnings   []DeviceWarning         `json:"warnings"`
+}
+
+// DeviceWarning 已发现设备的非致命问题，如无法从sysfs读取NUMA节点
+type DeviceWarning struct {
+	ResourceName string `json:"resourceName"`
+	ID           string `json:"id"`
+	Message      string `json:"message"`
+}
+
+// UnhealthyDevice 被标记为不健康的设备及原因
+type UnhealthyDevice struct {
+	ResourceName string `json:"resourceName"`
+	ID           string `json:"id"`
+	Reason       string `json:"reason"`
+	// Code : 原因代码，如 xid、ecc、thermal、drained
+	Code string `json:"code"`
+	// Xid : 触发的XID错误号
+	Xid uint64 `json:"xid,omitempty"`
+}
+
+// DeviceList : 每个资源对外提供的设备ID，以及被过滤规则排除的设备
+func (p *PluginManager) DeviceList() DeviceList {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	list := DeviceList{
+		Advertised: make(map[string][]string),
+		Excluded:   make([]device.ExcludedDevice, 0, len(p.excluded)),
+	}
+	for resourceName, devs := range p.devices {
+		ids := devs.GetIDs()
+		sort.Strings(ids)
+		list.Advertised[resourceName] = ids
+	}
+	list.Excluded = append(list.Excluded, p.excluded...)
+	list.Unhealthy = make([]UnhealthyDevice, 0)
+	for _, pl := range p.plugins {
+		resourceName := pl.Status().ResourceName
+		for id, reason := range pl.UnhealthyDevices() {
+			list.Unhealthy = append(list.Unhealthy, UnhealthyDevice{ResourceName: resourceName, ID: id, Reason: reason.String(), Code: reason.Code, Xid: reason.Xid})
+		}
+	}
+	sort.Slice(list.Unhealthy, func(i, j int) bool {
+		if list.Unhealthy[i].ResourceName != list.Unhealthy[j].ResourceName {
+			return list.Unhealthy[i].ResourceName < list.Unhealthy[j].ResourceName
+		}
+		return list.Unhealthy[i].ID < list.Unhealthy[j].ID
+	})
+	list.Warnings = deviceWarnings(p.devices)
+	return list
+}
+
+// deviceWarnings : 各资源设备的警告，共享设备的副本只列出一次
+func deviceWarnings(dmp device.DeviceMap) []DeviceWarning {
+	res := make([]DeviceWarning, 0)
+	for resourceName, devs := range dmp {
+		seen := make(map[string]bool)
+		for id, d := range devs {
+			id = device.AnnotatedID(id).GetID()
+			if d.NUMAWarning == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			res = append(res, DeviceWarning{ResourceName: resourceName, ID: id, Message: d.NUMAWarning})
+		}
 	}
-	if restart {
-		l.Logger.Info("Failed to start one or more plugins. Retrying in 30s...")
-		p.restartTimeout = time.After(30 * time.Second)
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].ResourceName != res[j].ResourceName {
+			return res[i].ResourceName < res[j].ResourceName
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// GPUMemory : 每个GPU的显存分块分配情况，未启用显存资源时返回空
+func (p *PluginManager) GPUMemory(ctx context.Context) []GPUMemoryUsage {
+	if p.memory == nil {
+		return []GPUMemoryUsage{}
 	}
-	l.Logger.Info("All plugins started.")
+	p.mu.RLock()
+	devices := p.devices[string(p.memoryResource)]
+	p.mu.RUnlock()
+	return p.memory.Usage(ctx, devices)
+}
+
+// Events : 最近的设备事件
+func (p *PluginManager) Events() []DeviceEvent {
+	return p.events.List()
+}
+
+// LedgerClaims : 共享GPU当前的占用情况
+func (p *PluginManager) LedgerClaims() map[string]string {
+	return p.ledger.Claims()
 }
 
 // stopPlugins : 停止插件
 func (p *PluginManager) stopPlugins() {
-	for _, p := range p.plugins {
-		if len(p.Devices()) == 0 {
+	for _, pl := range p.plugins {
+		if !p.shouldServe(pl) {
 			continue
 		}
-		if err := p.Stop(); err != nil {
+		if err := pl.Stop(); err != nil {
 			l.Logger.Error("Failed to stop plugin", zap.Error(err))
 			continue
 		}
 	}
 }
 
+// shouldServe : 插件是否需要启动
+func (p *PluginManager) shouldServe(pl Interface) bool {
+	if p.withheld() {
+		return false
+	}
+	if len(pl.Devices()) > 0 {
+		return true
+	}
+	return len(p.devices) == 0 && p.nonGpuNodeBehavior == NonGpuNodeBehaviorAdvertiseZero
+}
+
+// shutdownPlugins : 退出时停止插件，停止前先向kubelet上报设备不健康并等待宽限期
+// 按资源配置不上报的插件继续以健康状态提供设备，最多等待 maxSkew，与宽限期同时计算
+func (p *PluginManager) shutdownPlugins() {
+	if p.started {
+		var wait time.Duration
+		marked := false
+		for _, pl := range p.plugins {
+			if !p.shouldServe(pl) {
+				continue
+			}
+			markUnhealthy, maxSkew := p.shutdownPolicy(pl.Status().ResourceName)
+			if markUnhealthy {
+				pl.MarkUnhealthy()
+				marked = true
+				continue
+			}
+			l.Logger.Info("keeping devices healthy during shutdown", zap.String("resourceName", pl.Status().ResourceName), zap.Duration("maxSkew", maxSkew))
+			if maxSkew > wait {
+				wait = maxSkew
+			}
+		}
+		if marked {
+			l.Logger.Info("devices marked unhealthy, waiting for kubelet to observe", zap.Duration("gracePeriod", p.shutdown.GracePeriod))
+			if p.shutdown.GracePeriod > wait {
+				wait = p.shutdown.GracePeriod
+			}
+		}
+		p.clock.Sleep(wait)
+	}
+	p.stopPlugins()
+}
+
+// shutdownPolicy : 资源退出时是否上报设备不健康，以及不上报时继续提供设备的最长时间，按顺序取第一个匹配的配置
+func (p *PluginManager) shutdownPolicy(name string) (bool, time.Duration) {
+	for _, r := range p.shutdown.Resources {
+		if ok, _ := path.Match(sharingName(p.resourcePrefix, r.Name), name); !ok {
+			continue
+		}
+		markUnhealthy := p.shutdown.MarkUnhealthy
+		if r.MarkUnhealthy != nil {
+			markUnhealthy = *r.MarkUnhealthy
+		}
+		if markUnhealthy {
+			return true, 0
+		}
+		return false, r.MaxSkew
+	}
+	return p.shutdown.MarkUnhealthy, 0
+}
+
 // loadPlugins : 加载插件
 func (p *PluginManager) loadPlugins() error {
-	// 创建设备映射
-	dmp, err := device.NewDeviceMap(p.nvmllib, p.resources, p.migStrategy)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 节点未安装NVML、驱动未加载或没有设备时视为无GPU节点，模拟模式不依赖NVML，Windows节点通过DXGI发现设备
+	if reason := p.gpuAbsence(); reason != "" {
+		l.Logger.Info("no usable GPUs, treating node as having no GPUs", zap.String("reason", reason))
+		p.devices = make(device.DeviceMap)
+		p.setNoGPU(reason)
+		return p.loadZeroPlugins()
+	}
+	if err := ValidateInstanceID(p.pluginOptions.InstanceID); err != nil {
+		l.Logger.Error("invalid instance configuration", zap.Error(err))
+		return err
+	}
+	if err := p.checkResourceNames(); err != nil {
+		l.Logger.Error("invalid resource configuration", zap.Error(err))
+		return err
+	}
+	if !p.started {
+		p.restoreCheckpoint()
+	}
+	// 创建设备映射，共享配置与发现的设备比较后再展开副本
+	dmp, excluded, err := p.discoverDevices()
 	if err != nil {
 		l.Logger.Error("failed to create device map", zap.Error(err))
 		return err
 	}
-	p.devices = dmp
+	for _, d := range excluded {
+		if d.Reason == device.ReasonUnmatched {
+			l.Logger.Warn("GPU not advertised, its name matches no resource pattern", zap.String("index", d.Index), zap.String("uuid", d.UUID), zap.String("name", d.Name))
+			continue
+		}
+		l.Logger.Info("device excluded", zap.String("index", d.Index), zap.String("uuid", d.UUID), zap.String("reason", d.Reason))
+	}
+	for _, w := range deviceWarnings(dmp) {
+		l.Logger.Warn("device topology incomplete", zap.String("resource", w.ResourceName), zap.String("id", w.ID), zap.String("warning", w.Message))
+	}
+	p.sharingMismatches = p.checkSharingConfig(dmp)
+	p.devices = p.applySharing(dmp)
+	p.excluded = excluded
+	p.ledger.Track(p.devices)
+	if len(p.devices) == 0 {
+		reason := "no NVIDIA devices discovered"
+		if len(excluded) > 0 {
+			reason = fmt.Sprintf("all %d devices excluded by includeDevices/excludeDevices or resources.unmatched", len(excluded))
+		}
+		p.setNoGPU(reason)
+		return p.loadZeroPlugins()
+	}
+	p.setNoGPU("")
 	// 创建插件
 	for k, v := range p.devices {
-		pl, err := NewNvidiaDevicePlugin(resource.ResourceName(k), v)
+		pl, err := p.newPlugin(resource.ResourceName(k), v)
 		if err != nil {
 			l.Logger.Error("failed to create device plugin", zap.Error(err))
 			return err
 		}
 		p.plugins = append(p.plugins, pl)
 	}
+	// 重新创建的设备保持排空
+	p.applyDrains()
+	p.applyMaintenance()
+	p.applyDriverPolicy()
+	p.saveCheckpoint()
 	return nil
 }
 
-// restartPlugins : 重启插件
-func (p *PluginManager) restartPlugins() error {
+// Discover : 按当前配置发现设备，不创建插件，用于命令行排查
+func (p *PluginManager) Discover() (device.DeviceMap, []device.ExcludedDevice, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if hasNVML, reason := info.New().HasNvml(); p.platform != PlatformWindows && !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return nil, nil, fmt.Errorf("NVML not detected: %s", reason)
+	}
+	if err := p.checkResourceNames(); err != nil {
+		return nil, nil, err
+	}
+	return p.buildDevices()
+}
+
+// buildDevices : 创建资源名称到设备的映射，共享的资源展开为副本，同时返回被过滤的设备
+func (p *PluginManager) buildDevices() (device.DeviceMap, []device.ExcludedDevice, error) {
+	dmp, excluded, err := p.discoverDevices()
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.applySharing(dmp), excluded, nil
+}
+
+// discoverDevices : 根据NVML或DXGI创建资源名称到设备的映射，同时返回被过滤的设备
+func (p *PluginManager) discoverDevices() (device.DeviceMap, []device.ExcludedDevice, error) {
+	defer func(start time.Time) {
+		discoveryDuration.Observe(p.clock.Since(start).Seconds())
+	}(p.clock.Now())
+	if p.platform == PlatformWindows {
+		return p.buildAdapterDevices()
+	}
+	dmp, excluded, err := device.NewDeviceMap(p.nvmllib, p.resources, p.migStrategy, p.filter, p.attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 显存资源与GPU资源共享物理GPU，由分配账本协调
+	if p.memory != nil {
+		mem, err := device.NewMemoryDevices(p.nvmllib, p.filter, p.gpuMemory.ChunkMiB, p.attributes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating GPU memory devices: %w", err)
+		}
+		if len(mem) > 0 {
+			dmp[string(p.memoryResource)] = mem
+		}
+	}
+	p.addMigAny(dmp)
+	return dmp, excluded, nil
+}
+
+// AttributeCache : 设备属性缓存的使用情况
+func (p *PluginManager) AttributeCache() device.AttributeCacheStats {
+	return p.attributes.Stats()
+}
+
+// InvalidateAttributeCache : 清空设备属性缓存，下次发现设备或查询句柄时重新读取NVML
+func (p *PluginManager) InvalidateAttributeCache() {
+	p.attributes.Invalidate()
+}
+
+// newPlugin : 为资源创建插件，显存资源的插件使用分块分配记录
+func (p *PluginManager) newPlugin(resourceName resource.ResourceName, devices device.Devices) (*NvidiaDevicePlugin, error) {
+	opts := p.pluginOptions
+	if p.memory != nil && resourceName == p.memoryResource {
+		opts.Memory = p.memory
+		opts.MemoryChunkMiB = p.gpuMemory.ChunkMiB
+	}
+	if p.migAnyResource != "" && resourceName == p.sharedName(p.migAnyResource) {
+		opts.SmallestFirst = true
+	}
+	return NewNvidiaDevicePlugin(resourceName, devices, p.nvmllib, opts)
+}
+
+// checkResourceNames : 检查MIG配置文件、显存资源等来源的资源名称和插件socket是否冲突
+func (p *PluginManager) checkResourceNames() error {
+	return resource.CheckCollisions(p.resourceNameClaims())
+}
+
+// resourceNameClaims : 本实例会提供的资源名称及其来源
+func (p *PluginManager) resourceNameClaims() []resource.NameClaim {
+	var claims []resource.NameClaim
+	// 多个模式可以提供同一资源，不视为冲突
+	patterns := make(map[resource.ResourceName][]string)
+	for _, r := range p.resources {
+		patterns[r.Name] = append(patterns[r.Name], fmt.Sprintf("%q", r.Pattern))
+	}
+	for _, name := range resource.Names(p.resources) {
+		claims = append(claims, resource.NameClaim{Name: p.sharedName(name), Source: fmt.Sprintf("%s strategy pattern %s", p.migStrategy, strings.Join(patterns[name], ", "))})
+	}
+	if p.memory != nil {
+		claims = append(claims, resource.NameClaim{Name: p.memoryResource, Source: "gpuMemory.resourceName"})
+	}
+	if p.migAnyResource != "" {
+		claims = append(claims, resource.NameClaim{Name: p.sharedName(p.migAnyResource), Source: "migAny.resourceName"})
+	}
+	return claims
+}
+
+// loadZeroPlugins : 为没有设备的资源创建插件，用于向kubelet上报数量为0的资源
+func (p *PluginManager) loadZeroPlugins() error {
+	if p.nonGpuNodeBehavior != NonGpuNodeBehaviorAdvertiseZero {
+		return nil
+	}
+	for _, name := range resource.Names(p.resources) {
+		pl, err := NewNvidiaDevicePlugin(p.sharedName(name), make(device.Devices), p.nvmllib, p.pluginOptions)
+		if err != nil {
+			l.Logger.Error("failed to create device plugin", zap.Error(err))
+			return err
+		}
+		p.plugins = append(p.plugins, pl)
+	}
+	return nil
+}
+
+// restartPlugins : 重启插件，并更新重启任务的进度
+func (p *PluginManager) restartPlugins(job *RestartJob) error {
+	// 重启后重新查询设备属性
+	p.attributes.Invalidate()
+	if len(job.Resources) > 0 {
+		return p.restartResources(job)
+	}
 	// 如果插件已启动，则停止插件
+	p.restarts.SetPhase(job, RestartStopping, nil)
 	if p.started {
 		p.stopPlugins()
 	}
+	p.mu.Lock()
+	before := p.devices
 	p.devices = nil
+	p.excluded = nil
 	p.plugins = make([]Interface, 0)
+	p.mu.Unlock()
 	// 加载插件
+	p.restarts.SetPhase(job, RestartRebuilding, nil)
 	err := p.loadPlugins()
 	if err != nil {
 		l.Logger.Error("failed to load plugins", zap.Error(err))
+		p.restarts.SetPhase(job, RestartFailed, err)
+		emitNodeEvent(p.nodeEvents, kube.EventTypeWarning, EventReasonPluginRestart, fmt.Sprintf("GPU device plugins failed to restart (trigger: %s): %v", job.Trigger, err))
 		return err
 	}
+	p.mu.RLock()
+	diff := DiffDeviceMaps(before, p.devices, p.excluded)
+	p.mu.RUnlock()
+	logDeviceMapDiff(diff)
+	p.restarts.SetDevices(job, diff)
 	// 启动插件
-	p.startPlugins()
-	p.restart = false
+	p.restarts.SetPhase(job, RestartRegistering, nil)
+	if failed := p.startPlugins(); failed > 0 {
+		// 启动失败的插件会按退避时间重试
+		p.restarts.SetPhase(job, RestartSucceeded, fmt.Errorf("%d plugins failed to start and will be retried", failed))
+		emitNodeEvent(p.nodeEvents, kube.EventTypeWarning, EventReasonPluginRestart, fmt.Sprintf("GPU device plugins restarted (trigger: %s), %d plugins failed to start and will be retried", job.Trigger, failed))
+	} else {
+		p.restarts.SetPhase(job, RestartSucceeded, nil)
+		emitNodeEvent(p.nodeEvents, kube.EventTypeNormal, EventReasonPluginRestart, fmt.Sprintf("GPU device plugins restarted (trigger: %s)", job.Trigger))
+	}
+	for _, pl := range p.plugins {
+		if p.shouldServe(pl) {
+			pluginRestarts.WithLabelValues(pl.Status().ResourceName).Inc()
+		}
+	}
+	return nil
+}
+
+// restartResources : 只重启任务指定的资源的插件，重新发现设备后替换这些资源的设备，其它插件保持注册
+func (p *PluginManager) restartResources(job *RestartJob) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restarts.SetPhase(job, RestartRebuilding, nil)
+	dmp, excluded, err := p.discoverDevices()
+	if err != nil {
+		l.Logger.Error("failed to create device map", zap.Strings("resources", job.Resources), zap.Error(err))
+		p.restarts.SetPhase(job, RestartFailed, err)
+		emitNodeEvent(p.nodeEvents, kube.EventTypeWarning, EventReasonPluginRestart, fmt.Sprintf("GPU device plugins failed to restart (trigger: %s): %v", job.Trigger, err))
+		return err
+	}
+	p.replacePlugins(job, p.applySharing(dmp), excluded)
 	return nil
 }
+
+// replacePlugins : 用新的设备映射替换任务指定的资源的设备，停止并重新创建这些资源的插件，调用方需持有锁
+// 新的映射中没有设备的资源不再提供
+func (p *PluginManager) replacePlugins(job *RestartJob, dmp device.DeviceMap, excluded []device.ExcludedDevice) {
+	before := make(device.DeviceMap, len(job.Resources))
+	after := make(device.DeviceMap, len(job.Resources))
+	for _, name := range job.Resources {
+		if devices, ok := p.devices[name]; ok {
+			before[name] = devices
+		}
+		if devices, ok := dmp[name]; ok {
+			after[name] = devices
+		}
+	}
+	diff := DiffDeviceMaps(before, after, excluded)
+	logDeviceMapDiff(diff)
+	p.restarts.SetDevices(job, diff)
+
+	p.restarts.SetPhase(job, RestartStopping, nil)
+	for _, name := range job.Resources {
+		pl := p.findPlugin(name)
+		if pl == nil {
+			continue
+		}
+		if p.started && p.shouldServe(pl) {
+			if err := pl.Stop(); err != nil {
+				l.Logger.Error("Failed to stop plugin", zap.String("resourceName", name), zap.Error(err))
+			}
+		}
+		p.removePlugin(pl)
+	}
+	devices := make(device.DeviceMap, len(p.devices))
+	for name, d := range p.devices {
+		devices[name] = d
+	}
+	for _, name := range job.Resources {
+		if len(dmp[name]) > 0 {
+			devices[name] = dmp[name]
+		} else {
+			delete(devices, name)
+		}
+	}
+	p.devices = devices
+	p.excluded = excluded
+	p.ledger.Track(p.devices)
+	p.restarts.SetPhase(job, RestartRegistering, nil)
+	for _, name := range job.Resources {
+		if len(dmp[name]) == 0 {
+			l.Logger.Info("resource has no devices, no longer advertised", zap.String("resourceName", name))
+			continue
+		}
+		pl, err := p.newPlugin(resource.ResourceName(name), dmp[name])
+		if err != nil {
+			l.Logger.Error("failed to create device plugin", zap.String("resourceName", name), zap.Error(err))
+			continue
+		}
+		p.plugins = append(p.plugins, pl)
+		p.startPlugin(pl)
+		pluginRestarts.WithLabelValues(name).Inc()
+	}
+	p.applyDrains()
+	p.applyMaintenance()
+	p.applyDriverPolicy()
+	p.saveCheckpoint()
+	p.restarts.SetPhase(job, RestartSucceeded, nil)
+	l.Logger.Info("plugins restarted", zap.String("trigger", job.Trigger), zap.Strings("resources", job.Resources))
+	emitNodeEvent(p.nodeEvents, kube.EventTypeNormal, EventReasonPluginRestart, fmt.Sprintf("GPU device plugins restarted (trigger: %s): %s", job.Trigger, strings.Join(job.Resources, ", ")))
+}
@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+)
+
+// cpuTime : 进程已使用的用户态和内核态CPU时间
+func cpuTime(t *testing.T) time.Duration {
+	t.Helper()
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		t.Fatal(err)
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// 模拟时间不推进时没有定时器到期，主循环应阻塞在 select 上，不占用CPU
+func TestManagerIdleLoop(t *testing.T) {
+	cfg := testConfig(t)
+	clk := clock.NewFakeClock(time.Now())
+	startTestManager(t, cfg, testServer(t, 2), clk)
+
+	const idle = 500 * time.Millisecond
+	before := cpuTime(t)
+	time.Sleep(idle)
+	used := cpuTime(t) - before
+	// 空转的主循环会占满一个CPU核心，几乎等于等待的时间
+	if used > idle/5 {
+		t.Fatalf("manager used %s of CPU in %s while idle", used, idle)
+	}
+}
@@ -0,0 +1,235 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func init() {
+	l.Logger = zap.NewNop()
+}
+
+// testConfig : 合并默认值后的配置，关闭会访问节点或外部服务的功能
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	viper.Reset()
+	config.SetDefaultConfig()
+	cfg := new(config.Config)
+	if err := viper.Unmarshal(cfg); err != nil {
+		t.Fatalf("unmarshal default config: %v", err)
+	}
+	cfg.Shutdown.GracePeriod = 0
+	cfg.DriverReadiness.Enabled = false
+	return cfg
+}
+
+// testGPU : 模拟的A100
+var testGPU = simulate.GPU{Name: "NVIDIA A100-SXM4-40GB", MemoryMiB: 40960, ComputeCapability: "8.0", NumaNode: -1}
+
+// testServer : count 块模拟GPU
+func testServer(t *testing.T, count int) *simulate.Server {
+	t.Helper()
+	s, err := simulate.NewServer(simulate.NewTopology(count, testGPU))
+	if err != nil {
+		t.Fatalf("create simulated NVML: %v", err)
+	}
+	return s
+}
+
+// fakeKubelet 只接受注册请求的kubelet，前 fail 次注册返回错误
+type fakeKubelet struct {
+	pluginapi.UnimplementedRegistrationServer
+	mu        sync.Mutex
+	fail      int
+	attempts  int
+	resources []string
+}
+
+// Register : 记录注册的资源
+func (k *fakeKubelet) Register(_ context.Context, r *pluginapi.RegisterRequest) (*pluginapi.Empty, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.attempts++
+	if k.fail > 0 {
+		k.fail--
+		return nil, fmt.Errorf("registration of %s rejected", r.ResourceName)
+	}
+	k.resources = append(k.resources, r.ResourceName)
+	return &pluginapi.Empty{}, nil
+}
+
+// Attempts : 收到的注册请求数，包括失败的请求
+func (k *fakeKubelet) Attempts() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.attempts
+}
+
+// useTestSockets : 把插件socket目录和kubelet的注册socket指向临时目录，并在其中启动 fakeKubelet
+func useTestSockets(t *testing.T, kubelet *fakeKubelet) {
+	t.Helper()
+	// unix socket 路径长度有限，不使用 t.TempDir 下较长的路径
+	dir, err := os.MkdirTemp("", "gdp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDir, oldSocket := devicePluginPath, kubeletSocket
+	devicePluginPath = dir + string(filepath.Separator)
+	kubeletSocket = filepath.Join(dir, "kubelet.sock")
+	lis, err := net.Listen("unix", kubeletSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pluginapi.RegisterRegistrationServer(server, kubelet)
+	go server.Serve(lis)
+	t.Cleanup(func() {
+		server.Stop()
+		devicePluginPath, kubeletSocket = oldDir, oldSocket
+		os.RemoveAll(dir)
+	})
+}
+
+// newLoaded : 插件加载完成时关闭的通道
+func newLoaded() *util.CloseOnce {
+	loaded := &util.CloseOnce{C: make(chan struct{})}
+	loaded.Close = func() {
+		loaded.Once.Do(func() {
+			close(loaded.C)
+		})
+	}
+	return loaded
+}
+
+// testManager 在测试中运行的管理器
+type testManager struct {
+	*PluginManager
+	kubelet *fakeKubelet
+	done    chan error
+	once    sync.Once
+}
+
+// runTestManager : 用模拟GPU和 fakeKubelet 在后台启动管理器，测试结束时停止
+func runTestManager(t *testing.T, cfg *config.Config, nvmllib *simulate.Server, clk clock.Clock, kubelet *fakeKubelet) *testManager {
+	t.Helper()
+	useTestSockets(t, kubelet)
+	m := &testManager{
+		PluginManager: NewPluginManager(cfg, nvmllib, nil, nil, nil, newLoaded(), WithClock(clk)),
+		kubelet:       kubelet,
+		done:          make(chan error, 1),
+	}
+	go func() {
+		m.done <- m.Start()
+	}()
+	t.Cleanup(func() { m.stop(t) })
+	return m
+}
+
+// waitRegistered : 等待所有插件完成注册
+func (m *testManager) waitRegistered(t *testing.T) {
+	t.Helper()
+	select {
+	case <-m.Registered():
+	case err := <-m.done:
+		t.Fatalf("Start returned before registering: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("plugins not registered: %v", m.Readiness().Pending)
+	}
+}
+
+// stop : 停止管理器并释放NVML，只执行一次
+func (m *testManager) stop(t *testing.T) {
+	m.once.Do(func() {
+		m.Stop()
+		select {
+		case err := <-m.done:
+			if err != nil {
+				t.Errorf("Start returned %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("manager did not stop")
+		}
+		m.ShutdownNVML()
+	})
+}
+
+// startTestManager : 启动管理器并等到所有插件注册后返回
+func startTestManager(t *testing.T, cfg *config.Config, nvmllib *simulate.Server, clk clock.Clock) *testManager {
+	t.Helper()
+	m := runTestManager(t, cfg, nvmllib, clk, &fakeKubelet{})
+	m.waitRegistered(t)
+	return m
+}
+
+// 注册失败的插件按退避时间重试，模拟时间未到重试时间时不会再次注册
+func TestPluginRetryBackoff(t *testing.T) {
+	cfg := testConfig(t)
+	clk := clock.NewFakeClock(time.Now())
+	m := runTestManager(t, cfg, testServer(t, 1), clk, &fakeKubelet{fail: 2})
+
+	failed := func(failures int, backoff time.Duration) {
+		t.Helper()
+		want := clk.Now().Add(backoff)
+		waitFor(t, fmt.Sprintf("failure %d", failures), func() bool {
+			statuses := m.PluginStatuses()
+			return len(statuses) == 1 && statuses[0].State == StateError && statuses[0].Failures == failures
+		})
+		if got := m.PluginStatuses()[0].NextRetry; !got.Equal(want) {
+			t.Fatalf("failure %d: next retry at %s, want %s", failures, got, want)
+		}
+	}
+	failed(1, initialRestartBackoff)
+
+	clk.Step(initialRestartBackoff - time.Second)
+	time.Sleep(100 * time.Millisecond)
+	if got := m.kubelet.Attempts(); got != 1 {
+		t.Fatalf("registered %d times before the retry was due", got)
+	}
+
+	// 第二次失败后退避时间翻倍
+	clk.Step(time.Second)
+	failed(2, 2*initialRestartBackoff)
+
+	clk.Step(2 * initialRestartBackoff)
+	m.waitRegistered(t)
+	if got := m.kubelet.Attempts(); got != 3 {
+		t.Fatalf("registered after %d attempts, want 3", got)
+	}
+}
+
+// 未发现设备且配置为 exit 时 Start 返回 ErrNoDevices，由调用方正常退出
+func TestNoDevicesExit(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.NonGpuNodeBehavior = NonGpuNodeBehaviorExit
+	// 过滤掉所有GPU
+	cfg.ExcludeDevices = []string{"0"}
+	m := runTestManager(t, cfg, testServer(t, 1), clock.NewFakeClock(time.Now()), &fakeKubelet{})
+	select {
+	case err := <-m.done:
+		if !errors.Is(err, ErrNoDevices) {
+			t.Fatalf("Start returned %v, want ErrNoDevices", err)
+		}
+		// Start 已经返回，停止时不再等待
+		m.done <- nil
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start did not return on a node without devices")
+	}
+}
@@ -0,0 +1,229 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 显存资源分配时设置的环境变量
+const (
+	envMpsPinnedMemLimit   = "CUDA_MPS_PINNED_DEVICE_MEM_LIMIT"
+	envMpsThreadPercentage = "CUDA_MPS_ACTIVE_THREAD_PERCENTAGE"
+	envGPUMemoryMiB        = "GPU_MEMORY_LIMIT_MIB"
+)
+
+var memoryChunksAssigned = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "memory_chunks_assigned",
+	Help:      "Number of GPU memory chunks assigned to containers by GPU.",
+}, []string{"uuid"})
+
+// GPUMemoryUsage 单个GPU的显存分块分配情况
+type GPUMemoryUsage struct {
+	UUID           string `json:"uuid"`
+	ChunkMiB       uint64 `json:"chunkMiB"`
+	TotalChunks    int    `json:"totalChunks"`
+	AssignedChunks int    `json:"assignedChunks"`
+	AssignedMiB    uint64 `json:"assignedMiB"`
+}
+
+// MemoryTracker 记录显存分块被分配到的GPU
+// kubelet不通知设备释放，有 PodResources 时以其中的实际分配为准，宽限期内的新分配保留
+type MemoryTracker struct {
+	mu           sync.Mutex
+	resourceName string
+	chunkMiB     uint64
+	lister       AllocationLister
+	clock        clock.Clock
+	assigned     map[string]time.Time
+}
+
+// NewMemoryTracker 创建显存分块分配记录，lister为空时只记录 Allocate 的结果
+func NewMemoryTracker(resourceName string, chunkMiB uint64, lister AllocationLister, clk clock.Clock) *MemoryTracker {
+	return &MemoryTracker{
+		resourceName: resourceName,
+		chunkMiB:     chunkMiB,
+		lister:       lister,
+		clock:        clk,
+		assigned:     make(map[string]time.Time),
+	}
+}
+
+// Assign 记录分配给容器的显存分块
+func (m *MemoryTracker) Assign(ids []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	for _, id := range ids {
+		m.assigned[id] = now
+	}
+}
+
+// Usage 统计每个GPU的显存分块分配情况，按UUID排序
+func (m *MemoryTracker) Usage(ctx context.Context, devices device.Devices) []GPUMemoryUsage {
+	if m.lister != nil {
+		if err := m.sync(ctx); err != nil {
+			l.Logger.Warn("failed to sync GPU memory assignments", zap.Error(err))
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := make(map[string]*GPUMemoryUsage)
+	for id := range devices {
+		uuid := device.AnnotatedID(id).GetID()
+		u, ok := usage[uuid]
+		if !ok {
+			u = &GPUMemoryUsage{UUID: uuid, ChunkMiB: m.chunkMiB}
+			usage[uuid] = u
+		}
+		u.TotalChunks++
+		if _, ok := m.assigned[id]; ok {
+			u.AssignedChunks++
+			u.AssignedMiB += m.chunkMiB
+		}
+	}
+	res := make([]GPUMemoryUsage, 0, len(usage))
+	for _, u := range usage {
+		memoryChunksAssigned.WithLabelValues(u.UUID).Set(float64(u.AssignedChunks))
+		res = append(res, *u)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].UUID < res[j].UUID })
+	return res
+}
+
+// sync 根据 PodResources 中的实际分配重建记录，保留宽限期内的新分配
+func (m *MemoryTracker) sync(ctx context.Context) error {
+	allocations, err := m.lister.List(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	assigned := make(map[string]time.Time)
+	for id, since := range m.assigned {
+		if now.Sub(since) < claimGracePeriod {
+			assigned[id] = since
+		}
+	}
+	for _, a := range allocations {
+		if a.ResourceName != m.resourceName {
+			continue
+		}
+		for _, id := range a.DeviceIDs {
+			if _, ok := assigned[id]; !ok {
+				assigned[id] = now.Add(-claimGracePeriod)
+			}
+		}
+	}
+	m.assigned = assigned
+	return nil
+}
+
+// memoryEnvs 根据分配的显存分块生成容器环境变量
+// 容器内的GPU序号与 NVIDIA_VISIBLE_DEVICES 的顺序一致，MPS按序号限制每个GPU可用的显存
+func (plugin *NvidiaDevicePlugin) memoryEnvs(ids []string) map[string]string {
+	var uuids []string
+	chunks := make(map[string]int)
+	replicas := make(map[string]int)
+	for _, id := range ids {
+		uuid := device.AnnotatedID(id).GetID()
+		if chunks[uuid] == 0 {
+			uuids = append(uuids, uuid)
+		}
+		chunks[uuid]++
+		if d := plugin.Devices().GetByID(id); d != nil {
+			replicas[uuid] = d.Replicas
+		}
+	}
+	var limits []string
+	var totalMiB uint64
+	percentage := 1
+	for i, uuid := range uuids {
+		mib := uint64(chunks[uuid]) * plugin.memoryChunkMiB
+		totalMiB += mib
+		limits = append(limits, fmt.Sprintf("%d=%dM", i, mib))
+		// 按显存占比粗略限制可用的SM比例，向上取整
+		if replicas[uuid] > 0 {
+			if p := (chunks[uuid]*100 + replicas[uuid] - 1) / replicas[uuid]; p > percentage {
+				percentage = p
+			}
+		}
+	}
+	if percentage > 100 {
+		percentage = 100
+	}
+	return map[string]string{
+		"NVIDIA_VISIBLE_DEVICES": strings.Join(uuids, ","),
+		envMpsPinnedMemLimit:     strings.Join(limits, ","),
+		envMpsThreadPercentage:   fmt.Sprintf("%d", percentage),
+		envGPUMemoryMiB:          fmt.Sprintf("%d", totalMiB),
+	}
+}
+
+// packedAlloc 显存分块优先集中在同一个GPU上
+// 选择剩余分块足够且最少的GPU，没有单个GPU能满足时从剩余分块最多的GPU开始依次分配
+func (plugin *NvidiaDevicePlugin) packedAlloc(available, required []string, size int) ([]string, error) {
+	candidates := plugin.Devices().Subset(available).Difference(plugin.Devices().Subset(required)).GetIDs()
+	needed := size - len(required)
+	if len(candidates) < needed {
+		return nil, fmt.Errorf("not enough available devices to satisfy allocation")
+	}
+	byGPU := make(map[string][]string)
+	var gpus []string
+	for _, id := range candidates {
+		uuid := device.AnnotatedID(id).GetID()
+		if _, ok := byGPU[uuid]; !ok {
+			gpus = append(gpus, uuid)
+		}
+		byGPU[uuid] = append(byGPU[uuid], id)
+	}
+	// 已指定的分块所在的GPU优先
+	preferred := make(map[string]bool)
+	for _, id := range required {
+		preferred[device.AnnotatedID(id).GetID()] = true
+	}
+	sort.Slice(gpus, func(i, j int) bool {
+		if preferred[gpus[i]] != preferred[gpus[j]] {
+			return preferred[gpus[i]]
+		}
+		if len(byGPU[gpus[i]]) != len(byGPU[gpus[j]]) {
+			return len(byGPU[gpus[i]]) < len(byGPU[gpus[j]])
+		}
+		return gpus[i] < gpus[j]
+	})
+	for _, uuid := range gpus {
+		if len(byGPU[uuid]) >= needed {
+			ids := byGPU[uuid]
+			sort.Strings(ids)
+			return append(append([]string(nil), required...), ids[:needed]...), nil
+		}
+	}
+	sort.SliceStable(gpus, func(i, j int) bool { return len(byGPU[gpus[i]]) > len(byGPU[gpus[j]]) })
+	// 复制一份，避免追加时改写调用方的 MustIncludeDeviceIDs
+	devices := append([]string(nil), required...)
+	for _, uuid := range gpus {
+		ids := byGPU[uuid]
+		sort.Strings(ids)
+		for _, id := range ids {
+			if len(devices) == size {
+				return devices, nil
+			}
+			devices = append(devices, id)
+		}
+	}
+	return devices, nil
+}
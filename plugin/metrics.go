@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+var (
+	allocateRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "allocate_requests_total",
+		Help:      "Number of Allocate requests received by resource.",
+	}, []string{"resource"})
+	allocateErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "allocate_errors_total",
+		Help:      "Number of Allocate requests that returned an error by resource.",
+	}, []string{"resource"})
+	preferredAllocationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "preferred_allocation_duration_seconds",
+		Help:      "Time spent computing GetPreferredAllocation responses by resource.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 8),
+	}, []string{"resource"})
+	listAndWatchUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "listandwatch_updates_total",
+		Help:      "Number of device lists sent to kubelet through ListAndWatch by resource.",
+	}, []string{"resource"})
+	pluginRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "restarts_total",
+		Help:      "Number of times a plugin was restarted or retried after a failure by resource.",
+	}, []string{"resource"})
+	devicesAdvertised = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "devices_advertised",
+		Help:      "Number of healthy devices in the last device list sent to kubelet by resource.",
+	}, []string{"resource"})
+	physicalDevicesAdvertised = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "physical_devices_advertised",
+		Help:      "Number of physical devices with at least one healthy replica in the last device list sent to kubelet by resource.",
+	}, []string{"resource"})
+	replicaRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "plugin",
+		Name:      "replica_ratio",
+		Help:      "Schedulable units advertised per physical device by resource, greater than 1 when devices are time-sliced.",
+	}, []string{"resource"})
+)
+
+// 管理器控制循环处理的事件
+const (
+	loopEventRetry    = "retry"
+	loopEventWatchdog = "watchdog"
+	loopEventHealth   = "health"
+	loopEventDrift    = "drift"
+	loopEventHotplug  = "hotplug"
+	loopEventMig      = "mig"
+	loopEventXid      = "xid"
+	loopEventWatcher  = "watcher"
+	loopEventRestart  = "restart"
+	loopEventProbe    = "probe"
+)
+
+var (
+	watcherEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "watcher_events_total",
+		Help:      "Number of filesystem events received from the device plugin directory watcher by operation.",
+	}, []string{"op"})
+	watcherErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "watcher_errors_total",
+		Help:      "Number of errors reported by the device plugin directory watcher.",
+	})
+	controlLoopDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "control_loop_duration_seconds",
+		Help:      "Time the manager control loop spent handling an event by event type.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 9),
+	}, []string{"event"})
+	discoveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "discovery_duration_seconds",
+		Help:      "Time spent discovering devices and querying their attributes through NVML or DXGI.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	kubeletRestarts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "kubelet_restarts_total",
+		Help:      "Number of plugin restarts triggered by the kubelet socket being recreated.",
+	})
+)
+
+// observeLoop 记录控制循环处理一次事件的耗时
+func (p *PluginManager) observeLoop(event string, start time.Time) {
+	controlLoopDuration.WithLabelValues(event).Observe(p.clock.Since(start).Seconds())
+}
+
+// sendDevices 通过ListAndWatch推送设备列表并记录指标
+func (plugin *NvidiaDevicePlugin) sendDevices(s pluginapi.DevicePlugin_ListAndWatchServer, devices []*pluginapi.Device) error {
+	if err := s.Send(&pluginapi.ListAndWatchResponse{Devices: devices}); err != nil {
+		return err
+	}
+	capacity := device.CapacityOf(devices)
+	plugin.setAcknowledged(capacity)
+	listAndWatchUpdates.WithLabelValues(string(plugin.resourceName)).Inc()
+	devicesAdvertised.WithLabelValues(string(plugin.resourceName)).Set(float64(capacity.HealthySchedulable))
+	physicalDevicesAdvertised.WithLabelValues(string(plugin.resourceName)).Set(float64(capacity.HealthyPhysical))
+	replicaRatio.WithLabelValues(string(plugin.resourceName)).Set(capacity.ReplicaRatio())
+	return nil
+}
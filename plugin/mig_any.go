@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+)
+
+// addMigAny : mixed 策略下把所有MIG设备汇总为聚合资源，设备与各MIG配置的资源共享，
+// 由分配账本保证同一MIG设备不会被两个资源同时分配
+func (p *PluginManager) addMigAny(dmp device.DeviceMap) {
+	if p.migAnyResource == "" {
+		return
+	}
+	union := make(device.Devices)
+	for name, devices := range dmp {
+		if p.memory != nil && name == string(p.memoryResource) {
+			continue
+		}
+		for id, d := range devices {
+			if !d.IsMigDevice() {
+				continue
+			}
+			c := *d
+			union[id] = &c
+		}
+	}
+	if len(union) > 0 {
+		dmp[string(p.migAnyResource)] = union
+	}
+}
+
+// smallestAlloc : 优先选择显存最小的MIG设备，把大的MIG配置留给只能使用它们的Pod
+func (plugin *NvidiaDevicePlugin) smallestAlloc(available, required []string, size int) ([]string, error) {
+	devices := plugin.Devices()
+	candidates := devices.Subset(available).Difference(devices.Subset(required)).GetIDs()
+	needed := size - len(required)
+	if len(candidates) < needed {
+		return nil, fmt.Errorf("not enough available devices to satisfy allocation")
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := devices[candidates[i]], devices[candidates[j]]
+		if a.TotalMemory != b.TotalMemory {
+			return a.TotalMemory < b.TotalMemory
+		}
+		if a.Product != b.Product {
+			return a.Product < b.Product
+		}
+		return a.ID < b.ID
+	})
+	return append(append([]string{}, required...), candidates[:needed]...), nil
+}
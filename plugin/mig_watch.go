@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	nvdevice "github.com/NVIDIA/go-nvlib/pkg/nvlib/device"
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// RestartTriggerMIG MIG配置变化触发的重启
+const RestartTriggerMIG = "mig"
+
+// EventMigReconfigured GPU的MIG配置发生变化
+const EventMigReconfigured = "mig_reconfigured"
+
+var migReconfigurations = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "mig_reconfigurations_total",
+	Help:      "Number of MIG layout changes detected at runtime that restarted the affected plugins.",
+})
+
+// migLayout : 每块GPU的MIG状态，键为GPU UUID，值为MIG模式以及排序后的MIG设备配置和UUID
+func (p *PluginManager) migLayout() (map[string]string, error) {
+	layout := make(map[string]string)
+	err := nvdevice.New(p.nvmllib).VisitDevices(func(i int, gpu nvdevice.Device) error {
+		uuid, ret := gpu.GetUUID()
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("error getting UUID of GPU %d: %v", i, ret)
+		}
+		enabled, err := gpu.IsMigEnabled()
+		if err != nil {
+			return fmt.Errorf("error checking if MIG is enabled on GPU %d: %v", i, err)
+		}
+		if !enabled {
+			layout[uuid] = "disabled"
+			return nil
+		}
+		var migs []string
+		err = gpu.VisitMigDevices(func(j int, mig nvdevice.MigDevice) error {
+			profile, err := mig.GetProfile()
+			if err != nil {
+				return fmt.Errorf("error getting MIG profile for MIG device at index '(%v, %v)': %v", i, j, err)
+			}
+			migUUID, ret := mig.GetUUID()
+			if ret != nvml.SUCCESS {
+				return fmt.Errorf("error getting UUID of MIG device at index '(%v, %v)': %v", i, j, ret)
+			}
+			migs = append(migs, profile.String()+"="+migUUID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Strings(migs)
+		layout[uuid] = "enabled:" + strings.Join(migs, ",")
+		return nil
+	})
+	return layout, err
+}
+
+// checkMigLayout : 比较GPU的MIG状态与上次检查的结果，运维人员用 nvidia-smi 重新划分MIG后
+// 只重启设备发生变化的资源的插件，第一次检查只记录当前状态
+func (p *PluginManager) checkMigLayout() {
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return
+	}
+	layout, err := p.migLayout()
+	if err != nil {
+		l.Logger.Warn("failed to read MIG layout", zap.Error(err))
+		return
+	}
+	prev := p.migLayouts
+	p.migLayouts = layout
+	if prev == nil {
+		return
+	}
+	var changed []string
+	for uuid, s := range layout {
+		if prev[uuid] != s {
+			changed = append(changed, uuid)
+		}
+	}
+	for uuid := range prev {
+		if _, ok := layout[uuid]; !ok {
+			changed = append(changed, uuid)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+	l.Logger.Info("MIG layout changed, restarting affected plugins", zap.Strings("gpus", changed))
+	migReconfigurations.Inc()
+	now := p.clock.Now()
+	for _, uuid := range changed {
+		p.events.Add(DeviceEvent{Time: now, Type: EventMigReconfigured, UUID: uuid, Reason: "mig", Message: fmt.Sprintf("%s -> %s", prev[uuid], layout[uuid])})
+	}
+	p.restartMigResources()
+}
+
+// restartMigResources : MIG配置变化后重新生成资源和设备映射，只重启设备发生变化的资源的插件
+// mixed 策略下新的MIG配置可能对应新的资源，不再有设备的资源停止提供
+func (p *PluginManager) restartMigResources() {
+	p.attributes.Invalidate()
+	resources := resource.NewResources(p.nvmllib, p.migStrategy, p.resourcePrefix, p.resourcePatterns)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resources = resources
+	if err := p.checkResourceNames(); err != nil {
+		l.Logger.Error("invalid resource configuration after MIG change", zap.Error(err))
+		p.restarts.SetPhase(p.restarts.Start(RestartTriggerMIG, nil), RestartFailed, err)
+		return
+	}
+	dmp, excluded, err := p.discoverDevices()
+	if err != nil {
+		l.Logger.Error("failed to create device map after MIG change", zap.Error(err))
+		p.restarts.SetPhase(p.restarts.Start(RestartTriggerMIG, nil), RestartFailed, err)
+		return
+	}
+	p.sharingMismatches = p.checkSharingConfig(dmp)
+	dmp = p.applySharing(dmp)
+
+	names := make(map[string]bool)
+	for name := range dmp {
+		names[name] = true
+	}
+	for name := range p.devices {
+		names[name] = true
+	}
+	var affected []string
+	for _, name := range sortedKeys(names) {
+		if added, removed := diffDevices(p.devices[name], dmp[name]); len(added) > 0 || len(removed) > 0 {
+			affected = append(affected, name)
+		}
+	}
+	if len(affected) == 0 {
+		l.Logger.Info("MIG layout changed without affecting any resource")
+		return
+	}
+	job := p.restarts.Start(RestartTriggerMIG, affected)
+	p.restarts.SetPhase(job, RestartRebuilding, nil)
+	p.replacePlugins(job, dmp, excluded)
+}
+
+// removePlugin : 从插件列表中移除插件
+func (p *PluginManager) removePlugin(pl Interface) {
+	for i, cur := range p.plugins {
+		if cur == pl {
+			p.plugins = append(p.plugins[:i], p.plugins[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/podresources"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// nicHintTimeout 查询Pod申请的网卡的超时时间
+const nicHintTimeout = 2 * time.Second
+
+// annotationNICResource Pod注解，值为RDMA网卡的资源名称，加上 kubernetes.annotationPrefix 前缀
+const annotationNICResource = "nic-resource"
+
+// 网卡提示的查询结果
+const (
+	nicHintFound     = "found"
+	nicHintNone      = "none"
+	nicHintAmbiguous = "ambiguous"
+	nicHintError     = "error"
+)
+
+var nicHints = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "nic_affinity_hints_total",
+	Help:      "Number of RDMA NIC hint lookups for preferred allocations, by result.",
+}, []string{"resource", "result"})
+
+// NICLister 获取kubelet分配给容器的其他资源的设备
+type NICLister interface {
+	ListResource(ctx context.Context, resourceName string) ([]podresources.Allocation, error)
+}
+
+// NICAffinity 推荐分配时优先选择与Pod申请的RDMA网卡在同一PCIe交换机下的GPU
+// Pod通过注解 <annotationPrefix>/nic-resource 给出RDMA资源的名称，已分配的网卡从PodResources接口读取
+type NICAffinity struct {
+	client     *kube.Client
+	nodeName   string
+	annotation string
+	lister     NICLister
+}
+
+// NewNICAffinity 创建网卡亲和的推荐分配提示
+func NewNICAffinity(client *kube.Client, nodeName, annotationPrefix string, lister NICLister) *NICAffinity {
+	return &NICAffinity{
+		client:     client,
+		nodeName:   nodeName,
+		annotation: annotationPrefix + "/" + annotationNICResource,
+		lister:     lister,
+	}
+}
+
+// hint : 正在等待分配该资源的Pod已分配的网卡的PCIe路径
+// 推荐分配请求中不包含Pod信息，只有一个带注解的Pending Pod申请该资源时才能确定是哪个Pod；
+// kubelet分配Pod的各个资源没有固定顺序，网卡还未分配时也没有提示
+func (a *NICAffinity) hint(resourceName string) ([][]string, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), nicHintTimeout)
+	defer cancel()
+	selector := fmt.Sprintf("spec.nodeName=%s,status.phase=Pending", a.nodeName)
+	pods, err := a.client.ListPods(ctx, selector)
+	if err != nil {
+		l.Logger.Warn("failed to list pending pods", zap.Error(err))
+		return nil, nicHintError
+	}
+	var matched []kube.Pod
+	for _, pod := range pods {
+		if pod.Metadata.Annotations[a.annotation] != "" && pod.Requests(resourceName) {
+			matched = append(matched, pod)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, nicHintNone
+	case 1:
+	default:
+		return nil, nicHintAmbiguous
+	}
+	pod := matched[0]
+	allocations, err := a.lister.ListResource(ctx, pod.Metadata.Annotations[a.annotation])
+	if err != nil {
+		l.Logger.Warn("failed to list allocated NICs", zap.Error(err))
+		return nil, nicHintError
+	}
+	var paths [][]string
+	for _, alloc := range allocations {
+		if alloc.Namespace != pod.Metadata.Namespace || alloc.Pod != pod.Metadata.Name {
+			continue
+		}
+		for _, id := range alloc.DeviceIDs {
+			if path := device.NICPCIePath(id); path != nil {
+				paths = append(paths, path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nicHintNone
+	}
+	return paths, nicHintFound
+}
+
+// nicCandidates : 有网卡提示时按与网卡的PCIe亲和度从高到低保留设备，直到足够分配
+// 只缩小候选范围，NVLink对齐和均匀分布仍由后续的分配方式决定
+func (plugin *NvidiaDevicePlugin) nicCandidates(available, required []string, size int) []string {
+	if plugin.nicAffinity == nil || len(available) <= size {
+		return available
+	}
+	nics, result := plugin.nicAffinity.hint(string(plugin.resourceName))
+	nicHints.WithLabelValues(string(plugin.resourceName), result).Inc()
+	if len(nics) == 0 {
+		return available
+	}
+	devices := plugin.Devices()
+	byAffinity := make(map[int][]string)
+	for _, id := range available {
+		best := 0
+		if d := devices.GetByID(id); d != nil {
+			for _, nic := range nics {
+				best = max(best, device.PCIeAffinity(d.PCIePath, nic))
+			}
+		}
+		byAffinity[best] = append(byAffinity[best], id)
+	}
+	affinities := make([]int, 0, len(byAffinity))
+	for a := range byAffinity {
+		affinities = append(affinities, a)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(affinities)))
+	var res []string
+	for _, a := range affinities {
+		res = append(res, byAffinity[a]...)
+		if len(res) >= size {
+			break
+		}
+	}
+	// 必须分配的设备始终保留
+	selected := make(map[string]bool, len(res))
+	for _, id := range res {
+		selected[id] = true
+	}
+	for _, id := range required {
+		if !selected[id] {
+			res = append(res, id)
+		}
+	}
+	l.Logger.Debug("preferring GPUs close to the pod's RDMA NICs", zap.String("resourceName", string(plugin.resourceName)), zap.Int("candidates", len(res)), zap.Int("available", len(available)))
+	return res
+}
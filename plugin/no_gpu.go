@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// HealthCheckGPUs 节点上是否发现了GPU，没有GPU时空闲并定期重新探测
+const HealthCheckGPUs = "gpus"
+
+var noGPUIdle = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "no_gpu",
+	Help:      "Whether the node has no usable NVIDIA GPU or driver and the plugin is idling with no resources (1).",
+})
+
+var gpuProbes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "gpu_probes_total",
+	Help:      "Number of periodic GPU probes on nodes without GPUs, by result (none, found).",
+}, []string{"result"})
+
+// NoGPU 节点没有可用GPU时的空闲状态
+type NoGPU struct {
+	// Reason : 没有可用GPU的原因，如未安装驱动、NVML初始化失败或没有设备
+	Reason    string    `json:"reason"`
+	Since     time.Time `json:"since"`
+	LastProbe time.Time `json:"lastProbe,omitempty"`
+}
+
+// setNoGPU : 记录节点没有可用GPU的原因，reason为空表示已发现GPU，调用方持有 p.mu
+func (p *PluginManager) setNoGPU(reason string) {
+	if reason == "" {
+		p.noGPU = nil
+		noGPUIdle.Set(0)
+		return
+	}
+	if p.noGPU == nil {
+		p.noGPU = &NoGPU{Since: p.clock.Now()}
+	}
+	p.noGPU.Reason = reason
+	noGPUIdle.Set(1)
+}
+
+// NoGPU : 节点没有可用GPU时的空闲状态，发现GPU后为空
+func (p *PluginManager) NoGPU() *NoGPU {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.noGPU == nil {
+		return nil
+	}
+	s := *p.noGPU
+	return &s
+}
+
+// gpuAbsence : 检查节点是否有NVML和NVIDIA设备，没有时返回原因
+func (p *PluginManager) gpuAbsence() string {
+	if p.platform == PlatformWindows || simulate.IsSimulated(p.nvmllib) {
+		return ""
+	}
+	if hasNVML, reason := info.New().HasNvml(); !hasNVML {
+		return "NVML not detected: " + reason
+	}
+	if !p.initNVML() {
+		return "NVML failed to initialize, the NVIDIA driver may not be loaded"
+	}
+	count, ret := p.nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return fmt.Sprintf("failed to count NVIDIA devices: %v", ret)
+	}
+	if count == 0 {
+		return "no NVIDIA devices found"
+	}
+	return ""
+}
+
+// probeGPUs : 无GPU节点定期重新探测，驱动安装或GPU接入后重新生成资源并启动插件，
+// 这样DaemonSet可以部署到所有节点而不需要按节点选择
+func (p *PluginManager) probeGPUs() {
+	if p.NoGPU() == nil {
+		return
+	}
+	reason := p.gpuAbsence()
+	if reason == "" {
+		// 驱动可用但设备可能都被过滤，只有确实能提供设备时才重启
+		resources := resource.NewResources(p.nvmllib, p.migStrategy, p.resourcePrefix, p.resourcePatterns)
+		p.mu.Lock()
+		p.resources = resources
+		dmp, _, err := p.buildDevices()
+		p.mu.Unlock()
+		switch {
+		case err != nil:
+			reason = fmt.Sprintf("failed to discover devices: %v", err)
+		case len(dmp) == 0:
+			reason = "no NVIDIA devices left after includeDevices/excludeDevices"
+		}
+	}
+	p.mu.Lock()
+	p.noGPU.LastProbe = p.clock.Now()
+	if reason != "" {
+		p.setNoGPU(reason)
+		p.mu.Unlock()
+		gpuProbes.WithLabelValues("none").Inc()
+		l.Logger.Debug("still no GPUs on the node", zap.String("reason", reason))
+		return
+	}
+	p.mu.Unlock()
+	gpuProbes.WithLabelValues("found").Inc()
+	l.Logger.Info("GPUs detected on a node that had none, loading plugins")
+	p.restartPlugins(p.restarts.Start(RestartTriggerProbe, nil))
+}
+
+// checkGPUs : 节点是否发现了GPU，没有GPU时空闲属于正常状态，只报告原因
+func (p *PluginManager) checkGPUs() HealthCheck {
+	c := HealthCheck{Name: HealthCheckGPUs, Healthy: true}
+	s := p.NoGPU()
+	if s == nil {
+		c.Message = "GPUs discovered"
+		return c
+	}
+	c.Message = fmt.Sprintf("no GPUs, idling with %s: %s", p.nonGpuNodeBehavior, s.Reason)
+	if p.nonGpuProbeInterval > 0 {
+		c.Message += fmt.Sprintf(", probing every %s", p.nonGpuProbeInterval)
+	}
+	return c
+}
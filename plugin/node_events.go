@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+)
+
+// 节点事件的原因
+const (
+	EventReasonGPUUnhealthy  = "GPUUnhealthy"
+	EventReasonPluginRestart = "GPUPluginRestart"
+)
+
+// nodeEventTimeout 发送节点事件的超时时间
+const nodeEventTimeout = 10 * time.Second
+
+// emitNodeEvent : 异步向本节点发送事件，recorder为空时不发送，发送失败只记录日志
+func emitNodeEvent(recorder *kube.Recorder, eventType, reason, message string) {
+	if recorder == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), nodeEventTimeout)
+		defer cancel()
+		if err := recorder.Event(ctx, kube.NodeReference(recorder.NodeName()), eventType, reason, message); err != nil {
+			l.Logger.Warn("failed to create node event", zap.String("node", recorder.NodeName()), zap.String("reason", reason), zap.Error(err))
+		}
+	}()
+}
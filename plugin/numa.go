@@ -0,0 +1,40 @@
+package plugin
+
+// 分时共享设备的NUMA分配方式
+const (
+	// NUMAPolicyNone : 不考虑NUMA节点，只在副本之间均匀分布
+	NUMAPolicyNone = "none"
+	// NUMAPolicyPack : 优先选择与必须分配的设备（没有时为第一个选中的设备）在同一NUMA节点上的设备
+	NUMAPolicyPack = "pack"
+	// NUMAPolicySpread : 优先选择已选设备最少的NUMA节点上的设备
+	NUMAPolicySpread = "spread"
+)
+
+// numaNode : 设备所在的NUMA节点，没有拓扑信息时返回false
+func (plugin *NvidiaDevicePlugin) numaNode(id string) (int64, bool) {
+	d := plugin.Devices().GetByID(id)
+	if d == nil || d.Topology == nil || len(d.Topology.Nodes) == 0 {
+		return 0, false
+	}
+	return d.Topology.Nodes[0].ID, true
+}
+
+// numaRank : 按NUMA分配方式计算候选设备的优先级，值越小越优先
+// selected 为各NUMA节点上已选设备的数量，包括必须分配的设备
+func (plugin *NvidiaDevicePlugin) numaRank(id string, selected map[int64]int) int {
+	node, ok := plugin.numaNode(id)
+	switch plugin.numaPolicy {
+	case NUMAPolicyPack:
+		// 还没有选中设备时所有节点相同
+		if len(selected) == 0 || (ok && selected[node] > 0) {
+			return 0
+		}
+		return 1
+	case NUMAPolicySpread:
+		if !ok {
+			return 0
+		}
+		return selected[node]
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var nvmlReferences = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "nvml_references",
+	Help:      "Number of references the plugin manager holds on NVML, NVML is shut down when it drops to 0.",
+})
+
+// acquireNVML : 持有一个NVML引用，第一个引用初始化NVML；节点没有NVML库或初始化失败时返回false，此时不需要释放
+func (p *PluginManager) acquireNVML() bool {
+	p.nvmlMu.Lock()
+	defer p.nvmlMu.Unlock()
+	return p.acquireNVMLLocked()
+}
+
+// acquireNVMLLocked : 调用方持有 nvmlMu
+func (p *PluginManager) acquireNVMLLocked() bool {
+	if p.nvmlRefs > 0 {
+		p.nvmlRefs++
+		nvmlReferences.Set(float64(p.nvmlRefs))
+		return true
+	}
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return false
+	}
+	if ret := p.nvmllib.Init(); ret != nvml.SUCCESS {
+		l.Logger.Warn("failed to initialize NVML", zap.Error(ret))
+		return false
+	}
+	p.nvmlRefs = 1
+	nvmlReferences.Set(1)
+	l.Logger.Debug("NVML initialized")
+	return true
+}
+
+// releaseNVML : 释放一个NVML引用，最后一个引用释放时关闭NVML
+func (p *PluginManager) releaseNVML() {
+	p.nvmlMu.Lock()
+	defer p.nvmlMu.Unlock()
+	p.releaseNVMLLocked()
+}
+
+// releaseNVMLLocked : 调用方持有 nvmlMu
+func (p *PluginManager) releaseNVMLLocked() {
+	if p.nvmlRefs == 0 {
+		l.Logger.Warn("NVML released more times than acquired")
+		return
+	}
+	p.nvmlRefs--
+	nvmlReferences.Set(float64(p.nvmlRefs))
+	if p.nvmlRefs > 0 {
+		return
+	}
+	if ret := p.nvmllib.Shutdown(); ret != nvml.SUCCESS {
+		l.Logger.Warn("failed to shutdown NVML", zap.Error(ret))
+		return
+	}
+	l.Logger.Debug("NVML shut down")
+}
+
+// initNVML : 持有管理器自身的NVML引用，运行期间保持初始化，退出时由 ShutdownNVML 释放；重复调用只持有一次
+func (p *PluginManager) initNVML() bool {
+	p.nvmlMu.Lock()
+	defer p.nvmlMu.Unlock()
+	if p.nvmlHeld {
+		return true
+	}
+	p.nvmlHeld = p.acquireNVMLLocked()
+	return p.nvmlHeld
+}
+
+// ShutdownNVML : 释放管理器自身的NVML引用，在所有插件停止后调用
+// Start 运行期间另外持有一个引用，退出超时插件仍在运行时不会关闭NVML
+func (p *PluginManager) ShutdownNVML() {
+	p.nvmlMu.Lock()
+	defer p.nvmlMu.Unlock()
+	if !p.nvmlHeld {
+		return
+	}
+	p.nvmlHeld = false
+	p.releaseNVMLLocked()
+}
+
+// NVMLReferences : 管理器当前持有的NVML引用数
+func (p *PluginManager) NVMLReferences() int {
+	p.nvmlMu.Lock()
+	defer p.nvmlMu.Unlock()
+	return p.nvmlRefs
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"strconv"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// throttleReasons NVML降频原因位在指标中的名称，ApplicationsClocksSetting 与 UserDefinedClocks 是同一位
+var throttleReasons = []struct {
+	bit  uint64
+	name string
+}{
+	{nvml.ClocksThrottleReasonGpuIdle, "gpu_idle"},
+	{nvml.ClocksThrottleReasonApplicationsClocksSetting, "applications_clocks_setting"},
+	{nvml.ClocksThrottleReasonSwPowerCap, "sw_power_cap"},
+	{nvml.ClocksThrottleReasonHwSlowdown, "hw_slowdown"},
+	{nvml.ClocksThrottleReasonSyncBoost, "sync_boost"},
+	{nvml.ClocksThrottleReasonSwThermalSlowdown, "sw_thermal_slowdown"},
+	{nvml.ClocksThrottleReasonHwThermalSlowdown, "hw_thermal_slowdown"},
+	{nvml.ClocksThrottleReasonHwPowerBrakeSlowdown, "hw_power_brake_slowdown"},
+	{nvml.ClocksThrottleReasonDisplayClockSetting, "display_clock_setting"},
+}
+
+// NVMLCollector 在采集时通过NVML查询每块物理GPU的时钟、降频原因和PCIe链路状态，
+// 不需要部署DCGM也能发现降频或PCIe链路降级的GPU；不支持的项不导出
+type NVMLCollector struct {
+	p                 *PluginManager
+	up                *prometheus.Desc
+	smClock           *prometheus.Desc
+	memoryClock       *prometheus.Desc
+	throttleReasons   *prometheus.Desc
+	throttleReason    *prometheus.Desc
+	pcieLinkGen       *prometheus.Desc
+	pcieLinkWidth     *prometheus.Desc
+	pcieMaxLinkGen    *prometheus.Desc
+	pcieMaxLinkWidth  *prometheus.Desc
+	pcieReplayCounter *prometheus.Desc
+}
+
+// NVMLCollector : 创建GPU时钟和PCIe链路指标采集器
+func (p *PluginManager) NVMLCollector() *NVMLCollector {
+	labels := []string{"uuid", "index"}
+	return &NVMLCollector{
+		p:                 p,
+		up:                prometheus.NewDesc("gpu_nvml_up", "Whether NVML could be queried for GPU clock and PCIe metrics during the last scrape.", nil, nil),
+		smClock:           prometheus.NewDesc("gpu_sm_clock_mhz", "Current SM clock of the GPU in MHz.", labels, nil),
+		memoryClock:       prometheus.NewDesc("gpu_memory_clock_mhz", "Current memory clock of the GPU in MHz.", labels, nil),
+		throttleReasons:   prometheus.NewDesc("gpu_clocks_throttle_reasons", "Bitmask of the reasons the GPU clocks are currently throttled, as reported by NVML.", labels, nil),
+		throttleReason:    prometheus.NewDesc("gpu_clocks_throttle_reason", "Whether the GPU clocks are currently throttled for the reason (1).", append(labels, "reason"), nil),
+		pcieLinkGen:       prometheus.NewDesc("gpu_pcie_link_generation", "Current PCIe link generation of the GPU.", labels, nil),
+		pcieLinkWidth:     prometheus.NewDesc("gpu_pcie_link_width", "Current PCIe link width (lanes) of the GPU.", labels, nil),
+		pcieMaxLinkGen:    prometheus.NewDesc("gpu_pcie_link_max_generation", "Maximum PCIe link generation supported by the GPU and its slot.", labels, nil),
+		pcieMaxLinkWidth:  prometheus.NewDesc("gpu_pcie_link_max_width", "Maximum PCIe link width (lanes) supported by the GPU and its slot.", labels, nil),
+		pcieReplayCounter: prometheus.NewDesc("gpu_pcie_replay_total", "Number of PCIe replays of the GPU since the driver was loaded.", labels, nil),
+	}
+}
+
+// Describe : prometheus.Collector
+func (c *NVMLCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.smClock
+	ch <- c.memoryClock
+	ch <- c.throttleReasons
+	ch <- c.throttleReason
+	ch <- c.pcieLinkGen
+	ch <- c.pcieLinkWidth
+	ch <- c.pcieMaxLinkGen
+	ch <- c.pcieMaxLinkWidth
+	ch <- c.pcieReplayCounter
+}
+
+// Collect : prometheus.Collector，采集期间持有NVML引用，节点没有NVML时只导出 gpu_nvml_up
+func (c *NVMLCollector) Collect(ch chan<- prometheus.Metric) {
+	if !c.p.acquireNVML() {
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	defer c.p.releaseNVML()
+	count, ret := c.p.nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		l.Logger.Debug("failed to get device count for NVML metrics", zap.Error(ret))
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+	for i := 0; i < count; i++ {
+		gpu, ret := c.p.nvmllib.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		uuid, ret := gpu.GetUUID()
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		c.collectDevice(ch, gpu, uuid, strconv.Itoa(i))
+	}
+}
+
+// collectDevice : 导出一块GPU的指标
+func (c *NVMLCollector) collectDevice(ch chan<- prometheus.Metric, gpu nvml.Device, uuid, index string) {
+	gauge := func(desc *prometheus.Desc, v float64, ret nvml.Return) {
+		if ret == nvml.SUCCESS {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, uuid, index)
+		}
+	}
+	sm, ret := gpu.GetClockInfo(nvml.CLOCK_SM)
+	gauge(c.smClock, float64(sm), ret)
+	mem, ret := gpu.GetClockInfo(nvml.CLOCK_MEM)
+	gauge(c.memoryClock, float64(mem), ret)
+	if reasons, ret := gpu.GetCurrentClocksThrottleReasons(); ret == nvml.SUCCESS {
+		gauge(c.throttleReasons, float64(reasons), ret)
+		for _, r := range throttleReasons {
+			v := 0.0
+			if reasons&r.bit != 0 {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.throttleReason, prometheus.GaugeValue, v, uuid, index, r.name)
+		}
+	}
+	gen, ret := gpu.GetCurrPcieLinkGeneration()
+	gauge(c.pcieLinkGen, float64(gen), ret)
+	width, ret := gpu.GetCurrPcieLinkWidth()
+	gauge(c.pcieLinkWidth, float64(width), ret)
+	maxGen, ret := gpu.GetMaxPcieLinkGeneration()
+	gauge(c.pcieMaxLinkGen, float64(maxGen), ret)
+	maxWidth, ret := gpu.GetMaxPcieLinkWidth()
+	gauge(c.pcieMaxLinkWidth, float64(maxWidth), ret)
+	if replays, ret := gpu.GetPcieReplayCounter(); ret == nvml.SUCCESS {
+		ch <- prometheus.MustNewConstMetric(c.pcieReplayCounter, prometheus.CounterValue, float64(replays), uuid, index)
+	}
+}
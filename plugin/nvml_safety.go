@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// HealthCheckNvmlSafety NVML与驱动版本是否一致、提供的设备是否都还能被NVML枚举
+const HealthCheckNvmlSafety = "nvmlSafety"
+
+// 安全模式的设备事件
+const (
+	EventNvmlFault     = "nvml_fault"
+	EventNvmlRecovered = "nvml_recovered"
+)
+
+// EventReasonNVMLFault 安全模式把资源的所有设备标记为不健康时的节点事件原因
+const EventReasonNVMLFault = "GPUNVMLFault"
+
+var nvmlFaulted = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "nvml_fault",
+	Help:      "Whether all devices of the resource are marked unhealthy because NVML reports a driver/library version mismatch or lost one of its devices (1).",
+}, []string{"resource"})
+
+// NVMLFault 安全模式下资源的所有设备被标记为不健康的原因
+type NVMLFault struct {
+	Resource string    `json:"resource"`
+	Code     string    `json:"code"`
+	Message  string    `json:"message"`
+	Since    time.Time `json:"since"`
+}
+
+// detectNVMLFaults : 安全模式下检查NVML是否与驱动版本一致、提供的设备是否都还能被枚举，
+// 出现问题时把整个资源的设备标记为不健康，而不是继续提供过时的设备列表
+// NVML因版本不一致不可用时返回true，调用方不需要再逐个检查设备
+func (p *PluginManager) detectNVMLFaults() bool {
+	if !p.deviceHealth.SafetyMode || p.platform == PlatformWindows {
+		return false
+	}
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return false
+	}
+	p.mu.RLock()
+	plugins := append([]Interface(nil), p.plugins...)
+	p.mu.RUnlock()
+
+	faults := make(map[string]HealthReason)
+	_, ret := p.nvmllib.DeviceGetCount()
+	switch ret {
+	case nvml.SUCCESS:
+		// 不使用缓存的句柄，否则设备消失后仍然能查到
+		for _, pl := range plugins {
+			for _, d := range pl.Devices() {
+				uuid := device.AnnotatedID(d.ID).GetID()
+				if _, ret := p.nvmllib.DeviceGetHandleByUUID(uuid); ret == nvml.ERROR_NOT_FOUND || ret == nvml.ERROR_GPU_IS_LOST {
+					faults[pl.Status().ResourceName] = HealthReason{Code: HealthReasonMissing, Message: fmt.Sprintf("device %s disappeared from NVML: %v", uuid, ret)}
+					break
+				}
+			}
+		}
+	case nvml.ERROR_LIB_RM_VERSION_MISMATCH:
+		reason := HealthReason{Code: HealthReasonVersionMismatch, Message: "NVML library version does not match the kernel driver"}
+		for _, pl := range plugins {
+			faults[pl.Status().ResourceName] = reason
+		}
+	default:
+		// 其它错误由 nvml 检查项报告
+		return false
+	}
+	p.applyNVMLFaults(plugins, faults)
+	return ret != nvml.SUCCESS
+}
+
+// applyNVMLFaults : 把有问题的资源的所有设备标记为不健康，问题消失后恢复
+func (p *PluginManager) applyNVMLFaults(plugins []Interface, faults map[string]HealthReason) {
+	now := p.clock.Now()
+	p.nvmlFaultMu.Lock()
+	defer p.nvmlFaultMu.Unlock()
+	seen := make(map[string]bool)
+	for _, pl := range plugins {
+		name := pl.Status().ResourceName
+		seen[name] = true
+		reason, faulted := faults[name]
+		prev, was := p.nvmlFaults[name]
+		switch {
+		case faulted:
+			if !was || prev.Code != reason.Code {
+				l.Logger.Error("NVML safety mode marking all devices of the resource unhealthy", zap.String("resourceName", name), zap.String("reason", reason.Code), zap.String("message", reason.Message))
+				p.events.Add(DeviceEvent{Time: now, Type: EventNvmlFault, Reason: reason.Code, Message: fmt.Sprintf("%s: %s", name, reason.Message)})
+				emitNodeEvent(p.nodeEvents, kube.EventTypeWarning, EventReasonNVMLFault, fmt.Sprintf("all devices of %s marked unhealthy: %s", name, reason.Message))
+				p.nvmlFaults[name] = NVMLFault{Resource: name, Code: reason.Code, Message: reason.Message, Since: now}
+			}
+			// 每次检查都重新标记，插件重启后重新创建的设备也保持不健康
+			for _, d := range pl.Devices() {
+				pl.MarkDeviceUnhealthy(d.ID, reason)
+			}
+			nvmlFaulted.WithLabelValues(name).Set(1)
+		case was:
+			l.Logger.Info("NVML safety mode condition cleared, restoring devices", zap.String("resourceName", name), zap.String("reason", prev.Code), zap.Duration("duration", now.Sub(prev.Since)))
+			p.events.Add(DeviceEvent{Time: now, Type: EventNvmlRecovered, Reason: prev.Code, Message: name})
+			for _, d := range pl.Devices() {
+				pl.MarkDeviceHealthy(d.ID, prev.Code)
+			}
+			delete(p.nvmlFaults, name)
+			nvmlFaulted.WithLabelValues(name).Set(0)
+		}
+	}
+	// 不再提供的资源不再报告
+	for name := range p.nvmlFaults {
+		if !seen[name] {
+			delete(p.nvmlFaults, name)
+			nvmlFaulted.DeleteLabelValues(name)
+		}
+	}
+}
+
+// NVMLFaults : 安全模式下所有设备被标记为不健康的资源，按资源名称排序
+func (p *PluginManager) NVMLFaults() []NVMLFault {
+	p.nvmlFaultMu.Lock()
+	defer p.nvmlFaultMu.Unlock()
+	res := make([]NVMLFault, 0, len(p.nvmlFaults))
+	for _, f := range p.nvmlFaults {
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Resource < res[j].Resource })
+	return res
+}
+
+// checkNvmlSafety : 安全模式是否把某些资源的设备全部标记为不健康
+func (p *PluginManager) checkNvmlSafety() HealthCheck {
+	c := HealthCheck{Name: HealthCheckNvmlSafety}
+	if !p.deviceHealth.SafetyMode {
+		c.Healthy = true
+		c.Message = "safety mode disabled"
+		return c
+	}
+	faults := p.NVMLFaults()
+	if len(faults) == 0 {
+		c.Healthy = true
+		c.Message = "NVML matches the driver and enumerates all advertised devices"
+		return c
+	}
+	var msgs []string
+	for _, f := range faults {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Resource, f.Message))
+	}
+	c.Message = "all devices marked unhealthy: " + strings.Join(msgs, "; ")
+	return c
+}
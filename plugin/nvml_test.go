@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// waitFor : 等待条件成立，超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 重启插件、健康检查和调试接口都不改变NVML的初始化次数，管理器退出后NVML完全关闭
+func TestNVMLInitBalanced(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DeviceHealth.Enabled = true
+	cfg.DeviceHealth.Interval = time.Minute
+	nvmllib := testServer(t, 2)
+	clk := clock.NewFakeClock(time.Now())
+	m := startTestManager(t, cfg, nvmllib, clk)
+
+	// NVML只初始化一次，管理器自身和 Start 各持有一个引用
+	balanced := func(step string) {
+		t.Helper()
+		if got, refs := nvmllib.InitCount(), m.NVMLReferences(); got != 1 || refs != 2 {
+			t.Fatalf("after %s: NVML initialized %d times with %d references, want 1 and 2", step, got, refs)
+		}
+	}
+	balanced("start")
+
+	job, err := m.Restart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "restart", func() bool {
+		j, _ := m.RestartJob(job.ID)
+		return j.Done()
+	})
+	if j, _ := m.RestartJob(job.ID); j.Phase != RestartSucceeded {
+		t.Fatalf("restart %s: %s", j.Phase, j.Error)
+	}
+	balanced("restart")
+
+	// 健康检查完成后主循环为下一次检查创建新的定时器
+	waiters := clk.Waiters()
+	clk.Step(cfg.DeviceHealth.Interval)
+	waitFor(t, "health check", func() bool { return clk.Waiters() == waiters })
+	balanced("health check")
+
+	if _, err := m.DebugSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	balanced("debug snapshot")
+	if err := m.WriteSupportBundle(io.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	balanced("support bundle")
+	gpu, _ := nvmllib.DeviceGetHandleByIndex(0)
+	uuid, _ := gpu.GetUUID()
+	if _, err := m.DeviceProcesses(uuid); err != nil {
+		t.Fatal(err)
+	}
+	balanced("device processes")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m.NVMLCollector())
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	balanced("NVML metrics")
+
+	m.stop(t)
+	if got := nvmllib.InitCount(); got != 0 {
+		t.Fatalf("after stop: NVML still initialized %d times", got)
+	}
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"runtime"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/dxgi"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"go.uber.org/zap"
+)
+
+// 设备发现平台
+const (
+	// PlatformAuto : Windows上没有NVML时使用DXGI，其它情况使用NVML
+	PlatformAuto = "auto"
+	// PlatformLinux : 通过NVML发现设备，包括WSL（挂载 /dev/dxg）
+	PlatformLinux = "linux"
+	// PlatformWindows : 通过DXGI枚举显示适配器，不支持MIG、显存资源和NVML健康检查
+	PlatformWindows = "windows"
+)
+
+// resolvePlatform : 根据配置和运行环境确定设备发现平台
+func resolvePlatform(platform string, nvmllib nvml.Interface) string {
+	switch platform {
+	case PlatformLinux:
+		return PlatformLinux
+	case PlatformWindows:
+		if runtime.GOOS != "windows" {
+			l.Logger.Warn("platform windows requires a Windows build, using NVML", zap.String("goos", runtime.GOOS))
+			return PlatformLinux
+		}
+		return PlatformWindows
+	case PlatformAuto, "":
+	default:
+		l.Logger.Warn("unknown platform, detecting automatically", zap.String("platform", platform))
+	}
+	if runtime.GOOS != "windows" || simulate.IsSimulated(nvmllib) {
+		return PlatformLinux
+	}
+	if hasNVML, _ := info.New().HasNvml(); hasNVML {
+		return PlatformLinux
+	}
+	return PlatformWindows
+}
+
+// buildAdapterDevices : 根据DXGI枚举的NVIDIA适配器创建资源名称到设备的映射
+func (p *PluginManager) buildAdapterDevices() (device.DeviceMap, []device.ExcludedDevice, error) {
+	adapters, err := dxgi.NvidiaAdapters()
+	if err != nil {
+		return nil, nil, err
+	}
+	return device.NewAdapterDeviceMap(adapters, p.resources, p.filter)
+}
@@ -5,22 +5,31 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"path"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
 	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
 	"go.uber.org/zap"
 
 	"github.com/NVIDIA/go-gpuallocator/gpuallocator"
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
@@ -28,56 +37,299 @@ type Interface interface {
 	Devices() device.Devices
 	Start() error
 	Stop() error
+	MarkUnhealthy()
+	Status() Status
+	VerifyRegistration(connectTimeout time.Duration) error
+	MarkDeviceUnhealthy(id string, reason HealthReason)
+	MarkDeviceHealthy(id string, code string)
+	UpdateDevices(devices device.Devices)
+	UnhealthyDevices() map[string]HealthReason
+	PauseUpdates()
+}
+
+// Options 设备插件的可选依赖
+type Options struct {
+	// Events : 分配被拒绝时向Pod发送事件，为空时不发送
+	Events *kube.Recorder
+	// NodeEvents : 设备变为不健康时向节点发送事件，为空时不发送
+	NodeEvents *kube.Recorder
+	// Ledger : 多个资源共享同一物理GPU时的分配账本，为空时不做协调
+	Ledger *Ledger
+	// Maintenance : 节点维护状态，维护期间拒绝所有分配请求，为空时不检查
+	Maintenance *Maintenance
+	// Limiter : Allocate/GetPreferredAllocation 的并发限制，为空时不限制
+	Limiter *Limiter
+	// Clock : 重试退避、注册检查和gRPC崩溃窗口使用的时间来源，为空时使用系统时间
+	Clock clock.Clock
+	// InitialSendDelay : ListAndWatch 推送第一次设备列表前的等待时间
+	InitialSendDelay time.Duration
+	// HealthBatchWindow : 合并健康状态变化的窗口，0表示每次变化立即推送
+	HealthBatchWindow time.Duration
+	// UnhealthyPolicy : 申请不健康设备时的处理方式，为空时拒绝
+	UnhealthyPolicy string
+	// CudaVisibleDevicesOrdinals : 是否额外设置按序号的 CUDA_VISIBLE_DEVICES
+	CudaVisibleDevicesOrdinals bool
+	// Memory : 显存资源的分块分配记录，只用于显存资源的插件
+	Memory *MemoryTracker
+	// MemoryChunkMiB : 显存资源每个分块的大小
+	MemoryChunkMiB uint64
+	// DeviceListStrategy : 向容器传递设备列表的方式，为空时使用 NVIDIA_VISIBLE_DEVICES
+	DeviceListStrategy string
+	// SmallestFirst : 推荐分配时优先选择显存最小的设备，用于任意MIG配置的聚合资源
+	SmallestFirst bool
+	// InstanceID : 实例ID，作为socket文件名前缀，同一节点运行多个实例时使用
+	InstanceID string
+	// GRPC : gRPC服务器的keepalive、消息大小和日志配置
+	GRPC config.GRPCConfig
+	// Policy : 选择推荐分配设备的外部策略，为空时使用内置策略
+	Policy AllocationPolicy
+	// PolicyFailure : 外部策略失败时的处理方式：fallback, fail
+	PolicyFailure string
+	// NUMAPolicy : 分时共享设备的NUMA分配方式：none, pack, spread
+	NUMAPolicy string
+	// RequireSameClique : 多卡分配是否要求设备在同一个多节点NVLink fabric clique中
+	RequireSameClique bool
+	// GDS : 是否挂载 GPUDirect Storage 的 nvidia-fs 设备
+	GDS bool
+	// NICAffinity : 优先分配与Pod申请的RDMA网卡在同一PCIe交换机下的GPU，为空时不考虑网卡
+	NICAffinity *NICAffinity
+	// Tracing : 是否为gRPC请求创建OpenTelemetry span
+	Tracing bool
+	// Audit : 分配请求的审计日志，为空时不记录
+	Audit *Auditor
+	// DisablePreferredAllocation : 不向kubelet声明支持 GetPreferredAllocation，由kubelet自行选择设备
+	DisablePreferredAllocation bool
+	// DeviceAttributes : 写入 Allocate 响应注解的设备属性，为空时不写入
+	DeviceAttributes []string
+	// AttributePrefix : 设备属性注解键的前缀
+	AttributePrefix string
+	// APIVersions : 按优先顺序尝试的设备插件API版本，为空时只使用v1beta1
+	APIVersions []string
+	// DialTimeout : 连接kubelet socket和插件自身socket的超时时间，0时使用5秒
+	DialTimeout time.Duration
+	// RegisterTimeout : 向kubelet注册的超时时间，0时使用10秒
+	RegisterTimeout time.Duration
+	// IdempotencyWindow : 同一设备集合的 Allocate 重试返回之前响应的时间窗口，0表示不缓存
+	IdempotencyWindow time.Duration
 }
 
 // NvidiaDevicePlugin k8s设备插件管理
 type NvidiaDevicePlugin struct {
-	resourceName resource.ResourceName
-	devices      device.Devices
-	nvmllib      nvml.Interface
-	socket       string
-	server       *grpc.Server
-	health       chan *device.Device
-	stop         chan interface{}
+	resourceName                 resource.ResourceName
+	devices                      device.Devices
+	nvmllib                      nvml.Interface
+	events                       *kube.Recorder
+	nodeEvents                   *kube.Recorder
+	ledger                       *Ledger
+	limiter                      *Limiter
+	maintenance                  *Maintenance
+	clock                        clock.Clock
+	initialDelay                 time.Duration
+	batchWindow                  time.Duration
+	unhealthyPolicy              string
+	memory                       *MemoryTracker
+	memoryChunkMiB               uint64
+	smallestFirst                bool
+	cudaOrdinals                 bool
+	deviceListStrategy           string
+	grpcConfig                   config.GRPCConfig
+	policy                       AllocationPolicy
+	policyFailure                string
+	numaPolicy                   string
+	requireSameClique            bool
+	gds                          bool
+	nicAffinity                  *NICAffinity
+	tracing                      bool
+	audit                        *Auditor
+	preferredAllocationAvailable bool
+	attributes                   []string
+	attributePrefix              string
+	apiVersions                  []string
+	dialTimeout                  time.Duration
+	registerTimeout              time.Duration
+	socket                       string
+	server                       *grpc.Server
+	healthServer                 *health.Server
+	health                       chan *device.Device
+	refresh                      chan struct{}
+	// unhealthy : 不健康设备的原因，每种原因代码一条，按标记顺序，全部恢复后设备才恢复健康
+	unhealthy   map[string][]HealthReason
+	allocations *allocateCache
+	// rejectionEvents : 每个Pod最近一次收到分配被拒绝事件的时间
+	rejectionEvents   map[string]time.Time
+	rejectionEventsMu sync.Mutex
+	stop              chan interface{}
+	drain             chan struct{}
+	drainOnce         sync.Once
+	paused            atomic.Bool
+	mu                sync.RWMutex
+	status            Status
+	devicesMu         sync.RWMutex
+	// links : 设备集中GPU之间的连接，与 devices 一起更新
+	links *deviceLinks
 }
 
-// NewNvidiaDevicePlugin 创建Nvidia设备插件管理
-func NewNvidiaDevicePlugin(resourceName resource.ResourceName, devices device.Devices) (*NvidiaDevicePlugin, error) {
-	pluginName := "nvidia-" + resourceName.GetResourceName()
-	pluginPath := filepath.Join(pluginapi.DevicePluginPath, pluginName)
+// NewNvidiaDevicePlugin 创建Nvidia设备插件管理，nvmllib 用于计算设备间的拓扑连接
+func NewNvidiaDevicePlugin(resourceName resource.ResourceName, devices device.Devices, nvmllib nvml.Interface, opts Options) (*NvidiaDevicePlugin, error) {
+	pluginPath := filepath.Join(devicePluginPath, socketName(opts.InstanceID, resourceName.PluginName()))
 	plugin := NvidiaDevicePlugin{
-		resourceName: resourceName,
-		devices:      devices,
-		socket:       pluginPath + ".sock",
-		server:       grpc.NewServer([]grpc.ServerOption{}...),
-		health:       make(chan *device.Device),
-		stop:         make(chan interface{}),
+		resourceName:                 resourceName,
+		devices:                      devices,
+		nvmllib:                      nvmllib,
+		events:                       opts.Events,
+		nodeEvents:                   opts.NodeEvents,
+		ledger:                       opts.Ledger,
+		limiter:                      opts.Limiter,
+		maintenance:                  opts.Maintenance,
+		clock:                        opts.Clock,
+		initialDelay:                 opts.InitialSendDelay,
+		batchWindow:                  opts.HealthBatchWindow,
+		unhealthyPolicy:              opts.UnhealthyPolicy,
+		memory:                       opts.Memory,
+		memoryChunkMiB:               opts.MemoryChunkMiB,
+		smallestFirst:                opts.SmallestFirst,
+		cudaOrdinals:                 opts.CudaVisibleDevicesOrdinals,
+		deviceListStrategy:           opts.DeviceListStrategy,
+		grpcConfig:                   opts.GRPC,
+		policy:                       opts.Policy,
+		policyFailure:                opts.PolicyFailure,
+		numaPolicy:                   opts.NUMAPolicy,
+		requireSameClique:            opts.RequireSameClique,
+		gds:                          opts.GDS,
+		nicAffinity:                  opts.NICAffinity,
+		tracing:                      opts.Tracing,
+		audit:                        opts.Audit,
+		preferredAllocationAvailable: !opts.DisablePreferredAllocation,
+		attributes:                   opts.DeviceAttributes,
+		attributePrefix:              opts.AttributePrefix,
+		apiVersions:                  opts.APIVersions,
+		dialTimeout:                  opts.DialTimeout,
+		registerTimeout:              opts.RegisterTimeout,
+		socket:                       pluginPath,
+		health:                       make(chan *device.Device, len(devices)),
+		refresh:                      make(chan struct{}, 1),
+		unhealthy:                    make(map[string][]HealthReason),
+		rejectionEvents:              make(map[string]time.Time),
+	}
+	if plugin.clock == nil {
+		plugin.clock = clock.RealClock{}
+	}
+	if plugin.dialTimeout <= 0 {
+		plugin.dialTimeout = 5 * time.Second
+	}
+	if plugin.registerTimeout <= 0 {
+		plugin.registerTimeout = 10 * time.Second
+	}
+	if len(plugin.apiVersions) == 0 {
+		plugin.apiVersions = []string{pluginapi.Version}
+	}
+	plugin.allocations = newAllocateCache(opts.IdempotencyWindow, plugin.clock)
+	plugin.links = newDeviceLinks(nvmllib)
+	plugin.status = Status{
+		ResourceName: string(resourceName),
+		Socket:       plugin.socket,
+		Devices:      len(devices),
+		State:        StateStopped,
 	}
 	return &plugin, nil
 }
 
+// initialize 每次启动时创建新的gRPC服务器和通道，使插件可以被重复启动
+func (plugin *NvidiaDevicePlugin) initialize() {
+	plugin.server = grpc.NewServer(plugin.serverOptions()...)
+	plugin.healthServer = health.NewServer()
+	plugin.stop = make(chan interface{})
+	plugin.drain = make(chan struct{})
+	plugin.drainOnce = sync.Once{}
+	plugin.allocations.reset()
+}
+
 func (plugin *NvidiaDevicePlugin) cleanup() {
 	close(plugin.stop)
+	plugin.server = nil
 }
 
+// Devices 插件提供的设备的副本，健康状态与不健康记录一致，调用方可以在不加锁的情况下读取
 func (plugin *NvidiaDevicePlugin) Devices() device.Devices {
-	return plugin.devices
+	plugin.devicesMu.RLock()
+	defer plugin.devicesMu.RUnlock()
+	plugin.mu.RLock()
+	defer plugin.mu.RUnlock()
+	res := make(device.Devices, len(plugin.devices))
+	for id, d := range plugin.devices {
+		c := *d
+		res[id] = &c
+	}
+	return res
+}
+
+// device : 按ID获取插件持有的设备对象，修改健康状态时需持有 plugin.mu
+func (plugin *NvidiaDevicePlugin) device(id string) *device.Device {
+	plugin.devicesMu.RLock()
+	defer plugin.devicesMu.RUnlock()
+	return plugin.devices.GetByID(id)
+}
+
+// UpdateDevices 替换插件提供的设备集并通过ListAndWatch推送，用于热插拔GPU
+// 仍然存在的设备保留原有对象，健康状态不变；已移除设备的不健康记录被清除，GPU连接重新读取
+func (plugin *NvidiaDevicePlugin) UpdateDevices(devices device.Devices) {
+	links := newDeviceLinks(plugin.nvmllib)
+	plugin.devicesMu.Lock()
+	updated := make(device.Devices, len(devices))
+	for id, d := range devices {
+		if old := plugin.devices.GetByID(id); old != nil {
+			d = old
+		}
+		updated[id] = d
+	}
+	plugin.devices = updated
+	plugin.links = links
+	plugin.devicesMu.Unlock()
+
+	plugin.mu.Lock()
+	for id := range plugin.unhealthy {
+		if _, ok := updated[id]; !ok {
+			delete(plugin.unhealthy, id)
+		}
+	}
+	plugin.updateUnhealthyMetric()
+	plugin.status.Devices = len(updated)
+	plugin.mu.Unlock()
+	plugin.allocations.reset()
+
+	select {
+	case plugin.refresh <- struct{}{}:
+	default:
+	}
 }
 
 // 启动设备插件
 func (plugin *NvidiaDevicePlugin) Start() error {
+	if other := plugin.competingSocket(); other != "" {
+		err := fmt.Errorf("resource %s is already served by another plugin instance on %s; use a different instanceId, resource name or device filter for each instance", plugin.resourceName, other)
+		l.Logger.Error("Could not start device plugin", zap.String("resourceName", string(plugin.resourceName)), zap.Error(err))
+		plugin.setError(err)
+		return err
+	}
+	plugin.initialize()
+	plugin.paused.Store(false)
 	err := plugin.Serve()
 	if err != nil {
 		l.Logger.Info("Could not start device plugin", zap.String("resourceName", string(plugin.resourceName)), zap.Error(err))
-		plugin.cleanup()
+		err = errors.Join(err, plugin.Stop())
+		plugin.setError(err)
 		return err
 	}
+	plugin.setState(StateServing)
 	l.Logger.Info("Starting to serve", zap.String("resourceName", string(plugin.resourceName)), zap.String("socket", plugin.socket))
 	err = plugin.Register()
 	if err != nil {
 		l.Logger.Info("Could not register device plugin", zap.String("resourceName", string(plugin.resourceName)), zap.Error(err))
-		return errors.Join(err, plugin.Stop())
+		err = errors.Join(err, plugin.Stop())
+		plugin.setError(err)
+		return err
 	}
+	plugin.setState(StateRegistered)
 	l.Logger.Info("Registered device plugin for", zap.String("resourceName", string(plugin.resourceName)))
 	return nil
 }
@@ -88,14 +340,101 @@ func (plugin *NvidiaDevicePlugin) Stop() error {
 		return nil
 	}
 	l.Logger.Info("Stopping to serve", zap.String("resourceName", string(plugin.resourceName)), zap.String("socket", plugin.socket))
+	plugin.healthServer.Shutdown()
 	plugin.server.Stop()
+	plugin.cleanup()
+	plugin.setState(StateStopped)
+	devicesAdvertised.WithLabelValues(string(plugin.resourceName)).Set(0)
+	physicalDevicesAdvertised.WithLabelValues(string(plugin.resourceName)).Set(0)
 	if err := os.Remove(plugin.socket); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	plugin.cleanup()
 	return nil
 }
 
+// MarkUnhealthy 通过ListAndWatch向kubelet上报所有设备不健康，用于停止服务前的注销
+func (plugin *NvidiaDevicePlugin) MarkUnhealthy() {
+	plugin.drainOnce.Do(func() {
+		close(plugin.drain)
+		plugin.setServing(false)
+	})
+}
+
+// MarkDeviceUnhealthy 把设备标记为不健康并记录原因，通过ListAndWatch通知kubelet
+// 通道有缓冲，kubelet未连接时在下次连接后推送
+func (plugin *NvidiaDevicePlugin) MarkDeviceUnhealthy(id string, reason HealthReason) {
+	d := plugin.device(id)
+	if d == nil {
+		return
+	}
+	plugin.mu.Lock()
+	reasons := plugin.unhealthy[id]
+	marked := len(reasons) > 0
+	if i := slices.IndexFunc(reasons, func(r HealthReason) bool { return r.Code == reason.Code }); i >= 0 {
+		reasons[i] = reason
+	} else {
+		plugin.unhealthy[id] = append(reasons, reason)
+	}
+	plugin.updateUnhealthyMetric()
+	d.Health = pluginapi.Unhealthy
+	changed := *d
+	plugin.mu.Unlock()
+	if marked {
+		return
+	}
+	l.Logger.Warn("marking device unhealthy", zap.String("resourceName", string(plugin.resourceName)), zap.String("deviceID", id), zap.String("code", reason.Code), zap.String("reason", reason.String()))
+	emitNodeEvent(plugin.nodeEvents, kube.EventTypeWarning, EventReasonGPUUnhealthy, fmt.Sprintf("%s device %s is unhealthy: %s", plugin.resourceName, id, reason))
+	select {
+	case plugin.health <- &changed:
+	default:
+	}
+}
+
+// MarkDeviceHealthy 清除设备原因代码为code的不健康原因，没有其它原因时恢复为健康，通过ListAndWatch通知kubelet
+// 设备还因其它原因不健康时保持不健康，避免掩盖硬件故障
+func (plugin *NvidiaDevicePlugin) MarkDeviceHealthy(id string, code string) {
+	d := plugin.device(id)
+	if d == nil {
+		return
+	}
+	plugin.mu.Lock()
+	reasons := plugin.unhealthy[id]
+	i := slices.IndexFunc(reasons, func(r HealthReason) bool { return r.Code == code })
+	if i < 0 {
+		plugin.mu.Unlock()
+		return
+	}
+	reasons = slices.Delete(reasons, i, i+1)
+	if len(reasons) > 0 {
+		plugin.unhealthy[id] = reasons
+		plugin.updateUnhealthyMetric()
+		plugin.mu.Unlock()
+		l.Logger.Info("device still unhealthy for other reasons", zap.String("resourceName", string(plugin.resourceName)), zap.String("deviceID", id), zap.String("cleared", code), zap.String("code", reasons[0].Code))
+		return
+	}
+	delete(plugin.unhealthy, id)
+	plugin.updateUnhealthyMetric()
+	d.Health = pluginapi.Healthy
+	changed := *d
+	plugin.mu.Unlock()
+	l.Logger.Info("marking device healthy", zap.String("resourceName", string(plugin.resourceName)), zap.String("deviceID", id), zap.String("code", code))
+	select {
+	case plugin.health <- &changed:
+	default:
+	}
+}
+
+// UnhealthyDevices 被标记为不健康的设备及最早的原因
+func (plugin *NvidiaDevicePlugin) UnhealthyDevices() map[string]HealthReason {
+	plugin.mu.RLock()
+	defer plugin.mu.RUnlock()
+	res := make(map[string]HealthReason, len(plugin.unhealthy))
+	for id, reasons := range plugin.unhealthy {
+		res[id] = reasons[0]
+	}
+	return res
+}
+
 // 启动设备插件的gRPC服务器
 func (plugin *NvidiaDevicePlugin) Serve() error {
 	os.Remove(plugin.socket)
@@ -103,23 +442,33 @@ func (plugin *NvidiaDevicePlugin) Serve() error {
 	if err != nil {
 		return err
 	}
-	pluginapi.RegisterDevicePluginServer(plugin.server, plugin)
+	if err := applySocketPermissions(plugin.socket, plugin.grpcConfig); err != nil {
+		sock.Close()
+		return err
+	}
+	server := plugin.server
+	for _, version := range plugin.apiVersions {
+		if v, ok := findAPIVersion(version); ok {
+			v.serve(plugin, server)
+		}
+	}
+	healthpb.RegisterHealthServer(server, plugin.healthServer)
 	go func() {
-		lastCrashTime := time.Now()
+		lastCrashTime := plugin.clock.Now()
 		restartCount := 0
 		for {
 			if restartCount > 5 {
 				l.Logger.Fatal("GRPC server for '%s' has repeatedly crashed recently. Quitting", zap.String("resourceName", string(plugin.resourceName)))
 			}
 			l.Logger.Info("Starting GRPC server for '%s'", zap.String("resourceName", string(plugin.resourceName)))
-			err := plugin.server.Serve(sock)
+			err := server.Serve(sock)
 			if err == nil {
 				break
 			}
 			l.Logger.Error("GRPC server for '%s' crashed with error: %v", zap.String("resourceName", string(plugin.resourceName)), zap.Error(err))
 
-			timeSinceLastCrash := time.Since(lastCrashTime).Seconds()
-			lastCrashTime = time.Now()
+			timeSinceLastCrash := plugin.clock.Since(lastCrashTime).Seconds()
+			lastCrashTime = plugin.clock.Now()
 			if timeSinceLastCrash > 3600 {
 				restartCount = 0
 			} else {
@@ -127,61 +476,102 @@ func (plugin *NvidiaDevicePlugin) Serve() error {
 			}
 		}
 	}()
-	conn, err := plugin.dial(plugin.socket, 5*time.Second)
+	conn, err := plugin.dial(plugin.socket, plugin.dialTimeout)
 	if err != nil {
 		return err
 	}
 	conn.Close()
+	plugin.setServing(true)
 
 	return nil
 }
 
-// 注册设备插件
+// 注册设备插件，与kubelet协商API版本
 func (plugin *NvidiaDevicePlugin) Register() error {
-	conn, err := plugin.dial(pluginapi.KubeletSocket, 5*time.Second)
+	conn, err := plugin.dial(kubeletSocket, plugin.dialTimeout)
 	if err != nil {
-		return err
+		return fmt.Errorf("error connecting to kubelet within %s: %w", plugin.dialTimeout, err)
 	}
 	defer conn.Close()
 
-	client := pluginapi.NewRegistrationClient(conn)
-	reqt := &pluginapi.RegisterRequest{
-		Version:      pluginapi.Version,
-		Endpoint:     path.Base(plugin.socket),
-		ResourceName: string(plugin.resourceName),
-		Options: &pluginapi.DevicePluginOptions{
-			GetPreferredAllocationAvailable: true,
-		},
-	}
-
-	_, err = client.Register(context.Background(), reqt)
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.registerTimeout)
+	defer cancel()
+	version, err := plugin.negotiateRegister(ctx, conn)
 	if err != nil {
 		return err
 	}
+	plugin.mu.Lock()
+	plugin.status.APIVersion = version
+	plugin.mu.Unlock()
 	return nil
 }
 
 // 插件的可选设置值
 func (plugin *NvidiaDevicePlugin) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
 	options := &pluginapi.DevicePluginOptions{
-		GetPreferredAllocationAvailable: true,
+		GetPreferredAllocationAvailable: plugin.preferredAllocationAvailable,
 	}
 	return options, nil
 }
 
 // 更新设备列表
 func (plugin *NvidiaDevicePlugin) ListAndWatch(e *pluginapi.Empty, s pluginapi.DevicePlugin_ListAndWatchServer) error {
-	if err := s.Send(&pluginapi.ListAndWatchResponse{Devices: plugin.Devices().GetPluginDevices()}); err != nil {
+	plugin.setWatching(true)
+	defer plugin.setWatching(false)
+	stop, drain := plugin.stop, plugin.drain
+	if plugin.initialDelay > 0 {
+		select {
+		case <-plugin.clock.After(plugin.initialDelay):
+		case <-stop:
+			return nil
+		}
+	}
+	if err := plugin.sendDevices(s, plugin.Devices().GetPluginDevices()); err != nil {
 		return err
 	}
+	// 合并窗口内的健康状态变化，窗口结束时统一推送
+	var batch <-chan time.Time
 	for {
 		select {
-		case <-plugin.stop:
+		case <-stop:
 			return nil
+		case <-drain:
+			drain = nil
+			batch = nil
+			l.Logger.Info("marking all devices unhealthy before stopping", zap.String("resourceName", string(plugin.resourceName)))
+			if err := plugin.sendDevices(s, unhealthyPluginDevices(plugin.Devices())); err != nil {
+				return nil
+			}
 		case d := <-plugin.health:
-			d.Health = pluginapi.Unhealthy
-			l.Logger.Info("'%s' device marked unhealthy: %s", zap.String("resourceName", string(plugin.resourceName)), zap.String("deviceID", d.ID))
-			if err := s.Send(&pluginapi.ListAndWatchResponse{Devices: plugin.Devices().GetPluginDevices()}); err != nil {
+			l.Logger.Info("device health changed", zap.String("resourceName", string(plugin.resourceName)), zap.String("deviceID", d.ID), zap.String("health", d.Health))
+			// 已上报全部不健康或kubelet已停止时不再推送实际状态
+			if drain == nil || plugin.paused.Load() {
+				continue
+			}
+			if plugin.batchWindow <= 0 {
+				if err := plugin.sendDevices(s, plugin.Devices().GetPluginDevices()); err != nil {
+					return nil
+				}
+				continue
+			}
+			if batch == nil {
+				batch = plugin.clock.After(plugin.batchWindow)
+			}
+		case <-plugin.refresh:
+			l.Logger.Info("device list changed", zap.String("resourceName", string(plugin.resourceName)), zap.Int("devices", len(plugin.Devices())))
+			// 已上报全部不健康或kubelet已停止时不再推送实际状态
+			if drain == nil || plugin.paused.Load() {
+				continue
+			}
+			if err := plugin.sendDevices(s, plugin.Devices().GetPluginDevices()); err != nil {
+				return nil
+			}
+		case <-batch:
+			batch = nil
+			if plugin.paused.Load() {
+				continue
+			}
+			if err := plugin.sendDevices(s, plugin.Devices().GetPluginDevices()); err != nil {
 				return nil
 			}
 		}
@@ -189,10 +579,28 @@ func (plugin *NvidiaDevicePlugin) ListAndWatch(e *pluginapi.Empty, s pluginapi.D
 }
 
 // 指定的设备集的首选分配
-func (plugin *NvidiaDevicePlugin) GetPreferredAllocation(ctx context.Context, r *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
-	response := &pluginapi.PreferredAllocationResponse{}
+func (plugin *NvidiaDevicePlugin) GetPreferredAllocation(ctx context.Context, r *pluginapi.PreferredAllocationRequest) (response *pluginapi.PreferredAllocationResponse, err error) {
+	// 未声明支持时kubelet不会调用，直接拒绝其它客户端的调用
+	if !plugin.preferredAllocationAvailable {
+		return nil, fmt.Errorf("GetPreferredAllocation is disabled for %s", plugin.resourceName)
+	}
+	defer func(start time.Time) {
+		plugin.audit.PreferredAllocation(ctx, string(plugin.resourceName), r, response, err, time.Since(start))
+	}(time.Now())
+	release, err := plugin.limiter.Acquire(ctx, string(plugin.resourceName), methodGetPreferredAllocation)
+	if err != nil {
+		return nil, fmt.Errorf("error getting list of preferred allocation devices: %w", err)
+	}
+	defer release()
+	timer := prometheus.NewTimer(preferredAllocationDuration.WithLabelValues(string(plugin.resourceName)))
+	defer timer.ObserveDuration()
+	response = &pluginapi.PreferredAllocationResponse{}
 	for _, req := range r.ContainerRequests {
-		devices, err := plugin.getPreferredAllocation(req.AvailableDeviceIDs, req.MustIncludeDeviceIDs, int(req.AllocationSize))
+		available := req.AvailableDeviceIDs
+		if plugin.ledger != nil {
+			available = plugin.ledger.Available(string(plugin.resourceName), available)
+		}
+		devices, err := plugin.preferredAllocation(ctx, available, req.MustIncludeDeviceIDs, int(req.AllocationSize))
 		if err != nil {
 			return nil, fmt.Errorf("error getting list of preferred allocation devices: %v", err)
 		}
@@ -207,23 +615,128 @@ func (plugin *NvidiaDevicePlugin) GetPreferredAllocation(ctx context.Context, r
 }
 
 // 返回设备列表
-func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
+func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (resp *pluginapi.AllocateResponse, err error) {
+	defer func(start time.Time) {
+		plugin.audit.Allocate(ctx, string(plugin.resourceName), reqs, resp, err, time.Since(start))
+	}(time.Now())
+	allocateRequests.WithLabelValues(string(plugin.resourceName)).Inc()
+	release, err := plugin.limiter.Acquire(ctx, string(plugin.resourceName), methodAllocate)
+	if err != nil {
+		return nil, plugin.rejectAllocation(ctx, RejectReasonTimeout, fmt.Errorf("allocation request for %s timed out: %w", plugin.resourceName, err))
+	}
+	defer release()
+	if s, ok := plugin.maintenance.State(); ok {
+		return nil, plugin.rejectAllocation(ctx, RejectReasonMaintenance, fmt.Errorf("allocation request for %s rejected: node in GPU maintenance since %s: %s", plugin.resourceName, s.Time.Format(time.RFC3339), s.healthReason().Message))
+	}
+	// 同一请求中任一容器分配失败时，回滚前面容器在账本中的占用
+	var claimed []string
+	defer func() {
+		if err != nil && len(claimed) > 0 {
+			plugin.ledger.Release(string(plugin.resourceName), claimed)
+		}
+	}()
 	responses := pluginapi.AllocateResponse{}
 	for _, req := range reqs.ContainerRequests {
-		b := plugin.devices.Contains(req.DevicesIDs...)
+		if err := ctx.Err(); err != nil {
+			return nil, plugin.rejectAllocation(ctx, RejectReasonTimeout, fmt.Errorf("allocation request for %s timed out: %w", plugin.resourceName, err))
+		}
+		b := plugin.Devices().Contains(req.DevicesIDs...)
 		if !b {
-			return nil, fmt.Errorf("invalid allocation request for %s", plugin.resourceName)
+			return nil, plugin.rejectAllocation(ctx, RejectReasonUnknownDevice, fmt.Errorf("invalid allocation request for %s: unknown device", plugin.resourceName))
+		}
+		if id, ok := duplicateID(req.DevicesIDs); ok {
+			return nil, plugin.rejectAllocation(ctx, RejectReasonOverShared, fmt.Errorf("invalid allocation request for %s: device %s requested more than once", plugin.resourceName, id))
+		}
+		if err := plugin.checkHealth(ctx, req.DevicesIDs); err != nil {
+			return nil, plugin.rejectAllocation(ctx, RejectReasonUnhealthy, err)
+		}
+		if plugin.ledger != nil {
+			uuids, err := plugin.ledger.Claim(ctx, string(plugin.resourceName), req.DevicesIDs)
+			if err != nil {
+				return nil, plugin.rejectAllocation(ctx, RejectReasonSharedConflict, fmt.Errorf("invalid allocation request for %s: %w", plugin.resourceName, err))
+			}
+			claimed = append(claimed, uuids...)
+		}
+		// 分配账本和显存分块记录仍然更新，同一资源重复占用不冲突，重复记录分块只刷新时间
+		if plugin.memory != nil {
+			plugin.memory.Assign(req.DevicesIDs)
+		}
+		if cached, ok := plugin.cachedAllocation(ctx, req.DevicesIDs); ok {
+			responses.ContainerResponses = append(responses.ContainerResponses, cached)
+			continue
 		}
 		response := pluginapi.ContainerAllocateResponse{
 			Envs: map[string]string{
-				"NVIDIA_VISIBLE_DEVICES": strings.Join(req.DevicesIDs, ","),
+				"NVIDIA_VISIBLE_DEVICES": visibleDevices(req.DevicesIDs),
 			},
+			Devices:     plugin.deviceSpecs(req.DevicesIDs),
+			Mounts:      plugin.mounts(),
+			Annotations: plugin.deviceAnnotations(req.DevicesIDs),
+		}
+		if plugin.memory != nil {
+			response.Envs = plugin.memoryEnvs(req.DevicesIDs)
 		}
+		if plugin.cudaOrdinals {
+			response.Envs["CUDA_DEVICE_ORDER"] = "PCI_BUS_ID"
+			response.Envs["CUDA_VISIBLE_DEVICES"] = plugin.cudaVisibleDevices(req.DevicesIDs)
+		}
+		plugin.applyDeviceList(&response, req.DevicesIDs)
+		plugin.allocations.put(req.DevicesIDs, &response)
 		responses.ContainerResponses = append(responses.ContainerResponses, &response)
 	}
 	return &responses, nil
 }
 
+// cudaVisibleDevices 生成容器内的 CUDA_VISIBLE_DEVICES，副本只保留一次
+// 容器内只能看到分配的GPU，主机上的索引无效；配合 CUDA_DEVICE_ORDER=PCI_BUS_ID，
+// 按PCI总线顺序的容器内序号就是 0..n-1。MIG设备没有CUDA序号，使用其UUID
+func (plugin *NvidiaDevicePlugin) cudaVisibleDevices(ids []string) string {
+	var res, migs []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		d := plugin.Devices().GetByID(id)
+		if d == nil {
+			continue
+		}
+		uuid := d.GetUUID()
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+		if strings.Contains(d.Index, ":") {
+			migs = append(migs, uuid)
+			continue
+		}
+		res = append(res, strconv.Itoa(len(res)))
+	}
+	return strings.Join(append(res, migs...), ",")
+}
+
+// unhealthyPluginDevices 获取所有设备不健康状态的副本，不修改原设备
+func unhealthyPluginDevices(ds device.Devices) []*pluginapi.Device {
+	var res []*pluginapi.Device
+	for _, d := range ds.GetPluginDevices() {
+		res = append(res, &pluginapi.Device{
+			ID:       d.ID,
+			Health:   pluginapi.Unhealthy,
+			Topology: d.Topology,
+		})
+	}
+	return res
+}
+
+// duplicateID 检查设备ID是否被重复申请
+func duplicateID(ids []string) (string, bool) {
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			return id, true
+		}
+		seen[id] = true
+	}
+	return "", false
+}
+
 func (plugin *NvidiaDevicePlugin) PreStartContainer(context.Context, *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
 	return &pluginapi.PreStartContainerResponse{}, nil
 }
@@ -246,7 +759,22 @@ func (plugin *NvidiaDevicePlugin) dial(unixSocketPath string, timeout time.Durat
 }
 
 func (plugin *NvidiaDevicePlugin) getPreferredAllocation(availableDeviceIDs []string, mustIncludeDeviceIDs []string, allocationSize int) ([]string, error) {
-	if plugin.devices.AlignedAllocationSupported() && !device.AnnotatedIDs(availableDeviceIDs).AnyHasAnnotations() {
+	// 显存分块集中在同一个GPU上
+	if plugin.memory != nil {
+		return plugin.packedAlloc(availableDeviceIDs, mustIncludeDeviceIDs, allocationSize)
+	}
+	// 多卡分配限制在同一个fabric clique内
+	availableDeviceIDs, err := plugin.cliqueCandidates(availableDeviceIDs, mustIncludeDeviceIDs, allocationSize)
+	if err != nil {
+		return nil, err
+	}
+	// 优先选择靠近Pod申请的RDMA网卡的GPU
+	availableDeviceIDs = plugin.nicCandidates(availableDeviceIDs, mustIncludeDeviceIDs, allocationSize)
+	// 任意MIG配置的资源优先使用最小的MIG设备
+	if plugin.smallestFirst {
+		return plugin.smallestAlloc(availableDeviceIDs, mustIncludeDeviceIDs, allocationSize)
+	}
+	if plugin.Devices().AlignedAllocationSupported() && !device.AnnotatedIDs(availableDeviceIDs).AnyHasAnnotations() {
 		return plugin.alignedAlloc(availableDeviceIDs, mustIncludeDeviceIDs, allocationSize)
 	}
 	// 将它们均匀分配到所有复制的GPU上
@@ -256,19 +784,17 @@ func (plugin *NvidiaDevicePlugin) getPreferredAllocation(availableDeviceIDs []st
 func (plugin *NvidiaDevicePlugin) alignedAlloc(available, required []string, size int) ([]string, error) {
 	var devices []string
 
-	linkedDevices, err := gpuallocator.NewDevices(
-		gpuallocator.WithNvmlLib(plugin.nvmllib),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("unable to get device link information: %w", err)
+	links := plugin.deviceLinks()
+	if links.err != nil {
+		return nil, fmt.Errorf("unable to get device link information: %w", links.err)
 	}
 
-	availableDevices, err := linkedDevices.Filter(available)
+	availableDevices, err := links.gpus.Filter(available)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve list of available devices: %v", err)
 	}
 
-	requiredDevices, err := linkedDevices.Filter(required)
+	requiredDevices, err := links.gpus.Filter(required)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve list of required devices: %v", err)
 	}
@@ -282,7 +808,7 @@ func (plugin *NvidiaDevicePlugin) alignedAlloc(available, required []string, siz
 }
 
 func (plugin *NvidiaDevicePlugin) distributedAlloc(available, required []string, size int) ([]string, error) {
-	candidates := plugin.devices.Subset(available).Difference(plugin.devices.Subset(required)).GetIDs()
+	candidates := plugin.Devices().Subset(available).Difference(plugin.Devices().Subset(required)).GetIDs()
 	needed := size - len(required)
 
 	if len(candidates) < needed {
@@ -297,7 +823,7 @@ func (plugin *NvidiaDevicePlugin) distributedAlloc(available, required []string,
 		}
 		replicas[id].available++
 	}
-	for d := range plugin.devices {
+	for d := range plugin.Devices() {
 		id := device.AnnotatedID(d).GetID()
 		if _, exists := replicas[id]; !exists {
 			continue
@@ -305,9 +831,21 @@ func (plugin *NvidiaDevicePlugin) distributedAlloc(available, required []string,
 		replicas[id].total++
 	}
 
+	// 各NUMA节点上已选的设备数量
+	selected := make(map[int64]int)
+	for _, r := range required {
+		if node, ok := plugin.numaNode(r); ok {
+			selected[node]++
+		}
+	}
+
 	var devices []string
 	for i := 0; i < needed; i++ {
 		sort.Slice(candidates, func(i, j int) bool {
+			// 先按NUMA分配方式排序，再在副本之间均匀分布
+			if irank, jrank := plugin.numaRank(candidates[i], selected), plugin.numaRank(candidates[j], selected); irank != jrank {
+				return irank < jrank
+			}
 			iid := device.AnnotatedID(candidates[i]).GetID()
 			jid := device.AnnotatedID(candidates[j]).GetID()
 			idiff := replicas[iid].total - replicas[iid].available
@@ -316,6 +854,9 @@ func (plugin *NvidiaDevicePlugin) distributedAlloc(available, required []string,
 		})
 		id := device.AnnotatedID(candidates[0]).GetID()
 		replicas[id].available--
+		if node, ok := plugin.numaNode(candidates[0]); ok {
+			selected[node]++
+		}
 		devices = append(devices, candidates[0])
 		candidates = candidates[1:]
 	}
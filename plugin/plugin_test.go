@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// recordingStream 记录ListAndWatch推送的最新设备列表
+type recordingStream struct {
+	grpc.ServerStream
+	mu   sync.Mutex
+	last map[string]string
+}
+
+// Send : 记录每个设备的健康状态
+func (s *recordingStream) Send(r *pluginapi.ListAndWatchResponse) error {
+	health := make(map[string]string, len(r.Devices))
+	for _, d := range r.Devices {
+		health[d.ID] = d.Health
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = health
+	return nil
+}
+
+// Health : 最近一次推送中设备的健康状态
+func (s *recordingStream) Health(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last[id]
+}
+
+// 并发标记设备健康状态时推送和读取的设备状态与不健康记录一致，用 -race 检查数据竞争
+func TestConcurrentMarkAndSend(t *testing.T) {
+	devices := make(device.Devices)
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("GPU-%d", i)
+		devices[id] = &device.Device{Device: pluginapi.Device{ID: id, Health: pluginapi.Healthy}}
+	}
+	plugin, err := NewNvidiaDevicePlugin("nvidia.com/gpu", devices, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.initialize()
+	stream := &recordingStream{}
+	done := make(chan error)
+	go func() { done <- plugin.ListAndWatch(&pluginapi.Empty{}, stream) }()
+
+	var wg sync.WaitGroup
+	for id := range devices {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				plugin.MarkDeviceUnhealthy(id, HealthReason{Code: HealthReasonThermal})
+				plugin.MarkDeviceHealthy(id, HealthReasonThermal)
+			}
+		}(id)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			for _, d := range plugin.Devices() {
+				_ = d.Health
+			}
+			plugin.Devices().GetCapacity()
+		}
+	}()
+	wg.Wait()
+
+	plugin.MarkDeviceUnhealthy("GPU-0", HealthReason{Code: HealthReasonThermal})
+	unhealthy := plugin.UnhealthyDevices()
+	for id, d := range plugin.Devices() {
+		_, marked := unhealthy[id]
+		if want := map[bool]string{true: pluginapi.Unhealthy, false: pluginapi.Healthy}[marked]; d.Health != want {
+			t.Errorf("device %s is %s, want %s", id, d.Health, want)
+		}
+	}
+	waitFor(t, "GPU-0 reported unhealthy", func() bool {
+		return stream.Health("GPU-0") == pluginapi.Unhealthy && stream.Health("GPU-1") == pluginapi.Healthy
+	})
+	plugin.cleanup()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 未配置API版本时按v1beta1提供服务和注册
+func TestDefaultAPIVersions(t *testing.T) {
+	plugin, err := NewNvidiaDevicePlugin("nvidia.com/gpu", nil, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plugin.apiVersions) != 1 || plugin.apiVersions[0] != pluginapi.Version {
+		t.Fatalf("apiVersions %v, want [%s]", plugin.apiVersions, pluginapi.Version)
+	}
+}
+
+// 按显存分块分配时不改写调用方的必须分配设备列表
+func TestPackedAllocKeepsRequired(t *testing.T) {
+	devices := make(device.Devices)
+	var available []string
+	for _, gpu := range []string{"GPU-0", "GPU-1"} {
+		for i := 0; i < 3; i++ {
+			id := string(device.NewAnnotatedID(gpu, i))
+			devices[id] = &device.Device{Device: pluginapi.Device{ID: id, Health: pluginapi.Healthy}}
+			available = append(available, id)
+		}
+	}
+	plugin, err := NewNvidiaDevicePlugin("nvidia.com/gpu", devices, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{3, 5} {
+		backing := []string{"GPU-0::0", "", "", "", ""}
+		ids, err := plugin.packedAlloc(available, backing[:1], size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != size {
+			t.Fatalf("size %d: got %v", size, ids)
+		}
+		for _, id := range backing[1:] {
+			if id != "" {
+				t.Fatalf("size %d: required devices overwritten: %v", size, backing)
+			}
+		}
+	}
+}
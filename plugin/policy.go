@@ -0,0 +1,210 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/NVIDIA/go-gpuallocator/gpuallocator"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// 推荐分配策略
+const (
+	// AllocationPolicyBuiltin : 使用插件内置的NVLink对齐和均匀分布策略
+	AllocationPolicyBuiltin = "builtin"
+	// AllocationPolicyWebhook : 调用外部HTTP接口选择设备
+	AllocationPolicyWebhook = "webhook"
+)
+
+// 外部策略失败时的处理方式
+const (
+	// PolicyFailureFallback : 使用内置策略
+	PolicyFailureFallback = "fallback"
+	// PolicyFailureFail : GetPreferredAllocation 返回错误，kubelet按自己的方式选择设备
+	PolicyFailureFail = "fail"
+)
+
+// 外部策略调用结果
+const (
+	policyResultSuccess = "success"
+	policyResultError   = "error"
+	policyResultInvalid = "invalid"
+)
+
+var policyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "allocation_policy_requests_total",
+	Help:      "Number of external allocation policy calls by resource and result (success, error, invalid).",
+}, []string{"resource", "result"})
+
+// AllocationPolicy 选择推荐分配设备的外部策略，返回的设备由插件校验后使用
+type AllocationPolicy interface {
+	PreferredAllocation(ctx context.Context, req PolicyRequest) ([]string, error)
+}
+
+// PolicyRequest 一个容器的推荐分配请求
+type PolicyRequest struct {
+	Resource       string           `json:"resource"`
+	AllocationSize int              `json:"allocationSize"`
+	Available      []DeviceMetadata `json:"available"`
+	MustInclude    []string         `json:"mustInclude"`
+}
+
+// DeviceMetadata 推荐分配请求中的设备信息
+type DeviceMetadata struct {
+	// ID : 设备ID，共享的副本带有 ::<序号> 后缀
+	ID string `json:"id"`
+	// UUID : 物理GPU或MIG设备的UUID，同一设备的副本相同
+	UUID              string     `json:"uuid"`
+	Index             string     `json:"index"`
+	Health            string     `json:"health"`
+	NUMANode          *int64     `json:"numaNode,omitempty"`
+	TotalMemory       uint64     `json:"totalMemory"`
+	ComputeCapability string     `json:"computeCapability"`
+	Replicas          int        `json:"replicas,omitempty"`
+	Clique            string     `json:"clique,omitempty"`
+	NIC               string     `json:"nic,omitempty"`
+	Links             []PeerLink `json:"links,omitempty"`
+}
+
+// PeerLink 与另一块GPU之间的P2P连接
+type PeerLink struct {
+	UUID string `json:"uuid"`
+	Type string `json:"type"`
+}
+
+// preferredAllocation : 配置了外部策略时由外部策略选择设备，失败时按失败处理方式使用内置策略或返回错误
+// 显存资源的分块需要集中在同一GPU上，始终使用内置策略
+func (plugin *NvidiaDevicePlugin) preferredAllocation(ctx context.Context, available, required []string, size int) ([]string, error) {
+	if plugin.policy == nil || plugin.memory != nil {
+		return plugin.getPreferredAllocation(available, required, size)
+	}
+	result := policyResultSuccess
+	ids, err := plugin.policy.PreferredAllocation(ctx, plugin.policyRequest(available, required, size))
+	if err != nil {
+		result = policyResultError
+	} else if err = validatePolicyResponse(ids, available, required, size); err != nil {
+		result = policyResultInvalid
+	}
+	policyRequests.WithLabelValues(string(plugin.resourceName), result).Inc()
+	if err == nil {
+		return ids, nil
+	}
+	if plugin.policyFailure == PolicyFailureFail {
+		return nil, fmt.Errorf("allocation policy failed: %w", err)
+	}
+	l.FromContext(ctx).Warn("allocation policy failed, using builtin policy", zap.String("resourceName", string(plugin.resourceName)), zap.Error(err))
+	return plugin.getPreferredAllocation(available, required, size)
+}
+
+// policyRequest : 构造推荐分配请求，NVML可用时附带GPU之间的连接信息
+func (plugin *NvidiaDevicePlugin) policyRequest(available, required []string, size int) PolicyRequest {
+	links := plugin.peerLinks()
+	devices := plugin.Devices()
+	req := PolicyRequest{
+		Resource:       string(plugin.resourceName),
+		AllocationSize: size,
+		Available:      make([]DeviceMetadata, 0, len(available)),
+		MustInclude:    append([]string{}, required...),
+	}
+	for _, id := range available {
+		d := devices.GetByID(id)
+		if d == nil {
+			continue
+		}
+		uuid := device.AnnotatedID(id).GetID()
+		m := DeviceMetadata{
+			ID:                id,
+			UUID:              uuid,
+			Index:             d.Index,
+			Health:            d.Health,
+			TotalMemory:       d.TotalMemory,
+			ComputeCapability: d.ComputeCapability,
+			Replicas:          d.Replicas,
+			Clique:            d.Clique,
+			NIC:               d.NIC,
+			Links:             links[uuid],
+		}
+		if d.Topology != nil && len(d.Topology.Nodes) > 0 {
+			node := d.Topology.Nodes[0].ID
+			m.NUMANode = &node
+		}
+		req.Available = append(req.Available, m)
+	}
+	return req
+}
+
+// deviceLinks GPU之间的P2P和NVLink连接，发现设备时从NVML读取，推荐分配时不再访问NVML
+type deviceLinks struct {
+	gpus  gpuallocator.DeviceList
+	peers map[string][]PeerLink
+	err   error
+}
+
+// newDeviceLinks : 读取节点上所有GPU之间的连接，NVML不可用时记录错误
+func newDeviceLinks(nvmllib nvml.Interface) *deviceLinks {
+	if nvmllib == nil {
+		return &deviceLinks{err: fmt.Errorf("NVML is not available")}
+	}
+	gpus, err := gpuallocator.NewDevices(gpuallocator.WithNvmlLib(nvmllib))
+	if err != nil {
+		return &deviceLinks{err: err}
+	}
+	peers := make(map[string][]PeerLink)
+	for _, gpu := range gpus {
+		for _, links := range gpu.Links {
+			for _, link := range links {
+				peers[gpu.UUID] = append(peers[gpu.UUID], PeerLink{UUID: link.GPU.UUID, Type: link.Type.String()})
+			}
+		}
+		sort.Slice(peers[gpu.UUID], func(i, j int) bool { return peers[gpu.UUID][i].UUID < peers[gpu.UUID][j].UUID })
+	}
+	return &deviceLinks{gpus: gpus, peers: peers}
+}
+
+// deviceLinks : 当前设备集的GPU连接
+func (plugin *NvidiaDevicePlugin) deviceLinks() *deviceLinks {
+	plugin.devicesMu.RLock()
+	defer plugin.devicesMu.RUnlock()
+	return plugin.links
+}
+
+// peerLinks : 按GPU UUID获取P2P连接，NVML不可用时返回空
+func (plugin *NvidiaDevicePlugin) peerLinks() map[string][]PeerLink {
+	return plugin.deviceLinks().peers
+}
+
+// validatePolicyResponse : 检查外部策略返回的设备数量正确、都在可用设备中、包含必须分配的设备且没有重复
+func validatePolicyResponse(ids, available, required []string, size int) error {
+	if len(ids) != size {
+		return fmt.Errorf("policy returned %d devices, %d requested", len(ids), size)
+	}
+	if id, ok := duplicateID(ids); ok {
+		return fmt.Errorf("policy returned device %s more than once", id)
+	}
+	allowed := make(map[string]bool, len(available))
+	for _, id := range available {
+		allowed[id] = true
+	}
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !allowed[id] {
+			return fmt.Errorf("policy returned unavailable device %s", id)
+		}
+		selected[id] = true
+	}
+	for _, id := range required {
+		if !selected[id] {
+			return fmt.Errorf("policy did not return required device %s", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// GPU进程类型
+const (
+	ProcessCompute  = "compute"
+	ProcessGraphics = "graphics"
+)
+
+// procRoot 读取进程cgroup的目录，插件需要使用宿主机PID命名空间（hostPID）才能看到GPU上的进程
+const procRoot = "/proc"
+
+// nvmlValueNotAvailable NVML无法获取进程显存占用时返回的值，如没有权限或Windows WDDM模式
+const nvmlValueNotAvailable = ^uint64(0)
+
+var (
+	// containerIDRegexp cgroup路径中的容器ID，如 cri-containerd-<id>.scope、crio-<id>.scope、/docker/<id>
+	containerIDRegexp = regexp.MustCompile(`[0-9a-f]{64}`)
+	// podUIDRegexp cgroup路径中的Pod UID，systemd驱动下中划线被替换为下划线
+	podUIDRegexp = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// GPUProcess 正在使用GPU或MIG设备的进程
+type GPUProcess struct {
+	PID uint32 `json:"pid"`
+	// Types : 进程在设备上的上下文类型：compute, graphics
+	Types []string `json:"types"`
+	// UsedMemoryMiB : 进程占用的显存，NVML无法获取时为空
+	UsedMemoryMiB *uint64 `json:"usedMemoryMiB,omitempty"`
+	// ContainerID : 进程所在的容器，非容器进程或看不到该进程时为空
+	ContainerID string `json:"containerId,omitempty"`
+	PodUID      string `json:"podUid,omitempty"`
+}
+
+// DeviceProcesses : 通过NVML列出正在使用GPU或MIG设备的进程，并从 /proc 读取进程所在的容器和Pod
+// 同一进程的计算和图形上下文合并为一条，按PID排序
+func (p *PluginManager) DeviceProcesses(uuid string) ([]GPUProcess, error) {
+	if len(p.gpuMembers(uuid)) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDevice, uuid)
+	}
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return nil, fmt.Errorf("NVML is not available")
+	}
+	d, ret := p.attributes.Handle(p.nvmllib, device.AnnotatedID(uuid).GetID())
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting device handle: %v", ret)
+	}
+	compute, ret := d.GetComputeRunningProcesses()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting compute processes: %v", ret)
+	}
+	graphics, ret := d.GetGraphicsRunningProcesses()
+	if ret != nvml.SUCCESS && ret != nvml.ERROR_NOT_SUPPORTED {
+		return nil, fmt.Errorf("error getting graphics processes: %v", ret)
+	}
+	byPID := make(map[uint32]*GPUProcess)
+	add := func(infos []nvml.ProcessInfo, typ string) {
+		for _, pi := range infos {
+			proc, ok := byPID[pi.Pid]
+			if !ok {
+				proc = &GPUProcess{PID: pi.Pid}
+				proc.ContainerID, proc.PodUID = processContainer(pi.Pid)
+				byPID[pi.Pid] = proc
+			}
+			proc.Types = append(proc.Types, typ)
+			if pi.UsedGpuMemory != nvmlValueNotAvailable {
+				used := pi.UsedGpuMemory / device.MiB
+				if proc.UsedMemoryMiB != nil {
+					used += *proc.UsedMemoryMiB
+				}
+				proc.UsedMemoryMiB = &used
+			}
+		}
+	}
+	add(compute, ProcessCompute)
+	add(graphics, ProcessGraphics)
+	res := make([]GPUProcess, 0, len(byPID))
+	for _, proc := range byPID {
+		res = append(res, *proc)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].PID < res[j].PID })
+	return res, nil
+}
+
+// processContainer : 从进程的cgroup中解析容器ID和Pod UID，读取失败或不在容器中时返回空
+func processContainer(pid uint32) (string, string) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10), "cgroup"))
+	if err != nil {
+		return "", ""
+	}
+	var containerID, podUID string
+	for _, line := range strings.Split(string(data), "\n") {
+		if ids := containerIDRegexp.FindAllString(line, -1); len(ids) > 0 && containerID == "" {
+			containerID = ids[len(ids)-1]
+		}
+		if m := podUIDRegexp.FindStringSubmatch(line); m != nil && podUID == "" {
+			podUID = strings.ReplaceAll(m[1], "_", "-")
+		}
+	}
+	return containerID, podUID
+}
@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"sort"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+)
+
+// Readiness 就绪状态，所有需要提供服务的插件都已向kubelet注册时就绪
+type Readiness struct {
+	Ready            bool     `json:"ready"`
+	WaitingForDriver bool     `json:"waitingForDriver,omitempty"`
+	Pending          []string `json:"pending,omitempty"`
+}
+
+// Readiness : 当前的就绪状态，插件注册失效后重新变为未就绪
+func (p *PluginManager) Readiness() Readiness {
+	if !p.Loaded() {
+		return Readiness{Ready: false, WaitingForDriver: p.waitingForDriver.Load()}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var pending []string
+	for _, pl := range p.plugins {
+		if !p.shouldServe(pl) {
+			continue
+		}
+		if status := pl.Status(); status.State != StateRegistered {
+			pending = append(pending, status.ResourceName)
+		}
+	}
+	sort.Strings(pending)
+	return Readiness{Ready: len(pending) == 0, Pending: pending}
+}
+
+// Registered : 所有插件首次完成注册时关闭的通道
+func (p *PluginManager) Registered() <-chan struct{} {
+	return p.registered.C
+}
+
+// checkRegistered : 所有插件都已注册时关闭注册通道
+func (p *PluginManager) checkRegistered() {
+	select {
+	case <-p.registered.C:
+		return
+	default:
+	}
+	if p.Readiness().Ready {
+		l.Logger.Info("all plugins registered with kubelet")
+		p.registered.Close()
+	}
+}
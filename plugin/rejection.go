@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/kube"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Allocate 拒绝原因
+const (
+	RejectReasonUnknownDevice  = "unknown_device"
+	RejectReasonOverShared     = "over_shared"
+	RejectReasonPolicyVeto     = "policy_veto"
+	RejectReasonTimeout        = "timeout"
+	RejectReasonSharedConflict = "shared_conflict"
+	RejectReasonUnhealthy      = "unhealthy_device"
+	RejectReasonMaintenance    = "maintenance"
+)
+
+// 申请不健康设备时的处理方式
+const (
+	UnhealthyPolicyReject = "reject"
+	UnhealthyPolicyWarn   = "warn"
+)
+
+var allocateUnhealthy = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "allocate_unhealthy_total",
+	Help:      "Number of Allocate requests that asked for a device marked unhealthy, by resource and the action taken.",
+}, []string{"resource", "action"})
+
+// allocationRejectedEventReason 分配被拒绝时Pod事件的原因
+const allocationRejectedEventReason = "GPUAllocationRejected"
+
+// rejectionEventInterval 同一个Pod两次分配被拒绝事件的最小间隔，kubelet重试分配时不会刷出大量重复事件
+const rejectionEventInterval = time.Minute
+
+var allocateRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "plugin",
+	Name:      "allocate_rejections_total",
+	Help:      "Number of rejected Allocate requests by resource and reason.",
+}, []string{"resource", "reason"})
+
+// rejectAllocation 记录分配被拒绝的原因，并返回给kubelet的错误
+func (plugin *NvidiaDevicePlugin) rejectAllocation(ctx context.Context, reason string, err error) error {
+	allocateRejections.WithLabelValues(string(plugin.resourceName), reason).Inc()
+	allocateErrors.WithLabelValues(string(plugin.resourceName)).Inc()
+	l.FromContext(ctx).Warn("allocation rejected", zap.String("resourceName", string(plugin.resourceName)), zap.String("reason", reason), zap.Error(err))
+	// 不知道所在节点时无法只选出本节点的Pod，不发送事件
+	if plugin.events != nil && plugin.events.NodeName() != "" {
+		go plugin.emitRejectionEvents(reason, err)
+	}
+	return err
+}
+
+// checkHealth 检查申请的设备是否健康
+// kubelet可能在收到不健康状态之前就发起了分配，按配置拒绝或只记录警告
+func (plugin *NvidiaDevicePlugin) checkHealth(ctx context.Context, ids []string) error {
+	var unhealthy []string
+	for _, id := range ids {
+		if d := plugin.Devices().GetByID(id); d != nil && d.Health != pluginapi.Healthy {
+			unhealthy = append(unhealthy, id)
+		}
+	}
+	if len(unhealthy) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("invalid allocation request for %s: unhealthy devices %s", plugin.resourceName, strings.Join(unhealthy, ","))
+	if plugin.unhealthyPolicy == UnhealthyPolicyWarn {
+		allocateUnhealthy.WithLabelValues(string(plugin.resourceName), UnhealthyPolicyWarn).Inc()
+		l.FromContext(ctx).Warn("allocating unhealthy devices", zap.String("resourceName", string(plugin.resourceName)), zap.Strings("devices", unhealthy))
+		return nil
+	}
+	allocateUnhealthy.WithLabelValues(string(plugin.resourceName), UnhealthyPolicyReject).Inc()
+	return err
+}
+
+// emitRejectionEvents 为本节点上等待该资源的Pod创建事件
+// Allocate 请求中不包含Pod信息，因此事件会发送到所有申请该资源且仍处于Pending状态的Pod
+// 每个Pod在 rejectionEventInterval 内最多收到一个事件
+func (plugin *NvidiaDevicePlugin) emitRejectionEvents(reason string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	selector := fmt.Sprintf("spec.nodeName=%s,status.phase=Pending", plugin.events.NodeName())
+	pods, lerr := plugin.events.Client().ListPods(ctx, selector)
+	if lerr != nil {
+		l.Logger.Warn("failed to list pending pods", zap.Error(lerr))
+		return
+	}
+	message := fmt.Sprintf("%s allocation rejected (%s): %v", plugin.resourceName, reason, err)
+	for _, pod := range pods {
+		if !pod.Requests(string(plugin.resourceName)) || !plugin.allowRejectionEvent(podKey(pod)) {
+			continue
+		}
+		if eerr := plugin.events.Event(ctx, kube.PodReference(pod), kube.EventTypeWarning, allocationRejectedEventReason, message); eerr != nil {
+			l.Logger.Warn("failed to create pod event", zap.String("pod", pod.Metadata.Namespace+"/"+pod.Metadata.Name), zap.Error(eerr))
+		}
+	}
+}
+
+// allowRejectionEvent : 距离上次向该Pod发送拒绝事件超过 rejectionEventInterval 时记录本次发送并返回 true
+// 同时清理过期的记录，已删除的Pod不会一直占用内存
+func (plugin *NvidiaDevicePlugin) allowRejectionEvent(key string) bool {
+	plugin.rejectionEventsMu.Lock()
+	defer plugin.rejectionEventsMu.Unlock()
+	now := plugin.clock.Now()
+	for k, last := range plugin.rejectionEvents {
+		if now.Sub(last) >= rejectionEventInterval {
+			delete(plugin.rejectionEvents, k)
+		}
+	}
+	if _, exists := plugin.rejectionEvents[key]; exists {
+		return false
+	}
+	plugin.rejectionEvents[key] = now
+	return true
+}
+
+// podKey : Pod的唯一标识，没有UID时使用命名空间和名称
+func podKey(pod kube.Pod) string {
+	if pod.Metadata.UID != "" {
+		return pod.Metadata.UID
+	}
+	return pod.Metadata.Namespace + "/" + pod.Metadata.Name
+}
@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+)
+
+// kubelet重试分配时同一个Pod在间隔内只收到一个拒绝事件，其它Pod不受影响
+func TestAllowRejectionEvent(t *testing.T) {
+	clk := clock.NewFakeClock(time.Now())
+	plugin, err := NewNvidiaDevicePlugin("nvidia.com/gpu", nil, nil, Options{Clock: clk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plugin.allowRejectionEvent("pod-a") {
+		t.Fatal("first event for pod-a suppressed")
+	}
+	if plugin.allowRejectionEvent("pod-a") {
+		t.Fatal("repeated event for pod-a not suppressed")
+	}
+	if !plugin.allowRejectionEvent("pod-b") {
+		t.Fatal("event for pod-b suppressed by pod-a")
+	}
+	clk.Step(rejectionEventInterval - time.Second)
+	if plugin.allowRejectionEvent("pod-a") {
+		t.Fatal("event for pod-a allowed before the interval passed")
+	}
+	clk.Step(time.Second)
+	if !plugin.allowRejectionEvent("pod-a") {
+		t.Fatal("event for pod-a suppressed after the interval passed")
+	}
+	// 过期的记录被清理
+	if _, exists := plugin.rejectionEvents["pod-b"]; exists {
+		t.Fatal("expired entry for pod-b not removed")
+	}
+}
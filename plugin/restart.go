@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+)
+
+// 重启任务阶段
+const (
+	RestartPending     = "pending"
+	RestartStopping    = "stopping_plugins"
+	RestartRebuilding  = "rebuilding_devices"
+	RestartRegistering = "registering"
+	RestartSucceeded   = "succeeded"
+	RestartFailed      = "failed"
+)
+
+// 重启的触发原因
+const (
+	RestartTriggerAPI     = "api"
+	RestartTriggerKubelet = "kubelet"
+	RestartTriggerProbe   = "probe"
+)
+
+// ErrUnknownResource 资源没有对应的插件
+var ErrUnknownResource = errors.New("unknown resource")
+
+// maxRestartJobs 保留的重启任务数量
+const maxRestartJobs = 32
+
+// RestartJob 插件重启任务
+type RestartJob struct {
+	ID         string    `json:"id"`
+	Trigger    string    `json:"trigger"`
+	Phase      string    `json:"phase"`
+	Requests   int       `json:"requests"`
+	CreatedAt  time.Time `json:"createdAt"`
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Devices : 重启前后的设备变化，重新加载设备后才有
+	Devices *DeviceMapDiff `json:"devices,omitempty"`
+	// Resources : 只重启这些资源的插件，其它插件保持注册，为空时重启全部插件
+	Resources []string `json:"resources,omitempty"`
+}
+
+// Done 任务是否已结束
+func (j RestartJob) Done() bool {
+	return j.Phase == RestartSucceeded || j.Phase == RestartFailed
+}
+
+// RestartJobs 重启任务记录
+// 尚未开始的任务只有一个，期间的重启请求合并到该任务；正在执行的任务不合并，因为可能已经过了停止插件的阶段
+type RestartJobs struct {
+	mu      sync.Mutex
+	jobs    []*RestartJob
+	pending *RestartJob
+	clock   clock.Clock
+}
+
+// NewRestartJobs 创建重启任务记录
+func NewRestartJobs(clk clock.Clock) *RestartJobs {
+	return &RestartJobs{clock: clk}
+}
+
+// Request 请求重启，已有未开始的任务时合并到该任务，返回任务及是否新建
+// resources 为空时重启全部插件；合并时重启的资源取并集，任一请求重启全部时合并后的任务也重启全部
+func (r *RestartJobs) Request(trigger string, resources []string) (RestartJob, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job := r.pending; job != nil {
+		job.Requests++
+		if len(job.Resources) > 0 && len(resources) > 0 {
+			job.Resources = mergeResources(job.Resources, resources)
+		} else {
+			job.Resources = nil
+		}
+		return *job, false, nil
+	}
+	job, err := r.add(trigger, resources)
+	if err != nil {
+		return RestartJob{}, false, err
+	}
+	r.pending = job
+	return *job, true, nil
+}
+
+// Take 取出等待执行的任务并标记为开始，没有时返回空
+func (r *RestartJobs) Take() *RestartJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.pending
+	r.pending = nil
+	if job != nil {
+		job.StartedAt = r.clock.Now()
+	}
+	return job
+}
+
+// Start 新建并立即开始任务，用于kubelet重启等内部触发的重启
+// 重启全部插件时待执行的任务也一并完成，只重启部分资源时不影响待执行的任务
+func (r *RestartJobs) Start(trigger string, resources []string) *RestartJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job := r.pending; job != nil && len(resources) == 0 {
+		r.pending = nil
+		job.StartedAt = r.clock.Now()
+		job.Resources = nil
+		return job
+	}
+	job, err := r.add(trigger, resources)
+	if err != nil {
+		// 任务ID生成失败不影响重启本身
+		job = &RestartJob{Trigger: trigger, Phase: RestartPending, Requests: 1, CreatedAt: r.clock.Now(), Resources: resources}
+	}
+	job.StartedAt = job.CreatedAt
+	return job
+}
+
+// SetPhase 更新任务阶段，任务为空时忽略
+func (r *RestartJobs) SetPhase(job *RestartJob, phase string, err error) {
+	if job == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.Phase = phase
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if job.Done() {
+		job.FinishedAt = r.clock.Now()
+	}
+}
+
+// SetDevices 记录重启前后的设备变化，任务为空时忽略
+func (r *RestartJobs) SetDevices(job *RestartJob, diff DeviceMapDiff) {
+	if job == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.Devices = &diff
+}
+
+// Get 按ID获取任务
+func (r *RestartJobs) Get(id string) (RestartJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return RestartJob{}, false
+}
+
+// List 按创建时间返回最近的任务
+func (r *RestartJobs) List() []RestartJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]RestartJob, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		res = append(res, *job)
+	}
+	return res
+}
+
+// add 新建任务，超出容量时丢弃最早的已结束任务
+func (r *RestartJobs) add(trigger string, resources []string) (*RestartJob, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, fmt.Errorf("error generating restart job ID: %w", err)
+	}
+	job := &RestartJob{ID: id, Trigger: trigger, Phase: RestartPending, Requests: 1, CreatedAt: r.clock.Now(), Resources: mergeResources(nil, resources)}
+	r.jobs = append(r.jobs, job)
+	if len(r.jobs) > maxRestartJobs {
+		for i, j := range r.jobs {
+			if j.Done() {
+				r.jobs = append(r.jobs[:i:i], r.jobs[i+1:]...)
+				break
+			}
+		}
+	}
+	return job, nil
+}
+
+// mergeResources 合并资源名称，去重并排序
+func mergeResources(a, b []string) []string {
+	set := make(map[string]bool, len(a)+len(b))
+	for _, name := range a {
+		set[name] = true
+	}
+	for _, name := range b {
+		set[name] = true
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return sortedKeys(set)
+}
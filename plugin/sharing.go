@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+
+	"go.uber.org/zap"
+)
+
+// HealthCheckSharing 共享配置与发现的设备是否一致
+const HealthCheckSharing = "sharing"
+
+// SharingMismatch 与发现的设备不一致的共享配置
+type SharingMismatch struct {
+	// Name : 配置中的资源名称或通配符
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// sharingName : 配置中的资源名称，未指定前缀时使用 resourcePrefix
+func sharingName(prefix, name string) string {
+	if !strings.Contains(name, "/") {
+		return prefix + "/" + name
+	}
+	return name
+}
+
+// sharingFor : 资源的共享配置，按顺序取第一个匹配的配置
+func (p *PluginManager) sharingFor(name resource.ResourceName) (config.ReplicatedResourceConfig, bool) {
+	for _, r := range p.timeSlicing.Resources {
+		if ok, _ := path.Match(sharingName(p.resourcePrefix, r.Name), string(name)); ok {
+			return r, true
+		}
+	}
+	return config.ReplicatedResourceConfig{}, false
+}
+
+// replicasFor : 资源的副本数，未匹配或未开启分时共享时为1
+func (p *PluginManager) replicasFor(name resource.ResourceName) int {
+	if r, ok := p.sharingFor(name); ok {
+		return r.Replicas
+	}
+	return 1
+}
+
+// sharedName : 资源对外提供的名称，共享的资源优先使用配置的 rename，否则在 renameByDefault 时加上 .shared 后缀
+func (p *PluginManager) sharedName(name resource.ResourceName) resource.ResourceName {
+	r, ok := p.sharingFor(name)
+	if !ok || r.Replicas <= 1 {
+		return name
+	}
+	if r.Rename != "" {
+		return resource.ResourceName(sharingName(p.resourcePrefix, r.Rename))
+	}
+	if p.timeSlicing.RenameByDefault {
+		return resource.ResourceName(name.DefaultSharedRename())
+	}
+	return name
+}
+
+// ValidateSharing : 加载配置时检查共享资源的 rename：必须是合法的扩展资源名称，
+// 只能用于不含通配符且确实共享的资源，不同资源不能使用同一名称
+func ValidateSharing(c config.TimeSlicingConfig, prefix string) error {
+	var errs []error
+	renamed := make(map[string]int)
+	for i, r := range c.Resources {
+		if r.Rename == "" {
+			continue
+		}
+		key := fmt.Sprintf("sharing.timeSlicing.resources[%d].rename", i)
+		name := sharingName(prefix, r.Rename)
+		if err := resource.ResourceName(name).Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+		if strings.ContainsAny(r.Name, "*?[") {
+			errs = append(errs, fmt.Errorf("%s: cannot rename the wildcard %q, each matched resource would get the same name", key, r.Name))
+		}
+		if r.Replicas <= 1 {
+			errs = append(errs, fmt.Errorf("%s: has no effect without replicas greater than 1", key))
+		}
+		if j, ok := renamed[name]; ok {
+			errs = append(errs, fmt.Errorf("%s: %s is also used by sharing.timeSlicing.resources[%d]", key, name, j))
+			continue
+		}
+		renamed[name] = i
+	}
+	return errors.Join(errs...)
+}
+
+// applySharing : 按副本数把设备展开为多个副本，副本ID为 <设备ID>::<序号>，副本与原设备的NUMA节点相同
+// 显存资源已经按分块提供，不参与分时共享
+func (p *PluginManager) applySharing(dmp device.DeviceMap) device.DeviceMap {
+	if len(p.timeSlicing.Resources) == 0 {
+		return dmp
+	}
+	res := make(device.DeviceMap, len(dmp))
+	for name, devices := range dmp {
+		replicas := p.replicasFor(resource.ResourceName(name))
+		if replicas <= 1 || (p.memory != nil && name == string(p.memoryResource)) {
+			res[name] = devices
+			continue
+		}
+		shared := make(device.Devices, len(devices)*replicas)
+		for _, d := range devices {
+			for i := 0; i < replicas; i++ {
+				replica := *d
+				replica.ID = string(device.NewAnnotatedID(d.ID, i))
+				replica.Replicas = replicas
+				shared[replica.ID] = &replica
+			}
+		}
+		res[string(p.sharedName(resource.ResourceName(name)))] = shared
+	}
+	return res
+}
+
+// checkSharingConfig : 检查共享配置是否与发现的设备一致，没有匹配任何资源或匹配显存资源的配置视为不一致
+func (p *PluginManager) checkSharingConfig(dmp device.DeviceMap) []SharingMismatch {
+	var res []SharingMismatch
+	for _, r := range p.timeSlicing.Resources {
+		pattern := sharingName(p.resourcePrefix, r.Name)
+		var matched []string
+		for name := range dmp {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = append(matched, name)
+			}
+		}
+		switch {
+		case len(matched) == 0:
+			res = append(res, SharingMismatch{Name: r.Name, Reason: "matches no discovered resource"})
+		case p.memory != nil && len(matched) == 1 && matched[0] == string(p.memoryResource):
+			res = append(res, SharingMismatch{Name: r.Name, Reason: fmt.Sprintf("%s is already shared by memory chunks", p.memoryResource)})
+		}
+	}
+	for _, m := range res {
+		l.Logger.Warn("time-slicing config does not match the discovered devices", zap.String("name", m.Name), zap.String("reason", m.Reason))
+	}
+	return res
+}
+
+// SharingMismatches : 最近一次加载插件时与发现的设备不一致的共享配置
+func (p *PluginManager) SharingMismatches() []SharingMismatch {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]SharingMismatch{}, p.sharingMismatches...)
+}
+
+// checkSharing : 共享配置是否都匹配到发现的设备
+// 同一份配置通常用于多种GPU的节点，不一致时只报告，不视为降级
+func (p *PluginManager) checkSharing() HealthCheck {
+	mismatches := p.SharingMismatches()
+	c := HealthCheck{Name: HealthCheckSharing, Healthy: true}
+	if len(mismatches) == 0 {
+		c.Message = fmt.Sprintf("%d time-slicing entries match discovered resources", len(p.timeSlicing.Resources))
+		return c
+	}
+	var msgs []string
+	for _, m := range mismatches {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", m.Name, m.Reason))
+	}
+	c.Message = "time-slicing config mismatch: " + strings.Join(msgs, "; ")
+	return c
+}
+
+// visibleDevices : 副本对应的GPU或MIG设备UUID，按申请顺序排列，同一设备只出现一次
+func visibleDevices(ids []string) string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		uuid := device.AnnotatedID(id).GetID()
+		if !seen[uuid] {
+			seen[uuid] = true
+			res = append(res, uuid)
+		}
+	}
+	return strings.Join(res, ",")
+}
@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 分时共享的副本上报所在GPU的NUMA节点
+func TestApplySharingKeepsTopology(t *testing.T) {
+	p := &PluginManager{
+		resourcePrefix: "nvidia.com",
+		timeSlicing: config.TimeSlicingConfig{
+			Resources: []config.ReplicatedResourceConfig{{Name: "gpu", Replicas: 3}},
+		},
+	}
+	gpus := make(device.Devices)
+	for i, id := range []string{"GPU-a", "GPU-b"} {
+		gpus[id] = &device.Device{Device: pluginapi.Device{
+			ID:       id,
+			Health:   pluginapi.Healthy,
+			Topology: &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(i)}}},
+		}}
+	}
+	shared := p.applySharing(device.DeviceMap{"nvidia.com/gpu": gpus})["nvidia.com/gpu"]
+	if len(shared) != 6 {
+		t.Fatalf("got %d replicas, want 6", len(shared))
+	}
+	for _, d := range shared.GetPluginDevices() {
+		want := gpus[device.AnnotatedID(d.ID).GetID()].Topology.Nodes[0].ID
+		if d.Topology == nil || len(d.Topology.Nodes) != 1 || d.Topology.Nodes[0].ID != want {
+			t.Errorf("%s: topology %v, want NUMA node %d", d.ID, d.Topology, want)
+		}
+	}
+}
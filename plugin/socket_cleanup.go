@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var staleSocketsRemoved = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "stale_sockets_removed_total",
+	Help:      "Number of sockets left behind by a crashed instance that were removed at startup.",
+})
+
+// ownSockets : 本实例按资源配置会创建的socket文件名，包括管理器的socket
+// 只按确切的文件名匹配，同一目录下其它设备插件（如上游的 nvidia-gpu.sock）的socket不会被误删
+func (p *PluginManager) ownSockets() map[string]bool {
+	names := map[string]bool{filepath.Base(p.socket): true}
+	for _, c := range p.resourceNameClaims() {
+		names[socketName(p.pluginOptions.InstanceID, c.Name.PluginName())] = true
+	}
+	return names
+}
+
+// cleanupSockets : 启动插件前清理本实例会创建的socket
+// 无法连接的socket是崩溃实例的残留，直接删除；仍在服务的socket属于其它进程，拒绝启动以免互相覆盖注册
+func (p *PluginManager) cleanupSockets() error {
+	dir := devicePluginPath
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	own := p.ownSockets()
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.Type()&os.ModeSocket == 0 || !own[e.Name()] {
+			continue
+		}
+		conn, err := net.DialTimeout("unix", path, competingDialTimeout)
+		if err != nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing stale socket %s: %w", path, err)
+			}
+			staleSocketsRemoved.Inc()
+			l.Logger.Info("removed stale plugin socket", zap.String("socket", path), zap.NamedError("probe", err))
+			continue
+		}
+		owner := socketOwner(conn)
+		conn.Close()
+		if owner > 0 {
+			return fmt.Errorf("socket %s is served by a live process (pid %d); stop it or give this instance a different instanceId", path, owner)
+		}
+		return fmt.Errorf("socket %s is served by a live process; stop it or give this instance a different instanceId", path)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package plugin
+
+import (
+	"net"
+	"syscall"
+)
+
+// socketOwner : 通过 SO_PEERCRED 获取监听socket的进程ID，获取失败时返回0
+func socketOwner(conn net.Conn) int {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	var pid int
+	raw.Control(func(fd uintptr) {
+		if cred, err := syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED); err == nil {
+			pid = int(cred.Pid)
+		}
+	})
+	return pid
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package plugin
+
+import "net"
+
+// socketOwner : 非Linux平台无法获取监听socket的进程ID
+func socketOwner(conn net.Conn) int {
+	return 0
+}
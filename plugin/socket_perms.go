@@ -0,0 +1,33 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+)
+
+// applySocketPermissions : 按配置设置socket的权限、属主和SELinux标签
+// 加固的主机（如OpenShift）上默认权限或标签可能使kubelet无法连接插件socket
+func applySocketPermissions(socket string, cfg config.GRPCConfig) error {
+	if cfg.SocketMode != "" {
+		mode, err := strconv.ParseUint(cfg.SocketMode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid socket mode %q: %w", cfg.SocketMode, err)
+		}
+		if err := os.Chmod(socket, os.FileMode(mode)); err != nil {
+			return fmt.Errorf("error setting mode of %s: %w", socket, err)
+		}
+	}
+	// -1 表示保持不变
+	if cfg.SocketUID >= 0 || cfg.SocketGID >= 0 {
+		if err := os.Lchown(socket, cfg.SocketUID, cfg.SocketGID); err != nil {
+			return fmt.Errorf("error setting owner of %s: %w", socket, err)
+		}
+	}
+	if cfg.SELinuxLabel == "" && !cfg.RestoreSELinuxContext {
+		return nil
+	}
+	return setSELinuxContext(socket, cfg.SELinuxLabel)
+}
@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+)
+
+// selinuxXattr SELinux标签的扩展属性
+const selinuxXattr = "security.selinux"
+
+// selinuxEnabled : 主机是否启用了SELinux
+func selinuxEnabled() bool {
+	_, err := os.Stat("/sys/fs/selinux/enforce")
+	return err == nil
+}
+
+// setSELinuxContext : 设置socket的SELinux标签，label为空时通过 restorecon 按策略恢复默认标签
+// 主机未启用SELinux时不处理
+func setSELinuxContext(socket, label string) error {
+	if !selinuxEnabled() {
+		l.Logger.Debug("SELinux not enabled, skipping socket label", zap.String("socket", socket))
+		return nil
+	}
+	if label != "" {
+		if err := syscall.Setxattr(socket, selinuxXattr, []byte(label), 0); err != nil {
+			return fmt.Errorf("error setting SELinux label %q on %s: %w", label, socket, err)
+		}
+		return nil
+	}
+	out, err := exec.Command("restorecon", socket).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error restoring SELinux context of %s: %w: %s", socket, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
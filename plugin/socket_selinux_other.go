@@ -0,0 +1,8 @@
+//go:build !linux
+
+package plugin
+
+// setSELinuxContext : 非Linux平台没有SELinux
+func setSELinuxContext(socket, label string) error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"time"
+)
+
+// 插件状态
+const (
+	StateStopped    = "stopped"
+	StateServing    = "serving"
+	StateRegistered = "registered"
+	StateError      = "error"
+	// StateWaitingKubelet : kubelet已停止，等待其重新启动后重新注册
+	StateWaitingKubelet = "waitingForKubelet"
+)
+
+// 插件启动失败后的重试间隔
+const (
+	initialRestartBackoff = 30 * time.Second
+	maxRestartBackoff     = 5 * time.Minute
+)
+
+// Status 插件运行状态
+type Status struct {
+	ResourceName string           `json:"resourceName"`
+	Socket       string           `json:"socket"`
+	Devices      int              `json:"devices"`
+	State        string           `json:"state"`
+	RegisteredAt time.Time        `json:"registeredAt,omitempty"`
+	APIVersion   string           `json:"apiVersion,omitempty"`
+	Watching     bool             `json:"watching"`
+	Acknowledged *Acknowledgement `json:"acknowledged,omitempty"`
+	Error        string           `json:"error,omitempty"`
+	Failures     int              `json:"failures"`
+	LastFailure  time.Time        `json:"lastFailure,omitempty"`
+	NextRetry    time.Time        `json:"nextRetry,omitempty"`
+}
+
+// Status 获取插件运行状态
+func (plugin *NvidiaDevicePlugin) Status() Status {
+	plugin.mu.RLock()
+	defer plugin.mu.RUnlock()
+	return plugin.status
+}
+
+// setState 设置插件状态
+// 注册成功后清除错误，失败次数在kubelet调用ListAndWatch后才重置，使注册静默失败时重试间隔仍然递增
+func (plugin *NvidiaDevicePlugin) setState(state string) {
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	plugin.status.State = state
+	if state == StateRegistered {
+		plugin.status.RegisteredAt = plugin.clock.Now()
+		plugin.status.Error = ""
+		plugin.status.NextRetry = time.Time{}
+	}
+}
+
+// setWatching 记录kubelet是否正在通过ListAndWatch获取设备列表
+func (plugin *NvidiaDevicePlugin) setWatching(watching bool) {
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	plugin.status.Watching = watching
+	if watching {
+		plugin.status.Failures = 0
+	}
+}
+
+// setError 记录启动失败并计算下一次重试时间
+func (plugin *NvidiaDevicePlugin) setError(err error) {
+	plugin.mu.Lock()
+	defer plugin.mu.Unlock()
+	now := plugin.clock.Now()
+	plugin.status.State = StateError
+	plugin.status.Error = err.Error()
+	plugin.status.Failures++
+	plugin.status.LastFailure = now
+	backoff := initialRestartBackoff
+	for i := 1; i < plugin.status.Failures && backoff < maxRestartBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRestartBackoff {
+		backoff = maxRestartBackoff
+	}
+	plugin.status.NextRetry = now.Add(backoff)
+}
@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/clock"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// stuckProcessChecker 检查GPU上是否有进程已退出但仍占用GPU上下文，这类GPU通常需要重置才能再次使用
+// 通过 /proc 判断进程是否存在，插件需要使用宿主机PID命名空间（hostPID），否则所有进程都会被视为已退出
+type stuckProcessChecker struct {
+	clock    clock.Clock
+	stuckFor time.Duration
+	// since : 每块GPU上已退出进程的首次发现时间
+	since map[string]map[uint32]time.Time
+}
+
+// newStuckProcessChecker 创建残留进程检查器，进程退出后仍占用GPU超过 stuckFor 时标记为不健康
+func newStuckProcessChecker(clk clock.Clock, stuckFor time.Duration) *stuckProcessChecker {
+	return &stuckProcessChecker{
+		clock:    clk,
+		stuckFor: stuckFor,
+		since:    make(map[string]map[uint32]time.Time),
+	}
+}
+
+// Name : 检查器名称
+func (c *stuckProcessChecker) Name() string {
+	return HealthCheckerStuckProcess
+}
+
+// Recoverable : 残留的上下文释放后恢复
+func (c *stuckProcessChecker) Recoverable() bool {
+	return true
+}
+
+// Check : 检查GPU上的计算进程是否都还存在
+func (c *stuckProcessChecker) Check(_ context.Context, gpu HealthTarget) (HealthResult, error) {
+	procs, ret := gpu.Device.GetComputeRunningProcesses()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return HealthResult{}, nil
+	}
+	if ret != nvml.SUCCESS {
+		return HealthResult{}, fmt.Errorf("error getting compute processes: %v", ret)
+	}
+	now := c.clock.Now()
+	prev := c.since[gpu.UUID]
+	exited := make(map[uint32]time.Time)
+	var stuck []string
+	for _, pi := range procs {
+		if _, err := os.Stat(filepath.Join(procRoot, strconv.FormatUint(uint64(pi.Pid), 10))); err == nil {
+			continue
+		}
+		since, ok := prev[pi.Pid]
+		if !ok {
+			since = now
+		}
+		exited[pi.Pid] = since
+		if now.Sub(since) >= c.stuckFor {
+			stuck = append(stuck, strconv.FormatUint(uint64(pi.Pid), 10))
+		}
+	}
+	c.since[gpu.UUID] = exited
+	if len(stuck) == 0 {
+		return HealthResult{}, nil
+	}
+	sort.Strings(stuck)
+	return HealthResult{Reason: HealthReason{
+		Code:    HealthReasonStuckProcess,
+		Message: fmt.Sprintf("exited processes %v still hold GPU contexts after %s", stuck, c.stuckFor),
+	}}, nil
+}
@@ -0,0 +1,255 @@
+package plugin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"go.uber.org/zap"
+)
+
+// supportBundleLogTail 每个日志文件放入支持包的最大字节数
+const supportBundleLogTail = 1 << 20
+
+// SupportBundleFile 支持包中附加的文件，如性能分析文件
+type SupportBundleFile struct {
+	// Name : 支持包中的路径
+	Name string
+	// Path : 本地文件路径
+	Path string
+}
+
+// NVMLQuery 节点GPU的NVML查询结果
+type NVMLQuery struct {
+	Driver  version.Driver    `json:"driver"`
+	Devices []NVMLDeviceQuery `json:"devices"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// NVMLDeviceQuery 一块物理GPU的NVML查询结果，不支持的项省略，查询失败的项记录在 Errors 中
+type NVMLDeviceQuery struct {
+	Index                int               `json:"index"`
+	UUID                 string            `json:"uuid,omitempty"`
+	Name                 string            `json:"name,omitempty"`
+	PCIBusID             string            `json:"pciBusID,omitempty"`
+	MemoryTotal          uint64            `json:"memoryTotal,omitempty"`
+	MemoryUsed           uint64            `json:"memoryUsed,omitempty"`
+	TemperatureC         uint32            `json:"temperatureC,omitempty"`
+	PowerUsageMilliwatts uint32            `json:"powerUsageMilliwatts,omitempty"`
+	PowerLimitMilliwatts uint32            `json:"powerLimitMilliwatts,omitempty"`
+	Modes                map[string]string `json:"modes,omitempty"`
+	UncorrectedECCErrors *uint64           `json:"uncorrectedEccErrors,omitempty"`
+	RetiredPagesPending  *bool             `json:"retiredPagesPending,omitempty"`
+	RowRemapFailure      *bool             `json:"rowRemapFailure,omitempty"`
+	ComputeProcesses     []uint32          `json:"computeProcesses,omitempty"`
+	Errors               map[string]string `json:"errors,omitempty"`
+}
+
+// queryResult : 记录NVML查询失败的项，不支持的项忽略，返回是否成功
+func (q *NVMLDeviceQuery) queryResult(item string, ret nvml.Return) bool {
+	if ret == nvml.SUCCESS {
+		return true
+	}
+	if ret != nvml.ERROR_NOT_SUPPORTED {
+		if q.Errors == nil {
+			q.Errors = make(map[string]string)
+		}
+		q.Errors[item] = ret.Error()
+	}
+	return false
+}
+
+// QueryNVML : 查询每块物理GPU的状态、模式和错误计数，相当于 nvidia-smi -q 的摘要，用于问题报告
+func (p *PluginManager) QueryNVML() NVMLQuery {
+	q := NVMLQuery{Driver: p.DriverVersions(), Devices: make([]NVMLDeviceQuery, 0)}
+	if hasNVML, reason := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		q.Error = "NVML not present: " + reason
+		return q
+	}
+	count, ret := p.nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		q.Error = fmt.Sprintf("error getting device count: %v", ret)
+		return q
+	}
+	for i := 0; i < count; i++ {
+		d := NVMLDeviceQuery{Index: i}
+		gpu, ret := p.nvmllib.DeviceGetHandleByIndex(i)
+		if !d.queryResult("handle", ret) {
+			q.Devices = append(q.Devices, d)
+			continue
+		}
+		if uuid, ret := gpu.GetUUID(); d.queryResult("uuid", ret) {
+			d.UUID = uuid
+		}
+		if name, ret := gpu.GetName(); d.queryResult("name", ret) {
+			d.Name = name
+		}
+		if pci, ret := gpu.GetPciInfo(); d.queryResult("pciInfo", ret) {
+			d.PCIBusID = device.PCIBusID(pci)
+		}
+		if mem, ret := gpu.GetMemoryInfo(); d.queryResult("memory", ret) {
+			d.MemoryTotal, d.MemoryUsed = mem.Total, mem.Used
+		}
+		if temp, ret := gpu.GetTemperature(nvml.TEMPERATURE_GPU); d.queryResult("temperature", ret) {
+			d.TemperatureC = temp
+		}
+		if power, ret := gpu.GetPowerUsage(); d.queryResult("powerUsage", ret) {
+			d.PowerUsageMilliwatts = power
+		}
+		if limit, ret := gpu.GetEnforcedPowerLimit(); d.queryResult("powerLimit", ret) {
+			d.PowerLimitMilliwatts = limit
+		}
+		for _, s := range modeSettings {
+			if current, _, ret := s.get(gpu); d.queryResult(s.name, ret) {
+				if d.Modes == nil {
+					d.Modes = make(map[string]string)
+				}
+				d.Modes[s.name] = current
+			}
+		}
+		if n, ret := gpu.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_UNCORRECTED, nvml.VOLATILE_ECC); d.queryResult("eccErrors", ret) {
+			d.UncorrectedECCErrors = &n
+		}
+		if pending, ret := gpu.GetRetiredPagesPendingStatus(); d.queryResult("retiredPages", ret) {
+			b := pending == nvml.FEATURE_ENABLED
+			d.RetiredPagesPending = &b
+		}
+		if _, _, _, failure, ret := gpu.GetRemappedRows(); d.queryResult("remappedRows", ret) {
+			d.RowRemapFailure = &failure
+		}
+		if procs, ret := gpu.GetComputeRunningProcesses(); d.queryResult("computeProcesses", ret) {
+			for _, pi := range procs {
+				d.ComputeProcesses = append(d.ComputeProcesses, pi.Pid)
+			}
+		}
+		q.Devices = append(q.Devices, d)
+	}
+	return q
+}
+
+// WriteSupportBundle : 把日志末尾、运行配置、设备发现快照、NVML查询结果、健康状态和最近的设备事件
+// 打包为 tar.gz 写入 w，files 为附加的文件。单项收集失败时写入同名的 .error 文件，不中断打包
+func (p *PluginManager) WriteSupportBundle(w io.Writer, files []SupportBundleFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	b := &supportBundle{tw: tw, now: p.clock.Now()}
+
+	b.addJSON("config.json", func() (interface{}, error) { return p.EffectiveConfig() })
+	b.addJSON("snapshot.json", func() (interface{}, error) { return p.DebugSnapshot() })
+	b.addJSON("nvml.json", func() (interface{}, error) { return p.QueryNVML(), nil })
+	b.addJSON("health.json", func() (interface{}, error) { return p.Health(), nil })
+	b.addJSON("events.json", func() (interface{}, error) { return p.Events(), nil })
+	for _, path := range l.Files() {
+		b.addLogTail("logs/"+filepath.Base(path), path)
+	}
+	for _, f := range files {
+		b.addFile(f.Name, f.Path)
+	}
+
+	if b.err != nil {
+		return b.err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// supportBundle 支持包的写入状态，写入失败后不再写入
+type supportBundle struct {
+	tw  *tar.Writer
+	now time.Time
+	err error
+}
+
+// write : 写入一个文件
+func (b *supportBundle) write(name string, data []byte) {
+	if b.err != nil {
+		return
+	}
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: b.now}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		b.err = fmt.Errorf("error writing %s: %w", name, err)
+		return
+	}
+	if _, err := b.tw.Write(data); err != nil {
+		b.err = fmt.Errorf("error writing %s: %w", name, err)
+	}
+}
+
+// fail : 收集失败时写入说明
+func (b *supportBundle) fail(name string, err error) {
+	l.Logger.Warn("failed to collect support bundle item", zap.String("item", name), zap.Error(err))
+	b.write(name+".error", []byte(err.Error()+"\n"))
+}
+
+// addJSON : 写入JSON格式的收集结果
+func (b *supportBundle) addJSON(name string, collect func() (interface{}, error)) {
+	v, err := collect()
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	b.write(name, data)
+}
+
+// addLogTail : 写入日志文件的末尾，从完整的一行开始
+func (b *supportBundle) addLogTail(name, path string) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	offset := st.Size() - supportBundleLogTail
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, st.Size()-offset))
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	b.write(name, data)
+}
+
+// addFile : 写入完整的本地文件
+func (b *supportBundle) addFile(name, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	b.write(name, data)
+}
@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	thermalEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "thermal_events_total",
+		Help:      "Number of GPUs cordoned or uncordoned by the thermal/power policy.",
+	}, []string{"type"})
+	thermalCordoned = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "gpu",
+		Subsystem: "manager",
+		Name:      "thermal_cordoned",
+		Help:      "Whether the GPU is currently cordoned by the thermal/power policy.",
+	}, []string{"uuid"})
+)
+
+// thermalReading GPU的一次温度和功耗读数
+type thermalReading struct {
+	temperature  uint32
+	powerWatts   float64
+	powerPercent float64
+}
+
+// thermalState 单个GPU的阈值状态
+type thermalState struct {
+	overSince  time.Time
+	underSince time.Time
+	cordoned   bool
+	reason     string
+}
+
+// ThermalPolicy 温度或功耗持续超过阈值时把GPU标记为不健康，持续回落到阈值减去回差后恢复
+type ThermalPolicy struct {
+	cfg    config.ThermalConfig
+	states map[string]*thermalState
+}
+
+// NewThermalPolicy 创建温度和功耗策略
+func NewThermalPolicy(cfg config.ThermalConfig) *ThermalPolicy {
+	return &ThermalPolicy{
+		cfg:    cfg,
+		states: make(map[string]*thermalState),
+	}
+}
+
+// over 读数是否超过阈值，返回超过的原因
+func (t *ThermalPolicy) over(r thermalReading) (string, bool) {
+	if t.cfg.MaxTemperatureC > 0 && r.temperature >= t.cfg.MaxTemperatureC {
+		return fmt.Sprintf("temperature above %dC", t.cfg.MaxTemperatureC), true
+	}
+	if t.cfg.MaxPowerPercent > 0 && r.powerPercent >= t.cfg.MaxPowerPercent {
+		return fmt.Sprintf("power draw above %g%% of limit", t.cfg.MaxPowerPercent), true
+	}
+	return "", false
+}
+
+// under 读数是否已回落到恢复阈值以下
+func (t *ThermalPolicy) under(r thermalReading) bool {
+	if t.cfg.MaxTemperatureC > 0 && r.temperature+t.cfg.TemperatureHysteresisC >= t.cfg.MaxTemperatureC {
+		return false
+	}
+	if t.cfg.MaxPowerPercent > 0 && r.powerPercent+t.cfg.PowerHysteresisPercent >= t.cfg.MaxPowerPercent {
+		return false
+	}
+	return true
+}
+
+// update 根据读数更新GPU状态，返回发生的事件类型，没有变化时返回空
+func (t *ThermalPolicy) update(uuid string, r thermalReading, now time.Time) string {
+	s, ok := t.states[uuid]
+	if !ok {
+		s = &thermalState{}
+		t.states[uuid] = s
+	}
+	if !s.cordoned {
+		reason, over := t.over(r)
+		if !over {
+			s.overSince = time.Time{}
+			return ""
+		}
+		if s.overSince.IsZero() {
+			s.overSince = now
+		}
+		if now.Sub(s.overSince) < t.cfg.SustainFor {
+			return ""
+		}
+		s.cordoned = true
+		s.reason = reason
+		s.underSince = time.Time{}
+		return EventCordoned
+	}
+	if !t.under(r) {
+		s.underSince = time.Time{}
+		return ""
+	}
+	if s.underSince.IsZero() {
+		s.underSince = now
+	}
+	if now.Sub(s.underSince) < t.cfg.RecoverAfter {
+		return ""
+	}
+	s.cordoned = false
+	s.overSince = time.Time{}
+	return EventUncordoned
+}
+
+// thermalChecker 读取GPU温度和功耗，按策略隔离或恢复GPU上的所有设备
+type thermalChecker struct {
+	p *PluginManager
+}
+
+// Name : 检查器名称
+func (c *thermalChecker) Name() string {
+	return HealthCheckerThermal
+}
+
+// Recoverable : 温度和功耗持续回落后恢复
+func (c *thermalChecker) Recoverable() bool {
+	return true
+}
+
+// Check : 按读数更新GPU的隔离状态，隔离期间返回不健康
+func (c *thermalChecker) Check(_ context.Context, gpu HealthTarget) (HealthResult, error) {
+	r, err := readThermal(gpu.Device)
+	if err != nil {
+		return HealthResult{}, fmt.Errorf("failed to read GPU temperature and power: %w", err)
+	}
+	p := c.p
+	now := p.clock.Now()
+	event := p.thermal.update(gpu.UUID, r, now)
+	s := p.thermal.states[gpu.UUID]
+	if event != "" {
+		message := fmt.Sprintf("temperature %dC, power %.0fW (%.0f%% of limit)", r.temperature, r.powerWatts, r.powerPercent)
+		l.Logger.Warn("thermal policy "+event+" GPU", zap.String("uuid", gpu.UUID), zap.String("reason", s.reason), zap.String("reading", message))
+		thermalEvents.WithLabelValues(event).Inc()
+		p.events.Add(DeviceEvent{Time: now, Type: event, UUID: gpu.UUID, Reason: s.reason, Message: message})
+	}
+	if !s.cordoned {
+		thermalCordoned.WithLabelValues(gpu.UUID).Set(0)
+		return HealthResult{}, nil
+	}
+	thermalCordoned.WithLabelValues(gpu.UUID).Set(1)
+	return HealthResult{Reason: HealthReason{Code: HealthReasonThermal, Message: s.reason}}, nil
+}
+
+// readThermal 读取GPU温度和功耗，不支持功耗查询时功耗为0
+func readThermal(gpu nvml.Device) (thermalReading, error) {
+	var r thermalReading
+	temperature, ret := gpu.GetTemperature(nvml.TEMPERATURE_GPU)
+	if ret != nvml.SUCCESS {
+		return r, fmt.Errorf("error getting temperature: %v", ret)
+	}
+	r.temperature = temperature
+	usage, ret := gpu.GetPowerUsage()
+	if ret != nvml.SUCCESS {
+		return r, nil
+	}
+	r.powerWatts = float64(usage) / 1000
+	if limit, ret := gpu.GetEnforcedPowerLimit(); ret == nvml.SUCCESS && limit > 0 {
+		r.powerPercent = float64(usage) * 100 / float64(limit)
+	}
+	return r, nil
+}
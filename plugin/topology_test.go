@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/resource"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// topologyPlugin : 用拓扑文件中的模拟GPU创建 nvidia.com/gpu 插件，插件通过传入的NVML库计算GPU之间的连接
+func topologyPlugin(t *testing.T, file string) (*NvidiaDevicePlugin, []string, *simulate.Server) {
+	t.Helper()
+	nvmllib, err := simulate.NewServerFromFile(filepath.Join("..", "simulate", "topologies", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret := nvmllib.Init(); ret != nvml.SUCCESS {
+		t.Fatalf("init simulated NVML: %v", ret)
+	}
+	t.Cleanup(func() { nvmllib.Shutdown() })
+	r := resource.NewResource("*", "gpu", "nvidia.com")
+	dmp, _, err := device.NewDeviceMap(nvmllib, []*resource.Resource{r}, resource.MigStrategyNone, device.Filter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := dmp[string(r.Name)]
+	plugin, err := NewNvidiaDevicePlugin(r.Name, devices, nvmllib, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按GPU索引排列的UUID
+	uuids := make([]string, len(devices))
+	for _, d := range devices {
+		i, err := strconv.Atoi(d.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uuids[i] = d.ID
+	}
+	return plugin, uuids, nvmllib
+}
+
+// 推荐分配优先选择同一PCIe交换机或NUMA节点下的GPU
+func TestPreferredAllocationTopology(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		required []int
+		size     int
+		want     [][]int
+	}{
+		{"same NUMA node", "pcie-t4.yml", nil, 2, [][]int{{0, 1}, {2, 3}}},
+		{"NUMA peer of required GPU", "pcie-t4.yml", []int{2}, 2, [][]int{{2, 3}}},
+		{"PCIe switch peer of required GPU", "dgx-a100.yml", []int{4}, 2, [][]int{{4, 5}}},
+		{"one NUMA node", "dgx-a100.yml", []int{0}, 4, [][]int{{0, 1, 2, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin, uuids, _ := topologyPlugin(t, tt.file)
+			var required []string
+			for _, i := range tt.required {
+				required = append(required, uuids[i])
+			}
+			resp, err := plugin.GetPreferredAllocation(context.Background(), &pluginapi.PreferredAllocationRequest{
+				ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{{
+					AvailableDeviceIDs:   uuids,
+					MustIncludeDeviceIDs: required,
+					AllocationSize:       int32(tt.size),
+				}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			index := make(map[string]int)
+			for i, id := range uuids {
+				index[id] = i
+			}
+			var got []int
+			for _, id := range resp.ContainerResponses[0].DeviceIDs {
+				got = append(got, index[id])
+			}
+			sort.Ints(got)
+			for _, want := range tt.want {
+				if slices.Equal(got, want) {
+					return
+				}
+			}
+			t.Fatalf("got GPUs %v, want one of %v", got, tt.want)
+		})
+	}
+}
+
+// GPU之间的连接在创建插件时读取，推荐分配和外部策略请求不再访问NVML
+func TestDeviceLinksCached(t *testing.T) {
+	plugin, uuids, nvmllib := topologyPlugin(t, "dgx-a100.yml")
+	enumerations := len(nvmllib.DeviceGetCountCalls())
+	for i := 0; i < 3; i++ {
+		if _, err := plugin.getPreferredAllocation(uuids, nil, 2); err != nil {
+			t.Fatal(err)
+		}
+		req := plugin.policyRequest(uuids, nil, 2)
+		// 8块GPU两两之间都有NVLink
+		if links := len(req.Available[0].Links); links < 7 {
+			t.Fatalf("GPU 0 has %d peer links, want at least 7", links)
+		}
+	}
+	if got := len(nvmllib.DeviceGetCountCalls()); got != enumerations {
+		t.Fatalf("allocation enumerated GPUs through NVML %d times", got-enumerations)
+	}
+}
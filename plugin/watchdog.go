@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+)
+
+// VerifyRegistration 检查已注册的插件是否仍被kubelet使用
+// 插件socket被删除，或注册后超过connectTimeout仍没有ListAndWatch连接时，停止插件并记录失败，由管理器按退避时间重试
+func (plugin *NvidiaDevicePlugin) VerifyRegistration(connectTimeout time.Duration) error {
+	status := plugin.Status()
+	if status.State != StateRegistered {
+		return nil
+	}
+	err := plugin.checkRegistration(status, connectTimeout)
+	if err == nil {
+		return nil
+	}
+	l.Logger.Warn("device plugin registration lost", zap.String("resourceName", status.ResourceName), zap.Error(err))
+	if stopErr := plugin.Stop(); stopErr != nil {
+		l.Logger.Error("Failed to stop plugin", zap.String("resourceName", status.ResourceName), zap.Error(stopErr))
+	}
+	plugin.setError(err)
+	return err
+}
+
+// checkRegistration 根据插件socket和ListAndWatch连接判断注册是否有效
+func (plugin *NvidiaDevicePlugin) checkRegistration(status Status, connectTimeout time.Duration) error {
+	if _, err := os.Stat(plugin.socket); err != nil {
+		return fmt.Errorf("plugin socket %s is gone: %w", plugin.socket, err)
+	}
+	if connectTimeout > 0 && !status.Watching && plugin.clock.Since(status.RegisteredAt) > connectTimeout {
+		return fmt.Errorf("kubelet has not called ListAndWatch within %v of registration", connectTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+)
+
+// WebhookPolicy 通过HTTP POST调用外部接口选择推荐分配的设备
+// 请求体为 PolicyRequest，响应体为 {"deviceIDs": [...]}
+type WebhookPolicy struct {
+	url       string
+	tokenFile string
+	client    *http.Client
+}
+
+// webhookResponse 外部接口的响应
+type webhookResponse struct {
+	DeviceIDs []string `json:"deviceIDs"`
+}
+
+// NewWebhookPolicy : 根据配置创建外部策略
+func NewWebhookPolicy(cfg config.AllocationWebhookConfig) (*WebhookPolicy, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("allocationWebhook.url is required for the webhook allocation policy")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in webhook CA %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &WebhookPolicy{
+		url:       cfg.URL,
+		tokenFile: cfg.TokenFile,
+		client:    &http.Client{Timeout: cfg.Timeout, Transport: transport},
+	}, nil
+}
+
+// PreferredAllocation : 调用外部接口获取推荐分配的设备
+func (w *WebhookPolicy) PreferredAllocation(ctx context.Context, req PolicyRequest) ([]string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	// 策略服务可以用请求ID关联插件的日志
+	if id := l.RequestID(ctx); id != "" {
+		httpReq.Header.Set(HeaderRequestID, id)
+	}
+	if w.tokenFile != "" {
+		// 每次请求时重新读取，以支持Secret轮换
+		token, err := os.ReadFile(w.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook token: %w", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var res webhookResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res); err != nil {
+		return nil, fmt.Errorf("error decoding webhook response: %w", err)
+	}
+	return res.DeviceIDs, nil
+}
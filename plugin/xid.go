@@ -0,0 +1,221 @@
+package plugin
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// EventXid GPU发生XID严重错误
+const EventXid = "xid"
+
+// xidWaitTimeout 每次等待XID事件的最长时间（毫秒），超时后检查是否已停止
+const xidWaitTimeout = 5000
+
+// allInstances XID事件不属于某个MIG实例时的实例ID
+const allInstances = 0xFFFFFFFF
+
+var xidEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gpu",
+	Subsystem: "manager",
+	Name:      "xid_events_total",
+	Help:      "Number of XID critical error events by XID and action (unhealthy or ignored).",
+}, []string{"xid", "action"})
+
+// xidDescriptions 常见XID的说明，其它XID只记录错误号
+var xidDescriptions = map[uint64]string{
+	48:  "double bit ECC error",
+	62:  "internal micro-controller halt",
+	63:  "ECC page retirement or row remapping recording event",
+	64:  "ECC page retirement or row remapper recording failure",
+	74:  "NVLink error",
+	79:  "GPU has fallen off the bus",
+	92:  "high single-bit ECC error rate",
+	94:  "contained ECC error",
+	95:  "uncontained ECC error",
+	119: "GSP RPC timeout",
+	120: "GSP error",
+}
+
+// xidReason : XID对应的不健康原因
+func xidReason(xid uint64) HealthReason {
+	message, ok := xidDescriptions[xid]
+	if !ok {
+		message = "critical error"
+	}
+	return HealthReason{Code: HealthReasonXid, Xid: xid, Message: message}
+}
+
+// watchXids : 在所有支持的GPU上注册XID严重错误事件，返回接收事件的通道，停止时关闭
+// 未开启、使用DCGM作为健康状态来源或节点没有NVML、没有GPU支持XID事件时返回nil，XID事件在控制循环中处理
+func (p *PluginManager) watchXids() <-chan nvml.EventData {
+	if !p.deviceHealth.Enabled || !p.deviceHealth.Xids || p.healthBackend == HealthBackendDCGM {
+		return nil
+	}
+	if hasNVML, _ := info.New().HasNvml(); !hasNVML && !simulate.IsSimulated(p.nvmllib) {
+		return nil
+	}
+	eventSet, ret := p.nvmllib.EventSetCreate()
+	if ret != nvml.SUCCESS {
+		l.Logger.Warn("failed to create NVML event set, XID events are not watched", zap.Error(ret))
+		return nil
+	}
+	count, ret := p.nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		l.Logger.Warn("failed to get device count, XID events are not watched", zap.Error(ret))
+		eventSet.Free()
+		return nil
+	}
+	var watched []string
+	for i := 0; i < count; i++ {
+		gpu, ret := p.nvmllib.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			l.Logger.Warn("failed to get device handle for XID events", zap.Int("index", i), zap.Error(ret))
+			continue
+		}
+		uuid, _ := gpu.GetUUID()
+		supported, ret := gpu.GetSupportedEventTypes()
+		if ret != nvml.SUCCESS || supported&nvml.EventTypeXidCriticalError == 0 {
+			l.Logger.Info("GPU does not support XID events", zap.String("uuid", uuid))
+			continue
+		}
+		if ret := gpu.RegisterEvents(nvml.EventTypeXidCriticalError, eventSet); ret != nvml.SUCCESS {
+			l.Logger.Warn("failed to register XID events", zap.String("uuid", uuid), zap.Error(ret))
+			continue
+		}
+		watched = append(watched, uuid)
+	}
+	if len(watched) == 0 {
+		eventSet.Free()
+		return nil
+	}
+	l.Logger.Info("watching XID events", zap.Strings("gpus", watched), zap.Uint64s("ignoredXids", p.deviceHealth.IgnoredXids))
+	events := make(chan nvml.EventData)
+	go func() {
+		defer close(events)
+		defer eventSet.Free()
+		for p.ctx.Err() == nil {
+			e, ret := eventSet.Wait(xidWaitTimeout)
+			switch {
+			case ret == nvml.ERROR_TIMEOUT:
+				continue
+			case ret != nvml.SUCCESS:
+				l.Logger.Warn("failed to wait for XID events", zap.Error(ret))
+				select {
+				case <-p.clock.After(time.Second):
+				case <-p.ctx.Done():
+				}
+				continue
+			case e.EventType != nvml.EventTypeXidCriticalError:
+				continue
+			}
+			select {
+			case events <- e:
+			case <-p.ctx.Done():
+			}
+		}
+	}()
+	return events
+}
+
+// handleXid : 把发生XID错误的GPU上的设备标记为不健康，忽略列表中的XID只记录
+// 错误属于某个MIG实例时只标记该实例上的MIG设备
+func (p *PluginManager) handleXid(e nvml.EventData) {
+	xid := e.EventData
+	uuid, ret := e.Device.GetUUID()
+	if ret != nvml.SUCCESS {
+		l.Logger.Warn("failed to get UUID of the GPU with an XID error", zap.Uint64("xid", xid), zap.Error(ret))
+		return
+	}
+	if slices.Contains(p.deviceHealth.IgnoredXids, xid) {
+		xidEvents.WithLabelValues(strconv.FormatUint(xid, 10), "ignored").Inc()
+		l.Logger.Info("ignoring XID error", zap.String("uuid", uuid), zap.Uint64("xid", xid))
+		return
+	}
+	xidEvents.WithLabelValues(strconv.FormatUint(xid, 10), "unhealthy").Inc()
+	reason := xidReason(xid)
+	l.Logger.Warn("XID error", zap.String("uuid", uuid), zap.Uint64("xid", xid), zap.String("message", reason.Message), zap.Uint32("gpuInstance", e.GpuInstanceId))
+	p.events.Add(DeviceEvent{Time: p.clock.Now(), Type: EventXid, UUID: uuid, Reason: HealthReasonXid, Message: reason.String()})
+	res := HealthResult{Reason: reason}
+	if e.GpuInstanceId != allInstances {
+		res.GpuInstances = []int{int(e.GpuInstanceId)}
+	}
+	p.xids.add(uuid, res)
+	// 检查器取走了提供设备的GPU上的错误，检查了所有这些GPU时剩下的错误属于没有提供设备的GPU，不再保留
+	// 检查被跳过或有设备找不到所属GPU时保留，下次检查时处理
+	if p.triggerHealthCheck(HealthCheckerXid) {
+		clear(p.xids.pending)
+	}
+}
+
+// xidChecker 把收到XID事件的GPU或MIG实例上的设备标记为不健康，只在收到事件时检查，不自动恢复
+// 事件和检查都在管理器的控制循环中处理，不需要加锁
+type xidChecker struct {
+	// pending : 尚未处理的XID错误，键为GPU UUID
+	pending map[string][]HealthResult
+}
+
+// newXidChecker 创建XID检查器
+func newXidChecker() *xidChecker {
+	return &xidChecker{pending: make(map[string][]HealthResult)}
+}
+
+// add : 记录GPU上发生的XID错误，下一次检查时处理
+func (c *xidChecker) add(uuid string, res HealthResult) {
+	c.pending[uuid] = append(c.pending[uuid], res)
+}
+
+// Name : 检查器名称
+func (c *xidChecker) Name() string {
+	return HealthCheckerXid
+}
+
+// Recoverable : XID严重错误需要重置GPU
+func (c *xidChecker) Recoverable() bool {
+	return false
+}
+
+// Check : 返回GPU上尚未处理的XID错误，多个错误时使用最后一个，影响范围合并
+func (c *xidChecker) Check(_ context.Context, gpu HealthTarget) (HealthResult, error) {
+	pending := c.pending[gpu.UUID]
+	if len(pending) == 0 {
+		return HealthResult{}, nil
+	}
+	delete(c.pending, gpu.UUID)
+	res := HealthResult{Reason: pending[len(pending)-1].Reason}
+	for _, r := range pending {
+		if len(r.GpuInstances) == 0 {
+			res.GpuInstances = nil
+			break
+		}
+		res.GpuInstances = append(res.GpuInstances, r.GpuInstances...)
+	}
+	return res, nil
+}
+
+// onGpuInstance : 设备是否受该GPU实例的错误影响，整块GPU总是受影响，无法确定时视为受影响
+func (p *PluginManager) onGpuInstance(id string, gi int) bool {
+	d, ret := p.attributes.Handle(p.nvmllib, device.AnnotatedID(id).GetID())
+	if ret != nvml.SUCCESS {
+		return true
+	}
+	if isMig, ret := d.IsMigDeviceHandle(); ret != nvml.SUCCESS || !isMig {
+		return true
+	}
+	instance, ret := d.GetGpuInstanceId()
+	if ret != nvml.SUCCESS {
+		return true
+	}
+	return instance == gi
+}
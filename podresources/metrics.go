@@ -0,0 +1,64 @@
+package podresources
+
+import (
+	"context"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Collector 在采集时查询 PodResources 并导出 gpu_allocated 指标
+type Collector struct {
+	client    *Client
+	allocated *prometheus.Desc
+	up        *prometheus.Desc
+}
+
+// NewCollector 创建 PodResources 指标采集器
+func NewCollector(client *Client) *Collector {
+	return &Collector{
+		client: client,
+		allocated: prometheus.NewDesc(
+			"gpu_allocated",
+			"Number of device IDs of a GPU allocated to a container, as reported by the kubelet PodResources API.",
+			[]string{"namespace", "pod", "container", "resource", "uuid"}, nil,
+		),
+		up: prometheus.NewDesc(
+			"gpu_podresources_up",
+			"Whether the last query of the kubelet PodResources API succeeded.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe : prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.allocated
+	ch <- c.up
+}
+
+// Collect : prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	allocations, err := c.client.List(context.Background())
+	if err != nil {
+		l.Logger.Warn("failed to list pod resources", zap.Error(err))
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	type key struct{ namespace, pod, container, resource, uuid string }
+	counts := make(map[key]float64)
+	for _, a := range allocations {
+		for _, id := range a.DeviceIDs {
+			k := key{a.Namespace, a.Pod, a.Container, a.ResourceName, device.AnnotatedID(id).GetID()}
+			counts[k]++
+		}
+	}
+	for k, v := range counts {
+		ch <- prometheus.MustNewConstMetric(c.allocated, prometheus.GaugeValue, v, k.namespace, k.pod, k.container, k.resource, k.uuid)
+	}
+}
@@ -0,0 +1,120 @@
+package podresources
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uppercaveman/k8s-gpu-device-plugin/device"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// DefaultSocket kubelet PodResources 服务的默认socket路径
+const DefaultSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+
+// Allocation 容器已分配的GPU设备
+type Allocation struct {
+	Namespace    string   `json:"namespace"`
+	Pod          string   `json:"pod"`
+	Container    string   `json:"container"`
+	ResourceName string   `json:"resourceName"`
+	DeviceIDs    []string `json:"deviceIDs"`
+	UUIDs        []string `json:"uuids"`
+}
+
+// Client kubelet PodResources 客户端
+type Client struct {
+	socket  string
+	timeout time.Duration
+	prefix  string
+}
+
+// NewClient 创建 PodResources 客户端
+// prefix 为本插件的资源名称前缀，List 只返回该前缀的资源
+func NewClient(socket string, timeout time.Duration, prefix string) *Client {
+	if socket == "" {
+		socket = DefaultSocket
+	}
+	return &Client{
+		socket:  socket,
+		timeout: timeout,
+		prefix:  prefix,
+	}
+}
+
+// List 获取所有容器已分配的GPU设备
+func (c *Client) List(ctx context.Context) ([]Allocation, error) {
+	return c.list(ctx, func(resourceName string) bool {
+		return strings.HasPrefix(resourceName, c.prefix+"/")
+	})
+}
+
+// ListResource 获取所有容器已分配的指定资源的设备，如RDMA设备插件分配的网卡
+func (c *Client) ListResource(ctx context.Context, resourceName string) ([]Allocation, error) {
+	return c.list(ctx, func(name string) bool {
+		return name == resourceName
+	})
+}
+
+// list 获取所有容器已分配的、资源名称满足条件的设备
+func (c *Client) list(ctx context.Context, match func(string) bool) ([]Allocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, c.socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := podresourcesapi.NewPodResourcesListerClient(conn).List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	var allocations []Allocation
+	for _, pod := range resp.GetPodResources() {
+		for _, container := range pod.GetContainers() {
+			for _, devs := range container.GetDevices() {
+				if !match(devs.GetResourceName()) {
+					continue
+				}
+				allocations = append(allocations, Allocation{
+					Namespace:    pod.GetNamespace(),
+					Pod:          pod.GetName(),
+					Container:    container.GetName(),
+					ResourceName: devs.GetResourceName(),
+					DeviceIDs:    devs.GetDeviceIds(),
+					UUIDs:        uniqueUUIDs(devs.GetDeviceIds()),
+				})
+			}
+		}
+	}
+	return allocations, nil
+}
+
+// 去除副本标记后的设备uuid
+func uniqueUUIDs(ids []string) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, id := range device.AnnotatedIDs(ids).GetIDs() {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		res = append(res, id)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,108 @@
+package resource
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NameClaim 一个要对外提供的资源名称及其来源，用于检查名称冲突
+type NameClaim struct {
+	Name ResourceName
+	// Source : 名称的来源，用于错误说明，如 pattern "1g.5gb"
+	Source string
+}
+
+// PluginName 资源对应的插件名称，socket为 [实例ID-]<插件名称>.sock
+// 默认前缀的资源为 nvidia-<名称>，其它前缀为 <前缀>-<名称>，不同前缀的同名资源使用不同的socket
+func (rm ResourceName) PluginName() string {
+	prefix, name := rm.Split()
+	if prefix == "" || prefix == DefaultResourceNamePrefix {
+		return "nvidia-" + name
+	}
+	return prefix + "-" + name
+}
+
+// CheckCollisions 检查资源名称和插件socket是否冲突
+// 不同来源映射到同一资源名称，或不同资源名称映射到同一socket时返回说明冲突来源的错误
+func CheckCollisions(claims []NameClaim) error {
+	byName := make(map[ResourceName][]NameClaim)
+	bySocket := make(map[string][]NameClaim)
+	for _, c := range claims {
+		if err := c.Name.Validate(); err != nil {
+			return fmt.Errorf("invalid resource name from %s: %w", c.Source, err)
+		}
+		byName[c.Name] = append(byName[c.Name], c)
+		bySocket[c.Name.PluginName()] = append(bySocket[c.Name.PluginName()], c)
+	}
+	var errs []string
+	for name, cs := range byName {
+		if len(cs) > 1 {
+			errs = append(errs, fmt.Sprintf("resource name %s is produced by %s", name, describeClaims(cs)))
+		}
+	}
+	for plugin, cs := range bySocket {
+		names := make(map[ResourceName]bool)
+		for _, c := range cs {
+			names[c.Name] = true
+		}
+		if len(names) > 1 {
+			errs = append(errs, fmt.Sprintf("plugin socket %s.sock is shared by %s", plugin, describeClaims(cs)))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("resource name collision: %s", strings.Join(errs, "; "))
+}
+
+// nameRegexp 资源名称中 / 之后部分的合法格式
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// domainRegexp 资源名称前缀的合法格式，与Kubernetes的DNS子域名相同
+var domainRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// maxDomainLength Kubernetes DNS子域名的最大长度
+const maxDomainLength = 253
+
+// Validate 检查资源名称是否为合法的Kubernetes扩展资源名称：<域名>/<名称>，
+// 域名为DNS子域名且不属于 kubernetes.io，名称不超过63个字符
+func (rm ResourceName) Validate() error {
+	prefix, name := rm.Split()
+	if prefix == "" || name == "" {
+		return fmt.Errorf("'%s' must have the form <domain>/<name>", rm)
+	}
+	if err := ValidatePrefix(prefix); err != nil {
+		return fmt.Errorf("'%s': %w", rm, err)
+	}
+	if len(name) > MaxResourceNameLength {
+		return fmt.Errorf("'%s' is longer than %d characters", name, MaxResourceNameLength)
+	}
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("'%s' may only contain alphanumerics, '-', '_' and '.'", rm)
+	}
+	return nil
+}
+
+// ValidatePrefix 检查资源名称前缀是否为DNS子域名且不属于 kubernetes.io
+func ValidatePrefix(prefix string) error {
+	if len(prefix) > maxDomainLength || !domainRegexp.MatchString(prefix) {
+		return fmt.Errorf("'%s' is not a valid DNS subdomain", prefix)
+	}
+	if prefix == "kubernetes.io" || strings.HasSuffix(prefix, ".kubernetes.io") {
+		return fmt.Errorf("'%s' is the reserved kubernetes.io domain", prefix)
+	}
+	return nil
+}
+
+// describeClaims 按来源排序后描述冲突的名称
+func describeClaims(cs []NameClaim) string {
+	var res []string
+	for _, c := range cs {
+		res = append(res, fmt.Sprintf("%s (%s)", c.Name, c.Source))
+	}
+	sort.Strings(res)
+	return strings.Join(res, " and ")
+}
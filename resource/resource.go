@@ -1,12 +1,14 @@
 package resource
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 )
 
 // 资源名称相关的常量
 const (
-	ResourceNamePrefix              = "nvidia.com"
+	DefaultResourceNamePrefix       = "nvidia.com"
 	DefaultSharedResourceNameSuffix = ".shared"
 	MaxResourceNameLength           = 63
 )
@@ -18,6 +20,24 @@ const (
 	MigStrategyMixed  = "mixed"
 )
 
+// 资源模式的类型
+const (
+	// PatternTypeWildcard : * 匹配任意字符，其它字符按原样匹配
+	PatternTypeWildcard = "wildcard"
+	// PatternTypeRegex : Go正则表达式
+	PatternTypeRegex = "regex"
+)
+
+// GPU名称没有匹配任何资源模式时的处理方式
+const (
+	// UnmatchedFail : 返回错误，所有资源都不提供
+	UnmatchedFail = "fail"
+	// UnmatchedSkip : 不提供该GPU并记录警告，其它GPU正常提供
+	UnmatchedSkip = "skip"
+	// UnmatchedDefault : 以默认资源提供该GPU
+	UnmatchedDefault = "default"
+)
+
 // ResourcePattern 用于将资源名称匹配到特定模式
 type ResourcePattern string
 
@@ -27,16 +47,57 @@ type ResourceName string
 type Resource struct {
 	Pattern ResourcePattern
 	Name    ResourceName
+	// regexp 由模式编译的正则表达式，在GPU名称或MIG配置名称的任意位置匹配
+	regexp *regexp.Regexp
+}
+
+// NewResource 创建使用通配符模式的资源，名称未指定前缀时加上 prefix
+func NewResource(pattern, name, prefix string) *Resource {
+	r, _ := NewPatternResource(pattern, PatternTypeWildcard, name, prefix)
+	return r
 }
 
-func NewResource(pattern, name string) *Resource {
-	if !strings.HasPrefix(name, ResourceNamePrefix+"/") {
-		name = ResourceNamePrefix + "/" + name
+// NewPatternResource 创建资源，patternType 为 wildcard（默认）或 regex，正则表达式无效时返回错误
+func NewPatternResource(pattern, patternType, name, prefix string) (*Resource, error) {
+	if !strings.Contains(name, "/") {
+		name = prefix + "/" + name
+	}
+	expr := pattern
+	switch patternType {
+	case "", PatternTypeWildcard:
+		expr = wildCardToRegexp(pattern)
+	case PatternTypeRegex:
+	default:
+		return nil, fmt.Errorf("unknown pattern type %q, expected %s or %s", patternType, PatternTypeWildcard, PatternTypeRegex)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q for resource %s: %w", pattern, name, err)
 	}
 	return &Resource{
 		Pattern: ResourcePattern(pattern),
 		Name:    ResourceName(name),
+		regexp:  re,
+	}, nil
+}
+
+// Matches : GPU产品名称或MIG配置名称是否匹配资源的模式
+func (r *Resource) Matches(name string) bool {
+	return r.regexp.MatchString(name)
+}
+
+// 将通配符模式转换为正则表达式形式
+func wildCardToRegexp(pattern string) string {
+	var result strings.Builder
+	for i, literal := range strings.Split(pattern, "*") {
+		// 将 * 替换为 .*
+		if i > 0 {
+			result.WriteString(".*")
+		}
+		// 在文本中引用任何正则表达式字符
+		result.WriteString(regexp.QuoteMeta(literal))
 	}
+	return result.String()
 }
 
 // 获取资源名称
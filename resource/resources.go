@@ -3,7 +3,9 @@ package resource
 import (
 	"strings"
 
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
 	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/simulate"
 
 	"github.com/NVIDIA/go-nvlib/pkg/nvlib/device"
 	"github.com/NVIDIA/go-nvlib/pkg/nvlib/info"
@@ -11,17 +13,24 @@ import (
 	"go.uber.org/zap"
 )
 
-// 获取资源
-func NewResources(nvmllib nvml.Interface, migStrategy string) []*Resource {
+// 获取资源，资源名称使用 prefix 作为前缀
+// patterns 中配置了资源时按配置匹配，否则整块GPU都使用 gpu 资源，mixed 策略下每种MIG配置使用各自的资源
+func NewResources(nvmllib nvml.Interface, migStrategy, prefix string, patterns config.ResourcesConfig) []*Resource {
 	resources := make([]*Resource, 0)
 	switch migStrategy {
-	case MigStrategyNone:
-		resources = append(resources, NewResource("GPU", "nvidia.com/gpu"))
-	case MigStrategySingle:
-		resources = append(resources, NewResource("GPU", "nvidia.com/gpu"))
+	case MigStrategyNone, MigStrategySingle:
+		if len(patterns.GPUs) > 0 {
+			resources = configuredResources(patterns.GPUs, prefix)
+			// 没有匹配的GPU使用默认资源，放在最后，只匹配其它模式都不匹配的GPU
+			if patterns.Unmatched == UnmatchedDefault {
+				resources = append(resources, NewResource("*", patterns.DefaultName, prefix))
+			}
+			return resources
+		}
+		resources = append(resources, NewResource("*", "gpu", prefix))
 	case MigStrategyMixed:
 		hasNVML, reason := info.New().HasNvml()
-		if !hasNVML {
+		if !hasNVML && !simulate.IsSimulated(nvmllib) {
 			l.Logger.Warn("mig-strategy is only supported with NVML", zap.String("migStrategy", MigStrategyMixed), zap.String("reason", reason))
 			return nil
 		}
@@ -37,6 +46,9 @@ func NewResources(nvmllib nvml.Interface, migStrategy string) []*Resource {
 				l.Logger.Error("failed to shutting down NVML", zap.Error(ret))
 			}
 		}()
+		if len(patterns.MIG) > 0 {
+			return configuredResources(patterns.MIG, prefix)
+		}
 		// 初始化设备库
 		devicelib := device.New(nvmllib)
 		// 遍历MIG配置文件
@@ -46,9 +58,36 @@ func NewResources(nvmllib nvml.Interface, migStrategy string) []*Resource {
 				return nil
 			}
 			resourceName := strings.ReplaceAll("mig-"+mp.String(), "+", ".")
-			resources = append(resources, NewResource(mp.String(), resourceName))
+			resources = append(resources, NewResource(mp.String(), resourceName, prefix))
 			return nil
 		})
 	}
 	return resources
 }
+
+// Names : 资源名称，多个模式提供同一资源时只出现一次，按第一次出现的顺序
+func Names(resources []*Resource) []ResourceName {
+	seen := make(map[ResourceName]bool, len(resources))
+	names := make([]ResourceName, 0, len(resources))
+	for _, r := range resources {
+		if !seen[r.Name] {
+			seen[r.Name] = true
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// configuredResources : 按配置创建资源，配置加载时已校验模式，无效的模式只记录错误并跳过
+func configuredResources(patterns []config.ResourcePatternConfig, prefix string) []*Resource {
+	resources := make([]*Resource, 0, len(patterns))
+	for _, p := range patterns {
+		r, err := NewPatternResource(p.Pattern, p.PatternType, p.Name, prefix)
+		if err != nil {
+			l.Logger.Error("skipping resource with invalid pattern", zap.Error(err))
+			continue
+		}
+		resources = append(resources, r)
+	}
+	return resources
+}
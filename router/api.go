@@ -1,54 +1,536 @@
 package router
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
 
+	"github.com/uppercaveman/k8s-gpu-device-plugin/benchmark"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/feature"
+	selfmiddleware "github.com/uppercaveman/k8s-gpu-device-plugin/middleware"
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/version"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/podresources"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 )
 
 // API :
 type API struct {
 	pluginManager *plugin.PluginManager
+	podResources  *podresources.Client
+	bench         *benchmark.Benchmark
+	readOnly      echo.MiddlewareFunc
+	auth          echo.MiddlewareFunc
 }
 
-// NewAPI : new api
-func NewAPI(pluginManager *plugin.PluginManager) *API {
+// NewAPI : new api，bench 不为空时注册性能分析接口，readOnly 用于只读接口在启用认证时的认证，
+// auth 用于变更类和排查接口的认证和审计，无论是否启用认证都必须认证
+func NewAPI(pluginManager *plugin.PluginManager, podResources *podresources.Client, bench *benchmark.Benchmark, readOnly, auth echo.MiddlewareFunc) *API {
 	return &API{
 		pluginManager: pluginManager,
+		podResources:  podResources,
+		bench:         bench,
+		readOnly:      readOnly,
+		auth:          auth,
 	}
 }
 
 // Router : Router
+// 探针和监控接口不需要认证，其它只读接口在启用 webAuth 时需要认证，变更类和排查接口总是需要认证
 func (a *API) RegistApiRouter(e *echo.Echo) {
 	root := e.Group("")
 	// Version
 	root.GET("/", a.Version)
+	root.GET("/driver", a.Driver)
 	// 监控指标
 	root.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	// 服务健康检查
 	root.GET("/health", a.Health)
-	// 重启服务
-	root.GET("/restart", a.Restart)
+	// 就绪检查，所有插件都已向kubelet注册时返回200
+	root.GET("/ready", a.Ready)
+	// 期望提供的资源与已注册、kubelet已收到的资源对比，全部一致时返回200
+	root.GET("/status", a.Status)
+	// 异步重启插件，返回重启任务
+	root.POST("/restart", a.Restart, a.auth)
+	// 最近的重启任务
+	root.GET("/restart", a.RestartJobs, a.readOnly)
+	// 重启任务进度
+	root.GET("/restart/:id", a.RestartJob, a.readOnly)
+	// 插件运行状态
+	root.GET("/plugins", a.Plugins, a.readOnly)
+	// 容器已分配的GPU设备
+	root.GET("/podresources", a.PodResources, a.readOnly)
+	// 共享GPU的占用情况
+	root.GET("/ledger", a.Ledger, a.readOnly)
+	// 设备清单和健康状态
+	root.GET("/inventory", a.Inventory, a.readOnly)
+	// 对外提供的设备和被过滤的设备
+	root.GET("/devices", a.Devices, a.readOnly)
+	// 设备属性缓存的使用情况，清空后重新查询NVML
+	root.GET("/devices/cache", a.DeviceCache, a.readOnly)
+	root.DELETE("/devices/cache", a.InvalidateDeviceCache, a.auth)
+	// 排空GPU，停止向其调度新的Pod，用于维护单块GPU
+	root.POST("/devices/:uuid/drain", a.Drain, a.auth)
+	// 恢复被排空的GPU
+	root.POST("/devices/:uuid/undrain", a.Undrain, a.auth)
+	// 正在使用GPU或MIG设备的进程及其所在的容器
+	root.GET("/devices/:uuid/processes", a.DeviceProcesses, a.auth)
+	// 被排空的GPU
+	root.GET("/drains", a.Drains, a.readOnly)
+	// 节点GPU维护，维护期间所有设备不健康并拒绝新的分配，用于驱动升级等不需要cordon节点的维护
+	root.GET("/maintenance", a.Maintenance, a.readOnly)
+	root.POST("/maintenance/enter", a.EnterMaintenance, a.auth)
+	root.POST("/maintenance/exit", a.ExitMaintenance, a.auth)
+	// DCGM健康监控和诊断结果，healthBackend 为 dcgm 时有效
+	root.GET("/dcgm", a.DCGM, a.readOnly)
+	root.GET("/checkpoint", a.Checkpoint, a.readOnly)
+	// 各资源的物理设备数和可调度单元数
+	root.GET("/capacity", a.Capacity, a.readOnly)
+	// 每个GPU的显存分块分配情况
+	root.GET("/gpumemory", a.GPUMemory, a.readOnly)
+	// GPU模式设置与期望状态的差异
+	root.GET("/drift", a.Drift, a.readOnly)
+	// 设备隔离、恢复和模式漂移事件
+	root.GET("/events", a.Events, a.readOnly)
+	// 特性开关及成熟度
+	root.GET("/features", a.Features, a.readOnly)
+	// 运行日志等级，修改后立即生效，重启后恢复为配置的等级
+	root.GET("/loglevel", a.LogLevel, a.readOnly)
+	root.PUT("/loglevel", a.SetLogLevel, a.auth)
+	// 排查信息，包含日志、配置和进程等内部信息，未启用 webAuth 时也必须认证
+	debug := root.Group("/debug", a.auth)
+	// 合并默认值后的运行配置和设备发现快照，以JSON文件下载，用于附加到问题报告
+	debug.GET("/config", a.DebugConfig)
+	debug.GET("/snapshot", a.DebugSnapshot)
+	debug.GET("/support-bundle", a.SupportBundle)
+	// 性能分析
+	if a.bench != nil {
+		debug.GET("/bench", a.BenchStatus)
+		debug.POST("/bench/start", a.BenchStart)
+		debug.POST("/bench/stop", a.BenchStop)
+		debug.GET("/bench/profiles/:name", a.BenchProfile)
+		debug.POST("/bench/allocation", a.BenchAllocation)
+		debug.GET("/pprof/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+		debug.GET("/pprof/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+		debug.GET("/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+		debug.GET("/pprof/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+		debug.GET("/pprof/*", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	}
+}
+
+// DebugConfig : 去除认证信息后的运行配置
+func (a *API) DebugConfig(c echo.Context) error {
+	cfg, err := a.pluginManager.EffectiveConfig()
+	if err != nil {
+		return util.InternalError(err)
+	}
+	return attachment(c, "config", cfg)
+}
+
+// DebugSnapshot : 设备发现结果、资源、插件状态、共享展开及插件和NVML版本
+func (a *API) DebugSnapshot(c echo.Context) error {
+	s, err := a.pluginManager.DebugSnapshot()
+	if err != nil {
+		return util.InternalError(err)
+	}
+	return attachment(c, "snapshot", s)
+}
+
+// SupportBundle : 日志末尾、运行配置、设备发现快照、NVML查询结果和最近的设备事件打包的 tar.gz，
+// 启用 benchmark 且已生成性能分析文件时一并打包，用于附加到问题报告
+func (a *API) SupportBundle(c echo.Context) error {
+	var files []plugin.SupportBundleFile
+	if a.bench != nil {
+		for _, name := range a.bench.Status().Profiles {
+			if path, err := a.bench.ProfilePath(name); err == nil {
+				files = append(files, plugin.SupportBundleFile{Name: "profiles/" + name, Path: path})
+			}
+		}
+	}
+	file := fmt.Sprintf("k8s-gpu-device-plugin-support-bundle-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	c.Response().Header().Set(echo.HeaderContentType, "application/gzip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", file))
+	c.Response().WriteHeader(http.StatusOK)
+	// 响应头已发送，打包失败时只能记录日志
+	if err := a.pluginManager.WriteSupportBundle(c.Response(), files); err != nil {
+		l.FromContext(c.Request().Context()).Error("failed to write support bundle", zap.Error(err))
+	}
+	return nil
+}
+
+// attachment : 以带时间的JSON文件下载
+func attachment(c echo.Context, name string, v interface{}) error {
+	file := fmt.Sprintf("k8s-gpu-device-plugin-%s-%s.json", name, time.Now().UTC().Format("20060102T150405Z"))
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", file))
+	return c.JSONPretty(http.StatusOK, v, "  ")
+}
+
+// DCGM : DCGM健康监控发现的问题和最近一次诊断结果
+func (a *API) DCGM(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.DCGMStatus()))
+}
+
+// Driver : 驱动版本及是否满足 driverPolicy
+func (a *API) Driver(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.DriverCompatibility()))
 }
 
 // Version : 版本信息
 func (a *API) Version(c echo.Context) error {
-	return c.JSON(http.StatusOK, util.Success("version : "+version.Version))
+	return c.JSON(http.StatusOK, util.Success(version.Get(a.pluginManager.DriverVersions())))
 }
 
-// Health : 健康检查
+// Health : 健康检查，降级时返回503，可用作DaemonSet的就绪探针
+// 错误类型取第一个失败的检查项：NVML为nvml_error，kubelet为kubelet_error，其它为not_ready
 func (a *API) Health(c echo.Context) error {
-	return c.JSON(http.StatusOK, util.Success("ok"))
+	report := a.pluginManager.Health()
+	if report.Healthy {
+		return c.JSON(http.StatusOK, util.Success(report))
+	}
+	apiErr := util.NotReadyError("degraded")
+	for _, check := range report.Checks {
+		if check.Healthy {
+			continue
+		}
+		switch check.Name {
+		case plugin.HealthCheckNvml:
+			apiErr = util.NVMLError("degraded", nil)
+		case plugin.HealthCheckKubelet:
+			apiErr = util.NewError(http.StatusServiceUnavailable, util.ErrorTypeKubelet, "degraded", nil)
+		}
+		break
+	}
+	resp := util.ErrorResponse(apiErr, selfmiddleware.GetRequestID(c))
+	resp.Data = report
+	return c.JSON(apiErr.Status, resp)
+}
+
+// Ready : 就绪检查，仍有插件未向kubelet注册时返回503，可用作DaemonSet的就绪探针
+func (a *API) Ready(c echo.Context) error {
+	readiness := a.pluginManager.Readiness()
+	if !readiness.Ready {
+		resp := util.ErrorResponse(util.NotReadyError("plugins are not registered with kubelet"), selfmiddleware.GetRequestID(c))
+		resp.Data = readiness
+		return c.JSON(http.StatusServiceUnavailable, resp)
+	}
+	return c.JSON(http.StatusOK, util.Success(readiness))
+}
+
+// Status : 期望提供的资源与实际注册、kubelet通过 ListAndWatch 收到的资源对比，用于确认发布后节点已收敛
+// 未收敛时返回503并附带每个资源的对比结果
+func (a *API) Status(c echo.Context) error {
+	convergence := a.pluginManager.Convergence()
+	if !convergence.Converged {
+		resp := util.ErrorResponse(util.NotReadyError("resources have not converged"), selfmiddleware.GetRequestID(c))
+		resp.Data = convergence
+		return c.JSON(http.StatusServiceUnavailable, resp)
+	}
+	return c.JSON(http.StatusOK, util.Success(convergence))
 }
 
-// Restart : 重启服务
+// Restart : 异步重启插件，返回202和重启任务，可通过 /restart/:id 查询进度
+// 可重复的 resource 参数指定只重启这些资源的插件，其它插件保持注册
 func (a *API) Restart(c echo.Context) error {
-	// 重启服务
-	a.pluginManager.Restart()
-	return c.JSON(http.StatusOK, util.Success("ok"))
+	job, err := a.pluginManager.Restart(c.QueryParams()["resource"]...)
+	if err != nil {
+		if errors.Is(err, plugin.ErrUnknownResource) {
+			return util.NotFoundError(err.Error())
+		}
+		return util.InternalError(err)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/restart/"+job.ID)
+	return c.JSON(http.StatusAccepted, util.Success(job))
+}
+
+// RestartJobs : 最近的重启任务
+func (a *API) RestartJobs(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.RestartJobs()))
+}
+
+// RestartJob : 重启任务进度
+func (a *API) RestartJob(c echo.Context) error {
+	job, ok := a.pluginManager.RestartJob(c.Param("id"))
+	if !ok {
+		return util.NotFoundError("restart job not found")
+	}
+	return c.JSON(http.StatusOK, util.Success(job))
+}
+
+// Plugins : 插件运行状态
+func (a *API) Plugins(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.PluginStatuses()))
+}
+
+// PodResources : 容器已分配的GPU设备
+func (a *API) PodResources(c echo.Context) error {
+	if a.podResources == nil {
+		return util.ConfigError("podResources is disabled")
+	}
+	allocations, err := a.podResources.List(c.Request().Context())
+	if err != nil {
+		return util.KubeletError("failed to list pod resources", err)
+	}
+	return c.JSON(http.StatusOK, util.Success(allocations))
+}
+
+// Ledger : 共享GPU的占用情况
+func (a *API) Ledger(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.LedgerClaims()))
+}
+
+// Inventory : 设备清单和健康状态
+func (a *API) Inventory(c echo.Context) error {
+	if !a.pluginManager.Loaded() {
+		return util.NotReadyError("plugins are not started yet")
+	}
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Inventory()))
+}
+
+// Devices : 对外提供的设备和被过滤的设备
+func (a *API) Devices(c echo.Context) error {
+	if !a.pluginManager.Loaded() {
+		return util.NotReadyError("plugins are not started yet")
+	}
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.DeviceList()))
+}
+
+// Drain : 排空GPU，可选的 reason 参数记录排空原因
+func (a *API) Drain(c echo.Context) error {
+	if !a.pluginManager.Loaded() {
+		return util.NotReadyError("plugins are not started yet")
+	}
+	s, err := a.pluginManager.Drain(c.Param("uuid"), c.QueryParam("reason"))
+	if err != nil {
+		if errors.Is(err, plugin.ErrUnknownDevice) {
+			return util.NotFoundError(err.Error())
+		}
+		return util.InternalError(err)
+	}
+	return c.JSON(http.StatusOK, util.Success(s))
+}
+
+// Undrain : 恢复被排空的GPU
+func (a *API) Undrain(c echo.Context) error {
+	if err := a.pluginManager.Undrain(c.Param("uuid")); err != nil {
+		if errors.Is(err, plugin.ErrUnknownDevice) {
+			return util.NotFoundError(err.Error())
+		}
+		return util.InternalError(err)
+	}
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Drains()))
+}
+
+// DeviceCache : 设备属性缓存的有效期、缓存数和命中次数
+func (a *API) DeviceCache(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.AttributeCache()))
+}
+
+// InvalidateDeviceCache : 清空设备属性缓存
+func (a *API) InvalidateDeviceCache(c echo.Context) error {
+	a.pluginManager.InvalidateAttributeCache()
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.AttributeCache()))
+}
+
+// DeviceProcesses : 正在使用GPU或MIG设备的进程、显存占用及所在的容器
+func (a *API) DeviceProcesses(c echo.Context) error {
+	if !a.pluginManager.Loaded() {
+		return util.NotReadyError("plugins are not started yet")
+	}
+	processes, err := a.pluginManager.DeviceProcesses(c.Param("uuid"))
+	if err != nil {
+		if errors.Is(err, plugin.ErrUnknownDevice) {
+			return util.NotFoundError(err.Error())
+		}
+		return util.NVMLError("failed to list GPU processes", err)
+	}
+	return c.JSON(http.StatusOK, util.Success(processes))
+}
+
+// Drains : 被排空的GPU
+func (a *API) Drains(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Drains()))
+}
+
+// Maintenance : 节点是否在GPU维护中
+func (a *API) Maintenance(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Maintenance()))
+}
+
+// EnterMaintenance : 节点进入GPU维护，可选的 reason 参数记录维护原因
+func (a *API) EnterMaintenance(c echo.Context) error {
+	if !a.pluginManager.Loaded() {
+		return util.NotReadyError("plugins are not started yet")
+	}
+	if _, err := a.pluginManager.EnterMaintenance(c.QueryParam("reason")); err != nil {
+		return util.InternalError(err)
+	}
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Maintenance()))
+}
+
+// ExitMaintenance : 节点退出GPU维护
+func (a *API) ExitMaintenance(c echo.Context) error {
+	if err := a.pluginManager.ExitMaintenance(); err != nil {
+		return util.InternalError(err)
+	}
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Maintenance()))
+}
+
+// Events : 设备隔离、恢复和模式漂移事件
+func (a *API) Events(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Events()))
+}
+
+// Capacity : 各资源的物理设备数和可调度单元数，分时共享时两者不同
+func (a *API) Capacity(c echo.Context) error {
+	if !a.pluginManager.Loaded() {
+		return util.NotReadyError("plugins are not started yet")
+	}
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Capacity()))
+}
+
+// GPUMemory : 每个GPU的显存分块分配情况
+func (a *API) GPUMemory(c echo.Context) error {
+	if !a.pluginManager.Loaded() {
+		return util.NotReadyError("plugins are not started yet")
+	}
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.GPUMemory(c.Request().Context())))
+}
+
+// Drift : GPU模式设置与期望状态的差异
+func (a *API) Drift(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.ModeDrifts()))
+}
+
+// Features : 特性开关及成熟度
+func (a *API) Features(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(feature.DefaultGate.States()))
+}
+
+// LogLevel : 当前的日志等级
+func (a *API) LogLevel(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(map[string]string{"level": l.GetLevel()}))
+}
+
+// SetLogLevel : 修改日志等级：debug, info, warn, error
+func (a *API) SetLogLevel(c echo.Context) error {
+	prev := l.GetLevel()
+	if err := l.ChangeLevel(c.QueryParam("level")); err != nil {
+		return util.BadRequestError(fmt.Sprintf("invalid level %q, must be one of debug, info, warn, error", c.QueryParam("level")))
+	}
+	l.FromContext(c.Request().Context()).Warn("log level changed", zap.String("from", prev), zap.String("to", l.GetLevel()))
+	return c.JSON(http.StatusOK, util.Success(map[string]string{"level": l.GetLevel()}))
+}
+
+// BenchStatus : 性能分析状态和可下载的分析文件
+func (a *API) BenchStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.bench.Status()))
+}
+
+// BenchStart : 开始性能分析，duration 参数指定自动停止的时间，为空时运行到调用 /debug/bench/stop 或达到最长时间
+func (a *API) BenchStart(c echo.Context) error {
+	var d time.Duration
+	if s := c.QueryParam("duration"); s != "" {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil || d < 0 {
+			return util.BadRequestError("invalid duration: " + s)
+		}
+	}
+	if err := a.bench.RunFor(d); err != nil {
+		if errors.Is(err, benchmark.ErrRunning) {
+			return util.ConflictError(err.Error())
+		}
+		return util.InternalError(err)
+	}
+	return c.JSON(http.StatusOK, util.Success(a.bench.Status()))
+}
+
+// BenchStop : 停止性能分析并写入分析文件
+func (a *API) BenchStop(c echo.Context) error {
+	if err := a.bench.Stop(); err != nil {
+		if errors.Is(err, benchmark.ErrNotRunning) {
+			return util.ConflictError(err.Error())
+		}
+		return util.InternalError(err)
+	}
+	return c.JSON(http.StatusOK, util.Success(a.bench.Status()))
+}
+
+// BenchProfile : 下载分析文件，分析运行期间不可下载
+func (a *API) BenchProfile(c echo.Context) error {
+	path, err := a.bench.ProfilePath(c.Param("name"))
+	if err != nil {
+		if errors.Is(err, benchmark.ErrRunning) {
+			return util.ConflictError(err.Error())
+		}
+		return util.NotFoundError(err.Error())
+	}
+	return c.Attachment(path, c.Param("name"))
+}
+
+// 分配压测参数的默认值和上限
+const (
+	benchDefaultConcurrency = 8
+	benchDefaultRequests    = 1000
+	benchDefaultGPUs        = 8
+	benchMaxConcurrency     = 256
+	benchMaxRequests        = 100000
+	benchMaxGPUs            = 64
+)
+
+// BenchAllocation : 用模拟GPU以当前的分配策略执行分配压测，返回延迟分位数
+// 参数：concurrency 并发数，requests 分配序列总数，size 每次申请的设备数，gpus 模拟GPU数量
+func (a *API) BenchAllocation(c echo.Context) error {
+	load := benchmark.AllocationLoad{Concurrency: benchDefaultConcurrency, Requests: benchDefaultRequests, Size: 1}
+	gpus := benchDefaultGPUs
+	for _, p := range []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"concurrency", &load.Concurrency, benchMaxConcurrency},
+		{"requests", &load.Requests, benchMaxRequests},
+		{"size", &load.Size, benchMaxGPUs},
+		{"gpus", &gpus, benchMaxGPUs},
+	} {
+		s := c.QueryParam(p.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > p.max {
+			return util.BadRequestError(fmt.Sprintf("invalid %s: %s, must be between 1 and %d", p.name, s, p.max))
+		}
+		*p.value = v
+	}
+	target, err := a.pluginManager.NewBenchmarkPlugin(&config.SimulateConfig{
+		Count:             gpus,
+		ProductName:       "NVIDIA A100-SXM4-40GB",
+		MemoryMiB:         40960,
+		ComputeCapability: "8.0",
+	})
+	if err != nil {
+		return util.InternalError(err)
+	}
+	defer target.Close()
+	ctx := c.Request().Context()
+	report, err := benchmark.RunAllocationLoad(ctx, target, target.Available, load)
+	// 客户端断开时返回已完成部分的结果，参数错误才是请求错误
+	if err != nil && ctx.Err() == nil {
+		return util.BadRequestError(err.Error())
+	}
+	return c.JSON(http.StatusOK, util.Success(report))
+}
+
+// Checkpoint : 最近写入的插件状态检查点
+func (a *API) Checkpoint(c echo.Context) error {
+	return c.JSON(http.StatusOK, util.Success(a.pluginManager.Checkpoint()))
 }
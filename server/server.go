@@ -6,41 +6,73 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/uppercaveman/k8s-gpu-device-plugin/benchmark"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
 	selfmiddleware "github.com/uppercaveman/k8s-gpu-device-plugin/middleware"
 	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/plugin"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/podresources"
 	"github.com/uppercaveman/k8s-gpu-device-plugin/router"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.uber.org/zap"
 )
 
 // Server : http Server
 type Server struct {
-	pluginManager *plugin.PluginManager
-	listenAddress string
-	quitCh        chan struct{}
+	pluginManager   *plugin.PluginManager
+	podResources    *podresources.Client
+	bench           *benchmark.Benchmark
+	listenAddress   string
+	auth            config.WebAuthConfig
+	shutdownTimeout time.Duration
+	tracing         bool
+	quitCh          chan struct{}
 }
 
-// New : new Server
-func New(listenAddress string, pluginManager *plugin.PluginManager) *Server {
+// New : new Server，bench 不为空时提供性能分析接口，tracing 为真时为每个请求创建span
+func New(listenAddress string, shutdownTimeout time.Duration, auth config.WebAuthConfig, pluginManager *plugin.PluginManager, podResources *podresources.Client, bench *benchmark.Benchmark, tracing bool) *Server {
 	return &Server{
-		pluginManager: pluginManager,
-		listenAddress: listenAddress,
-		quitCh:        make(chan struct{}),
+		pluginManager:   pluginManager,
+		podResources:    podResources,
+		bench:           bench,
+		listenAddress:   listenAddress,
+		auth:            auth,
+		shutdownTimeout: shutdownTimeout,
+		tracing:         tracing,
+		quitCh:          make(chan struct{}),
 	}
 }
 
 // Run : 启动http服务
 func (s *Server) Run(ctx context.Context) error {
-	a := router.NewAPI(s.pluginManager)
+	auth, err := selfmiddleware.NewAuthenticator(s.auth)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := auth.TLSConfig()
+	if err != nil {
+		return err
+	}
+	if s.auth.TokenFile == "" && s.auth.ClientCAFile == "" {
+		l.Logger.Warn("neither webAuth.tokenFile nor webAuth.clientCAFile is set, mutating and debug endpoints are unavailable")
+	} else if s.auth.TokenFile != "" && tlsConfig == nil && !s.auth.AllowInsecureTokens {
+		l.Logger.Warn("webAuth.tokenFile is set without certFile and keyFile, bearer tokens are rejected over plain HTTP")
+	}
+	a := router.NewAPI(s.pluginManager, s.podResources, s.bench, auth.ReadOnly(), auth.Required())
 	router.RegistRouter(a.RegistApiRouter)
 
 	e := echo.New()
+	e.HTTPErrorHandler = selfmiddleware.ErrorHandler
+	e.Use(selfmiddleware.RequestID())
 	e.Use(middleware.Recover())
 	e.Use(Cros())
 	e.Use(middleware.Logger())
 	e.Use(selfmiddleware.MetricsMiddleware())
+	if s.tracing {
+		e.Use(selfmiddleware.Tracing())
+	}
 
 	router.StartRouter(e)
 	e.Server.ReadTimeout = 30 * time.Second
@@ -54,6 +86,14 @@ func (s *Server) Run(ctx context.Context) error {
 	}
 	errCh := make(chan error)
 	go func() {
+		if tlsConfig != nil {
+			l.Logger.Info("web server started", zap.Bool("tls", true))
+			e.TLSServer.Addr = s.listenAddress
+			e.TLSServer.ReadTimeout = e.Server.ReadTimeout
+			e.TLSServer.TLSConfig = tlsConfig
+			errCh <- e.StartServer(e.TLSServer)
+			return
+		}
 		l.Logger.Info("web server started")
 		errCh <- e.Start(s.listenAddress)
 	}()
@@ -62,7 +102,12 @@ func (s *Server) Run(ctx context.Context) error {
 	case e := <-errCh:
 		return e
 	case <-ctx.Done():
-		e.Shutdown(ctx)
+		// ctx 已取消，使用新的超时时间等待正在处理的请求完成
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+		if err := e.Shutdown(shutdownCtx); err != nil {
+			l.Logger.Warn("web server shutdown", zap.Error(err))
+		}
 		l.Logger.Info("web server stoped")
 		return nil
 	}
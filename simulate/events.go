@@ -0,0 +1,56 @@
+package simulate
+
+import (
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/NVIDIA/go-nvml/pkg/nvml/mock"
+)
+
+// noInstance XID事件不属于某个MIG实例
+const noInstance = 0xFFFFFFFF
+
+// eventSet 模拟的NVML事件集
+type eventSet struct {
+	mock.EventSet
+	events chan nvml.EventData
+}
+
+func newEventSet() *eventSet {
+	s := &eventSet{events: make(chan nvml.EventData, 64)}
+	s.WaitFunc = func(timeoutms uint32) (nvml.EventData, nvml.Return) {
+		select {
+		case e := <-s.events:
+			return e, nvml.SUCCESS
+		case <-time.After(time.Duration(timeoutms) * time.Millisecond):
+			return nvml.EventData{}, nvml.ERROR_TIMEOUT
+		}
+	}
+	s.FreeFunc = func() nvml.Return {
+		return nvml.SUCCESS
+	}
+	return s
+}
+
+// setEventMockFuncs 模拟XID事件，GPU注册XID事件后立即产生拓扑中配置的XID错误
+func (d *Device) setEventMockFuncs() {
+	d.GetSupportedEventTypesFunc = func() (uint64, nvml.Return) {
+		return nvml.EventTypeXidCriticalError, nvml.SUCCESS
+	}
+	d.RegisterEventsFunc = func(types uint64, set nvml.EventSet) nvml.Return {
+		s, ok := set.(*eventSet)
+		if !ok {
+			return nvml.ERROR_INVALID_ARGUMENT
+		}
+		if types&nvml.EventTypeXidCriticalError == 0 {
+			return nvml.SUCCESS
+		}
+		for _, xid := range d.gpu.Xids {
+			select {
+			case s.events <- nvml.EventData{Device: d, EventType: nvml.EventTypeXidCriticalError, EventData: xid, GpuInstanceId: noInstance, ComputeInstanceId: noInstance}:
+			default:
+			}
+		}
+		return nvml.SUCCESS
+	}
+}
@@ -0,0 +1,622 @@
+package simulate
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/NVIDIA/go-nvml/pkg/nvml/mock"
+	"github.com/google/uuid"
+)
+
+// Server 根据拓扑描述模拟的 nvml.Interface
+type Server struct {
+	mock.Interface
+	mock.ExtendedInterface
+	topology *Topology
+	devices  []*Device
+	// initCount : 与NVML一样按引用计数初始化，关闭次数多于初始化时返回未初始化
+	initMu    sync.Mutex
+	initCount int
+}
+
+// Device 模拟的GPU或MIG设备
+type Device struct {
+	mock.Device
+	server   *Server
+	index    int
+	uuid     string
+	busID    string
+	gpu      GPU
+	nvlinks  []string
+	migs     []*Device
+	parent   *Device
+	profile  migProfile
+	instance *GpuInstance
+	// 模式设置可以在运行时修改，ECC和MIG模式在重置前只修改待生效的值
+	modesMu    sync.Mutex
+	modes      Modes
+	pendingECC bool
+	pendingMig int
+}
+
+// GpuInstance 模拟的MIG GPU实例
+type GpuInstance struct {
+	mock.GpuInstance
+	info    nvml.GpuInstanceInfo
+	profile migProfile
+	compute *ComputeInstance
+}
+
+// ComputeInstance 模拟的MIG计算实例
+type ComputeInstance struct {
+	mock.ComputeInstance
+	info nvml.ComputeInstanceInfo
+}
+
+var _ nvml.Interface = (*Server)(nil)
+var _ nvml.Device = (*Device)(nil)
+var _ nvml.GpuInstance = (*GpuInstance)(nil)
+var _ nvml.ComputeInstance = (*ComputeInstance)(nil)
+
+// NewServer 根据拓扑描述创建模拟的NVML库
+func NewServer(t *Topology) (*Server, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Server{topology: t}
+	for i, gpu := range t.GPUs {
+		d := &Device{
+			server: s,
+			index:  i,
+			uuid:   t.uuid(i),
+			busID:  t.busID(i),
+			gpu:    gpu,
+			modes:  defaultModes,
+		}
+		if gpu.Modes != nil {
+			d.modes = *gpu.Modes
+		}
+		d.pendingECC = d.modes.ECC
+		d.pendingMig = nvml.DEVICE_MIG_DISABLE
+		if gpu.MIG != nil && gpu.MIG.Enabled {
+			d.pendingMig = nvml.DEVICE_MIG_ENABLE
+		}
+		if gpu.MIG != nil {
+			for j, name := range gpu.MIG.Devices {
+				// 拓扑已经校验过，这里不会出错
+				p, _ := parseMigProfile(name)
+				d.migs = append(d.migs, d.newMigDevice(j, p))
+			}
+		}
+		s.devices = append(s.devices, d)
+	}
+	for _, link := range t.NVLinks {
+		for n := 0; n < link.count(); n++ {
+			s.devices[link.From].nvlinks = append(s.devices[link.From].nvlinks, s.devices[link.To].busID)
+			s.devices[link.To].nvlinks = append(s.devices[link.To].nvlinks, s.devices[link.From].busID)
+		}
+	}
+	s.setMockFuncs()
+	for _, d := range s.devices {
+		d.setMockFuncs()
+		for _, mig := range d.migs {
+			mig.setMigMockFuncs()
+		}
+	}
+	return s, nil
+}
+
+// NewServerFromFile 从拓扑文件创建模拟的NVML库
+func NewServerFromFile(path string) (*Server, error) {
+	t, err := LoadTopology(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(t)
+}
+
+// newMigDevice 创建第j个MIG设备，GPU实例ID与MIG设备索引相同
+func (d *Device) newMigDevice(j int, p migProfile) *Device {
+	mig := &Device{
+		server:  d.server,
+		index:   j,
+		uuid:    fmt.Sprintf("MIG-00000000-0000-0000-%04x-%012x", d.index, j),
+		busID:   d.busID,
+		gpu:     d.gpu,
+		parent:  d,
+		profile: p,
+	}
+	ci := &ComputeInstance{}
+	gi := &GpuInstance{
+		info: nvml.GpuInstanceInfo{
+			Device:    d,
+			Id:        uint32(j),
+			ProfileId: uint32(p.giProfileID),
+		},
+		profile: p,
+		compute: ci,
+	}
+	ci.info = nvml.ComputeInstanceInfo{
+		Device:      d,
+		GpuInstance: gi,
+		Id:          0,
+		ProfileId:   uint32(p.ciProfileID),
+	}
+	gi.setMockFuncs()
+	ci.setMockFuncs()
+	mig.instance = gi
+	return mig
+}
+
+func (s *Server) setMockFuncs() {
+	s.ExtensionsFunc = func() nvml.ExtendedInterface {
+		return s
+	}
+	s.LookupSymbolFunc = func(symbol string) error {
+		return nil
+	}
+	s.InitFunc = func() nvml.Return {
+		s.initMu.Lock()
+		defer s.initMu.Unlock()
+		s.initCount++
+		return nvml.SUCCESS
+	}
+	s.EventSetCreateFunc = func() (nvml.EventSet, nvml.Return) {
+		return newEventSet(), nvml.SUCCESS
+	}
+	s.ShutdownFunc = func() nvml.Return {
+		s.initMu.Lock()
+		defer s.initMu.Unlock()
+		if s.initCount == 0 {
+			return nvml.ERROR_UNINITIALIZED
+		}
+		s.initCount--
+		return nvml.SUCCESS
+	}
+	s.SystemGetDriverVersionFunc = func() (string, nvml.Return) {
+		return s.topology.DriverVersion, nvml.SUCCESS
+	}
+	s.SystemGetNVMLVersionFunc = func() (string, nvml.Return) {
+		return "12." + s.topology.DriverVersion, nvml.SUCCESS
+	}
+	s.SystemGetCudaDriverVersionFunc = func() (int, nvml.Return) {
+		return s.topology.CudaDriverVersion, nvml.SUCCESS
+	}
+	s.DeviceGetCountFunc = func() (int, nvml.Return) {
+		return len(s.devices), nvml.SUCCESS
+	}
+	s.DeviceGetHandleByIndexFunc = func(index int) (nvml.Device, nvml.Return) {
+		if index < 0 || index >= len(s.devices) {
+			return nil, nvml.ERROR_INVALID_ARGUMENT
+		}
+		return s.devices[index], nvml.SUCCESS
+	}
+	s.DeviceGetHandleByUUIDFunc = func(uuid string) (nvml.Device, nvml.Return) {
+		for _, d := range s.devices {
+			if d.uuid == uuid {
+				return d, nvml.SUCCESS
+			}
+			for _, mig := range d.migs {
+				if mig.uuid == uuid {
+					return mig, nvml.SUCCESS
+				}
+			}
+		}
+		return nil, nvml.ERROR_NOT_FOUND
+	}
+	s.DeviceGetHandleByPciBusIdFunc = func(busID string) (nvml.Device, nvml.Return) {
+		for _, d := range s.devices {
+			if d.busID == busID {
+				return d, nvml.SUCCESS
+			}
+		}
+		return nil, nvml.ERROR_NOT_FOUND
+	}
+}
+
+// device 根据UUID查找GPU设备
+func (s *Server) device(uuid string) *Device {
+	for _, d := range s.devices {
+		if d.uuid == uuid {
+			return d
+		}
+	}
+	return nil
+}
+
+// enableState 转换为NVML的开关状态
+func enableState(enabled bool) nvml.EnableState {
+	if enabled {
+		return nvml.FEATURE_ENABLED
+	}
+	return nvml.FEATURE_DISABLED
+}
+
+// thermal 获取GPU的温度和功耗读数
+func (d *Device) thermal() Thermal {
+	if d.gpu.Thermal == nil {
+		return idleThermal
+	}
+	return *d.gpu.Thermal
+}
+
+// performance 获取GPU的时钟、降频原因和PCIe链路读数
+func (d *Device) performance() Performance {
+	if d.gpu.Performance == nil {
+		return idlePerformance
+	}
+	return *d.gpu.Performance
+}
+
+// setMockFuncs 设置GPU设备的模拟函数
+func (d *Device) setMockFuncs() {
+	d.setCommonMockFuncs()
+	d.setEventMockFuncs()
+	d.IsMigDeviceHandleFunc = func() (bool, nvml.Return) {
+		return false, nvml.SUCCESS
+	}
+	d.GetGpuFabricInfoFunc = func() (nvml.GpuFabricInfo, nvml.Return) {
+		if d.gpu.Fabric == nil {
+			return nvml.GpuFabricInfo{}, nvml.ERROR_NOT_SUPPORTED
+		}
+		info := nvml.GpuFabricInfo{
+			Status:      uint32(nvml.SUCCESS),
+			PartitionId: d.gpu.Fabric.CliqueID,
+			State:       nvml.GPU_FABRIC_STATE_COMPLETED,
+		}
+		id := uuid.MustParse(d.gpu.Fabric.ClusterUUID)
+		for i, b := range id {
+			info.ClusterUuid[i] = int8(b)
+		}
+		return info, nvml.SUCCESS
+	}
+	d.GetIndexFunc = func() (int, nvml.Return) {
+		return d.index, nvml.SUCCESS
+	}
+	d.GetMinorNumberFunc = func() (int, nvml.Return) {
+		return d.index, nvml.SUCCESS
+	}
+	d.GetMemoryInfoFunc = func() (nvml.Memory, nvml.Return) {
+		total := d.gpu.MemoryMiB * 1024 * 1024
+		return nvml.Memory{Total: total, Free: total}, nvml.SUCCESS
+	}
+	d.GetMemoryAffinityFunc = func(nodeSetSize int, scope nvml.AffinityScope) ([]uint, nvml.Return) {
+		return nodeSet(d.gpu.NumaNode, nodeSetSize)
+	}
+	d.GetCpuAffinityFunc = func(cpuSetSize int) ([]uint, nvml.Return) {
+		return nil, nvml.ERROR_NOT_SUPPORTED
+	}
+	d.GetTotalEccErrorsFunc = func(errorType nvml.MemoryErrorType, counterType nvml.EccCounterType) (uint64, nvml.Return) {
+		if errorType != nvml.MEMORY_ERROR_TYPE_UNCORRECTED || d.gpu.Faults == nil {
+			return 0, nvml.SUCCESS
+		}
+		return d.gpu.Faults.UncorrectableECCErrors, nvml.SUCCESS
+	}
+	d.GetRetiredPagesPendingStatusFunc = func() (nvml.EnableState, nvml.Return) {
+		if d.gpu.Faults != nil && d.gpu.Faults.RetiredPagesPending {
+			return nvml.FEATURE_ENABLED, nvml.SUCCESS
+		}
+		return nvml.FEATURE_DISABLED, nvml.SUCCESS
+	}
+	d.GetRemappedRowsFunc = func() (int, int, bool, bool, nvml.Return) {
+		if d.gpu.Faults == nil {
+			return 0, 0, false, false, nvml.SUCCESS
+		}
+		return 0, 0, d.gpu.Faults.RowRemapPending, d.gpu.Faults.RowRemapFailure, nvml.SUCCESS
+	}
+	d.GetTemperatureFunc = func(sensor nvml.TemperatureSensors) (uint32, nvml.Return) {
+		if sensor != nvml.TEMPERATURE_GPU {
+			return 0, nvml.ERROR_NOT_SUPPORTED
+		}
+		return d.thermal().TemperatureC, nvml.SUCCESS
+	}
+	d.GetPowerUsageFunc = func() (uint32, nvml.Return) {
+		return d.thermal().PowerWatts * 1000, nvml.SUCCESS
+	}
+	d.GetEnforcedPowerLimitFunc = func() (uint32, nvml.Return) {
+		return d.thermal().PowerLimitWatts * 1000, nvml.SUCCESS
+	}
+	d.GetClockInfoFunc = func(clockType nvml.ClockType) (uint32, nvml.Return) {
+		switch clockType {
+		case nvml.CLOCK_SM:
+			return d.performance().SMClockMHz, nvml.SUCCESS
+		case nvml.CLOCK_MEM:
+			return d.performance().MemoryClockMHz, nvml.SUCCESS
+		}
+		return 0, nvml.ERROR_NOT_SUPPORTED
+	}
+	d.GetCurrentClocksThrottleReasonsFunc = func() (uint64, nvml.Return) {
+		return d.performance().ThrottleReasons, nvml.SUCCESS
+	}
+	d.GetCurrPcieLinkGenerationFunc = func() (int, nvml.Return) {
+		return d.performance().PCIeLinkGen, nvml.SUCCESS
+	}
+	d.GetCurrPcieLinkWidthFunc = func() (int, nvml.Return) {
+		return d.performance().PCIeLinkWidth, nvml.SUCCESS
+	}
+	d.GetMaxPcieLinkGenerationFunc = func() (int, nvml.Return) {
+		return d.performance().PCIeMaxLinkGen, nvml.SUCCESS
+	}
+	d.GetMaxPcieLinkWidthFunc = func() (int, nvml.Return) {
+		return d.performance().PCIeMaxLinkWidth, nvml.SUCCESS
+	}
+	d.GetPcieReplayCounterFunc = func() (int, nvml.Return) {
+		return d.performance().PCIeReplays, nvml.SUCCESS
+	}
+	d.GetEccModeFunc = func() (nvml.EnableState, nvml.EnableState, nvml.Return) {
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		return enableState(d.modes.ECC), enableState(d.pendingECC), nvml.SUCCESS
+	}
+	d.SetEccModeFunc = func(state nvml.EnableState) nvml.Return {
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		d.pendingECC = state == nvml.FEATURE_ENABLED
+		return nvml.SUCCESS
+	}
+	d.GetPersistenceModeFunc = func() (nvml.EnableState, nvml.Return) {
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		return enableState(d.modes.Persistence), nvml.SUCCESS
+	}
+	d.SetPersistenceModeFunc = func(state nvml.EnableState) nvml.Return {
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		d.modes.Persistence = state == nvml.FEATURE_ENABLED
+		return nvml.SUCCESS
+	}
+	d.GetComputeModeFunc = func() (nvml.ComputeMode, nvml.Return) {
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		return computeModes[d.modes.ComputeMode], nvml.SUCCESS
+	}
+	d.SetComputeModeFunc = func(mode nvml.ComputeMode) nvml.Return {
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		for name, m := range computeModes {
+			if m == mode && name != "" {
+				d.modes.ComputeMode = name
+				return nvml.SUCCESS
+			}
+		}
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	d.SetMigModeFunc = func(mode int) (nvml.Return, nvml.Return) {
+		if d.gpu.MIG == nil {
+			return nvml.ERROR_NOT_SUPPORTED, nvml.ERROR_NOT_SUPPORTED
+		}
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		d.pendingMig = mode
+		return nvml.SUCCESS, nvml.ERROR_RESET_REQUIRED
+	}
+	d.GetTopologyCommonAncestorFunc = func(other nvml.Device) (nvml.GpuTopologyLevel, nvml.Return) {
+		// other 可能被 go-nvlib 包装过，通过UUID找到对应的模拟设备
+		uuid, ret := other.GetUUID()
+		if ret != nvml.SUCCESS {
+			return 0, ret
+		}
+		o := d.server.device(uuid)
+		if o == nil {
+			return 0, nvml.ERROR_INVALID_ARGUMENT
+		}
+		switch {
+		case o == d:
+			return nvml.TOPOLOGY_INTERNAL, nvml.SUCCESS
+		case d.gpu.PCIeSwitch != "" && d.gpu.PCIeSwitch == o.gpu.PCIeSwitch:
+			return nvml.TOPOLOGY_SINGLE, nvml.SUCCESS
+		case d.gpu.NumaNode == o.gpu.NumaNode:
+			return nvml.TOPOLOGY_NODE, nvml.SUCCESS
+		default:
+			return nvml.TOPOLOGY_SYSTEM, nvml.SUCCESS
+		}
+	}
+	d.GetNvLinkStateFunc = func(link int) (nvml.EnableState, nvml.Return) {
+		if link < 0 || link >= nvml.NVLINK_MAX_LINKS {
+			return nvml.FEATURE_DISABLED, nvml.ERROR_INVALID_ARGUMENT
+		}
+		if len(d.nvlinks) == 0 {
+			return nvml.FEATURE_DISABLED, nvml.ERROR_NOT_SUPPORTED
+		}
+		if link >= len(d.nvlinks) {
+			return nvml.FEATURE_DISABLED, nvml.SUCCESS
+		}
+		return nvml.FEATURE_ENABLED, nvml.SUCCESS
+	}
+	d.GetNvLinkRemotePciInfoFunc = func(link int) (nvml.PciInfo, nvml.Return) {
+		if link < 0 || link >= len(d.nvlinks) {
+			return nvml.PciInfo{}, nvml.ERROR_INVALID_ARGUMENT
+		}
+		return pciInfo(d.nvlinks[link]), nvml.SUCCESS
+	}
+	d.GetMigModeFunc = func() (int, int, nvml.Return) {
+		if d.gpu.MIG == nil {
+			return 0, 0, nvml.ERROR_NOT_SUPPORTED
+		}
+		mode := nvml.DEVICE_MIG_DISABLE
+		if d.gpu.MIG.Enabled {
+			mode = nvml.DEVICE_MIG_ENABLE
+		}
+		d.modesMu.Lock()
+		defer d.modesMu.Unlock()
+		return mode, d.pendingMig, nvml.SUCCESS
+	}
+	d.GetMaxMigDeviceCountFunc = func() (int, nvml.Return) {
+		if d.gpu.MIG == nil {
+			return 0, nvml.ERROR_NOT_SUPPORTED
+		}
+		return maxMigSlices, nvml.SUCCESS
+	}
+	d.GetMigDeviceHandleByIndexFunc = func(index int) (nvml.Device, nvml.Return) {
+		if index < 0 || index >= maxMigSlices {
+			return nil, nvml.ERROR_INVALID_ARGUMENT
+		}
+		if index >= len(d.migs) {
+			return nil, nvml.ERROR_NOT_FOUND
+		}
+		return d.migs[index], nvml.SUCCESS
+	}
+	d.GetGpuInstanceByIdFunc = func(id int) (nvml.GpuInstance, nvml.Return) {
+		if id < 0 || id >= len(d.migs) {
+			return nil, nvml.ERROR_NOT_FOUND
+		}
+		return d.migs[id].instance, nvml.SUCCESS
+	}
+	d.GetGpuInstanceProfileInfoFunc = func(giProfileID int) (nvml.GpuInstanceProfileInfo, nvml.Return) {
+		if giProfileID < 0 || giProfileID >= nvml.GPU_INSTANCE_PROFILE_COUNT {
+			return nvml.GpuInstanceProfileInfo{}, nvml.ERROR_INVALID_ARGUMENT
+		}
+		// 只支持拓扑中使用到的GPU实例配置文件
+		for _, mig := range d.migs {
+			if mig.profile.giProfileID == giProfileID {
+				return mig.instance.profileInfo(), nvml.SUCCESS
+			}
+		}
+		return nvml.GpuInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+	}
+}
+
+// setMigMockFuncs 设置MIG设备的模拟函数
+func (d *Device) setMigMockFuncs() {
+	d.setCommonMockFuncs()
+	d.IsMigDeviceHandleFunc = func() (bool, nvml.Return) {
+		return true, nvml.SUCCESS
+	}
+	d.GetDeviceHandleFromMigDeviceHandleFunc = func() (nvml.Device, nvml.Return) {
+		return d.parent, nvml.SUCCESS
+	}
+	d.GetGpuInstanceIdFunc = func() (int, nvml.Return) {
+		return int(d.instance.info.Id), nvml.SUCCESS
+	}
+	d.GetComputeInstanceIdFunc = func() (int, nvml.Return) {
+		return int(d.instance.compute.info.Id), nvml.SUCCESS
+	}
+	d.GetMemoryInfoFunc = func() (nvml.Memory, nvml.Return) {
+		total := d.profile.memoryGB * 1024 * 1024 * 1024
+		return nvml.Memory{Total: total, Free: total}, nvml.SUCCESS
+	}
+	d.GetAttributesFunc = func() (nvml.DeviceAttributes, nvml.Return) {
+		return nvml.DeviceAttributes{
+			GpuInstanceSliceCount:     uint32(d.profile.giSlices),
+			ComputeInstanceSliceCount: uint32(d.profile.ciSlices),
+			MemorySizeMB:              d.profile.memoryGB * 1024,
+		}, nvml.SUCCESS
+	}
+}
+
+// setCommonMockFuncs 设置GPU与MIG设备共用的模拟函数
+func (d *Device) setCommonMockFuncs() {
+	d.GetUUIDFunc = func() (string, nvml.Return) {
+		return d.uuid, nvml.SUCCESS
+	}
+	d.GetNameFunc = func() (string, nvml.Return) {
+		if d.parent != nil {
+			return fmt.Sprintf("%s MIG %s", d.gpu.Name, d.profile.name), nvml.SUCCESS
+		}
+		return d.gpu.Name, nvml.SUCCESS
+	}
+	d.GetCudaComputeCapabilityFunc = func() (int, int, nvml.Return) {
+		major, minor, _ := parseComputeCapability(d.gpu.ComputeCapability)
+		return major, minor, nvml.SUCCESS
+	}
+	d.GetPciInfoFunc = func() (nvml.PciInfo, nvml.Return) {
+		return pciInfo(d.busID), nvml.SUCCESS
+	}
+	d.GetComputeRunningProcessesFunc = func() ([]nvml.ProcessInfo, nvml.Return) {
+		return d.processes(false), nvml.SUCCESS
+	}
+	d.GetGraphicsRunningProcessesFunc = func() ([]nvml.ProcessInfo, nvml.Return) {
+		return d.processes(true), nvml.SUCCESS
+	}
+}
+
+// processes 获取GPU上计算或图形上下文的进程
+func (d *Device) processes(graphics bool) []nvml.ProcessInfo {
+	if d.parent != nil {
+		return nil
+	}
+	var res []nvml.ProcessInfo
+	for _, p := range d.gpu.Processes {
+		if p.Graphics == graphics {
+			res = append(res, nvml.ProcessInfo{Pid: p.PID, UsedGpuMemory: p.UsedMemoryMiB * 1024 * 1024})
+		}
+	}
+	return res
+}
+
+func (gi *GpuInstance) setMockFuncs() {
+	gi.GetInfoFunc = func() (nvml.GpuInstanceInfo, nvml.Return) {
+		return gi.info, nvml.SUCCESS
+	}
+	gi.GetComputeInstanceByIdFunc = func(id int) (nvml.ComputeInstance, nvml.Return) {
+		if id != int(gi.compute.info.Id) {
+			return nil, nvml.ERROR_NOT_FOUND
+		}
+		return gi.compute, nvml.SUCCESS
+	}
+	gi.GetComputeInstanceProfileInfoFunc = func(ciProfileID int, ciEngProfileID int) (nvml.ComputeInstanceProfileInfo, nvml.Return) {
+		if ciProfileID < 0 || ciProfileID >= nvml.COMPUTE_INSTANCE_PROFILE_COUNT {
+			return nvml.ComputeInstanceProfileInfo{}, nvml.ERROR_INVALID_ARGUMENT
+		}
+		if ciEngProfileID != nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED {
+			return nvml.ComputeInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+		}
+		for slices, id := range ciProfileIDs {
+			if id == ciProfileID && slices <= gi.profile.giSlices {
+				return nvml.ComputeInstanceProfileInfo{
+					Id:            uint32(id),
+					SliceCount:    uint32(slices),
+					InstanceCount: uint32(gi.profile.giSlices / slices),
+				}, nvml.SUCCESS
+			}
+		}
+		return nvml.ComputeInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+	}
+}
+
+// profileInfo GPU实例对应的配置文件信息
+func (gi *GpuInstance) profileInfo() nvml.GpuInstanceProfileInfo {
+	return nvml.GpuInstanceProfileInfo{
+		Id:            uint32(gi.profile.giProfileID),
+		SliceCount:    uint32(gi.profile.giSlices),
+		InstanceCount: uint32(maxMigSlices / gi.profile.giSlices),
+		MemorySizeMB:  gi.profile.memoryGB * 1024,
+	}
+}
+
+func (ci *ComputeInstance) setMockFuncs() {
+	ci.GetInfoFunc = func() (nvml.ComputeInstanceInfo, nvml.Return) {
+		return ci.info, nvml.SUCCESS
+	}
+}
+
+// pciInfo 根据总线ID构造PCI信息
+func pciInfo(busID string) nvml.PciInfo {
+	var info nvml.PciInfo
+	for i := 0; i < len(busID) && i < len(info.BusId)-1; i++ {
+		info.BusId[i] = int8(busID[i])
+	}
+	return info
+}
+
+// nodeSet 将NUMA节点转换为NVML的节点位图
+func nodeSet(node int, nodeSetSize int) ([]uint, nvml.Return) {
+	if node < 0 {
+		return nil, nvml.ERROR_NOT_SUPPORTED
+	}
+	if node >= nodeSetSize*bits.UintSize {
+		return nil, nvml.ERROR_INSUFFICIENT_SIZE
+	}
+	set := make([]uint, nodeSetSize)
+	set[node/bits.UintSize] |= 1 << uint(node%bits.UintSize)
+	return set, nvml.SUCCESS
+}
+
+// InitCount : 尚未关闭的 Init 次数，所有使用者退出后不为0说明有NVML句柄泄漏
+func (s *Server) InitCount() int {
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	return s.initCount
+}
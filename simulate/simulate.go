@@ -0,0 +1,32 @@
+package simulate
+
+import (
+	"github.com/uppercaveman/k8s-gpu-device-plugin/config"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// New 根据模拟配置创建模拟的NVML库，指定拓扑文件时忽略其它GPU配置
+func New(cfg *config.SimulateConfig) (*Server, error) {
+	if cfg.TopologyFile != "" {
+		return NewServerFromFile(cfg.TopologyFile)
+	}
+	gpu := GPU{
+		Name:              cfg.ProductName,
+		MemoryMiB:         cfg.MemoryMiB,
+		ComputeCapability: cfg.ComputeCapability,
+	}
+	if len(cfg.MigProfiles) > 0 {
+		gpu.MIG = &MIG{
+			Enabled: true,
+			Devices: cfg.MigProfiles,
+		}
+	}
+	return NewServer(NewTopology(cfg.Count, gpu))
+}
+
+// IsSimulated 判断NVML库是否为模拟实现
+func IsSimulated(nvmllib nvml.Interface) bool {
+	_, ok := nvmllib.(*Server)
+	return ok
+}
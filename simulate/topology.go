@@ -0,0 +1,370 @@
+package simulate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// Topology 模拟节点的拓扑描述，包含GPU、NUMA节点、NVLink连接和MIG配置
+type Topology struct {
+	// DriverVersion : 驱动版本
+	DriverVersion string `yaml:"driverVersion"`
+	// CudaDriverVersion : CUDA驱动版本，如 12040
+	CudaDriverVersion int `yaml:"cudaDriverVersion"`
+	// GPUs : GPU列表，下标即GPU索引
+	GPUs []GPU `yaml:"gpus"`
+	// NVLinks : GPU之间的NVLink连接
+	NVLinks []NVLink `yaml:"nvlinks"`
+}
+
+// GPU 模拟GPU的描述
+type GPU struct {
+	// Name : 产品名称，用于匹配资源
+	Name string `yaml:"name"`
+	// UUID : 为空时根据索引生成固定的UUID
+	UUID string `yaml:"uuid"`
+	// MemoryMiB : 显存大小
+	MemoryMiB uint64 `yaml:"memoryMiB"`
+	// ComputeCapability : 计算能力，如 8.0
+	ComputeCapability string `yaml:"computeCapability"`
+	// NumaNode : 所属NUMA节点，小于0表示没有NUMA信息
+	NumaNode int `yaml:"numaNode"`
+	// PCIeSwitch : 所在PCIe交换机，相同交换机下的GPU视为同一交换机直连
+	PCIeSwitch string `yaml:"pcieSwitch"`
+	// PCIBusID : 为空时根据索引生成
+	PCIBusID string `yaml:"pciBusID"`
+	// MIG : MIG配置，为空表示不支持MIG
+	MIG *MIG `yaml:"mig"`
+	// Faults : 模拟的硬件故障，为空表示没有故障
+	Faults *Faults `yaml:"faults"`
+	// Thermal : 模拟的温度和功耗，为空时使用空闲状态的读数
+	Thermal *Thermal `yaml:"thermal"`
+	// Performance : 模拟的时钟、降频原因和PCIe链路状态，为空时使用空闲状态的读数
+	Performance *Performance `yaml:"performance"`
+	// Modes : 模拟的ECC、持久化和计算模式，为空时ECC和持久化开启、计算模式为default
+	Modes *Modes `yaml:"modes"`
+	// Fabric : 多节点NVLink（IMEX）域，为空表示不支持
+	Fabric *Fabric `yaml:"fabric"`
+	// Processes : 模拟正在使用GPU的进程，MIG设备上没有进程
+	Processes []Process `yaml:"processes"`
+	// Xids : 注册XID事件后立即发生的XID错误
+	Xids []uint64 `yaml:"xids"`
+}
+
+// Process 模拟正在使用GPU的进程
+type Process struct {
+	PID uint32 `yaml:"pid"`
+	// UsedMemoryMiB : 进程占用的显存
+	UsedMemoryMiB uint64 `yaml:"usedMemoryMiB"`
+	// Graphics : 是否为图形上下文，默认为计算上下文
+	Graphics bool `yaml:"graphics"`
+}
+
+// Fabric 模拟GPU所在的NVLink fabric，同一 clusterUUID 和 cliqueID 的GPU可以跨节点通过NVLink通信
+type Fabric struct {
+	// ClusterUUID : NVLink域（IMEX域）的UUID
+	ClusterUUID string `yaml:"clusterUUID"`
+	// CliqueID : 域内的clique编号
+	CliqueID uint32 `yaml:"cliqueID"`
+}
+
+// Faults 模拟GPU的ECC和显存行重映射故障
+type Faults struct {
+	// UncorrectableECCErrors : 不可纠正的ECC错误数
+	UncorrectableECCErrors uint64 `yaml:"uncorrectableECCErrors"`
+	// RetiredPagesPending : 是否有等待重启后退役的显存页
+	RetiredPagesPending bool `yaml:"retiredPagesPending"`
+	// RowRemapPending : 是否有等待重置后生效的行重映射
+	RowRemapPending bool `yaml:"rowRemapPending"`
+	// RowRemapFailure : 行重映射是否失败
+	RowRemapFailure bool `yaml:"rowRemapFailure"`
+}
+
+// Thermal 模拟GPU的温度和功耗读数
+type Thermal struct {
+	// TemperatureC : GPU核心温度，单位摄氏度
+	TemperatureC uint32 `yaml:"temperatureC"`
+	// PowerWatts : 当前功耗，单位瓦
+	PowerWatts uint32 `yaml:"powerWatts"`
+	// PowerLimitWatts : 功耗上限，单位瓦
+	PowerLimitWatts uint32 `yaml:"powerLimitWatts"`
+}
+
+// idleThermal 未配置温度和功耗时的读数
+var idleThermal = Thermal{TemperatureC: 35, PowerWatts: 60, PowerLimitWatts: 400}
+
+// Performance 模拟GPU的时钟、降频原因和PCIe链路状态
+type Performance struct {
+	// SMClockMHz : SM时钟
+	SMClockMHz uint32 `yaml:"smClockMHz"`
+	// MemoryClockMHz : 显存时钟
+	MemoryClockMHz uint32 `yaml:"memoryClockMHz"`
+	// ThrottleReasons : NVML的降频原因位，如 0x40 为硬件过热降频
+	ThrottleReasons uint64 `yaml:"throttleReasons"`
+	// PCIeLinkGen : 当前PCIe链路代数，低于 PCIeMaxLinkGen 表示链路降级
+	PCIeLinkGen int `yaml:"pcieLinkGen"`
+	// PCIeLinkWidth : 当前PCIe链路宽度
+	PCIeLinkWidth int `yaml:"pcieLinkWidth"`
+	// PCIeMaxLinkGen : GPU和插槽支持的最高PCIe链路代数
+	PCIeMaxLinkGen int `yaml:"pcieMaxLinkGen"`
+	// PCIeMaxLinkWidth : GPU和插槽支持的最大PCIe链路宽度
+	PCIeMaxLinkWidth int `yaml:"pcieMaxLinkWidth"`
+	// PCIeReplays : PCIe重放计数
+	PCIeReplays int `yaml:"pcieReplays"`
+}
+
+// idlePerformance 未配置时钟和PCIe链路时的读数
+var idlePerformance = Performance{SMClockMHz: 210, MemoryClockMHz: 1215, ThrottleReasons: 1, PCIeLinkGen: 4, PCIeLinkWidth: 16, PCIeMaxLinkGen: 4, PCIeMaxLinkWidth: 16}
+
+// Modes 模拟GPU的模式设置
+type Modes struct {
+	// ECC : 是否开启ECC
+	ECC bool `yaml:"ecc"`
+	// Persistence : 是否开启持久化模式
+	Persistence bool `yaml:"persistence"`
+	// ComputeMode : 计算模式，default、exclusiveProcess 或 prohibited
+	ComputeMode string `yaml:"computeMode"`
+}
+
+// defaultModes 未配置模式时的设置
+var defaultModes = Modes{ECC: true, Persistence: true, ComputeMode: "default"}
+
+// computeModes 计算模式名称与NVML值的映射
+var computeModes = map[string]nvml.ComputeMode{
+	"":                 nvml.COMPUTEMODE_DEFAULT,
+	"default":          nvml.COMPUTEMODE_DEFAULT,
+	"exclusiveProcess": nvml.COMPUTEMODE_EXCLUSIVE_PROCESS,
+	"prohibited":       nvml.COMPUTEMODE_PROHIBITED,
+}
+
+// MIG 模拟GPU的MIG配置
+type MIG struct {
+	// Enabled : 是否开启MIG模式
+	Enabled bool `yaml:"enabled"`
+	// Devices : 已创建的MIG设备，使用配置文件名称，如 1g.5gb、1c.2g.10gb
+	Devices []string `yaml:"devices"`
+}
+
+// NVLink 两个GPU之间的NVLink连接
+type NVLink struct {
+	// From : GPU索引
+	From int `yaml:"from"`
+	// To : GPU索引
+	To int `yaml:"to"`
+	// Links : 连接数量，默认为1
+	Links int `yaml:"links"`
+}
+
+// 生成拓扑时使用的默认驱动版本
+const (
+	defaultDriverVersion     = "550.54.15"
+	defaultCudaDriverVersion = 12040
+)
+
+// migProfile 解析后的MIG配置文件
+type migProfile struct {
+	name        string
+	giProfileID int
+	ciProfileID int
+	giSlices    int
+	ciSlices    int
+	memoryGB    uint64
+}
+
+var migProfileRegexp = regexp.MustCompile(`^(?:(\d+)c\.)?(\d+)g\.(\d+)gb(\+me)?$`)
+
+// LoadTopology 从YAML文件加载拓扑描述
+func LoadTopology(path string) (*Topology, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading topology file: %w", err)
+	}
+	var t Topology
+	if err := v.Unmarshal(&t); err != nil {
+		return nil, fmt.Errorf("error parsing topology file: %w", err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid topology %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// NewTopology 生成由count个相同GPU组成的拓扑，不包含NVLink连接
+func NewTopology(count int, gpu GPU) *Topology {
+	t := &Topology{
+		DriverVersion:     defaultDriverVersion,
+		CudaDriverVersion: defaultCudaDriverVersion,
+	}
+	for i := 0; i < count; i++ {
+		t.GPUs = append(t.GPUs, gpu)
+	}
+	return t
+}
+
+// Validate 检查拓扑描述是否合法
+func (t *Topology) Validate() error {
+	if len(t.GPUs) == 0 {
+		return fmt.Errorf("no GPUs defined")
+	}
+	busIDs := make(map[string]int)
+	for i, gpu := range t.GPUs {
+		if gpu.Name == "" {
+			return fmt.Errorf("GPU %d: name is required", i)
+		}
+		if gpu.MemoryMiB == 0 {
+			return fmt.Errorf("GPU %d: memoryMiB is required", i)
+		}
+		if gpu.Modes != nil {
+			if _, ok := computeModes[gpu.Modes.ComputeMode]; !ok {
+				return fmt.Errorf("GPU %d: invalid compute mode '%s'", i, gpu.Modes.ComputeMode)
+			}
+		}
+		if _, _, err := parseComputeCapability(gpu.ComputeCapability); err != nil {
+			return fmt.Errorf("GPU %d: %w", i, err)
+		}
+		if gpu.Fabric != nil {
+			if _, err := uuid.Parse(gpu.Fabric.ClusterUUID); err != nil {
+				return fmt.Errorf("GPU %d: invalid fabric clusterUUID '%s'", i, gpu.Fabric.ClusterUUID)
+			}
+		}
+		busID := t.busID(i)
+		if j, exists := busIDs[busID]; exists {
+			return fmt.Errorf("GPU %d: PCI bus ID %s already used by GPU %d", i, busID, j)
+		}
+		busIDs[busID] = i
+		if gpu.MIG == nil {
+			continue
+		}
+		if len(gpu.MIG.Devices) > 0 && !gpu.MIG.Enabled {
+			return fmt.Errorf("GPU %d: MIG devices defined but MIG is not enabled", i)
+		}
+		var slices int
+		for _, name := range gpu.MIG.Devices {
+			p, err := parseMigProfile(name)
+			if err != nil {
+				return fmt.Errorf("GPU %d: %w", i, err)
+			}
+			slices += p.giSlices
+		}
+		if slices > maxMigSlices {
+			return fmt.Errorf("GPU %d: MIG devices use %d slices, at most %d are available", i, slices, maxMigSlices)
+		}
+	}
+	links := make([]int, len(t.GPUs))
+	for _, link := range t.NVLinks {
+		if link.From < 0 || link.From >= len(t.GPUs) || link.To < 0 || link.To >= len(t.GPUs) {
+			return fmt.Errorf("NVLink %d-%d: GPU index out of range", link.From, link.To)
+		}
+		if link.From == link.To {
+			return fmt.Errorf("NVLink %d-%d: a GPU cannot link to itself", link.From, link.To)
+		}
+		links[link.From] += link.count()
+		links[link.To] += link.count()
+	}
+	for i, n := range links {
+		if n > nvml.NVLINK_MAX_LINKS {
+			return fmt.Errorf("GPU %d: %d NVLinks defined, at most %d are supported", i, n, nvml.NVLINK_MAX_LINKS)
+		}
+	}
+	return nil
+}
+
+// uuid 获取GPU的UUID，未指定时根据索引生成，保证多次运行结果一致
+func (t *Topology) uuid(i int) string {
+	if t.GPUs[i].UUID != "" {
+		return t.GPUs[i].UUID
+	}
+	return fmt.Sprintf("GPU-00000000-0000-0000-0000-%012x", i)
+}
+
+// busID 获取GPU的PCI总线ID，格式与NVML一致
+func (t *Topology) busID(i int) string {
+	if t.GPUs[i].PCIBusID != "" {
+		return t.GPUs[i].PCIBusID
+	}
+	return fmt.Sprintf("00000000:%02X:00.0", 0x10+i)
+}
+
+func (l NVLink) count() int {
+	if l.Links <= 0 {
+		return 1
+	}
+	return l.Links
+}
+
+// parseComputeCapability 解析 major.minor 形式的计算能力
+func parseComputeCapability(cc string) (int, int, error) {
+	var major, minor int
+	if _, err := fmt.Sscanf(cc, "%d.%d", &major, &minor); err != nil {
+		return 0, 0, fmt.Errorf("invalid compute capability '%s'", cc)
+	}
+	return major, minor, nil
+}
+
+// parseMigProfile 解析MIG配置文件名称
+func parseMigProfile(name string) (migProfile, error) {
+	m := migProfileRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return migProfile{}, fmt.Errorf("invalid MIG profile '%s'", name)
+	}
+	g, _ := strconv.Atoi(m[2])
+	c := g
+	if m[1] != "" {
+		c, _ = strconv.Atoi(m[1])
+	}
+	gb, _ := strconv.ParseUint(m[3], 10, 64)
+	me := m[4] != ""
+
+	p := migProfile{name: name, giSlices: g, ciSlices: c, memoryGB: gb}
+	switch {
+	case g == 1 && me:
+		p.giProfileID = nvml.GPU_INSTANCE_PROFILE_1_SLICE_REV1
+	case g == 2 && me:
+		p.giProfileID = nvml.GPU_INSTANCE_PROFILE_2_SLICE_REV1
+	case me:
+		return migProfile{}, fmt.Errorf("invalid MIG profile '%s': media extensions are only available on 1g and 2g profiles", name)
+	default:
+		id, ok := giProfileIDs[g]
+		if !ok {
+			return migProfile{}, fmt.Errorf("invalid MIG profile '%s': unsupported GPU instance size %dg", name, g)
+		}
+		p.giProfileID = id
+	}
+	id, ok := ciProfileIDs[c]
+	if !ok || c > g {
+		return migProfile{}, fmt.Errorf("invalid MIG profile '%s': unsupported compute instance size %dc", name, c)
+	}
+	p.ciProfileID = id
+	return p, nil
+}
+
+// maxMigSlices 单个GPU最多可划分的GPU实例切片数
+const maxMigSlices = 8
+
+// giProfileIDs GPU实例切片数与NVML配置文件ID的映射
+var giProfileIDs = map[int]int{
+	1: nvml.GPU_INSTANCE_PROFILE_1_SLICE,
+	2: nvml.GPU_INSTANCE_PROFILE_2_SLICE,
+	3: nvml.GPU_INSTANCE_PROFILE_3_SLICE,
+	4: nvml.GPU_INSTANCE_PROFILE_4_SLICE,
+	6: nvml.GPU_INSTANCE_PROFILE_6_SLICE,
+	7: nvml.GPU_INSTANCE_PROFILE_7_SLICE,
+	8: nvml.GPU_INSTANCE_PROFILE_8_SLICE,
+}
+
+// ciProfileIDs 计算实例切片数与NVML配置文件ID的映射
+var ciProfileIDs = map[int]int{
+	1: nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE,
+	2: nvml.COMPUTE_INSTANCE_PROFILE_2_SLICE,
+	3: nvml.COMPUTE_INSTANCE_PROFILE_3_SLICE,
+	4: nvml.COMPUTE_INSTANCE_PROFILE_4_SLICE,
+	6: nvml.COMPUTE_INSTANCE_PROFILE_6_SLICE,
+	7: nvml.COMPUTE_INSTANCE_PROFILE_7_SLICE,
+	8: nvml.COMPUTE_INSTANCE_PROFILE_8_SLICE,
+}
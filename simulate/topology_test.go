@@ -0,0 +1,83 @@
+package simulate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// 随代码提供的拓扑文件都能加载，NVML报告的GPU、MIG设备、NVLink和fabric与文件描述一致
+func TestTopologyFiles(t *testing.T) {
+	tests := []struct {
+		file string
+		gpus int
+		// migs : 每块GPU上的MIG设备数
+		migs []int
+		// nvlinks : GPU 0 开启的NVLink数
+		nvlinks int
+		// numa : 每块GPU所在的NUMA节点
+		numa   []int
+		clique uint32
+	}{
+		{"dgx-a100.yml", 8, nil, 14, []int{0, 0, 0, 0, 1, 1, 1, 1}, 0},
+		{"pcie-t4.yml", 4, nil, 0, []int{0, 0, 1, 1}, 0},
+		{"a100-mig.yml", 2, []int{4, 1}, 1, []int{0, 0}, 0},
+		{"gb200-nvl.yml", 4, nil, 0, []int{0, 0, 1, 1}, 32766},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			s, err := NewServerFromFile(filepath.Join("topologies", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ret := s.Init(); ret != nvml.SUCCESS {
+				t.Fatalf("init: %v", ret)
+			}
+			defer s.Shutdown()
+			count, ret := s.DeviceGetCount()
+			if ret != nvml.SUCCESS || count != tt.gpus {
+				t.Fatalf("got %d GPUs (%v), want %d", count, ret, tt.gpus)
+			}
+			for i := 0; i < count; i++ {
+				d, _ := s.DeviceGetHandleByIndex(i)
+				// 测试的节点都只有两个NUMA节点
+				set, ret := d.GetMemoryAffinity(1, nvml.AFFINITY_SCOPE_NODE)
+				if ret != nvml.SUCCESS || set[0] != 1<<uint(tt.numa[i]) {
+					t.Errorf("GPU %d: memory affinity %v (%v), want NUMA node %d", i, set, ret, tt.numa[i])
+				}
+				migs := 0
+				for j := 0; ; j++ {
+					if _, ret := d.GetMigDeviceHandleByIndex(j); ret != nvml.SUCCESS {
+						break
+					}
+					migs++
+				}
+				want := 0
+				if tt.migs != nil {
+					want = tt.migs[i]
+				}
+				if migs != want {
+					t.Errorf("GPU %d: %d MIG devices, want %d", i, migs, want)
+				}
+				info, ret := d.GetGpuFabricInfo()
+				switch {
+				case tt.clique == 0 && ret != nvml.ERROR_NOT_SUPPORTED:
+					t.Errorf("GPU %d: unexpected fabric info %v", i, ret)
+				case tt.clique != 0 && (ret != nvml.SUCCESS || info.PartitionId != tt.clique):
+					t.Errorf("GPU %d: clique %d (%v), want %d", i, info.PartitionId, ret, tt.clique)
+				}
+			}
+			gpu0, _ := s.DeviceGetHandleByIndex(0)
+			nvlinks := 0
+			for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+				if state, ret := gpu0.GetNvLinkState(link); ret == nvml.SUCCESS && state == nvml.FEATURE_ENABLED {
+					nvlinks++
+				}
+			}
+			if nvlinks != tt.nvlinks {
+				t.Errorf("GPU 0: %d NVLinks, want %d", nvlinks, tt.nvlinks)
+			}
+		})
+	}
+}
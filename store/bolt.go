@@ -0,0 +1,200 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bbolt后端的数据库文件名和顶层bucket的前缀
+const (
+	boltFileName     = "state.db"
+	boltBucketPrefix = "bucket:"
+	boltStreamPrefix = "stream:"
+)
+
+// boltOpenTimeout 等待数据库文件锁的时间，另一个插件进程占用数据库时打开失败而不是一直阻塞
+const boltOpenTimeout = 5 * time.Second
+
+// boltStore 基于bbolt的单文件存储，每个bucket和stream是一个顶层bucket
+// stream中的记录以递增序号为键，按追加顺序保存
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBolt(opts Options) (Store, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("storage directory is required")
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %w", err)
+	}
+	db, err := bolt.Open(filepath.Join(opts.Dir, boltFileName), 0644, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (b *boltStore) Get(bucket, key string) (json.RawMessage, error) {
+	var value json.RawMessage
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(boltBucketPrefix + bucket))
+		if bkt == nil {
+			return ErrNotFound
+		}
+		v := bkt.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		// bbolt返回的切片只在事务内有效
+		value = append(json.RawMessage(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+func (b *boltStore) Put(bucket, key string, value json.RawMessage) error {
+	if err := validName(bucket); err != nil {
+		return err
+	}
+	if err := validValue(value); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(boltBucketPrefix + bucket))
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(key), value)
+	})
+}
+
+func (b *boltStore) Delete(bucket, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(boltBucketPrefix + bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.Delete([]byte(key))
+	})
+}
+
+func (b *boltStore) Keys(bucket string) ([]string, error) {
+	keys := make([]string, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(boltBucketPrefix + bucket))
+		if bkt == nil {
+			return nil
+		}
+		// bbolt按字节序遍历键，结果已排序
+		return bkt.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func (b *boltStore) Append(stream string, data json.RawMessage) error {
+	if err := validName(stream); err != nil {
+		return err
+	}
+	if err := validValue(data); err != nil {
+		return err
+	}
+	value, err := json.Marshal(Record{Time: time.Now(), Data: data})
+	if err != nil {
+		return fmt.Errorf("error encoding record: %w", err)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(boltStreamPrefix + stream))
+		if err != nil {
+			return err
+		}
+		seq, err := bkt.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bkt.Put(boltSequenceKey(seq), value)
+	})
+}
+
+func (b *boltStore) Records(stream string, t time.Time) ([]Record, error) {
+	if err := validName(stream); err != nil {
+		return nil, err
+	}
+	var records []Record
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		records, err = boltRecords(tx.Bucket([]byte(boltStreamPrefix + stream)))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading stream %s: %w", stream, err)
+	}
+	return since(records, t), nil
+}
+
+func (b *boltStore) Compact(retention Retention) error {
+	now := time.Now()
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bkt *bolt.Bucket) error {
+			if !strings.HasPrefix(string(name), boltStreamPrefix) {
+				return nil
+			}
+			records, err := boltRecords(bkt)
+			if err != nil {
+				return fmt.Errorf("error reading stream %s: %w", strings.TrimPrefix(string(name), boltStreamPrefix), err)
+			}
+			// 保留的记录是末尾的一段，删除之前的记录
+			// 遍历时删除会使游标跳过记录，先取出要删除的键
+			expired := len(records) - len(retain(records, retention, now))
+			keys := make([][]byte, 0, expired)
+			c := bkt.Cursor()
+			for k, _ := c.First(); k != nil && len(keys) < expired; k, _ = c.Next() {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			for _, k := range keys {
+				if err := bkt.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
+
+// boltRecords : 按追加顺序读取stream中的所有记录，stream不存在时返回空
+func boltRecords(bkt *bolt.Bucket) ([]Record, error) {
+	if bkt == nil {
+		return nil, nil
+	}
+	var records []Record
+	err := bkt.ForEach(func(_, v []byte) error {
+		var r Record
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		records = append(records, r)
+		return nil
+	})
+	return records, err
+}
+
+// boltSequenceKey : 大端序的记录序号，使键的字节序与追加顺序一致
+func boltSequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+	"github.com/uppercaveman/k8s-gpu-device-plugin/modules/util"
+
+	"go.uber.org/zap"
+)
+
+// 文件后端的文件后缀
+const (
+	bucketFileSuffix = ".json"
+	streamFileSuffix = ".jsonl"
+)
+
+// fileStore 基于目录的存储，每个bucket是一个JSON文件（原子替换），每个stream是一个JSON Lines文件（追加写入）
+type fileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func openFile(opts Options) (Store, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("storage directory is required")
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %w", err)
+	}
+	return &fileStore{dir: opts.Dir}, nil
+}
+
+func (f *fileStore) Get(bucket, key string) (json.RawMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values, err := f.readBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (f *fileStore) Put(bucket, key string, value json.RawMessage) error {
+	if err := validValue(value); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values, err := f.readBucket(bucket)
+	if err != nil {
+		return err
+	}
+	values[key] = value
+	return f.writeBucket(bucket, values)
+}
+
+func (f *fileStore) Delete(bucket, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values, err := f.readBucket(bucket)
+	if err != nil {
+		return err
+	}
+	if _, ok := values[key]; !ok {
+		return nil
+	}
+	delete(values, key)
+	return f.writeBucket(bucket, values)
+}
+
+func (f *fileStore) Keys(bucket string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values, err := f.readBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (f *fileStore) Append(stream string, data json.RawMessage) error {
+	if err := validName(stream); err != nil {
+		return err
+	}
+	if err := validValue(data); err != nil {
+		return err
+	}
+	line, err := json.Marshal(Record{Time: time.Now(), Data: data})
+	if err != nil {
+		return fmt.Errorf("error encoding record: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path(stream, streamFileSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening stream %s: %w", stream, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error appending to stream %s: %w", stream, err)
+	}
+	return nil
+}
+
+func (f *fileStore) Records(stream string, t time.Time) ([]Record, error) {
+	if err := validName(stream); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	records, err := f.readStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	return since(records, t), nil
+}
+
+func (f *fileStore) Compact(retention Retention) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(f.dir, "*"+streamFileSuffix))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var errs []error
+	for _, p := range paths {
+		stream := strings.TrimSuffix(filepath.Base(p), streamFileSuffix)
+		records, err := f.readStream(stream)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		kept := retain(records, retention, now)
+		if len(kept) == len(records) {
+			continue
+		}
+		var data []byte
+		for _, r := range kept {
+			line, err := json.Marshal(r)
+			if err != nil {
+				return fmt.Errorf("error encoding record: %w", err)
+			}
+			data = append(append(data, line...), '\n')
+		}
+		if err := util.WriteFileAtomic(p, data, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("error compacting stream %s: %w", stream, err))
+			continue
+		}
+		l.Logger.Debug("compacted storage stream", zap.String("stream", stream), zap.Int("removed", len(records)-len(kept)))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fileStore) Close() error {
+	return nil
+}
+
+// path stream或bucket的文件路径
+func (f *fileStore) path(name, suffix string) string {
+	return filepath.Join(f.dir, name+suffix)
+}
+
+// readBucket 读取bucket文件，文件不存在时返回空
+func (f *fileStore) readBucket(bucket string) (map[string]json.RawMessage, error) {
+	if err := validName(bucket); err != nil {
+		return nil, err
+	}
+	values := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(f.path(bucket, bucketFileSuffix))
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading bucket %s: %w", bucket, err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("error parsing bucket %s: %w", bucket, err)
+	}
+	return values, nil
+}
+
+// writeBucket 原子替换bucket文件
+func (f *fileStore) writeBucket(bucket string, values map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding bucket %s: %w", bucket, err)
+	}
+	if err := util.WriteFileAtomic(f.path(bucket, bucketFileSuffix), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing bucket %s: %w", bucket, err)
+	}
+	return nil
+}
+
+// readStream 读取stream的所有记录，跳过无法解析的行（如写入时崩溃留下的半行）
+func (f *fileStore) readStream(stream string) ([]Record, error) {
+	file, err := os.Open(f.path(stream, streamFileSuffix))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening stream %s: %w", stream, err)
+	}
+	defer file.Close()
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			l.Logger.Warn("skipping corrupt storage record", zap.String("stream", stream), zap.Error(err))
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stream %s: %w", stream, err)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
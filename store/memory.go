@@ -0,0 +1,99 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore 保存在内存中的存储，进程退出后数据丢失，用于测试或不需要持久化的场景
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]json.RawMessage
+	streams map[string][]Record
+}
+
+func openMemory(Options) (Store, error) {
+	return &memoryStore{
+		buckets: make(map[string]map[string]json.RawMessage),
+		streams: make(map[string][]Record),
+	}, nil
+}
+
+func (m *memoryStore) Get(bucket, key string) (json.RawMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append(json.RawMessage(nil), v...), nil
+}
+
+func (m *memoryStore) Put(bucket, key string, value json.RawMessage) error {
+	if err := validName(bucket); err != nil {
+		return err
+	}
+	if err := validValue(value); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[bucket] == nil {
+		m.buckets[bucket] = make(map[string]json.RawMessage)
+	}
+	m.buckets[bucket][key] = append(json.RawMessage(nil), value...)
+	return nil
+}
+
+func (m *memoryStore) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+func (m *memoryStore) Keys(bucket string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.buckets[bucket]))
+	for k := range m.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memoryStore) Append(stream string, data json.RawMessage) error {
+	if err := validName(stream); err != nil {
+		return err
+	}
+	if err := validValue(data); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams[stream] = append(m.streams[stream], Record{Time: time.Now(), Data: append(json.RawMessage(nil), data...)})
+	return nil
+}
+
+func (m *memoryStore) Records(stream string, t time.Time) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return since(m.streams[stream], t), nil
+}
+
+func (m *memoryStore) Compact(retention Retention) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for name, records := range m.streams {
+		m.streams[name] = append([]Record(nil), retain(records, retention, now)...)
+	}
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlite后端的数据库文件名
+const sqliteFileName = "state.sqlite"
+
+// sqliteSchema 键值表和追加型记录表，记录的 time 为UnixNano，按 id 保持追加顺序
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS kv (
+	bucket TEXT NOT NULL,
+	key    TEXT NOT NULL,
+	value  TEXT NOT NULL,
+	PRIMARY KEY (bucket, key)
+);
+CREATE TABLE IF NOT EXISTS records (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	stream TEXT NOT NULL,
+	time   INTEGER NOT NULL,
+	data   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS records_stream ON records (stream, id);
+`
+
+// sqliteStore 基于SQLite的单文件存储，使用WAL日志，适合需要用sqlite3命令行查询审计记录的场景
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLite(opts Options) (Store, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("storage directory is required")
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %w", err)
+	}
+	dsn := "file:" + filepath.Join(opts.Dir, sqliteFileName) + "?_journal_mode=WAL&_busy_timeout=5000&_synchronous=FULL"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite同时只允许一个写入者，使用单个连接避免 database is locked
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating tables: %w", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Get(bucket, key string) (json.RawMessage, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM kv WHERE bucket = ? AND key = ?`, bucket, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(value), nil
+}
+
+func (s *sqliteStore) Put(bucket, key string, value json.RawMessage) error {
+	if err := validName(bucket); err != nil {
+		return err
+	}
+	if err := validValue(value); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO kv (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`, bucket, key, string(value))
+	return err
+}
+
+func (s *sqliteStore) Delete(bucket, key string) error {
+	_, err := s.db.Exec(`DELETE FROM kv WHERE bucket = ? AND key = ?`, bucket, key)
+	return err
+}
+
+func (s *sqliteStore) Keys(bucket string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT key FROM kv WHERE bucket = ? ORDER BY key`, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]string, 0)
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqliteStore) Append(stream string, data json.RawMessage) error {
+	if err := validName(stream); err != nil {
+		return err
+	}
+	if err := validValue(data); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO records (stream, time, data) VALUES (?, ?, ?)`, stream, time.Now().UnixNano(), string(data))
+	if err != nil {
+		return fmt.Errorf("error appending to stream %s: %w", stream, err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Records(stream string, t time.Time) ([]Record, error) {
+	if err := validName(stream); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT time, data FROM records WHERE stream = ? AND time > ? ORDER BY id`, stream, t.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("error reading stream %s: %w", stream, err)
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		var (
+			nanos int64
+			data  string
+		)
+		if err := rows.Scan(&nanos, &data); err != nil {
+			return nil, fmt.Errorf("error reading stream %s: %w", stream, err)
+		}
+		records = append(records, Record{Time: time.Unix(0, nanos), Data: json.RawMessage(data)})
+	}
+	return records, rows.Err()
+}
+
+func (s *sqliteStore) Compact(retention Retention) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if retention.MaxAge > 0 {
+		cutoff := time.Now().Add(-retention.MaxAge).UnixNano()
+		if _, err := tx.Exec(`DELETE FROM records WHERE time <= ?`, cutoff); err != nil {
+			return fmt.Errorf("error removing expired records: %w", err)
+		}
+	}
+	if retention.MaxRecords > 0 {
+		// 每个stream只保留最新的 MaxRecords 条记录
+		_, err := tx.Exec(`DELETE FROM records WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY stream ORDER BY id DESC) AS n FROM records
+			) WHERE n > ?
+		)`, retention.MaxRecords)
+		if err != nil {
+			return fmt.Errorf("error removing excess records: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
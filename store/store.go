@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotFound 键不存在
+var ErrNotFound = errors.New("not found")
+
+// Store 状态和审计记录的持久化接口
+// 状态按 bucket/key 保存，值必须是JSON；审计等追加型记录写入 stream，按保留策略压缩
+type Store interface {
+	// Get 读取键值，不存在时返回 ErrNotFound
+	Get(bucket, key string) (json.RawMessage, error)
+	// Put 写入键值，返回时已持久化
+	Put(bucket, key string, value json.RawMessage) error
+	// Delete 删除键，不存在时不报错
+	Delete(bucket, key string) error
+	// Keys 列出bucket中的所有键，按名称排序
+	Keys(bucket string) ([]string, error)
+	// Append 向stream追加一条记录
+	Append(stream string, data json.RawMessage) error
+	// Records 读取stream中since之后的记录，按时间排序
+	Records(stream string, since time.Time) ([]Record, error)
+	// Compact 按保留策略删除过期记录
+	Compact(retention Retention) error
+	// Close 关闭存储
+	Close() error
+}
+
+// Record stream中的一条记录
+type Record struct {
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Retention 追加型记录的保留策略，字段为0时不限制
+type Retention struct {
+	// MaxAge : 记录的最长保留时间
+	MaxAge time.Duration
+	// MaxRecords : 每个stream最多保留的记录数
+	MaxRecords int
+}
+
+// Options 打开存储的参数
+type Options struct {
+	// Dir : 数据目录，file、bbolt、sqlite 后端使用
+	Dir string
+}
+
+// OpenFunc 创建存储后端
+type OpenFunc func(opts Options) (Store, error)
+
+// 内置的存储后端
+const (
+	BackendFile   = "file"
+	BackendMemory = "memory"
+	BackendBolt   = "bbolt"
+	BackendSQLite = "sqlite"
+)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]OpenFunc{
+		BackendFile:   openFile,
+		BackendMemory: openMemory,
+		BackendBolt:   openBolt,
+		BackendSQLite: openSQLite,
+	}
+)
+
+// nameRegexp bucket和stream名称只允许简单字符，避免被当作路径
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Register 注册内置后端以外的存储后端
+func Register(name string, open OpenFunc) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = open
+}
+
+// Backends 已注册的存储后端名称
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open 打开指定后端的存储
+func Open(backend string, opts Options) (Store, error) {
+	backendsMu.RLock()
+	open, ok := backends[backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend '%s', available: %v", backend, Backends())
+	}
+	s, err := open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s storage: %w", backend, err)
+	}
+	return s, nil
+}
+
+// RunCompaction 按间隔压缩存储，直到ctx结束
+func RunCompaction(ctx context.Context, s Store, retention Retention, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Compact(retention); err != nil {
+				l.Logger.Warn("failed to compact storage", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// validName 检查bucket或stream名称
+func validName(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid name '%s'", name)
+	}
+	return nil
+}
+
+// validValue 检查值是否为JSON
+func validValue(value json.RawMessage) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("value is not valid JSON")
+	}
+	return nil
+}
+
+// retain 按保留策略筛选记录，records已按时间排序
+func retain(records []Record, retention Retention, now time.Time) []Record {
+	if retention.MaxAge > 0 {
+		cutoff := now.Add(-retention.MaxAge)
+		i := sort.Search(len(records), func(i int) bool { return records[i].Time.After(cutoff) })
+		records = records[i:]
+	}
+	if retention.MaxRecords > 0 && len(records) > retention.MaxRecords {
+		records = records[len(records)-retention.MaxRecords:]
+	}
+	return records
+}
+
+// since 筛选since之后的记录
+func since(records []Record, t time.Time) []Record {
+	i := sort.Search(len(records), func(i int) bool { return records[i].Time.After(t) })
+	return append([]Record(nil), records[i:]...)
+}
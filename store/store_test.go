@@ -0,0 +1,121 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	l "github.com/uppercaveman/k8s-gpu-device-plugin/modules/log"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	l.Logger = zap.NewNop()
+}
+
+// 所有内置后端的读写、删除、追加和压缩行为一致，持久化后端重新打开后数据仍在
+func TestBackends(t *testing.T) {
+	for _, backend := range Backends() {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(backend, Options{Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { s.Close() }()
+
+			if _, err := s.Get("ledger", "a"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("get from missing bucket: %v, want ErrNotFound", err)
+			}
+			if keys, err := s.Keys("ledger"); err != nil || len(keys) != 0 {
+				t.Fatalf("keys of missing bucket: %v %v", keys, err)
+			}
+			for _, k := range []string{"b", "a", "c"} {
+				if err := s.Put("ledger", k, json.RawMessage(`{"key":"`+k+`"}`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Put("ledger", "a", json.RawMessage(`{"key":"a2"}`)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put("ledger", "bad", json.RawMessage(`{`)); err == nil {
+				t.Fatal("invalid JSON accepted")
+			}
+			if err := s.Put("../ledger", "a", json.RawMessage(`{}`)); err == nil {
+				t.Fatal("invalid bucket name accepted")
+			}
+			if err := s.Delete("ledger", "c"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete("ledger", "missing"); err != nil {
+				t.Fatalf("delete missing key: %v", err)
+			}
+			start := time.Now()
+			for i := 0; i < 5; i++ {
+				if err := s.Append("audit", json.RawMessage(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			check := func(step string, records int) {
+				t.Helper()
+				if v, err := s.Get("ledger", "a"); err != nil || compact(v) != `{"key":"a2"}` {
+					t.Fatalf("%s: get a: %s %v", step, v, err)
+				}
+				if keys, err := s.Keys("ledger"); err != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) {
+					t.Fatalf("%s: keys %v %v, want [a b]", step, keys, err)
+				}
+				got, err := s.Records("audit", start.Add(-time.Second))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != records {
+					t.Fatalf("%s: %d records, want %d", step, len(got), records)
+				}
+				// 压缩只删除最早的记录，剩余记录保持追加顺序
+				for i, r := range got {
+					if want := fmt.Sprintf(`{"n":%d}`, 5-records+i); compact(r.Data) != want {
+						t.Fatalf("%s: record %d is %s, want %s", step, i, r.Data, want)
+					}
+				}
+			}
+			check("write", 5)
+			if got, err := s.Records("audit", time.Now().Add(time.Second)); err != nil || len(got) != 0 {
+				t.Fatalf("records after now: %v %v", got, err)
+			}
+			if err := s.Compact(Retention{MaxRecords: 3}); err != nil {
+				t.Fatal(err)
+			}
+			check("compact", 3)
+			if err := s.Compact(Retention{MaxAge: time.Hour}); err != nil {
+				t.Fatal(err)
+			}
+			check("compact by age", 3)
+
+			if backend == BackendMemory {
+				return
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if s, err = Open(backend, Options{Dir: dir}); err != nil {
+				t.Fatal(err)
+			}
+			check("reopen", 3)
+		})
+	}
+}
+
+// compact : 去掉JSON中的空白，file 后端保存时会格式化JSON
+func compact(v json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return string(v)
+	}
+	return buf.String()
+}